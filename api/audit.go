@@ -0,0 +1,245 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// AuditEntry is a single record in the audit log.
+type AuditEntry struct {
+	Time       time.Time              `json:"time"`
+	SessionID  string                 `json:"session_id,omitempty"`
+	Client     string                 `json:"client,omitempty"`
+	Tool       string                 `json:"tool"`
+	Connection string                 `json:"connection,omitempty"`
+	SQL        string                 `json:"sql,omitempty"`
+	Params     map[string]interface{} `json:"params,omitempty"`
+	Rows       *int64                 `json:"rows,omitempty"`
+	DurationMS float64                `json:"duration_ms"`
+	Error      string                 `json:"error,omitempty"`
+}
+
+// AuditLogger appends audit entries as JSON lines to one or more writers.
+type AuditLogger struct {
+	mu      sync.Mutex
+	writers []io.Writer
+}
+
+// NewAuditLogger returns an AuditLogger writing to every one of writers.
+func NewAuditLogger(writers ...io.Writer) *AuditLogger {
+	return &AuditLogger{writers: writers}
+}
+
+// Log writes e to every writer, redacting secrets from its SQL and
+// parameters first. It returns the first write error encountered.
+func (l *AuditLogger) Log(e AuditEntry) error {
+	if l == nil {
+		return nil
+	}
+	e.SQL = RedactSQL(e.SQL)
+	e.Error = Redact(e.Error)
+	e.Params = redactParams(e.Params)
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit entry: %w", err)
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var firstErr error
+	for _, w := range l.writers {
+		if _, err := w.Write(line); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to write audit entry: %w", err)
+		}
+	}
+	return firstErr
+}
+
+// Close closes every writer that implements io.Closer.
+func (l *AuditLogger) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var firstErr error
+	for _, w := range l.writers {
+		if c, ok := w.(io.Closer); ok {
+			if err := c.Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// RotatingFile is an append-only file that is rotated once it grows past a
+// size limit. Rotated files are renamed to file.1, file.2, and so on, keeping
+// at most maxBackups of them.
+type RotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxBytes   int64
+	maxBackups int
+	f          *os.File
+	size       int64
+}
+
+// NewRotatingFile opens path for appending. A maxBytes of 0 disables
+// rotation. At least one rotated file is kept, so rotating never discards
+// the entries just written.
+func NewRotatingFile(path string, maxBytes int64, maxBackups int) (*RotatingFile, error) {
+	r := &RotatingFile{path: path, maxBytes: maxBytes, maxBackups: max(maxBackups, 1)}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to stat audit log: %w", err)
+	}
+	r.f, r.size = f, info.Size()
+	return nil
+}
+
+// Write appends p, rotating the file first if p would push it past the limit.
+// If rotation fails, p is still appended to the current file and the rotation
+// error is returned.
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var rotateErr error
+	if r.f == nil || (r.maxBytes > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxBytes) {
+		rotateErr = r.rotate()
+		if r.f == nil {
+			return 0, rotateErr
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	if err == nil {
+		err = rotateErr
+	}
+	return n, err
+}
+
+// rotate shifts the backups and moves the current file to path.1. Whatever
+// happens, it reopens path afterwards so that writing can go on.
+func (r *RotatingFile) rotate() error {
+	var rotateErr error
+	if r.f != nil {
+		if err := r.f.Close(); err != nil {
+			rotateErr = fmt.Errorf("failed to close audit log: %w", err)
+		}
+		r.f = nil
+	}
+	if rotateErr == nil {
+		os.Remove(fmt.Sprintf("%s.%d", r.path, r.maxBackups))
+		for i := r.maxBackups - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+		}
+		if err := os.Rename(r.path, r.path+".1"); err != nil {
+			rotateErr = fmt.Errorf("failed to rotate audit log: %w", err)
+		}
+	}
+	if err := r.open(); err != nil {
+		return err
+	}
+	return rotateErr
+}
+
+// Close closes the underlying file.
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return nil
+	}
+	return r.f.Close()
+}
+
+// QueryStats carries the number of rows returned or affected by a tool call
+// from the handler back to the middleware that audits it.
+type QueryStats struct {
+	rows atomic.Int64
+	set  atomic.Bool
+}
+
+type queryStatsKey struct{}
+
+// WithQueryStats returns a context carrying a fresh QueryStats.
+func WithQueryStats(ctx context.Context) (context.Context, *QueryStats) {
+	stats := &QueryStats{}
+	return context.WithValue(ctx, queryStatsKey{}, stats), stats
+}
+
+// RecordRows adds n to the row count of the QueryStats in ctx, if any.
+func RecordRows(ctx context.Context, n int64) {
+	if stats, ok := ctx.Value(queryStatsKey{}).(*QueryStats); ok {
+		stats.rows.Add(n)
+		stats.set.Store(true)
+	}
+}
+
+// Rows returns the recorded row count, or nil if none was recorded.
+func (s *QueryStats) Rows() *int64 {
+	if s == nil || !s.set.Load() {
+		return nil
+	}
+	n := s.rows.Load()
+	return &n
+}
+
+var (
+	secretLiteral = regexp.MustCompile(`(?i)\b(password|identified\s+by|secret|access_key|secret_key|token)(\s*=?\s*)'(?:[^']|'')*'`)
+	dsnPassword   = regexp.MustCompile(`([a-zA-Z][a-zA-Z0-9+.\-]*://[^:/@\s]*:)[^@\s]*@`)
+	secretParam   = regexp.MustCompile(`(?i)(^|_)(pass|passwd|password|secret|token|api_?key|credentials?|dsn)($|_)`)
+)
+
+// RedactSQL masks string literals that follow password-like keywords, such as
+// IDENTIFIED BY '...' or PASSWORD '...', passwords embedded in URLs and
+// registered secrets.
+func RedactSQL(query string) string {
+	query = secretLiteral.ReplaceAllString(query, "$1$2'****'")
+	return Redact(query)
+}
+
+// RedactDSN masks the password in any URL-style connection string in s.
+func RedactDSN(s string) string {
+	return dsnPassword.ReplaceAllString(s, "${1}****@")
+}
+
+func redactParams(params map[string]interface{}) map[string]interface{} {
+	if len(params) == 0 {
+		return nil
+	}
+	out := make(map[string]interface{}, len(params))
+	for k, v := range params {
+		if secretParam.MatchString(k) {
+			out[k] = "****"
+			continue
+		}
+		if s, ok := v.(string); ok {
+			out[k] = RedactSQL(s)
+			continue
+		}
+		out[k] = v
+	}
+	return out
+}
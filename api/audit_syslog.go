@@ -0,0 +1,19 @@
+//go:build !windows && !plan9
+
+package api
+
+import (
+	"fmt"
+	"io"
+	"log/syslog"
+)
+
+// NewSyslogWriter returns a writer sending audit entries to the local syslog
+// daemon with the given tag.
+func NewSyslogWriter(tag string) (io.Writer, error) {
+	w, err := syslog.New(syslog.LOG_INFO|syslog.LOG_AUTH, tag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+	}
+	return w, nil
+}
@@ -0,0 +1,13 @@
+//go:build windows || plan9
+
+package api
+
+import (
+	"errors"
+	"io"
+)
+
+// NewSyslogWriter is not supported on this platform.
+func NewSyslogWriter(tag string) (io.Writer, error) {
+	return nil, errors.New("syslog is not supported on this platform")
+}
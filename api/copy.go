@@ -0,0 +1,244 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DefaultCopyBatchSize is the number of rows CopyData inserts per statement
+// when CopyOptions.BatchSize is not set.
+const DefaultCopyBatchSize = 500
+
+// CopyOptions controls CopyData.
+type CopyOptions struct {
+	// Table is the destination table, optionally schema-qualified.
+	Table string
+	// Create creates the destination table from the source columns when it
+	// does not exist.
+	Create bool
+	// BatchSize is the number of rows inserted per statement.
+	BatchSize int
+	// MaxRows stops the copy after that many rows. 0 or less copies every
+	// row.
+	MaxRows int
+	// Transform, if set, is applied to every batch before it is inserted,
+	// e.g. to mask values.
+	Transform func([]Row) []Row
+	// Progress, if set, is called with the number of rows copied so far after
+	// every batch.
+	Progress func(copied int64)
+}
+
+// CopyResult describes a finished copy.
+type CopyResult struct {
+	Table     string   `json:"table"`
+	Columns   []string `json:"columns"`
+	Rows      int64    `json:"rows"`
+	Created   bool     `json:"created"`
+	Truncated bool     `json:"truncated"`
+}
+
+// CopyData streams the results of query on src into a table on dst, which
+// may be a different kind of database. dstDriver selects the dialect of the
+// generated DDL and INSERT statements. Rows are inserted in batches inside a
+// single transaction, so a failed copy inserts nothing; a table created for
+// the copy is kept.
+func CopyData(ctx context.Context, src *sql.DB, query string, dst *sql.DB, dstDriver string, opts CopyOptions) (result CopyResult, err error) {
+	ctx, span := startStatementSpan(ctx, "copy", query)
+	defer func() { endStatementSpan(ctx, span, result.Rows, err) }()
+
+	if opts.Table == "" {
+		return result, errors.New("destination table must not be empty")
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultCopyBatchSize
+	}
+	d := DialectFor(dstDriver)
+	result.Table = opts.Table
+
+	rows, err := src.QueryContext(ctx, query)
+	if err != nil {
+		return result, fmt.Errorf("failed to execute source query: %w", err)
+	}
+	defer rows.Close()
+
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return result, fmt.Errorf("failed to get columns: %w", err)
+	}
+	if len(columnTypes) == 0 {
+		return result, errors.New("source query returns no columns")
+	}
+	columns := make([]string, len(columnTypes))
+	binary := make([]bool, len(columnTypes))
+	for i, ct := range columnTypes {
+		columns[i] = ct.Name()
+		binary[i] = columnKind(ct) == kindBinary
+	}
+	result.Columns = columns
+
+	exists, err := tableExists(ctx, dst, d, opts.Table)
+	if err != nil {
+		return result, err
+	}
+	if !exists {
+		if !opts.Create {
+			return result, fmt.Errorf("destination table %s does not exist", opts.Table)
+		}
+		if _, err := dst.ExecContext(ctx, CreateTableSQL(d, opts.Table, columnTypes)); err != nil {
+			return result, fmt.Errorf("failed to create destination table: %w", err)
+		}
+		result.Created = true
+	}
+
+	// Keep every statement within the dialect's bind parameter limit.
+	perStatement := max(1, min(opts.BatchSize, d.MaxParams()/len(columns)))
+	if !d.MultiRowInsert() {
+		perStatement = 1
+	}
+
+	tx, err := dst.BeginTx(ctx, nil)
+	if err != nil {
+		return result, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	insert := func(batch []Row) error {
+		if opts.Transform != nil {
+			batch = opts.Transform(batch)
+		}
+		for len(batch) > 0 {
+			n := min(perStatement, len(batch))
+			stmt, args := insertSQL(d, opts.Table, columns, batch[:n])
+			if _, err := tx.ExecContext(ctx, stmt, args...); err != nil {
+				return fmt.Errorf("failed to insert rows: %w", err)
+			}
+			batch = batch[n:]
+		}
+		return nil
+	}
+
+	var copied int64
+	batch := make([]Row, 0, opts.BatchSize)
+	for rows.Next() {
+		if opts.MaxRows > 0 && copied+int64(len(batch)) == int64(opts.MaxRows) {
+			result.Truncated = true
+			break
+		}
+		values := make([]interface{}, len(columns))
+		scanArgs := make([]interface{}, len(columns))
+		for i := range values {
+			scanArgs[i] = &values[i]
+		}
+		if err := rows.Scan(scanArgs...); err != nil {
+			return result, fmt.Errorf("failed to scan row: %w", err)
+		}
+		row := make(Row, len(columns))
+		for i, col := range columns {
+			// Drivers return text as []byte; only binary columns should be
+			// inserted as such.
+			if b, ok := values[i].([]byte); ok && !binary[i] {
+				values[i] = string(b)
+			}
+			row[col] = values[i]
+		}
+		batch = append(batch, row)
+
+		if len(batch) == opts.BatchSize {
+			if err := insert(batch); err != nil {
+				return result, err
+			}
+			copied += int64(len(batch))
+			batch = batch[:0]
+			if opts.Progress != nil {
+				opts.Progress(copied)
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return result, fmt.Errorf("row iteration error: %w", err)
+	}
+	rows.Close()
+
+	if len(batch) > 0 {
+		if err := insert(batch); err != nil {
+			return result, err
+		}
+		copied += int64(len(batch))
+		if opts.Progress != nil {
+			opts.Progress(copied)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return result, fmt.Errorf("failed to commit copy: %w", err)
+	}
+	result.Rows = copied
+	return result, nil
+}
+
+// CreateTableSQL returns a CREATE TABLE statement in dialect d for a table
+// with the given columns, mapping each column type to d.
+func CreateTableSQL(d Dialect, table string, columns []*sql.ColumnType) string {
+	defs := make([]string, len(columns))
+	for i, ct := range columns {
+		defs[i] = d.QuoteIdent(ct.Name()) + " " + d.ColumnType(ct)
+	}
+	return createTableStatement(d, table, defs)
+}
+
+// createTableStatement returns a CREATE TABLE statement for column
+// definitions that are already in dialect d.
+func createTableStatement(d Dialect, table string, defs []string) string {
+	stmt := fmt.Sprintf("CREATE TABLE %s (%s)", d.QuoteQualified(table), strings.Join(defs, ", "))
+	if d.system() == "clickhouse" {
+		stmt += " ENGINE = MergeTree ORDER BY tuple()"
+	}
+	return stmt
+}
+
+// tableExists reports whether table can be queried on db.
+func tableExists(ctx context.Context, db *sql.DB, d Dialect, table string) (bool, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("SELECT * FROM %s WHERE 1 = 0", d.QuoteQualified(table)))
+	if err != nil {
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+		return false, nil
+	}
+	return true, rows.Close()
+}
+
+// insertSQL returns a multi-row INSERT statement for rows and its arguments.
+func insertSQL(d Dialect, table string, columns []string, rows []Row) (string, []interface{}) {
+	quoted := make([]string, len(columns))
+	for i, col := range columns {
+		quoted[i] = d.QuoteIdent(col)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "INSERT INTO %s (%s) VALUES ", d.QuoteQualified(table), strings.Join(quoted, ", "))
+	args := make([]interface{}, 0, len(rows)*len(columns))
+	for i, row := range rows {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteByte('(')
+		for j, col := range columns {
+			if j > 0 {
+				b.WriteString(", ")
+			}
+			args = append(args, row[col])
+			b.WriteString(d.Placeholder(len(args)))
+		}
+		b.WriteByte(')')
+	}
+	return b.String(), args
+}
@@ -0,0 +1,124 @@
+package api_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thesoulless/usqlmcp/api"
+)
+
+func TestCopyData(t *testing.T) {
+	ctx := context.Background()
+	src := openTestDB(t)
+	dst := openTestDB(t)
+
+	_, err := src.Exec(`CREATE TABLE users (id INTEGER, name TEXT, score REAL, avatar BLOB);
+		INSERT INTO users VALUES (1, 'Alice', 1.5, x'0102'), (2, 'Bob', 2.5, NULL), (3, 'Carol', NULL, NULL);`)
+	require.NoError(t, err)
+
+	var progress []int64
+	result, err := api.CopyData(ctx, src, `SELECT * FROM users ORDER BY id`, dst, "sqlite3", api.CopyOptions{
+		Table:     "people",
+		Create:    true,
+		BatchSize: 2,
+		Progress:  func(n int64) { progress = append(progress, n) },
+	})
+	require.NoError(t, err)
+	assert.Equal(t, api.CopyResult{
+		Table:   "people",
+		Columns: []string{"id", "name", "score", "avatar"},
+		Rows:    3,
+		Created: true,
+	}, result)
+	assert.Equal(t, []int64{2, 3}, progress)
+
+	rows, err := api.ReadQuery(dst, `SELECT * FROM people ORDER BY id`)
+	require.NoError(t, err)
+	assert.Equal(t, []api.Row{
+		{"id": int64(1), "name": "Alice", "score": 1.5, "avatar": []byte{1, 2}},
+		{"id": int64(2), "name": "Bob", "score": 2.5, "avatar": nil},
+		{"id": int64(3), "name": "Carol", "score": nil, "avatar": nil},
+	}, rows)
+
+	// Copying again appends to the existing table, applying the transform
+	// and the row limit.
+	result, err = api.CopyData(ctx, src, `SELECT id, name FROM users ORDER BY id`, dst, "sqlite3", api.CopyOptions{
+		Table:   "people",
+		MaxRows: 2,
+		Transform: func(rows []api.Row) []api.Row {
+			for _, r := range rows {
+				r["name"] = strings.ToUpper(r["name"].(string))
+			}
+			return rows
+		},
+	})
+	require.NoError(t, err)
+	assert.False(t, result.Created)
+	assert.True(t, result.Truncated)
+	assert.Equal(t, int64(2), result.Rows)
+
+	rows, err = api.ReadQuery(dst, `SELECT name FROM people WHERE score IS NULL AND avatar IS NULL ORDER BY id`)
+	require.NoError(t, err)
+	assert.Equal(t, []api.Row{{"name": "ALICE"}, {"name": "BOB"}, {"name": "Carol"}}, rows)
+}
+
+func TestCopyDataErrors(t *testing.T) {
+	ctx := context.Background()
+	src := openTestDB(t)
+	dst := openTestDB(t)
+
+	_, err := src.Exec(`CREATE TABLE t (id INTEGER, name TEXT); INSERT INTO t VALUES (1, 'a'), (2, 'b');`)
+	require.NoError(t, err)
+	_, err = dst.Exec(`CREATE TABLE strict (id INTEGER NOT NULL, name TEXT NOT NULL CHECK (name <> 'b'))`)
+	require.NoError(t, err)
+
+	_, err = api.CopyData(ctx, src, `SELECT * FROM t`, dst, "sqlite3", api.CopyOptions{Table: "missing"})
+	assert.ErrorContains(t, err, "destination table missing does not exist")
+
+	// A failing row rolls back the whole copy.
+	_, err = api.CopyData(ctx, src, `SELECT * FROM t`, dst, "sqlite3", api.CopyOptions{Table: "strict", BatchSize: 1})
+	assert.ErrorContains(t, err, "failed to insert rows")
+	rows, err := api.ReadQuery(dst, `SELECT * FROM strict`)
+	require.NoError(t, err)
+	assert.Empty(t, rows)
+}
+
+func TestDialect(t *testing.T) {
+	for _, tt := range []struct {
+		driver, quoted, placeholder string
+	}{
+		{"postgres", `"public"."my ""table"""`, "$2"},
+		{"mysql", "`public`.`my \"table\"`", "?"},
+		{"sqlserver", `[public].[my "table"]`, "@p2"},
+		{"oracle", `"public"."my ""table"""`, ":2"},
+		{"sqlite3", `"public"."my ""table"""`, "?"},
+	} {
+		d := api.DialectFor(tt.driver)
+		assert.Equal(t, tt.quoted, d.QuoteQualified(`public.my "table"`), tt.driver)
+		assert.Equal(t, tt.placeholder, d.Placeholder(2), tt.driver)
+	}
+	assert.False(t, api.DialectFor("oracle").MultiRowInsert())
+}
+
+func TestCreateTableSQL(t *testing.T) {
+	db := openTestDB(t)
+	_, err := db.Exec(`CREATE TABLE t (n BIGINT, s VARCHAR(10), f DOUBLE, b BLOB, ts DATETIME)`)
+	require.NoError(t, err)
+	rows, err := db.Query(`SELECT * FROM t`)
+	require.NoError(t, err)
+	defer rows.Close()
+	columns, err := rows.ColumnTypes()
+	require.NoError(t, err)
+
+	for driver, want := range map[string]string{
+		"postgres":   `CREATE TABLE "t" ("n" BIGINT, "s" TEXT, "f" DOUBLE PRECISION, "b" BYTEA, "ts" TIMESTAMP)`,
+		"mysql":      "CREATE TABLE `t` (`n` BIGINT, `s` LONGTEXT, `f` DOUBLE, `b` LONGBLOB, `ts` DATETIME)",
+		"sqlserver":  `CREATE TABLE [t] ([n] BIGINT, [s] NVARCHAR(MAX), [f] FLOAT, [b] VARBINARY(MAX), [ts] DATETIME2)`,
+		"clickhouse": "CREATE TABLE `t` (`n` Int64, `s` String, `f` Float64, `b` String, `ts` DateTime64(6)) ENGINE = MergeTree ORDER BY tuple()",
+	} {
+		assert.Equal(t, want, api.CreateTableSQL(api.DialectFor(driver), "t", columns), driver)
+	}
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 
@@ -9,10 +10,34 @@ import (
 
 // CreateTable executes a CREATE TABLE SQL statement and returns a confirmation message.
 func CreateTable(db *sql.DB, query string) (string, error) {
-	_, err := db.Exec(query)
+	return CreateTableContext(context.Background(), db, query)
+}
+
+// CreateTableContext is like CreateTable but runs the statement under ctx.
+func CreateTableContext(ctx context.Context, db *sql.DB, query string) (message string, err error) {
+	if _, err := ParseCreateTable(query); err != nil {
+		return "", err
+	}
+	ctx, span := startStatementSpan(ctx, "exec", query)
+	defer func() { endStatementSpan(ctx, span, 0, err) }()
+
+	_, err = db.ExecContext(ctx, query)
 	if err != nil {
 		return "", fmt.Errorf("failed to execute create table query: %w", err)
 	}
 
 	return "Table created successfully", nil
 }
+
+// ParseCreateTable parses query, which must be a single CREATE TABLE
+// statement.
+func ParseCreateTable(query string) (Statement, error) {
+	stmt, err := parseSingle(query)
+	if err != nil {
+		return Statement{}, err
+	}
+	if stmt.Verb != "CREATE" || stmt.Object != "TABLE" {
+		return Statement{}, fmt.Errorf("only CREATE TABLE statements are allowed, not %s", describeStatement(stmt))
+	}
+	return stmt, nil
+}
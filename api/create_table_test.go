@@ -37,3 +37,23 @@ func TestCreateTable(t *testing.T) {
 	}
 	assert.Equal(t, "test_table", tableName, "table name does not match")
 }
+
+func TestParseCreateTable(t *testing.T) {
+	for _, query := range []string{
+		"CREATE TABLE t (n int)",
+		"create temporary table if not exists t (n int);",
+		"CREATE TABLE t AS SELECT 1 AS n",
+	} {
+		_, err := api.ParseCreateTable(query)
+		assert.NoError(t, err, query)
+	}
+	for _, query := range []string{
+		"DROP TABLE t",
+		"CREATE VIEW v AS SELECT 1",
+		"CREATE TABLE t (n int); DROP TABLE u",
+		"",
+	} {
+		_, err := api.ParseCreateTable(query)
+		assert.Error(t, err, query)
+	}
+}
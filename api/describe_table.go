@@ -57,6 +57,8 @@ type TableColumn struct {
 	Nullable     bool        `json:"nullable"`
 	Default      interface{} `json:"default"`
 	IsPrimaryKey bool        `json:"is_primary_key"`
+	// Comment is only filled in by ReadSchema.
+	Comment string `json:"comment,omitempty"`
 }
 
 // DescribeTableUniversal retrieves schema information for a specific table across different database types
@@ -0,0 +1,225 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Dialect describes how to write SQL for the database behind a driver.
+type Dialect struct {
+	// Driver is the usql driver name, e.g. "postgres" or "sqlite3".
+	Driver string
+}
+
+// DialectFor returns the dialect of driver.
+func DialectFor(driver string) Dialect {
+	return Dialect{Driver: strings.ToLower(driver)}
+}
+
+// system returns the normalized database system of the dialect.
+func (d Dialect) system() string {
+	return DBSystem(d.Driver)
+}
+
+// QuoteIdent quotes a single identifier.
+func (d Dialect) QuoteIdent(name string) string {
+	switch d.system() {
+	case "mysql", "clickhouse":
+		return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+	case "mssql":
+		return "[" + strings.ReplaceAll(name, "]", "]]") + "]"
+	default:
+		return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+	}
+}
+
+// QuoteQualified quotes a possibly schema-qualified name such as
+// public.users, part by part.
+func (d Dialect) QuoteQualified(name string) string {
+	parts := strings.Split(name, ".")
+	for i, p := range parts {
+		parts[i] = d.QuoteIdent(p)
+	}
+	return strings.Join(parts, ".")
+}
+
+// Placeholder returns the bind parameter for the n-th (1-based) argument.
+func (d Dialect) Placeholder(n int) string {
+	switch d.system() {
+	case "postgresql":
+		return fmt.Sprintf("$%d", n)
+	case "mssql":
+		return fmt.Sprintf("@p%d", n)
+	case "oracle":
+		return fmt.Sprintf(":%d", n)
+	default:
+		return "?"
+	}
+}
+
+// MultiRowInsert reports whether the dialect accepts several rows in one
+// INSERT ... VALUES statement.
+func (d Dialect) MultiRowInsert() bool {
+	return d.system() != "oracle"
+}
+
+// MaxParams is the number of bind parameters a single statement may carry.
+func (d Dialect) MaxParams() int {
+	switch d.system() {
+	case "sqlite":
+		return 999
+	case "mssql":
+		return 2000
+	default:
+		return 65535
+	}
+}
+
+// Type kinds that column types are mapped through.
+const (
+	kindBool      = "bool"
+	kindInteger   = "integer"
+	kindFloat     = "float"
+	kindDecimal   = "decimal"
+	kindText      = "text"
+	kindBinary    = "binary"
+	kindDate      = "date"
+	kindTime      = "time"
+	kindTimestamp = "timestamp"
+	kindJSON      = "json"
+	kindUUID      = "uuid"
+)
+
+// dialectTypes maps type kinds to column types per database system. Systems
+// and kinds that are missing fall back to defaultTypes.
+var dialectTypes = map[string]map[string]string{
+	"postgresql": {kindBool: "BOOLEAN", kindFloat: "DOUBLE PRECISION", kindBinary: "BYTEA", kindTimestamp: "TIMESTAMP", kindJSON: "JSONB", kindUUID: "UUID"},
+	"mysql":      {kindBool: "BOOLEAN", kindFloat: "DOUBLE", kindText: "LONGTEXT", kindBinary: "LONGBLOB", kindTimestamp: "DATETIME", kindJSON: "JSON", kindUUID: "CHAR(36)"},
+	"mssql":      {kindBool: "BIT", kindFloat: "FLOAT", kindText: "NVARCHAR(MAX)", kindBinary: "VARBINARY(MAX)", kindTimestamp: "DATETIME2", kindJSON: "NVARCHAR(MAX)", kindUUID: "UNIQUEIDENTIFIER"},
+	"oracle":     {kindBool: "NUMBER(1)", kindInteger: "NUMBER(19)", kindFloat: "BINARY_DOUBLE", kindText: "CLOB", kindBinary: "BLOB", kindTime: "VARCHAR2(32)", kindJSON: "CLOB", kindUUID: "VARCHAR2(36)"},
+	"sqlite":     {kindBool: "INTEGER", kindFloat: "REAL", kindDecimal: "NUMERIC", kindBinary: "BLOB", kindJSON: "TEXT", kindUUID: "TEXT"},
+	"clickhouse": {kindBool: "Bool", kindInteger: "Int64", kindFloat: "Float64", kindDecimal: "Decimal(38, 10)", kindText: "String", kindBinary: "String", kindDate: "Date", kindTime: "String", kindTimestamp: "DateTime64(6)", kindJSON: "String", kindUUID: "UUID"},
+	"duckdb":     {kindBool: "BOOLEAN", kindFloat: "DOUBLE", kindBinary: "BLOB", kindJSON: "JSON", kindUUID: "UUID"},
+	"snowflake":  {kindBool: "BOOLEAN", kindFloat: "FLOAT", kindBinary: "BINARY", kindTimestamp: "TIMESTAMP_NTZ", kindJSON: "VARIANT", kindUUID: "VARCHAR(36)"},
+}
+
+var defaultTypes = map[string]string{
+	kindBool:      "BOOLEAN",
+	kindInteger:   "BIGINT",
+	kindFloat:     "DOUBLE PRECISION",
+	kindDecimal:   "DECIMAL(38, 10)",
+	kindText:      "TEXT",
+	kindBinary:    "BLOB",
+	kindDate:      "DATE",
+	kindTime:      "TIME",
+	kindTimestamp: "TIMESTAMP",
+	kindJSON:      "TEXT",
+	kindUUID:      "VARCHAR(36)",
+}
+
+// typeFor returns the column type the dialect uses for kind.
+func (d Dialect) typeFor(kind string) string {
+	if t, ok := dialectTypes[d.system()][kind]; ok {
+		return t
+	}
+	return defaultTypes[kind]
+}
+
+// ColumnType maps a column type reported by any driver to the equivalent
+// column type of this dialect. Decimal precision is kept where the source
+// reports it; anything unrecognized becomes text.
+func (d Dialect) ColumnType(ct *sql.ColumnType) string {
+	kind := columnKind(ct)
+	if kind == kindDecimal {
+		if precision, scale, ok := ct.DecimalSize(); ok && precision > 0 && precision <= 38 && d.system() != "sqlite" {
+			if d.system() == "clickhouse" {
+				return fmt.Sprintf("Decimal(%d, %d)", precision, scale)
+			}
+			if d.system() == "oracle" {
+				return fmt.Sprintf("NUMBER(%d, %d)", precision, scale)
+			}
+			return fmt.Sprintf("DECIMAL(%d, %d)", precision, scale)
+		}
+	}
+	return d.typeFor(kind)
+}
+
+// columnKind classifies a result column, falling back on the Go type it
+// scans into when the driver reports no type name, as SQLite does for
+// expressions.
+func columnKind(ct *sql.ColumnType) string {
+	if ct.DatabaseTypeName() != "" {
+		return typeKind(ct.DatabaseTypeName())
+	}
+	t := ct.ScanType()
+	if t == nil {
+		return kindText
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return kindBool
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return kindInteger
+	case reflect.Float32, reflect.Float64:
+		return kindFloat
+	}
+	switch t {
+	case reflect.TypeOf(time.Time{}), reflect.TypeOf(sql.NullTime{}):
+		return kindTimestamp
+	case reflect.TypeOf(sql.NullInt64{}), reflect.TypeOf(sql.NullInt32{}), reflect.TypeOf(sql.NullInt16{}):
+		return kindInteger
+	case reflect.TypeOf(sql.NullFloat64{}):
+		return kindFloat
+	case reflect.TypeOf(sql.NullBool{}):
+		return kindBool
+	}
+	return kindText
+}
+
+var integerType = regexp.MustCompile(`^(U?INT(EGER|[0-9]+)?|(TINY|SMALL|MEDIUM|BIG)INT|(SMALL|BIG)?SERIAL)$`)
+
+// typeKind classifies a database type name into a type kind.
+func typeKind(name string) string {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	// ClickHouse wraps types, e.g. Nullable(Int32) or LowCardinality(String).
+	for _, wrapper := range []string{"NULLABLE(", "LOWCARDINALITY("} {
+		for strings.HasPrefix(name, wrapper) && strings.HasSuffix(name, ")") {
+			name = name[len(wrapper) : len(name)-1]
+		}
+	}
+	if i := strings.IndexByte(name, '('); i >= 0 {
+		name = strings.TrimSpace(name[:i])
+	}
+	name = strings.TrimSuffix(strings.TrimPrefix(name, "UNSIGNED "), " UNSIGNED")
+	switch {
+	case name == "":
+		return kindText
+	case name == "BOOL" || name == "BOOLEAN" || name == "BIT":
+		return kindBool
+	case integerType.MatchString(name):
+		return kindInteger
+	case name == "REAL" || strings.HasPrefix(name, "FLOAT") || strings.HasPrefix(name, "DOUBLE") || name == "BINARY_DOUBLE" || name == "BINARY_FLOAT":
+		return kindFloat
+	case name == "NUMERIC" || name == "DECIMAL" || name == "NUMBER" || name == "MONEY":
+		return kindDecimal
+	case strings.Contains(name, "BLOB") || name == "BYTEA" || strings.Contains(name, "BINARY") || name == "IMAGE" || name == "RAW":
+		return kindBinary
+	case name == "DATE":
+		return kindDate
+	case name == "TIME" || name == "TIMETZ":
+		return kindTime
+	case strings.HasPrefix(name, "TIMESTAMP") || strings.HasPrefix(name, "DATETIME") || name == "SMALLDATETIME":
+		return kindTimestamp
+	case name == "JSON" || name == "JSONB" || name == "VARIANT":
+		return kindJSON
+	case name == "UUID" || name == "UNIQUEIDENTIFIER":
+		return kindUUID
+	default:
+		return kindText
+	}
+}
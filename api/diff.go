@@ -0,0 +1,613 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultDiffChunkSize is the key range compared at once when
+	// DiffOptions.ChunkSize is not set.
+	DefaultDiffChunkSize = 10000
+	// DefaultDiffMaxReported is the number of rows of each kind of
+	// difference listed when DiffOptions.MaxReported is not set.
+	DefaultDiffMaxReported = 20
+	// maxDiffChunks caps the number of chunks; sparse keys get wider ones.
+	maxDiffChunks = 10000
+)
+
+// DiffSource is one side of a data diff: a table or a query on a database.
+type DiffSource struct {
+	DB     *sql.DB
+	Driver string
+	// Table or Query is the data to compare.
+	Table string
+	Query string
+	// Mask, if set, is applied to the values reported from this side.
+	Mask func(column string, val interface{}) interface{}
+}
+
+// DiffOptions controls DiffData.
+type DiffOptions struct {
+	// Keys are the columns identifying a row on both sides.
+	Keys []string
+	// Columns are the columns compared. By default every column both sides
+	// have, other than the keys, is compared.
+	Columns []string
+	// ChunkSize is the width of the key ranges compared at once when there
+	// is a single integer key. Other keys are compared in one chunk.
+	ChunkSize int
+	// MaxReported is the number of rows listed for each kind of difference;
+	// all of them are counted.
+	MaxReported int
+}
+
+// DiffResult describes the differences between two tables or queries.
+type DiffResult struct {
+	Keys    []string `json:"keys"`
+	Columns []string `json:"columns"`
+	// LeftOnlyColumns and RightOnlyColumns are columns that only one side
+	// has, which are not compared.
+	LeftOnlyColumns  []string `json:"left_only_columns,omitempty"`
+	RightOnlyColumns []string `json:"right_only_columns,omitempty"`
+	LeftRows         int64    `json:"left_rows"`
+	RightRows        int64    `json:"right_rows"`
+	OnlyLeft         int64    `json:"only_left"`
+	OnlyRight        int64    `json:"only_right"`
+	Changed          int64    `json:"changed"`
+	// Chunks is the number of key ranges compared, of which ChunksMatched
+	// were found equal by checksums computed in the databases.
+	Chunks        int                      `json:"chunks"`
+	ChunksMatched int                      `json:"chunks_matched"`
+	OnlyLeftKeys  []map[string]interface{} `json:"only_left_keys,omitempty"`
+	OnlyRightKeys []map[string]interface{} `json:"only_right_keys,omitempty"`
+	ChangedRows   []RowDiff                `json:"changed_rows,omitempty"`
+	// Truncated is set when more differences were found than listed.
+	Truncated bool `json:"truncated"`
+}
+
+// RowDiff is a row present on both sides with different values.
+type RowDiff struct {
+	Key     map[string]interface{} `json:"key"`
+	Columns map[string]ValueDiff   `json:"columns"`
+}
+
+// ValueDiff is the value of a column on each side.
+type ValueDiff struct {
+	Left  interface{} `json:"left"`
+	Right interface{} `json:"right"`
+}
+
+// diffSide is a DiffSource resolved against the compared columns.
+type diffSide struct {
+	DiffSource
+	d Dialect
+	// columns are the side's names for the keys followed by the compared
+	// columns, and kinds their type kinds.
+	columns []string
+	kinds   []string
+	keys    int
+}
+
+func (s *diffSide) from() string {
+	if s.Table != "" {
+		return s.d.QuoteQualified(s.Table)
+	}
+	return "(" + s.Query + ") src"
+}
+
+// selectList returns the quoted columns from i on.
+func (s *diffSide) selectList(i int) string {
+	quoted := make([]string, 0, len(s.columns)-i)
+	for _, c := range s.columns[i:] {
+		quoted = append(quoted, s.d.QuoteIdent(c))
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// diffChunk is a key range, or the whole of both sides when bounded is
+// false.
+type diffChunk struct {
+	bounded bool
+	lo, hi  int64
+}
+
+// where returns the condition selecting c on side s, and its arguments.
+func (c diffChunk) where(s *diffSide) (string, []interface{}) {
+	if !c.bounded {
+		return "", nil
+	}
+	key := s.d.QuoteIdent(s.columns[0])
+	return fmt.Sprintf(" WHERE %s >= %s AND %s < %s", key, s.d.Placeholder(1), key, s.d.Placeholder(2)), []interface{}{c.lo, c.hi}
+}
+
+// DiffData compares two tables or queries, possibly on different databases,
+// by key. Rows are compared a chunk of keys at a time: when both sides are
+// on the same kind of database, chunks whose checksums match are skipped
+// without reading their rows. Otherwise only the keys and a hash of each row
+// of the chunk's right side are held in memory while its left side is
+// streamed.
+func DiffData(ctx context.Context, left, right DiffSource, opts DiffOptions) (result DiffResult, err error) {
+	if len(opts.Keys) == 0 {
+		return result, errors.New("at least one key column is required")
+	}
+	for _, s := range []DiffSource{left, right} {
+		if (s.Table == "") == (s.Query == "") {
+			return result, errors.New("each side needs exactly one of a table and a query")
+		}
+	}
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = DefaultDiffChunkSize
+	}
+	if opts.MaxReported <= 0 {
+		opts.MaxReported = DefaultDiffMaxReported
+	}
+
+	l := &diffSide{DiffSource: left, d: DialectFor(left.Driver)}
+	r := &diffSide{DiffSource: right, d: DialectFor(right.Driver)}
+	ctx, span := startStatementSpan(ctx, "diff", "SELECT * FROM "+l.from()+";\nSELECT * FROM "+r.from())
+	defer func() { endStatementSpan(ctx, span, result.LeftRows+result.RightRows, err) }()
+
+	if err := resolveDiffColumns(ctx, l, r, opts, &result); err != nil {
+		return result, err
+	}
+
+	chunks, err := diffChunks(ctx, l, r, opts.ChunkSize)
+	if err != nil {
+		return result, err
+	}
+	result.Chunks = len(chunks)
+	checksums := l.d.system() == r.d.system() && l.d.checksum(l.columns) != ""
+	for _, c := range chunks {
+		if checksums {
+			n, ok, err := checksumsMatch(ctx, l, r, c)
+			if err != nil {
+				return result, err
+			}
+			if ok {
+				result.LeftRows += n
+				result.RightRows += n
+				result.ChunksMatched++
+				continue
+			}
+		}
+		if err := diffRows(ctx, l, r, c, opts, &result); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// sourceColumns returns the result columns of s and their kinds.
+func sourceColumns(ctx context.Context, s *diffSide) ([]string, []string, error) {
+	rows, err := s.DB.QueryContext(ctx, "SELECT * FROM "+s.from()+" WHERE 1 = 0")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read columns: %w", err)
+	}
+	defer rows.Close()
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read columns: %w", err)
+	}
+	names, kinds := make([]string, len(types)), make([]string, len(types))
+	for i, ct := range types {
+		names[i], kinds[i] = ct.Name(), columnKind(ct)
+	}
+	return names, kinds, nil
+}
+
+// resolveDiffColumns matches the keys and compared columns of both sides by
+// case-insensitive name.
+func resolveDiffColumns(ctx context.Context, l, r *diffSide, opts DiffOptions, result *DiffResult) error {
+	lNames, lKinds, err := sourceColumns(ctx, l)
+	if err != nil {
+		return fmt.Errorf("left: %w", err)
+	}
+	rNames, rKinds, err := sourceColumns(ctx, r)
+	if err != nil {
+		return fmt.Errorf("right: %w", err)
+	}
+	find := func(names []string, name string) int {
+		for i, n := range names {
+			if strings.EqualFold(n, name) {
+				return i
+			}
+		}
+		return -1
+	}
+
+	compared := opts.Columns
+	if len(compared) == 0 {
+		for _, n := range lNames {
+			if find(opts.Keys, n) >= 0 {
+				continue
+			}
+			if find(rNames, n) >= 0 {
+				compared = append(compared, n)
+			} else {
+				result.LeftOnlyColumns = append(result.LeftOnlyColumns, n)
+			}
+		}
+		for _, n := range rNames {
+			if find(opts.Keys, n) < 0 && find(lNames, n) < 0 {
+				result.RightOnlyColumns = append(result.RightOnlyColumns, n)
+			}
+		}
+	}
+
+	for _, name := range append(append([]string{}, opts.Keys...), compared...) {
+		li, ri := find(lNames, name), find(rNames, name)
+		if li < 0 {
+			return fmt.Errorf("left side has no column %q", name)
+		}
+		if ri < 0 {
+			return fmt.Errorf("right side has no column %q", name)
+		}
+		l.columns, l.kinds = append(l.columns, lNames[li]), append(l.kinds, lKinds[li])
+		r.columns, r.kinds = append(r.columns, rNames[ri]), append(r.kinds, rKinds[ri])
+	}
+	l.keys, r.keys = len(opts.Keys), len(opts.Keys)
+	result.Keys = l.columns[:len(opts.Keys)]
+	result.Columns = l.columns[len(opts.Keys):]
+	return nil
+}
+
+// diffChunks splits a single integer key into ranges covering both sides.
+// Other keys get a single unbounded chunk.
+func diffChunks(ctx context.Context, l, r *diffSide, size int) ([]diffChunk, error) {
+	whole := []diffChunk{{}}
+	if l.keys != 1 || l.kinds[0] != kindInteger || r.kinds[0] != kindInteger {
+		return whole, nil
+	}
+
+	var (
+		lo, hi int64
+		found  bool
+	)
+	for _, s := range []*diffSide{l, r} {
+		key := s.d.QuoteIdent(s.columns[0])
+		var min, max interface{}
+		err := s.DB.QueryRowContext(ctx, fmt.Sprintf("SELECT MIN(%s), MAX(%s) FROM %s", key, key, s.from())).Scan(&min, &max)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key range: %w", err)
+		}
+		mn, okMin := intValue(min)
+		mx, okMax := intValue(max)
+		if !okMin || !okMax {
+			continue
+		}
+		if !found || mn < lo {
+			lo = mn
+		}
+		if !found || mx > hi {
+			hi = mx
+		}
+		found = true
+	}
+	if !found {
+		return whole, nil
+	}
+
+	width := int64(size)
+	if span := float64(hi) - float64(lo) + 1; span/float64(width) > maxDiffChunks {
+		width = int64(math.Ceil(span / maxDiffChunks))
+	}
+	var chunks []diffChunk
+	for start := lo; ; start += width {
+		end := start + width
+		if end > hi || end < start {
+			// The last chunk ends past hi, guarding against overflow.
+			end = hi + 1
+			if hi == math.MaxInt64 {
+				return whole, nil
+			}
+		}
+		chunks = append(chunks, diffChunk{bounded: true, lo: start, hi: end})
+		if end > hi {
+			return chunks, nil
+		}
+	}
+}
+
+// checksum returns an aggregate expression checksumming columns, or "" when
+// the dialect has no suitable hash function.
+func (d Dialect) checksum(columns []string) string {
+	quoted := make([]string, len(columns))
+	for i, c := range columns {
+		quoted[i] = d.QuoteIdent(c)
+	}
+	list := strings.Join(quoted, ", ")
+	switch d.system() {
+	case "postgresql":
+		return "COALESCE(SUM(('x' || substr(md5(ROW(" + list + ")::text), 1, 15))::bit(60)::bigint), 0)"
+	case "mysql":
+		// ISNULL tells NULL from an empty string, which CONCAT_WS skips.
+		parts := make([]string, len(quoted))
+		for i, q := range quoted {
+			parts[i] = "ISNULL(" + q + "), " + q
+		}
+		return "COALESCE(SUM(CONV(SUBSTRING(MD5(CONCAT_WS('|', " + strings.Join(parts, ", ") + ")), 1, 15), 16, 10)), 0)"
+	case "duckdb":
+		return "COALESCE(SUM(hash(" + list + ")), 0)"
+	case "clickhouse":
+		return "sum(cityHash64(" + list + "))"
+	default:
+		// SQL Server's CHECKSUM_AGG and BINARY_CHECKSUM are XOR based and
+		// collide too easily to skip rows on.
+		return ""
+	}
+}
+
+// checksumsMatch compares the row count and checksum of chunk c on both
+// sides, returning the row count when they match.
+func checksumsMatch(ctx context.Context, l, r *diffSide, c diffChunk) (int64, bool, error) {
+	var counts [2]int64
+	var sums [2]string
+	for i, s := range []*diffSide{l, r} {
+		where, args := c.where(s)
+		var count, sum interface{}
+		query := "SELECT COUNT(*), " + s.d.checksum(s.columns) + " FROM " + s.from() + where
+		if err := s.DB.QueryRowContext(ctx, query, args...).Scan(&count, &sum); err != nil {
+			return 0, false, fmt.Errorf("failed to checksum rows: %w", err)
+		}
+		counts[i], _ = intValue(count)
+		sums[i] = fmt.Sprint(profileValue(sum))
+	}
+	return counts[0], counts[0] == counts[1] && sums[0] == sums[1], nil
+}
+
+// diffEntry is a right-side row held while the left side is streamed.
+type diffEntry struct {
+	key  []interface{}
+	hash [sha256.Size]byte
+}
+
+// diffRows compares the rows of chunk c, adding the differences to result.
+func diffRows(ctx context.Context, l, r *diffSide, c diffChunk, opts DiffOptions, result *DiffResult) error {
+	nkeys := len(opts.Keys)
+
+	right := map[string]*diffEntry{}
+	err := scanDiffRows(ctx, r, c, false, func(values []interface{}) error {
+		key, hash := diffHash(r.kinds, values, nkeys)
+		right[key] = &diffEntry{key: values[:nkeys:nkeys], hash: hash}
+		result.RightRows++
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("right: %w", err)
+	}
+
+	err = scanDiffRows(ctx, l, c, true, func(values []interface{}) error {
+		result.LeftRows++
+		key, hash := diffHash(l.kinds, values, nkeys)
+		entry, ok := right[key]
+		if !ok {
+			result.OnlyLeft++
+			if len(result.OnlyLeftKeys) < opts.MaxReported {
+				result.OnlyLeftKeys = append(result.OnlyLeftKeys, reportKey(l, values))
+			} else {
+				result.Truncated = true
+			}
+			return nil
+		}
+		delete(right, key)
+		if entry.hash == hash {
+			return nil
+		}
+		result.Changed++
+		if len(result.ChangedRows) >= opts.MaxReported {
+			result.Truncated = true
+			return nil
+		}
+		diff, err := diffRow(ctx, l, r, values, entry.key, nkeys)
+		if err != nil {
+			return err
+		}
+		result.ChangedRows = append(result.ChangedRows, diff)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("left: %w", err)
+	}
+
+	remaining := make([]string, 0, len(right))
+	for key := range right {
+		remaining = append(remaining, key)
+	}
+	sort.Strings(remaining)
+	for _, key := range remaining {
+		result.OnlyRight++
+		if len(result.OnlyRightKeys) < opts.MaxReported {
+			result.OnlyRightKeys = append(result.OnlyRightKeys, reportKey(r, right[key].key))
+		} else {
+			result.Truncated = true
+		}
+	}
+	return nil
+}
+
+// scanDiffRows calls fn with the keys and compared values of every row of
+// chunk c on side s, ordered by key if ordered is set.
+func scanDiffRows(ctx context.Context, s *diffSide, c diffChunk, ordered bool, fn func([]interface{}) error) error {
+	where, args := c.where(s)
+	query := "SELECT " + s.selectList(0) + " FROM " + s.from() + where
+	if ordered {
+		keys := make([]string, s.keys)
+		for i := range keys {
+			keys[i] = s.d.QuoteIdent(s.columns[i])
+		}
+		query += " ORDER BY " + strings.Join(keys, ", ")
+	}
+	rows, err := s.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to read rows: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		values := make([]interface{}, len(s.columns))
+		scanArgs := make([]interface{}, len(values))
+		for i := range values {
+			scanArgs[i] = &values[i]
+		}
+		if err := rows.Scan(scanArgs...); err != nil {
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		for i, v := range values {
+			if b, ok := v.([]byte); ok && s.kinds[i] != kindBinary {
+				values[i] = string(b)
+			}
+		}
+		if err := fn(values); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// diffRow reads the right-side row with key rightKey and returns its
+// differences from the left-side values.
+func diffRow(ctx context.Context, l, r *diffSide, values, rightKey []interface{}, nkeys int) (RowDiff, error) {
+	conds := make([]string, nkeys)
+	for i := range conds {
+		conds[i] = r.d.QuoteIdent(r.columns[i]) + " = " + r.d.Placeholder(i+1)
+	}
+	query := "SELECT " + r.selectList(nkeys) + " FROM " + r.from() + " WHERE " + strings.Join(conds, " AND ")
+	rightValues := make([]interface{}, len(r.columns)-nkeys)
+	scanArgs := make([]interface{}, len(rightValues))
+	for i := range rightValues {
+		scanArgs[i] = &rightValues[i]
+	}
+	if err := r.DB.QueryRowContext(ctx, query, rightKey...).Scan(scanArgs...); err != nil {
+		return RowDiff{}, fmt.Errorf("failed to read changed row: %w", err)
+	}
+
+	diff := RowDiff{Key: reportKey(l, values), Columns: map[string]ValueDiff{}}
+	for i, rv := range rightValues {
+		col := nkeys + i
+		if b, ok := rv.([]byte); ok && r.kinds[col] != kindBinary {
+			rv = string(b)
+		}
+		lv := values[col]
+		lc, lnull := canonicalValue(l.kinds[col], lv)
+		rc, rnull := canonicalValue(r.kinds[col], rv)
+		if lnull == rnull && lc == rc {
+			continue
+		}
+		diff.Columns[l.columns[col]] = ValueDiff{
+			Left:  maskDiffValue(l, l.columns[col], lv),
+			Right: maskDiffValue(r, r.columns[col], rv),
+		}
+	}
+	return diff, nil
+}
+
+func reportKey(s *diffSide, values []interface{}) map[string]interface{} {
+	key := make(map[string]interface{}, len(values))
+	for i, v := range values {
+		if i == s.keys {
+			break
+		}
+		key[s.columns[i]] = maskDiffValue(s, s.columns[i], v)
+	}
+	return key
+}
+
+func maskDiffValue(s *diffSide, column string, v interface{}) interface{} {
+	if s.Mask != nil {
+		return s.Mask(column, v)
+	}
+	return v
+}
+
+// diffHash returns the canonical key of a row and a hash of all its values.
+// Values are canonicalized first so that rows read from different kinds of
+// database compare equal when their values are.
+func diffHash(kinds []string, values []interface{}, nkeys int) (string, [sha256.Size]byte) {
+	h := sha256.New()
+	var key strings.Builder
+	var n [8]byte
+	for i, v := range values {
+		s, null := canonicalValue(kinds[i], v)
+		field := []byte{0}
+		if !null {
+			binary.BigEndian.PutUint64(n[:], uint64(len(s)))
+			field = append(append([]byte{1}, n[:]...), s...)
+		}
+		h.Write(field)
+		if i < nkeys {
+			key.Write(field)
+		}
+	}
+	var sum [sha256.Size]byte
+	h.Sum(sum[:0])
+	return key.String(), sum
+}
+
+// canonicalValue returns a representation of v that does not depend on the
+// driver it was read with, and whether v is NULL.
+func canonicalValue(kind string, v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case nil:
+		return "", true
+	case []byte:
+		return string(v), false
+	case bool:
+		if v {
+			return "1", false
+		}
+		return "0", false
+	case time.Time:
+		if kind == kindDate {
+			return v.Format("2006-01-02"), false
+		}
+		return v.UTC().Format(time.RFC3339Nano), false
+	case float64:
+		return canonicalFloat(v), false
+	case float32:
+		return canonicalFloat(float64(v)), false
+	case string:
+		switch {
+		case numeric(kind) || kind == kindBool:
+			if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+				return canonicalFloat(f), false
+			}
+			switch strings.ToLower(v) {
+			case "true", "t":
+				return "1", false
+			case "false", "f":
+				return "0", false
+			}
+		case kind == kindDate:
+			if t, ok := parseTime(v, append(dateLayouts, timestampLayouts...)); ok {
+				return t.Format("2006-01-02"), false
+			}
+		case kind == kindTimestamp:
+			if t, ok := parseTime(v, timestampLayouts); ok {
+				return t.UTC().Format(time.RFC3339Nano), false
+			}
+		}
+		return v, false
+	}
+	if n, err := toInt64(v); err == nil {
+		return strconv.FormatInt(n, 10), false
+	}
+	return fmt.Sprint(v), false
+}
+
+// canonicalFloat formats whole numbers as integers, so that 42 and 42.0 read
+// from different databases compare equal.
+func canonicalFloat(f float64) string {
+	if f == math.Trunc(f) && math.Abs(f) < 1e15 {
+		return strconv.FormatInt(int64(f), 10)
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
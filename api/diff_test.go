@@ -0,0 +1,79 @@
+package api_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thesoulless/usqlmcp/api"
+)
+
+func TestDiffData(t *testing.T) {
+	ctx := context.Background()
+	left := openTestDB(t)
+	right := openTestDB(t)
+
+	_, err := left.Exec(`CREATE TABLE users (id INTEGER, name TEXT, score INTEGER, nickname TEXT);
+INSERT INTO users VALUES (1, 'Alice', 10, 'al'), (2, 'Bob', 20, NULL), (3, 'Carol', NULL, NULL), (5, 'Eve', 50, NULL);`)
+	require.NoError(t, err)
+	_, err = right.Exec(`CREATE TABLE users (ID INTEGER, name TEXT, score REAL, created TEXT);
+INSERT INTO users VALUES (1, 'Alice', 10.0, NULL), (2, 'Robert', 20.0, NULL), (3, 'Carol', 30, NULL), (4, 'Dan', 40, NULL);`)
+	require.NoError(t, err)
+
+	result, err := api.DiffData(ctx,
+		api.DiffSource{DB: left, Driver: "sqlite3", Table: "users"},
+		api.DiffSource{DB: right, Driver: "sqlite3", Table: "users"},
+		api.DiffOptions{Keys: []string{"id"}, ChunkSize: 2},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"id"}, result.Keys)
+	assert.Equal(t, []string{"name", "score"}, result.Columns)
+	assert.Equal(t, []string{"nickname"}, result.LeftOnlyColumns)
+	assert.Equal(t, []string{"created"}, result.RightOnlyColumns)
+	assert.Equal(t, 3, result.Chunks)
+	assert.Equal(t, int64(4), result.LeftRows)
+	assert.Equal(t, int64(4), result.RightRows)
+	assert.Equal(t, int64(1), result.OnlyLeft)
+	assert.Equal(t, int64(1), result.OnlyRight)
+	assert.Equal(t, int64(2), result.Changed)
+	assert.Equal(t, []map[string]interface{}{{"id": int64(5)}}, result.OnlyLeftKeys)
+	assert.Equal(t, []map[string]interface{}{{"ID": int64(4)}}, result.OnlyRightKeys)
+	assert.Equal(t, []api.RowDiff{
+		{Key: map[string]interface{}{"id": int64(2)}, Columns: map[string]api.ValueDiff{"name": {Left: "Bob", Right: "Robert"}}},
+		{Key: map[string]interface{}{"id": int64(3)}, Columns: map[string]api.ValueDiff{"score": {Left: nil, Right: 30.0}}},
+	}, result.ChangedRows)
+	assert.False(t, result.Truncated)
+
+	// Queries work as sides too, and reported values are masked.
+	result, err = api.DiffData(ctx,
+		api.DiffSource{DB: left, Driver: "sqlite3", Query: "SELECT id, name FROM users"},
+		api.DiffSource{
+			DB: right, Driver: "sqlite3", Query: "SELECT id, name FROM users",
+			Mask: func(column string, val interface{}) interface{} { return api.Redacted },
+		},
+		api.DiffOptions{Keys: []string{"id"}, MaxReported: 1},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Chunks)
+	assert.Equal(t, int64(1), result.Changed)
+	assert.Equal(t, int64(1), result.OnlyLeft)
+	assert.Equal(t, int64(1), result.OnlyRight)
+	require.Len(t, result.ChangedRows, 1)
+	assert.Equal(t, api.ValueDiff{Left: "Bob", Right: api.Redacted}, result.ChangedRows[0].Columns["name"])
+	assert.Equal(t, []map[string]interface{}{{"id": api.Redacted}}, result.OnlyRightKeys)
+
+	_, err = api.DiffData(ctx,
+		api.DiffSource{DB: left, Driver: "sqlite3", Table: "users"},
+		api.DiffSource{DB: right, Driver: "sqlite3", Table: "users"},
+		api.DiffOptions{Keys: []string{"nickname"}},
+	)
+	assert.ErrorContains(t, err, `right side has no column "nickname"`)
+
+	_, err = api.DiffData(ctx,
+		api.DiffSource{DB: left, Driver: "sqlite3", Table: "users"},
+		api.DiffSource{DB: right, Driver: "sqlite3", Table: "users"},
+		api.DiffOptions{},
+	)
+	assert.ErrorContains(t, err, "at least one key column is required")
+}
@@ -0,0 +1,226 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"time"
+)
+
+// DefaultPreviewRows is the number of rows ExportQuery returns as a preview
+// when ExportOptions.PreviewRows is not set.
+const DefaultPreviewRows = 5
+
+// exportProgressRows is how often, in rows, ExportQuery reports progress.
+const exportProgressRows = 10000
+
+// ExportOptions controls ExportQuery.
+type ExportOptions struct {
+	// Format is one of FormatCSV, FormatJSONL, FormatParquet or FormatXLSX.
+	// When empty it is taken from the file extension.
+	Format string
+	// MaxRows stops the export after that many rows. 0 or less exports every
+	// row, up to the format's own limit.
+	MaxRows int
+	// PreviewRows is the number of rows returned in ExportResult.Preview. 0
+	// uses DefaultPreviewRows and a negative value returns none.
+	PreviewRows int
+	// Overwrite replaces an existing file.
+	Overwrite bool
+	// Mask, if set, is applied to every value before it is written.
+	Mask func(column string, val interface{}) interface{}
+	// Progress, if set, is called with the number of rows written so far.
+	Progress func(rows int64)
+}
+
+// ExportResult describes a written export file.
+type ExportResult struct {
+	Path      string   `json:"path"`
+	Format    string   `json:"format"`
+	Columns   []string `json:"columns"`
+	Rows      int64    `json:"rows"`
+	Bytes     int64    `json:"bytes"`
+	Truncated bool     `json:"truncated"`
+	Preview   []Row    `json:"preview"`
+}
+
+// exportWriter writes rows to an export file.
+type exportWriter interface {
+	writeRow(values []interface{}) error
+	// close completes the file; it does not close the underlying writer.
+	close() error
+}
+
+// ExportQuery runs query on db and streams its rows to a file at path,
+// without holding more than a preview of them in memory. The file is
+// written under a temporary name and renamed into place once complete.
+func ExportQuery(ctx context.Context, db *sql.DB, query, path string, opts ExportOptions) (result ExportResult, err error) {
+	ctx, span := startStatementSpan(ctx, "export", query)
+	defer func() { endStatementSpan(ctx, span, result.Rows, err) }()
+
+	format, err := ExportFormat(path, opts.Format)
+	if err != nil {
+		return result, err
+	}
+	if opts.PreviewRows == 0 {
+		opts.PreviewRows = DefaultPreviewRows
+	}
+	maxRows := int64(opts.MaxRows)
+	if format == FormatXLSX && (maxRows <= 0 || maxRows > xlsxMaxRows) {
+		maxRows = xlsxMaxRows
+	}
+	result.Path, result.Format, result.Preview = path, format, []Row{}
+
+	if !opts.Overwrite {
+		if _, err := os.Lstat(path); err == nil {
+			return result, fmt.Errorf("file %s already exists", filepath.Base(path))
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return result, err
+		}
+	}
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return result, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return result, fmt.Errorf("failed to get columns: %w", err)
+	}
+	columns := make([]string, len(columnTypes))
+	kinds := make([]string, len(columnTypes))
+	for i, ct := range columnTypes {
+		columns[i] = ct.Name()
+		kinds[i] = columnKind(ct)
+	}
+	if opts.Mask != nil {
+		maskKinds(columns, kinds, opts.Mask)
+	}
+	result.Columns = columns
+
+	f, err := os.CreateTemp(filepath.Dir(path), ".export-*")
+	if err != nil {
+		return result, fmt.Errorf("failed to create export file: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	buf := bufio.NewWriterSize(f, 1<<16)
+
+	var w exportWriter
+	switch format {
+	case FormatCSV:
+		w, err = newCSVWriter(buf, columns, kinds)
+	case FormatJSONL:
+		w, err = newJSONLWriter(buf, columns, kinds)
+	case FormatParquet:
+		w, err = newParquetWriter(buf, columns, kinds)
+	case FormatXLSX:
+		w, err = newXLSXWriter(buf, columns, kinds)
+	}
+	if err != nil {
+		return result, fmt.Errorf("failed to start %s file: %w", format, err)
+	}
+
+	values := make([]interface{}, len(columns))
+	scanArgs := make([]interface{}, len(columns))
+	for i := range values {
+		scanArgs[i] = &values[i]
+	}
+	for rows.Next() {
+		if maxRows > 0 && result.Rows == maxRows {
+			result.Truncated = true
+			break
+		}
+		if err := rows.Scan(scanArgs...); err != nil {
+			return result, fmt.Errorf("failed to scan row: %w", err)
+		}
+		for i, v := range values {
+			// Drivers return text as []byte; only binary columns are kept
+			// as bytes.
+			if b, ok := v.([]byte); ok && kinds[i] != kindBinary {
+				v = string(b)
+			}
+			if opts.Mask != nil {
+				v = opts.Mask(columns[i], v)
+			}
+			values[i] = v
+		}
+		if len(result.Preview) < opts.PreviewRows {
+			row := make(Row, len(columns))
+			for i, col := range columns {
+				row[col] = values[i]
+			}
+			result.Preview = append(result.Preview, row)
+		}
+		if err := w.writeRow(values); err != nil {
+			return result, fmt.Errorf("failed to write row: %w", err)
+		}
+		result.Rows++
+		if opts.Progress != nil && result.Rows%exportProgressRows == 0 {
+			opts.Progress(result.Rows)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return result, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	if err := w.close(); err != nil {
+		return result, fmt.Errorf("failed to finish %s file: %w", format, err)
+	}
+	if err := buf.Flush(); err != nil {
+		return result, fmt.Errorf("failed to write export file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return result, fmt.Errorf("failed to write export file: %w", err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return result, fmt.Errorf("failed to move export file into place: %w", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return result, err
+	}
+	result.Bytes = info.Size()
+	if opts.Progress != nil && result.Rows%exportProgressRows != 0 {
+		opts.Progress(result.Rows)
+	}
+	return result, nil
+}
+
+// kindProbes holds a sample value of each kind whose values a column rule
+// could turn into text.
+var kindProbes = map[string]interface{}{
+	kindBool:      true,
+	kindInteger:   int64(0),
+	kindFloat:     float64(0),
+	kindBinary:    []byte{0xff},
+	kindDate:      time.Time{},
+	kindTimestamp: time.Time{},
+}
+
+// maskKinds changes the kind of columns whose values mask replaces with text
+// to kindText, so that typed formats such as Parquet write the masked text.
+// Only column rules change non-text values, and they do so regardless of the
+// value, so a sample value tells whether a column is masked.
+func maskKinds(columns, kinds []string, mask func(string, interface{}) interface{}) {
+	for i, kind := range kinds {
+		probe, ok := kindProbes[kind]
+		if !ok {
+			continue
+		}
+		if reflect.TypeOf(mask(columns[i], probe)) != reflect.TypeOf(probe) {
+			kinds[i] = kindText
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet"
+	"github.com/apache/arrow-go/v18/parquet/compress"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+)
+
+// parquetRowGroupRows is the number of rows buffered per Parquet row group.
+const parquetRowGroupRows = 64 * 1024
+
+// parquetWriter writes rows to Parquet through Arrow record batches. Columns
+// are typed by kind; decimals, times and anything else not natively mapped
+// are written as strings to keep their exact text.
+type parquetWriter struct {
+	fw    *pqarrow.FileWriter
+	b     *array.RecordBuilder
+	kinds []string
+	n     int
+}
+
+// arrowType returns the Arrow type a column of kind is written as.
+func arrowType(kind string) arrow.DataType {
+	switch kind {
+	case kindBool:
+		return arrow.FixedWidthTypes.Boolean
+	case kindInteger:
+		return arrow.PrimitiveTypes.Int64
+	case kindFloat:
+		return arrow.PrimitiveTypes.Float64
+	case kindBinary:
+		return arrow.BinaryTypes.Binary
+	case kindDate:
+		return arrow.FixedWidthTypes.Date32
+	case kindTimestamp:
+		return arrow.FixedWidthTypes.Timestamp_us
+	default:
+		return arrow.BinaryTypes.String
+	}
+}
+
+func newParquetWriter(w io.Writer, columns, kinds []string) (*parquetWriter, error) {
+	fields := make([]arrow.Field, len(columns))
+	for i, col := range columns {
+		fields[i] = arrow.Field{Name: col, Type: arrowType(kinds[i]), Nullable: true}
+	}
+	schema := arrow.NewSchema(fields, nil)
+	props := parquet.NewWriterProperties(parquet.WithCompression(compress.Codecs.Snappy))
+	fw, err := pqarrow.NewFileWriter(schema, w, props, pqarrow.DefaultWriterProps())
+	if err != nil {
+		return nil, err
+	}
+	return &parquetWriter{fw: fw, b: array.NewRecordBuilder(memory.DefaultAllocator, schema), kinds: kinds}, nil
+}
+
+func (w *parquetWriter) writeRow(values []interface{}) error {
+	for i, v := range values {
+		if err := w.append(i, v); err != nil {
+			return fmt.Errorf("column %d: %w", i+1, err)
+		}
+	}
+	w.n++
+	if w.n == parquetRowGroupRows {
+		return w.flush()
+	}
+	return nil
+}
+
+func (w *parquetWriter) append(i int, v interface{}) error {
+	fb := w.b.Field(i)
+	if v == nil {
+		fb.AppendNull()
+		return nil
+	}
+	kind := w.kinds[i]
+	if _, ok := arrowType(kind).(*arrow.StringType); ok {
+		fb.(*array.StringBuilder).Append(formatText(v))
+		return nil
+	}
+	// Values whose driver type does not match the column type are
+	// converted the same way imported values are.
+	v, err := convertValue(kind, v)
+	if err != nil {
+		return err
+	}
+	switch b := fb.(type) {
+	case *array.BooleanBuilder:
+		if t, ok := v.(bool); ok {
+			b.Append(t)
+			break
+		}
+		n, err := toInt64(v)
+		if err != nil {
+			return err
+		}
+		b.Append(n != 0)
+	case *array.Int64Builder:
+		n, err := toInt64(v)
+		if err != nil {
+			return err
+		}
+		b.Append(n)
+	case *array.Float64Builder:
+		f, err := toFloat64(v)
+		if err != nil {
+			return err
+		}
+		b.Append(f)
+	case *array.BinaryBuilder:
+		b.Append(v.([]byte))
+	case *array.Date32Builder:
+		b.Append(arrow.Date32FromTime(v.(time.Time)))
+	case *array.TimestampBuilder:
+		b.Append(arrow.Timestamp(v.(time.Time).UnixMicro()))
+	default:
+		return fmt.Errorf("unsupported builder %T", fb)
+	}
+	return nil
+}
+
+func toInt64(v interface{}) (int64, error) {
+	switch v := v.(type) {
+	case int64:
+		return v, nil
+	case int32:
+		return int64(v), nil
+	case int16:
+		return int64(v), nil
+	case int8:
+		return int64(v), nil
+	case int:
+		return int64(v), nil
+	case uint32:
+		return int64(v), nil
+	case uint16:
+		return int64(v), nil
+	case uint8:
+		return int64(v), nil
+	case uint64:
+		if v > 1<<63-1 {
+			return 0, fmt.Errorf("integer %d out of range", v)
+		}
+		return int64(v), nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	case float64:
+		if v != math.Trunc(v) || math.Abs(v) > 1<<63 {
+			return 0, fmt.Errorf("%v is not an integer", v)
+		}
+		return int64(v), nil
+	default:
+		return 0, fmt.Errorf("unexpected integer value %T", v)
+	}
+}
+
+func toFloat64(v interface{}) (float64, error) {
+	switch v := v.(type) {
+	case float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	default:
+		n, err := toInt64(v)
+		return float64(n), err
+	}
+}
+
+// flush writes the buffered rows as a row group.
+func (w *parquetWriter) flush() error {
+	if w.n == 0 {
+		return nil
+	}
+	rec := w.b.NewRecord()
+	defer rec.Release()
+	w.n = 0
+	return w.fw.Write(rec)
+}
+
+func (w *parquetWriter) close() error {
+	defer w.b.Release()
+	if err := w.flush(); err != nil {
+		return err
+	}
+	return w.fw.Close()
+}
@@ -0,0 +1,115 @@
+package api_test
+
+import (
+	"archive/zip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thesoulless/usqlmcp/api"
+)
+
+func TestExportQuery(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	dir := t.TempDir()
+
+	_, err := db.Exec(`CREATE TABLE users (id INTEGER, name TEXT, email TEXT, score REAL);
+INSERT INTO users VALUES (1, 'Alice', 'alice@example.com', 1.5), (2, 'Bob, Jr.', 'bob@example.com', NULL), (3, 'Carol', NULL, 3)`)
+	require.NoError(t, err)
+
+	masker, err := api.NewMasker(api.MaskConfig{Rules: []api.MaskRule{{Columns: []string{"users.email"}, Strategy: api.MaskRedact}}})
+	require.NoError(t, err)
+	query := `SELECT id, name, email, score FROM users ORDER BY id`
+
+	var progress []int64
+	path := filepath.Join(dir, "users.csv")
+	result, err := api.ExportQuery(ctx, db, query, path, api.ExportOptions{
+		PreviewRows: 2,
+		Mask:        masker.QueryMasker(query),
+		Progress:    func(n int64) { progress = append(progress, n) },
+	})
+	require.NoError(t, err)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "id,name,email,score\n"+
+		"1,Alice,[REDACTED],1.5\n"+
+		"2,\"Bob, Jr.\",[REDACTED],\n"+
+		"3,Carol,,3\n", string(data))
+	assert.Equal(t, api.ExportResult{
+		Path:    path,
+		Format:  "csv",
+		Columns: []string{"id", "name", "email", "score"},
+		Rows:    3,
+		Bytes:   int64(len(data)),
+		Preview: []api.Row{
+			{"id": int64(1), "name": "Alice", "email": "[REDACTED]", "score": 1.5},
+			{"id": int64(2), "name": "Bob, Jr.", "email": "[REDACTED]", "score": nil},
+		},
+	}, result)
+	assert.Equal(t, []int64{3}, progress)
+
+	_, err = api.ExportQuery(ctx, db, query, path, api.ExportOptions{})
+	assert.ErrorContains(t, err, "file users.csv already exists")
+
+	// Overwriting replaces the file; MaxRows truncates it.
+	result, err = api.ExportQuery(ctx, db, query, path, api.ExportOptions{Format: "jsonl", MaxRows: 2, PreviewRows: -1, Overwrite: true})
+	require.NoError(t, err)
+	assert.True(t, result.Truncated)
+	assert.Equal(t, int64(2), result.Rows)
+	assert.Empty(t, result.Preview)
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, `{"id":1,"name":"Alice","email":"alice@example.com","score":1.5}
+{"id":2,"name":"Bob, Jr.","email":"bob@example.com","score":null}
+`, string(data))
+
+	// A failed export leaves no file behind.
+	_, err = api.ExportQuery(ctx, db, `SELECT * FROM missing`, filepath.Join(dir, "missing.csv"), api.ExportOptions{})
+	assert.Error(t, err)
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "users.csv", entries[0].Name())
+
+	_, err = api.ExportQuery(ctx, db, query, filepath.Join(dir, "users.txt"), api.ExportOptions{})
+	assert.ErrorContains(t, err, `unsupported file format "txt"`)
+}
+
+func TestExportXLSX(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	path := filepath.Join(t.TempDir(), "out.xlsx")
+
+	result, err := api.ExportQuery(ctx, db, `SELECT 1 AS n, 'a<b' AS s, NULL AS z`, path, api.ExportOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "xlsx", result.Format)
+	assert.Equal(t, int64(1), result.Rows)
+
+	zr, err := zip.OpenReader(path)
+	require.NoError(t, err)
+	defer zr.Close()
+	var names []string
+	var sheet string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+		if f.Name == "xl/worksheets/sheet1.xml" {
+			r, err := f.Open()
+			require.NoError(t, err)
+			b, err := io.ReadAll(r)
+			require.NoError(t, err)
+			sheet = string(b)
+		}
+	}
+	assert.Contains(t, names, "[Content_Types].xml")
+	assert.Contains(t, names, "xl/workbook.xml")
+	assert.True(t, strings.HasSuffix(sheet, `<sheetData>`+
+		`<row><c t="inlineStr"><is><t xml:space="preserve">n</t></is></c><c t="inlineStr"><is><t xml:space="preserve">s</t></is></c><c t="inlineStr"><is><t xml:space="preserve">z</t></is></c></row>`+
+		`<row><c><v>1</v></c><c t="inlineStr"><is><t xml:space="preserve">a&lt;b</t></is></c><c/></row>`+
+		`</sheetData></worksheet>`), sheet)
+}
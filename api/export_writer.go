@@ -0,0 +1,191 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// formatText formats a value for text-only formats. Binary values are
+// base64-encoded.
+func formatText(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return base64.StdEncoding.EncodeToString(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// csvWriter writes a header row and one record per row. NULL is written as
+// an empty field.
+type csvWriter struct {
+	w      *csv.Writer
+	record []string
+}
+
+func newCSVWriter(w io.Writer, columns, kinds []string) (*csvWriter, error) {
+	cw := &csvWriter{w: csv.NewWriter(w), record: make([]string, len(columns))}
+	if err := cw.w.Write(columns); err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+func (w *csvWriter) writeRow(values []interface{}) error {
+	for i, v := range values {
+		w.record[i] = formatText(v)
+	}
+	return w.w.Write(w.record)
+}
+
+func (w *csvWriter) close() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+// jsonlWriter writes one JSON object per row, with keys in column order.
+type jsonlWriter struct {
+	w    io.Writer
+	keys [][]byte
+	buf  bytes.Buffer
+}
+
+func newJSONLWriter(w io.Writer, columns, kinds []string) (*jsonlWriter, error) {
+	jw := &jsonlWriter{w: w, keys: make([][]byte, len(columns))}
+	for i, col := range columns {
+		key, err := json.Marshal(col)
+		if err != nil {
+			return nil, err
+		}
+		jw.keys[i] = append(key, ':')
+	}
+	return jw, nil
+}
+
+func (w *jsonlWriter) writeRow(values []interface{}) error {
+	w.buf.Reset()
+	w.buf.WriteByte('{')
+	for i, v := range values {
+		if i > 0 {
+			w.buf.WriteByte(',')
+		}
+		w.buf.Write(w.keys[i])
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		w.buf.Write(b)
+	}
+	w.buf.WriteString("}\n")
+	_, err := w.w.Write(w.buf.Bytes())
+	return err
+}
+
+func (w *jsonlWriter) close() error { return nil }
+
+// xlsxMaxRows is the number of data rows that fit on a worksheet below the
+// header row.
+const xlsxMaxRows = 1<<20 - 1
+
+// XLSX package parts other than the worksheet, which is streamed.
+var xlsxParts = []struct{ name, content string }{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+	{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Sheet1" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`},
+}
+
+// xlsxWriter writes a single-sheet workbook. Numbers and booleans become
+// typed cells; everything else, including dates, is written as text.
+type xlsxWriter struct {
+	zw    *zip.Writer
+	sheet io.Writer
+	buf   bytes.Buffer
+}
+
+func newXLSXWriter(w io.Writer, columns, kinds []string) (*xlsxWriter, error) {
+	zw := zip.NewWriter(w)
+	for _, part := range xlsxParts {
+		pw, err := zw.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(pw, part.content); err != nil {
+			return nil, err
+		}
+	}
+	sheet, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	xw := &xlsxWriter{zw: zw, sheet: sheet}
+	if _, err := io.WriteString(sheet, `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`); err != nil {
+		return nil, err
+	}
+	header := make([]interface{}, len(columns))
+	for i, col := range columns {
+		header[i] = col
+	}
+	if err := xw.writeRow(header); err != nil {
+		return nil, err
+	}
+	return xw, nil
+}
+
+func (w *xlsxWriter) writeRow(values []interface{}) error {
+	w.buf.Reset()
+	w.buf.WriteString("<row>")
+	for _, v := range values {
+		switch v := v.(type) {
+		case nil:
+			w.buf.WriteString("<c/>")
+		case bool:
+			if v {
+				w.buf.WriteString(`<c t="b"><v>1</v></c>`)
+			} else {
+				w.buf.WriteString(`<c t="b"><v>0</v></c>`)
+			}
+		case int64, int32, int16, int8, int, uint64, uint32, uint16, uint8, uint, float64, float32:
+			fmt.Fprintf(&w.buf, "<c><v>%s</v></c>", formatText(v))
+		default:
+			w.buf.WriteString(`<c t="inlineStr"><is><t xml:space="preserve">`)
+			if err := xml.EscapeText(&w.buf, []byte(formatText(v))); err != nil {
+				return err
+			}
+			w.buf.WriteString("</t></is></c>")
+		}
+	}
+	w.buf.WriteString("</row>")
+	_, err := w.sheet.Write(w.buf.Bytes())
+	return err
+}
+
+func (w *xlsxWriter) close() error {
+	if _, err := io.WriteString(w.sheet, "</sheetData></worksheet>"); err != nil {
+		return err
+	}
+	return w.zw.Close()
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ResolvePath resolves name, relative to dir unless absolute, and returns it
+// only if it lies inside dir once symlinks are followed. The file itself does
+// not have to exist, but its parent directory does.
+func ResolvePath(dir, name string) (string, error) {
+	if dir == "" {
+		return "", errors.New("no directory is configured for file access")
+	}
+	if name == "" {
+		return "", errors.New("path must not be empty")
+	}
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		return "", fmt.Errorf("failed to resolve directory: %w", err)
+	}
+
+	p := name
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(dir, p)
+	}
+	p, err = filepath.Abs(p)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(p)
+	if errors.Is(err, os.ErrNotExist) {
+		var parent string
+		parent, err = filepath.EvalSymlinks(filepath.Dir(p))
+		resolved = filepath.Join(parent, filepath.Base(p))
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve path: %w", err)
+	}
+
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %q is outside the allowed directory", name)
+	}
+	return resolved, nil
+}
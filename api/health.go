@@ -0,0 +1,39 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrUnavailable is returned for calls on a connection that is not currently
+// connected to its database.
+var ErrUnavailable = errors.New("database unavailable")
+
+// ServerVersion returns the version reported by the database server behind
+// db. The driver name selects the query used to ask for it.
+func ServerVersion(ctx context.Context, db *sql.DB, driver string) (string, error) {
+	var query string
+	switch strings.ToLower(driver) {
+	case "sqlite", "sqlite3", "moderncsqlite":
+		query = "SELECT sqlite_version()"
+	case "postgres", "pgx", "mysql", "mymysql", "clickhouse", "duckdb":
+		query = "SELECT version()"
+	case "sqlserver", "mssql":
+		query = "SELECT @@VERSION"
+	case "oracle", "godror":
+		query = "SELECT banner FROM v$version WHERE ROWNUM = 1"
+	case "snowflake":
+		query = "SELECT CURRENT_VERSION()"
+	default:
+		return "", fmt.Errorf("unsupported database driver for server version: %s", driver)
+	}
+
+	var version string
+	if err := db.QueryRowContext(ctx, query).Scan(&version); err != nil {
+		return "", fmt.Errorf("failed to query server version: %w", err)
+	}
+	return version, nil
+}
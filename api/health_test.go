@@ -0,0 +1,20 @@
+package api_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thesoulless/usqlmcp/api"
+)
+
+func TestServerVersion(t *testing.T) {
+	db := openTestDB(t)
+	version, err := api.ServerVersion(context.Background(), db, "sqlite3")
+	require.NoError(t, err)
+	assert.Regexp(t, `^3\.\d+\.\d+`, version)
+
+	_, err = api.ServerVersion(context.Background(), db, "cassandra")
+	assert.ErrorContains(t, err, "unsupported database driver")
+}
@@ -0,0 +1,670 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// File formats supported by ImportFile and ExportQuery.
+const (
+	FormatCSV     = "csv"
+	FormatJSON    = "json"
+	FormatJSONL   = "jsonl"
+	FormatParquet = "parquet"
+	FormatXLSX    = "xlsx"
+)
+
+var (
+	importFormats = []string{FormatCSV, FormatJSON, FormatJSONL, FormatParquet}
+	exportFormats = []string{FormatCSV, FormatJSONL, FormatParquet, FormatXLSX}
+)
+
+// Defaults for ImportOptions.
+const (
+	DefaultInferRows  = 1000
+	DefaultMaxRejects = 100
+)
+
+// Load methods reported in ImportResult.
+const (
+	LoadCopy     = "copy"
+	LoadReadFile = "read_file"
+	LoadPrepared = "prepared"
+	LoadInsert   = "insert"
+)
+
+// ImportOptions controls ImportFile.
+type ImportOptions struct {
+	// Table is the destination table, optionally schema-qualified.
+	Table string
+	// Format is one of the Format constants. When empty it is taken from the
+	// file extension.
+	Format string
+	// Create creates the table when it does not exist.
+	Create bool
+	// Types overrides inferred column types. Values are column types of the
+	// destination database, e.g. "VARCHAR(20)".
+	Types map[string]string
+	// Delimiter is the CSV field delimiter. It defaults to a comma.
+	Delimiter rune
+	// InferRows is the number of records column types are inferred from.
+	InferRows int
+	// BatchSize is the number of rows per INSERT statement.
+	BatchSize int
+	// MaxRejects aborts the import once more records are rejected. 0 uses
+	// DefaultMaxRejects and a negative value never aborts.
+	MaxRejects int
+	// Progress, if set, is called with the number of rows loaded so far.
+	Progress func(loaded int64)
+}
+
+// ImportColumn is a column of an imported table.
+type ImportColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// RejectedRow is a record that was not imported.
+type RejectedRow struct {
+	// Line is the line the record starts on, or its row number for Parquet
+	// files.
+	Line   int    `json:"line"`
+	Reason string `json:"error"`
+}
+
+func (r *RejectedRow) Error() string {
+	return fmt.Sprintf("line %d: %s", r.Line, r.Reason)
+}
+
+// ImportResult describes a finished import.
+type ImportResult struct {
+	Table   string         `json:"table"`
+	Format  string         `json:"format"`
+	Method  string         `json:"method"`
+	Columns []ImportColumn `json:"columns"`
+	Created bool           `json:"created"`
+	Rows    int64          `json:"rows"`
+	// Rejected counts every rejected record; RejectedRows lists the first
+	// DefaultMaxRejects of them.
+	Rejected     int64         `json:"rejected"`
+	RejectedRows []RejectedRow `json:"rejected_rows,omitempty"`
+}
+
+// FileFormat returns format, or the format implied by the extension of path
+// when format is empty, if ImportFile supports it.
+func FileFormat(path, format string) (string, error) {
+	return fileFormat(path, format, importFormats)
+}
+
+// ExportFormat is like FileFormat for the formats ExportQuery writes.
+func ExportFormat(path, format string) (string, error) {
+	return fileFormat(path, format, exportFormats)
+}
+
+func fileFormat(path, format string, allowed []string) (string, error) {
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+		if format == "ndjson" {
+			format = FormatJSONL
+		}
+	}
+	format = strings.ToLower(format)
+	if !slices.Contains(allowed, format) {
+		return "", fmt.Errorf("unsupported file format %q, expected one of %s", format, strings.Join(allowed, ", "))
+	}
+	return format, nil
+}
+
+// importColumn is a destination column and how values are converted for it.
+type importColumn struct {
+	name     string
+	kind     string
+	typeName string
+}
+
+// ImportFile loads the records of the file at path into a table on db.
+// Column types are inferred from the first records unless overridden, and
+// the table is created with dialect-specific types if needed. Records that
+// do not match the column types are rejected and reported; the rest are
+// loaded in a single transaction using the fastest method the driver
+// supports.
+func ImportFile(ctx context.Context, db *sql.DB, driver, path string, opts ImportOptions) (result ImportResult, err error) {
+	ctx, span := startStatementSpan(ctx, "import", "IMPORT "+opts.Table)
+	defer func() { endStatementSpan(ctx, span, result.Rows, err) }()
+
+	if opts.Table == "" {
+		return result, errors.New("destination table must not be empty")
+	}
+	format, err := FileFormat(path, opts.Format)
+	if err != nil {
+		return result, err
+	}
+	if opts.InferRows <= 0 {
+		opts.InferRows = DefaultInferRows
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultCopyBatchSize
+	}
+	if opts.MaxRejects == 0 {
+		opts.MaxRejects = DefaultMaxRejects
+	}
+	d := DialectFor(driver)
+	result.Table, result.Format = opts.Table, format
+
+	exists, err := tableExists(ctx, db, d, opts.Table)
+	if err != nil {
+		return result, err
+	}
+	if !exists && !opts.Create {
+		return result, fmt.Errorf("destination table %s does not exist", opts.Table)
+	}
+
+	// DuckDB reads files itself, which is much faster than any insert. Its
+	// readers abort on the first record they cannot load rather than
+	// rejecting it, and the failed statement loads nothing, so such files
+	// are loaded again record by record below.
+	if d.system() == "duckdb" && len(opts.Types) == 0 && opts.Delimiter == 0 {
+		loaded, err := importReadFile(ctx, db, d, path, format, exists, result)
+		if err == nil {
+			if opts.Progress != nil && loaded.Rows > 0 {
+				opts.Progress(loaded.Rows)
+			}
+			return loaded, nil
+		}
+		if ctx.Err() != nil {
+			return result, err
+		}
+	}
+
+	src, err := openSource(path, format, opts.Delimiter)
+	if err != nil {
+		return result, err
+	}
+	defer src.close()
+
+	reject := func(r *RejectedRow) error {
+		result.Rejected++
+		if len(result.RejectedRows) < DefaultMaxRejects {
+			result.RejectedRows = append(result.RejectedRows, *r)
+		}
+		if opts.MaxRejects > 0 && result.Rejected > int64(opts.MaxRejects) {
+			return fmt.Errorf("aborted after %d rejected records, the last at %s", result.Rejected, r.Error())
+		}
+		return nil
+	}
+
+	// Read the records types are inferred from.
+	type record struct {
+		values []interface{}
+		line   int
+	}
+	var sample []record
+	for len(sample) < opts.InferRows {
+		values, line, err := src.next()
+		if err == io.EOF {
+			break
+		}
+		var rejected *RejectedRow
+		if errors.As(err, &rejected) {
+			if err := reject(rejected); err != nil {
+				return result, err
+			}
+			continue
+		}
+		if err != nil {
+			return result, err
+		}
+		sample = append(sample, record{values, line})
+	}
+	if f, ok := src.(freezer); ok {
+		f.freeze()
+	}
+
+	names := src.columns()
+	if len(names) == 0 {
+		return result, errors.New("file has no columns")
+	}
+	var kinds []string
+	if ks, ok := src.(kindSource); ok {
+		kinds = ks.kinds()
+	} else {
+		kinds = make([]string, len(names))
+		for i := range names {
+			for _, r := range sample {
+				if i < len(r.values) {
+					kinds[i] = mergeKind(kinds[i], valueKind(r.values[i]))
+				}
+			}
+			if kinds[i] == "" {
+				kinds[i] = kindText
+			}
+		}
+	}
+
+	columns := make([]importColumn, len(names))
+	for i, name := range names {
+		c := importColumn{name: name, kind: kinds[i], typeName: d.typeFor(kinds[i])}
+		if t, ok := opts.Types[name]; ok {
+			c.kind, c.typeName = typeKind(t), t
+		}
+		columns[i] = c
+		result.Columns = append(result.Columns, ImportColumn{Name: c.name, Type: c.typeName})
+	}
+	for name := range opts.Types {
+		if !slices.Contains(names, name) {
+			return result, fmt.Errorf("type override for unknown column %q", name)
+		}
+	}
+
+	if !exists {
+		defs := make([]string, len(columns))
+		for i, c := range columns {
+			defs[i] = d.QuoteIdent(c.name) + " " + c.typeName
+		}
+		if _, err := db.ExecContext(ctx, createTableStatement(d, opts.Table, defs)); err != nil {
+			return result, fmt.Errorf("failed to create table: %w", err)
+		}
+		result.Created = true
+	}
+
+	l, err := newLoader(ctx, db, d, opts.Table, names, opts.BatchSize)
+	if err != nil {
+		return result, err
+	}
+	result.Method = l.method
+	defer func() {
+		if err != nil {
+			l.rollback()
+		}
+	}()
+
+	var reported int64
+	progress := func(final bool) {
+		if opts.Progress != nil && result.Rows > reported && (final || result.Rows-reported >= int64(opts.BatchSize)) {
+			opts.Progress(result.Rows)
+			reported = result.Rows
+		}
+	}
+	add := func(values []interface{}, line int) error {
+		row := make([]interface{}, len(columns))
+		for i, c := range columns {
+			if i >= len(values) {
+				continue
+			}
+			v, err := convertValue(c.kind, values[i])
+			if err != nil {
+				return reject(&RejectedRow{Line: line, Reason: fmt.Sprintf("column %s: %v", c.name, err)})
+			}
+			row[i] = v
+		}
+		n, err := l.add(row)
+		if err != nil {
+			return fmt.Errorf("failed to load record at line %d: %w", line, err)
+		}
+		result.Rows += n
+		progress(false)
+		return nil
+	}
+
+	for _, r := range sample {
+		if err := add(r.values, r.line); err != nil {
+			return result, err
+		}
+	}
+	for {
+		values, line, err := src.next()
+		if err == io.EOF {
+			break
+		}
+		var rejected *RejectedRow
+		if errors.As(err, &rejected) {
+			if err := reject(rejected); err != nil {
+				return result, err
+			}
+			continue
+		}
+		if err != nil {
+			return result, err
+		}
+		if err := add(values, line); err != nil {
+			return result, err
+		}
+	}
+
+	n, err := l.finish()
+	if err != nil {
+		return result, err
+	}
+	result.Rows += n
+	progress(true)
+	return result, nil
+}
+
+// importReadFile loads a file with DuckDB's own readers.
+func importReadFile(ctx context.Context, db *sql.DB, d Dialect, path, format string, exists bool, result ImportResult) (ImportResult, error) {
+	quoted := "'" + strings.ReplaceAll(path, "'", "''") + "'"
+	var from string
+	switch format {
+	case FormatCSV:
+		from = fmt.Sprintf("read_csv(%s, header = true)", quoted)
+	case FormatJSON:
+		from = fmt.Sprintf("read_json(%s, format = 'array')", quoted)
+	case FormatJSONL:
+		from = fmt.Sprintf("read_json(%s, format = 'newline_delimited')", quoted)
+	case FormatParquet:
+		from = fmt.Sprintf("read_parquet(%s)", quoted)
+	}
+	table := d.QuoteQualified(result.Table)
+
+	stmt := fmt.Sprintf("INSERT INTO %s SELECT * FROM %s", table, from)
+	if !exists {
+		stmt = fmt.Sprintf("CREATE TABLE %s AS SELECT * FROM %s", table, from)
+		result.Created = true
+	}
+	res, err := db.ExecContext(ctx, stmt)
+	if err != nil {
+		return result, fmt.Errorf("failed to import file: %w", err)
+	}
+	result.Method = LoadReadFile
+	result.Rows, _ = res.RowsAffected()
+
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("SELECT * FROM %s WHERE 1 = 0", table))
+	if err != nil {
+		return result, fmt.Errorf("failed to read imported columns: %w", err)
+	}
+	defer rows.Close()
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return result, fmt.Errorf("failed to read imported columns: %w", err)
+	}
+	for _, ct := range types {
+		result.Columns = append(result.Columns, ImportColumn{Name: ct.Name(), Type: ct.DatabaseTypeName()})
+	}
+	return result, nil
+}
+
+// loader inserts rows into a table inside a transaction.
+type loader struct {
+	method  string
+	tx      *sql.Tx
+	stmt    *sql.Stmt
+	d       Dialect
+	table   string
+	columns []string
+	batch   [][]interface{}
+	size    int
+	ctx     context.Context
+}
+
+// newLoader starts a transaction on db and picks the load method: COPY for
+// lib/pq, a prepared INSERT for SQLite, whose per-statement overhead is tiny
+// inside a transaction, and multi-row INSERTs otherwise.
+func newLoader(ctx context.Context, db *sql.DB, d Dialect, table string, columns []string, batchSize int) (*loader, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	l := &loader{tx: tx, d: d, table: table, columns: columns, ctx: ctx}
+
+	quoted := make([]string, len(columns))
+	for i, c := range columns {
+		quoted[i] = d.QuoteIdent(c)
+	}
+	switch {
+	case d.Driver == "postgres":
+		// lib/pq turns a prepared COPY ... FROM STDIN into a copy-in
+		// stream fed by Exec.
+		l.method = LoadCopy
+		l.stmt, err = tx.PrepareContext(ctx, fmt.Sprintf("COPY %s (%s) FROM STDIN", d.QuoteQualified(table), strings.Join(quoted, ", ")))
+	case d.system() == "sqlite" || !d.MultiRowInsert():
+		l.method = LoadPrepared
+		placeholders := make([]string, len(columns))
+		for i := range columns {
+			placeholders[i] = d.Placeholder(i + 1)
+		}
+		l.stmt, err = tx.PrepareContext(ctx, fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", d.QuoteQualified(table), strings.Join(quoted, ", "), strings.Join(placeholders, ", ")))
+	default:
+		l.method = LoadInsert
+		l.size = max(1, min(batchSize, d.MaxParams()/len(columns)))
+	}
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to prepare load statement: %w", err)
+	}
+	return l, nil
+}
+
+// add loads a row, returning how many rows were written to the database.
+func (l *loader) add(row []interface{}) (int64, error) {
+	if l.stmt != nil {
+		if _, err := l.stmt.ExecContext(l.ctx, row...); err != nil {
+			return 0, err
+		}
+		return 1, nil
+	}
+	l.batch = append(l.batch, row)
+	if len(l.batch) < l.size {
+		return 0, nil
+	}
+	return l.flush()
+}
+
+func (l *loader) flush() (int64, error) {
+	if len(l.batch) == 0 {
+		return 0, nil
+	}
+	rows := make([]Row, len(l.batch))
+	for i, values := range l.batch {
+		rows[i] = make(Row, len(values))
+		for j, c := range l.columns {
+			rows[i][c] = values[j]
+		}
+	}
+	stmt, args := insertSQL(l.d, l.table, l.columns, rows)
+	if _, err := l.tx.ExecContext(l.ctx, stmt, args...); err != nil {
+		return 0, err
+	}
+	n := int64(len(l.batch))
+	l.batch = l.batch[:0]
+	return n, nil
+}
+
+// finish writes any pending rows and commits.
+func (l *loader) finish() (int64, error) {
+	n, err := l.flush()
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert rows: %w", err)
+	}
+	if l.stmt != nil {
+		if l.method == LoadCopy {
+			// An Exec without arguments ends the copy-in stream.
+			if _, err := l.stmt.ExecContext(l.ctx); err != nil {
+				return 0, fmt.Errorf("failed to finish COPY: %w", err)
+			}
+		}
+		if err := l.stmt.Close(); err != nil {
+			return 0, fmt.Errorf("failed to close load statement: %w", err)
+		}
+	}
+	if err := l.tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit import: %w", err)
+	}
+	return n, nil
+}
+
+func (l *loader) rollback() {
+	if l.stmt != nil {
+		l.stmt.Close()
+	}
+	l.tx.Rollback()
+}
+
+// Layouts accepted for date and timestamp values.
+var (
+	dateLayouts      = []string{"2006-01-02"}
+	timestampLayouts = []string{
+		time.RFC3339Nano,
+		"2006-01-02 15:04:05.999999999Z07:00",
+		"2006-01-02 15:04:05.999999999Z0700",
+		"2006-01-02T15:04:05.999999999",
+		"2006-01-02 15:04:05.999999999",
+	}
+)
+
+func parseTime(s string, layouts []string) (time.Time, bool) {
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// valueKind returns the narrowest type kind that can hold v, or "" for
+// NULL.
+func valueKind(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case bool:
+		return kindBool
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return kindInteger
+		}
+		return kindFloat
+	case map[string]interface{}, []interface{}:
+		return kindJSON
+	case string:
+		if _, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return kindInteger
+		}
+		if _, err := strconv.ParseFloat(v, 64); err == nil {
+			return kindFloat
+		}
+		if v == "true" || v == "false" || v == "TRUE" || v == "FALSE" {
+			return kindBool
+		}
+		if _, ok := parseTime(v, dateLayouts); ok {
+			return kindDate
+		}
+		if _, ok := parseTime(v, timestampLayouts); ok {
+			return kindTimestamp
+		}
+		return kindText
+	default:
+		return kindText
+	}
+}
+
+// mergeKind returns a kind that can hold values of both kinds.
+func mergeKind(a, b string) string {
+	switch {
+	case a == "" || a == b:
+		return b
+	case b == "":
+		return a
+	case (a == kindInteger && b == kindFloat) || (a == kindFloat && b == kindInteger):
+		return kindFloat
+	case (a == kindDate && b == kindTimestamp) || (a == kindTimestamp && b == kindDate):
+		return kindTimestamp
+	default:
+		return kindText
+	}
+}
+
+// convertValue converts a value read from a file for a column of kind.
+func convertValue(kind string, v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	// Numbers, booleans and times read by drivers or from Parquet files
+	// already have a Go type.
+	switch v.(type) {
+	case int8, int16, int32, int64, uint8, uint16, uint32, uint64, float32, float64, bool:
+		if kind == kindInteger || kind == kindFloat || kind == kindBool || kind == kindDecimal {
+			return v, nil
+		}
+	case time.Time:
+		if kind == kindDate || kind == kindTimestamp {
+			return v, nil
+		}
+	}
+
+	var s string
+	switch v := v.(type) {
+	case string:
+		s = v
+	case []byte:
+		if kind == kindBinary {
+			return v, nil
+		}
+		s = string(v)
+	case map[string]interface{}, []interface{}:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		s = string(b)
+	default:
+		s = fmt.Sprint(v)
+	}
+
+	switch kind {
+	case kindInteger:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer %q", s)
+		}
+		return n, nil
+	case kindFloat:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", s)
+		}
+		return f, nil
+	case kindDecimal:
+		if _, err := strconv.ParseFloat(s, 64); err != nil {
+			return nil, fmt.Errorf("invalid number %q", s)
+		}
+		return s, nil
+	case kindBool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid boolean %q", s)
+		}
+		return b, nil
+	case kindDate:
+		t, ok := parseTime(s, dateLayouts)
+		if !ok {
+			return nil, fmt.Errorf("invalid date %q", s)
+		}
+		return t, nil
+	case kindTimestamp:
+		t, ok := parseTime(s, timestampLayouts)
+		if !ok {
+			if t, ok = parseTime(s, dateLayouts); !ok {
+				return nil, fmt.Errorf("invalid timestamp %q", s)
+			}
+		}
+		return t, nil
+	case kindJSON:
+		if !json.Valid([]byte(s)) {
+			return nil, fmt.Errorf("invalid JSON %q", s)
+		}
+		return s, nil
+	case kindBinary:
+		return []byte(s), nil
+	default:
+		return s, nil
+	}
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet/file"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+)
+
+// parquetBatchSize is the number of rows read from a Parquet file at a time.
+const parquetBatchSize = 4096
+
+// parquetSource reads a Parquet file through Arrow record batches. Lines are
+// 1-based row numbers.
+type parquetSource struct {
+	f      *file.Reader
+	rr     pqarrow.RecordReader
+	schema *arrow.Schema
+	rec    arrow.Record
+	i      int
+	row    int
+}
+
+func openParquet(path string) (*parquetSource, error) {
+	f, err := file.OpenParquetFile(path, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open Parquet file: %w", err)
+	}
+	fr, err := pqarrow.NewFileReader(f, pqarrow.ArrowReadProperties{BatchSize: parquetBatchSize}, memory.DefaultAllocator)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to read Parquet schema: %w", err)
+	}
+	rr, err := fr.GetRecordReader(context.Background(), nil, nil)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to read Parquet file: %w", err)
+	}
+	return &parquetSource{f: f, rr: rr, schema: rr.Schema()}, nil
+}
+
+func (s *parquetSource) columns() []string {
+	names := make([]string, s.schema.NumFields())
+	for i, f := range s.schema.Fields() {
+		names[i] = f.Name
+	}
+	return names
+}
+
+func (s *parquetSource) kinds() []string {
+	kinds := make([]string, s.schema.NumFields())
+	for i, f := range s.schema.Fields() {
+		kinds[i] = arrowKind(f.Type)
+	}
+	return kinds
+}
+
+func (s *parquetSource) next() ([]interface{}, int, error) {
+	for s.rec == nil || s.i >= int(s.rec.NumRows()) {
+		if !s.rr.Next() {
+			if err := s.rr.Err(); err != nil && err != io.EOF {
+				return nil, 0, fmt.Errorf("failed to read Parquet file: %w", err)
+			}
+			return nil, 0, io.EOF
+		}
+		s.rec, s.i = s.rr.Record(), 0
+	}
+
+	values := make([]interface{}, s.rec.NumCols())
+	for c, col := range s.rec.Columns() {
+		if col.IsNull(s.i) {
+			continue
+		}
+		switch arrowKind(col.DataType()) {
+		case kindBool, kindInteger, kindFloat, kindJSON:
+			values[c] = col.GetOneForMarshal(s.i)
+		case kindText, kindBinary:
+			// Copy out of the Arrow buffers, which are reused by later
+			// batches.
+			switch v := col.GetOneForMarshal(s.i).(type) {
+			case string:
+				values[c] = strings.Clone(v)
+			case []byte:
+				values[c] = bytes.Clone(v)
+			default:
+				values[c] = v
+			}
+		default:
+			// Dates, timestamps and decimals are converted from their
+			// string form.
+			values[c] = col.ValueStr(s.i)
+		}
+	}
+	s.i++
+	s.row++
+	return values, s.row, nil
+}
+
+func (s *parquetSource) close() error {
+	s.rr.Release()
+	return s.f.Close()
+}
+
+// arrowKind classifies an Arrow data type into a type kind.
+func arrowKind(t arrow.DataType) string {
+	switch t.ID() {
+	case arrow.BOOL:
+		return kindBool
+	case arrow.INT8, arrow.INT16, arrow.INT32, arrow.INT64,
+		arrow.UINT8, arrow.UINT16, arrow.UINT32, arrow.UINT64:
+		return kindInteger
+	case arrow.FLOAT16, arrow.FLOAT32, arrow.FLOAT64:
+		return kindFloat
+	case arrow.DECIMAL128, arrow.DECIMAL256:
+		return kindDecimal
+	case arrow.BINARY, arrow.LARGE_BINARY, arrow.FIXED_SIZE_BINARY:
+		return kindBinary
+	case arrow.DATE32, arrow.DATE64:
+		return kindDate
+	case arrow.TIME32, arrow.TIME64:
+		return kindTime
+	case arrow.TIMESTAMP:
+		return kindTimestamp
+	case arrow.STRING, arrow.LARGE_STRING:
+		return kindText
+	default:
+		// Nested types are stored as their JSON representation.
+		return kindJSON
+	}
+}
@@ -0,0 +1,259 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// recordSource yields the records of an import file.
+type recordSource interface {
+	// columns returns the column names. For sources without a header it is
+	// only complete after the records used for inference have been read.
+	columns() []string
+	// next returns the next record, in the order of columns, and the line
+	// (or, for Parquet, the row) it starts on. It returns io.EOF at the end
+	// and a *RejectedRow for records that cannot be parsed.
+	next() (values []interface{}, line int, err error)
+	close() error
+}
+
+// freezer is implemented by sources that add columns as they see new keys.
+// Once frozen, records with unknown keys are rejected.
+type freezer interface {
+	freeze()
+}
+
+// kindSource is implemented by sources whose format carries column types.
+type kindSource interface {
+	kinds() []string
+}
+
+// openSource opens path as a record source of the given format.
+func openSource(path, format string, delimiter rune) (recordSource, error) {
+	switch format {
+	case FormatCSV:
+		return openCSV(path, delimiter)
+	case FormatJSON:
+		return openJSON(path)
+	case FormatJSONL:
+		return openJSONL(path)
+	case FormatParquet:
+		return openParquet(path)
+	default:
+		return nil, fmt.Errorf("unsupported import format %q", format)
+	}
+}
+
+// csvSource reads a CSV file with a header row. Empty fields are NULL.
+type csvSource struct {
+	f      *os.File
+	r      *csv.Reader
+	header []string
+}
+
+func openCSV(path string, delimiter rune) (*csvSource, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r := csv.NewReader(bufio.NewReader(f))
+	if delimiter != 0 {
+		r.Comma = delimiter
+	}
+	r.ReuseRecord = true
+	header, err := r.Read()
+	if err != nil {
+		f.Close()
+		if err == io.EOF {
+			return nil, errors.New("CSV file is empty")
+		}
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+	// Strip a UTF-8 byte order mark left by spreadsheet exports.
+	header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	return &csvSource{f: f, r: r, header: append([]string(nil), header...)}, nil
+}
+
+func (s *csvSource) columns() []string { return s.header }
+
+func (s *csvSource) next() ([]interface{}, int, error) {
+	record, err := s.r.Read()
+	if err != nil {
+		var perr *csv.ParseError
+		if errors.As(err, &perr) {
+			return nil, perr.StartLine, &RejectedRow{Line: perr.StartLine, Reason: perr.Err.Error()}
+		}
+		return nil, 0, err
+	}
+	line, _ := s.r.FieldPos(0)
+	values := make([]interface{}, len(record))
+	for i, field := range record {
+		if field != "" {
+			values[i] = field
+		}
+	}
+	return values, line, nil
+}
+
+func (s *csvSource) close() error { return s.f.Close() }
+
+// objectSource turns decoded JSON objects into records. Columns are the keys
+// in order of first appearance.
+type objectSource struct {
+	names  []string
+	index  map[string]int
+	frozen bool
+}
+
+func (s *objectSource) columns() []string { return s.names }
+func (s *objectSource) freeze()           { s.frozen = true }
+
+// record converts an object into a record, adding columns for new keys
+// until the source is frozen.
+func (s *objectSource) record(obj map[string]interface{}, keys []string) ([]interface{}, error) {
+	if s.index == nil {
+		s.index = map[string]int{}
+	}
+	for _, k := range keys {
+		if _, ok := s.index[k]; !ok {
+			if s.frozen {
+				return nil, fmt.Errorf("unknown field %q", k)
+			}
+			s.index[k] = len(s.names)
+			s.names = append(s.names, k)
+		}
+	}
+	values := make([]interface{}, len(s.names))
+	for k, v := range obj {
+		values[s.index[k]] = v
+	}
+	return values, nil
+}
+
+// decodeObject decodes a single JSON object, keeping its key order and
+// numbers as json.Number.
+func decodeObject(data []byte) (map[string]interface{}, []string, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, nil, err
+	}
+	if tok != json.Delim('{') {
+		return nil, nil, errors.New("record is not a JSON object")
+	}
+	obj := map[string]interface{}{}
+	var keys []string
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		key := tok.(string)
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			return nil, nil, err
+		}
+		if _, dup := obj[key]; !dup {
+			keys = append(keys, key)
+		}
+		obj[key] = v
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, nil, err
+	}
+	return obj, keys, nil
+}
+
+// jsonSource reads a JSON array of objects.
+type jsonSource struct {
+	objectSource
+	data []byte
+	dec  *json.Decoder
+}
+
+func openJSON(path string) (*jsonSource, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		return nil, errors.New("JSON file must contain an array of objects")
+	}
+	return &jsonSource{data: data, dec: dec}, nil
+}
+
+func (s *jsonSource) next() ([]interface{}, int, error) {
+	if !s.dec.More() {
+		return nil, 0, io.EOF
+	}
+	var raw json.RawMessage
+	if err := s.dec.Decode(&raw); err != nil {
+		return nil, 0, fmt.Errorf("failed to parse JSON: %w", err)
+	}
+	// The decoder is positioned after the element; find where it started.
+	end := int(s.dec.InputOffset())
+	start := end - len(raw)
+	line := 1 + bytes.Count(s.data[:start], []byte("\n"))
+
+	obj, keys, err := decodeObject(raw)
+	if err != nil {
+		return nil, line, &RejectedRow{Line: line, Reason: err.Error()}
+	}
+	values, err := s.record(obj, keys)
+	if err != nil {
+		return nil, line, &RejectedRow{Line: line, Reason: err.Error()}
+	}
+	return values, line, nil
+}
+
+func (s *jsonSource) close() error { return nil }
+
+// jsonlSource reads one JSON object per line. Blank lines are skipped.
+type jsonlSource struct {
+	objectSource
+	f    *os.File
+	r    *bufio.Reader
+	line int
+}
+
+func openJSONL(path string) (*jsonlSource, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &jsonlSource{f: f, r: bufio.NewReader(f)}, nil
+}
+
+func (s *jsonlSource) next() ([]interface{}, int, error) {
+	for {
+		data, err := s.r.ReadBytes('\n')
+		if len(data) == 0 && err != nil {
+			return nil, 0, err
+		}
+		s.line++
+		data = bytes.TrimSpace(data)
+		if len(data) == 0 {
+			continue
+		}
+		obj, keys, perr := decodeObject(data)
+		if perr != nil {
+			return nil, s.line, &RejectedRow{Line: s.line, Reason: perr.Error()}
+		}
+		values, perr := s.record(obj, keys)
+		if perr != nil {
+			return nil, s.line, &RejectedRow{Line: s.line, Reason: perr.Error()}
+		}
+		return values, s.line, nil
+	}
+}
+
+func (s *jsonlSource) close() error { return s.f.Close() }
@@ -0,0 +1,171 @@
+package api_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thesoulless/usqlmcp/api"
+)
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestImportCSV(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	dir := t.TempDir()
+
+	path := writeFile(t, dir, "people.csv", "\ufeffid,name,score,active,born\n"+
+		"1,Alice,1.5,true,2001-02-03\n"+
+		"2,\"Bob, Jr.\",2,false,\n"+
+		"3,Carol,,true,2003-04-05\n")
+
+	var progress []int64
+	result, err := api.ImportFile(ctx, db, "sqlite3", path, api.ImportOptions{
+		Table:    "people",
+		Create:   true,
+		Progress: func(n int64) { progress = append(progress, n) },
+	})
+	require.NoError(t, err)
+	assert.Equal(t, api.ImportResult{
+		Table:  "people",
+		Format: "csv",
+		Method: api.LoadPrepared,
+		Columns: []api.ImportColumn{
+			{Name: "id", Type: "BIGINT"},
+			{Name: "name", Type: "TEXT"},
+			{Name: "score", Type: "REAL"},
+			{Name: "active", Type: "INTEGER"},
+			{Name: "born", Type: "DATE"},
+		},
+		Created: true,
+		Rows:    3,
+	}, result)
+	assert.Equal(t, []int64{3}, progress)
+
+	rows, err := api.ReadQuery(db, `SELECT id, name, score, active FROM people ORDER BY id`)
+	require.NoError(t, err)
+	assert.Equal(t, []api.Row{
+		{"id": int64(1), "name": "Alice", "score": 1.5, "active": int64(1)},
+		{"id": int64(2), "name": "Bob, Jr.", "score": 2.0, "active": int64(0)},
+		{"id": int64(3), "name": "Carol", "score": nil, "active": int64(1)},
+	}, rows)
+
+	// Rows that do not fit the existing table's inferred types are rejected
+	// with their line numbers.
+	path = writeFile(t, dir, "more.csv", "id,name\n4,Dan\nfive,Eve\n6,Fay,extra\n7,Gus\n")
+	result, err = api.ImportFile(ctx, db, "sqlite3", path, api.ImportOptions{Table: "people", InferRows: 1})
+	require.NoError(t, err)
+	assert.False(t, result.Created)
+	assert.Equal(t, int64(2), result.Rows)
+	assert.Equal(t, int64(2), result.Rejected)
+	assert.Equal(t, []api.RejectedRow{
+		{Line: 3, Reason: `column id: invalid integer "five"`},
+		{Line: 4, Reason: "wrong number of fields"},
+	}, result.RejectedRows)
+
+	_, err = api.ImportFile(ctx, db, "sqlite3", path, api.ImportOptions{Table: "people", InferRows: 1, MaxRejects: 1})
+	assert.ErrorContains(t, err, "aborted after 2 rejected records, the last at line 4")
+	rows, err = api.ReadQuery(db, `SELECT count(*) AS n FROM people`)
+	require.NoError(t, err)
+	assert.Equal(t, []api.Row{{"n": int64(5)}}, rows)
+}
+
+func TestImportJSON(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	dir := t.TempDir()
+
+	path := writeFile(t, dir, "events.json", `[
+  {"id": 1, "kind": "click", "meta": {"x": 1}},
+  {"id": 2, "kind": "view", "zip": "01234"},
+  {"id": "x", "kind": "view"}
+]`)
+	result, err := api.ImportFile(ctx, db, "sqlite3", path, api.ImportOptions{
+		Table:     "events",
+		Create:    true,
+		Types:     map[string]string{"zip": "VARCHAR(10)"},
+		InferRows: 2,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []api.ImportColumn{
+		{Name: "id", Type: "BIGINT"},
+		{Name: "kind", Type: "TEXT"},
+		{Name: "meta", Type: "TEXT"},
+		{Name: "zip", Type: "VARCHAR(10)"},
+	}, result.Columns)
+	assert.Equal(t, int64(2), result.Rows)
+	assert.Equal(t, []api.RejectedRow{{Line: 4, Reason: `column id: invalid integer "x"`}}, result.RejectedRows)
+
+	rows, err := api.ReadQuery(db, `SELECT * FROM events ORDER BY id`)
+	require.NoError(t, err)
+	assert.Equal(t, []api.Row{
+		{"id": int64(1), "kind": "click", "meta": `{"x":1}`, "zip": nil},
+		{"id": int64(2), "kind": "view", "meta": nil, "zip": "01234"},
+	}, rows)
+
+	// JSONL columns are fixed by the inference sample; later records with
+	// new fields are rejected.
+	path = writeFile(t, dir, "events.ndjson", "{\"id\": 3, \"kind\": \"buy\"}\n\nnot json\n{\"id\": 4, \"extra\": true}\n")
+	result, err = api.ImportFile(ctx, db, "sqlite3", path, api.ImportOptions{Table: "events", InferRows: 1})
+	require.NoError(t, err)
+	assert.Equal(t, "jsonl", result.Format)
+	assert.Equal(t, int64(1), result.Rows)
+	require.Len(t, result.RejectedRows, 2)
+	assert.Equal(t, 3, result.RejectedRows[0].Line)
+	assert.Equal(t, api.RejectedRow{Line: 4, Reason: `unknown field "extra"`}, result.RejectedRows[1])
+
+	_, err = api.ImportFile(ctx, db, "sqlite3", path, api.ImportOptions{Table: "events", Types: map[string]string{"nope": "TEXT"}, InferRows: 1})
+	assert.ErrorContains(t, err, `type override for unknown column "nope"`)
+	_, err = api.ImportFile(ctx, db, "sqlite3", path, api.ImportOptions{Table: "missing"})
+	assert.ErrorContains(t, err, "destination table missing does not exist")
+}
+
+func TestFileFormat(t *testing.T) {
+	for path, want := range map[string]string{
+		"a.csv": "csv", "a.JSON": "json", "a.jsonl": "jsonl", "a.ndjson": "jsonl", "a.parquet": "parquet",
+	} {
+		got, err := api.FileFormat(path, "")
+		require.NoError(t, err, path)
+		assert.Equal(t, want, got, path)
+	}
+	got, err := api.FileFormat("data.txt", "CSV")
+	require.NoError(t, err)
+	assert.Equal(t, "csv", got)
+	_, err = api.FileFormat("data.txt", "")
+	assert.ErrorContains(t, err, `unsupported file format "txt"`)
+}
+
+func TestResolvePath(t *testing.T) {
+	dir := t.TempDir()
+	outside := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0o700))
+	writeFile(t, dir, "a.csv", "")
+	require.NoError(t, os.Symlink(outside, filepath.Join(dir, "escape")))
+
+	root, err := filepath.EvalSymlinks(dir)
+	require.NoError(t, err)
+
+	got, err := api.ResolvePath(dir, "a.csv")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(root, "a.csv"), got)
+
+	got, err = api.ResolvePath(dir, filepath.Join(dir, "sub", "new.csv"))
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(root, "sub", "new.csv"), got)
+
+	for _, name := range []string{"../a.csv", "sub/../../a.csv", "escape/a.csv", outside, "."} {
+		_, err := api.ResolvePath(dir, name)
+		assert.Error(t, err, name)
+	}
+	_, err = api.ResolvePath("", "a.csv")
+	assert.ErrorContains(t, err, "no directory is configured")
+}
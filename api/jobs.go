@@ -0,0 +1,506 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Job states.
+const (
+	JobRunning  = "running"
+	JobDone     = "done"
+	JobFailed   = "failed"
+	JobCanceled = "canceled"
+)
+
+const (
+	// DefaultJobTTL is how long finished jobs and their results are kept.
+	DefaultJobTTL = time.Hour
+	// DefaultMaxRunningJobs is how many jobs a session may run at once.
+	DefaultMaxRunningJobs = 4
+	// DefaultJobPageSize and MaxJobPageSize bound the rows of a result page.
+	DefaultJobPageSize = 100
+	MaxJobPageSize     = 1000
+)
+
+// ErrJobNotFound is returned for unknown and expired jobs, and for jobs of
+// other sessions.
+var ErrJobNotFound = errors.New("job not found")
+
+// JobOptions configures a JobStore.
+type JobOptions struct {
+	// TTL is how long finished jobs are kept. Defaults to DefaultJobTTL.
+	TTL time.Duration
+	// MaxRunning is how many jobs a session may run at once. Defaults to
+	// DefaultMaxRunningJobs.
+	MaxRunning int
+	// MaxBytes bounds the size of the results of all jobs, held in memory
+	// or written to Dir. Jobs whose results do not fit stop early and are
+	// marked truncated. Zero means no limit.
+	MaxBytes int64
+	// Dir, if set, is where results are written as JSON lines instead of
+	// being held in memory.
+	Dir string
+}
+
+// SubmitOptions configures a submitted job.
+type SubmitOptions struct {
+	// MaxRows stops the job after this many rows, marking it truncated.
+	MaxRows int
+	// Mask, if set, is applied to every value before it is stored.
+	Mask func(column string, val interface{}) interface{}
+}
+
+// JobStatus describes a job.
+type JobStatus struct {
+	ID          string     `json:"job_id"`
+	Connection  string     `json:"connection"`
+	Query       string     `json:"query"`
+	State       string     `json:"state"`
+	Error       string     `json:"error,omitempty"`
+	Columns     []string   `json:"columns,omitempty"`
+	Rows        int64      `json:"rows"`
+	Truncated   bool       `json:"truncated,omitempty"`
+	SubmittedAt time.Time  `json:"submitted_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+}
+
+// JobPage is a page of the rows of a job.
+type JobPage struct {
+	ID     string `json:"job_id"`
+	State  string `json:"state"`
+	Offset int    `json:"offset"`
+	Rows   []Row  `json:"rows"`
+	// NextOffset is the offset of the next page, if the job has more rows
+	// or is still running.
+	NextOffset *int `json:"next_offset,omitempty"`
+}
+
+// JobStore runs queries in the background and keeps their results for a
+// while, so that clients can fetch them after their tool call would have
+// timed out. Jobs belong to the session that submitted them.
+type JobStore struct {
+	opts JobOptions
+
+	mu    sync.Mutex
+	jobs  map[string]*job
+	bytes int64
+}
+
+type job struct {
+	status  JobStatus
+	session string
+	cancel  context.CancelFunc
+	done    chan struct{}
+	// rows holds the results in memory, and file on disk when the store
+	// has a directory. index holds the file offset of every
+	// jobIndexStride-th row, so that pages need not read the rows before
+	// them.
+	rows  []Row
+	size  int64
+	file  string
+	index []int64
+}
+
+// jobIndexStride is how many rows of a job result file apart the offsets
+// kept in its index are.
+const jobIndexStride = 256
+
+// NewJobStore returns a store with opts, creating its directory if needed.
+func NewJobStore(opts JobOptions) (*JobStore, error) {
+	if opts.TTL <= 0 {
+		opts.TTL = DefaultJobTTL
+	}
+	if opts.MaxRunning <= 0 {
+		opts.MaxRunning = DefaultMaxRunningJobs
+	}
+	if opts.Dir != "" {
+		if err := os.MkdirAll(opts.Dir, 0o700); err != nil {
+			return nil, fmt.Errorf("failed to create jobs directory: %w", err)
+		}
+	}
+	return &JobStore{opts: opts, jobs: map[string]*job{}}, nil
+}
+
+// Submit starts running query on a connection of its own from db, on behalf
+// of session, and returns the new job's status at once.
+func (s *JobStore) Submit(session, connection string, db *sql.DB, query string, opts SubmitOptions) (JobStatus, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return JobStatus{}, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &job{
+		status: JobStatus{
+			ID:          "job_" + hex.EncodeToString(b),
+			Connection:  connection,
+			Query:       query,
+			State:       JobRunning,
+			SubmittedAt: time.Now().UTC(),
+		},
+		session: session,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	if s.opts.Dir != "" {
+		j.file = filepath.Join(s.opts.Dir, j.status.ID+".jsonl")
+	}
+
+	s.mu.Lock()
+	s.prune()
+	running := 0
+	for _, other := range s.jobs {
+		if other.session == session && other.status.State == JobRunning {
+			running++
+		}
+	}
+	if running >= s.opts.MaxRunning {
+		s.mu.Unlock()
+		cancel()
+		return JobStatus{}, fmt.Errorf("%d jobs are already running; wait for one to finish or cancel it", running)
+	}
+	s.jobs[j.status.ID] = j
+	status := j.status
+	s.mu.Unlock()
+
+	go s.run(ctx, j, db, query, opts)
+	return status, nil
+}
+
+// run runs the query of j and stores its rows.
+func (s *JobStore) run(ctx context.Context, j *job, db *sql.DB, query string, opts SubmitOptions) {
+	defer close(j.done)
+	err := s.runQuery(ctx, j, db, query, opts)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC()
+	j.status.FinishedAt = &now
+	switch {
+	case j.status.State == JobCanceled:
+	case err != nil && ctx.Err() != nil:
+		j.status.State = JobCanceled
+	case err != nil:
+		j.status.State, j.status.Error = JobFailed, RedactError(err).Error()
+	default:
+		j.status.State = JobDone
+	}
+}
+
+func (s *JobStore) runQuery(ctx context.Context, j *job, db *sql.DB, query string, opts SubmitOptions) (err error) {
+	ctx, span := startStatementSpan(ctx, "job", query)
+	defer func() { endStatementSpan(ctx, span, j.rowCount(s), err) }()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get a connection: %w", err)
+	}
+	defer conn.Close()
+	rows, err := conn.QueryContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return fmt.Errorf("failed to get columns: %w", err)
+	}
+	columns := make([]string, len(columnTypes))
+	kinds := make([]string, len(columnTypes))
+	for i, ct := range columnTypes {
+		columns[i] = ct.Name()
+		kinds[i] = columnKind(ct)
+	}
+	s.mu.Lock()
+	j.status.Columns = columns
+	s.mu.Unlock()
+
+	var w *bufio.Writer
+	if j.file != "" {
+		f, err := os.OpenFile(j.file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err != nil {
+			return fmt.Errorf("failed to create job result file: %w", err)
+		}
+		defer f.Close()
+		w = bufio.NewWriter(f)
+	}
+
+	values := make([]interface{}, len(columns))
+	scanArgs := make([]interface{}, len(columns))
+	for i := range values {
+		scanArgs[i] = &values[i]
+	}
+	for rows.Next() {
+		if opts.MaxRows > 0 && j.rowCount(s) == int64(opts.MaxRows) {
+			s.setTruncated(j)
+			break
+		}
+		if err := rows.Scan(scanArgs...); err != nil {
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		row := make(Row, len(columns))
+		for i, v := range values {
+			// Drivers return text as []byte; only binary columns are kept
+			// as bytes.
+			if b, ok := v.([]byte); ok && kinds[i] != kindBinary {
+				v = string(b)
+			}
+			if opts.Mask != nil {
+				v = opts.Mask(columns[i], v)
+			}
+			row[columns[i]] = v
+		}
+
+		if w != nil {
+			line, err := json.Marshal(row)
+			if err != nil {
+				return fmt.Errorf("failed to encode row: %w", err)
+			}
+			size := int64(len(line) + 1)
+			s.mu.Lock()
+			if s.opts.MaxBytes > 0 && s.bytes+size > s.opts.MaxBytes {
+				j.status.Truncated = true
+				s.mu.Unlock()
+				break
+			}
+			if j.status.Rows%jobIndexStride == 0 {
+				j.index = append(j.index, j.size)
+			}
+			s.mu.Unlock()
+			if _, err := w.Write(append(line, '\n')); err != nil {
+				return fmt.Errorf("failed to write job result file: %w", err)
+			}
+			// Flushed per row so that pages of running jobs see every
+			// counted row.
+			if err := w.Flush(); err != nil {
+				return fmt.Errorf("failed to write job result file: %w", err)
+			}
+			s.mu.Lock()
+			j.size += size
+			s.bytes += size
+			j.status.Rows++
+			s.mu.Unlock()
+			continue
+		}
+		size := rowsSize([]Row{row})
+		s.mu.Lock()
+		if s.opts.MaxBytes > 0 && s.bytes+size > s.opts.MaxBytes {
+			j.status.Truncated = true
+			s.mu.Unlock()
+			break
+		}
+		j.rows = append(j.rows, row)
+		j.size += size
+		s.bytes += size
+		j.status.Rows++
+		s.mu.Unlock()
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("row iteration error: %w", err)
+	}
+	return nil
+}
+
+func (j *job) rowCount(s *JobStore) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return j.status.Rows
+}
+
+func (s *JobStore) setTruncated(j *job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j.status.Truncated = true
+}
+
+// Status returns the status of the job with id submitted by session.
+func (s *JobStore) Status(session, id string) (JobStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, err := s.lookup(session, id)
+	if err != nil {
+		return JobStatus{}, err
+	}
+	return j.status, nil
+}
+
+// Result returns up to limit rows of the job with id submitted by session,
+// starting at offset. Rows of running jobs can be read as they arrive.
+func (s *JobStore) Result(session, id string, offset, limit int) (JobPage, error) {
+	if limit <= 0 {
+		limit = DefaultJobPageSize
+	}
+	limit = min(limit, MaxJobPageSize)
+	offset = max(offset, 0)
+
+	s.mu.Lock()
+	j, err := s.lookup(session, id)
+	if err != nil {
+		s.mu.Unlock()
+		return JobPage{}, err
+	}
+	page := JobPage{ID: id, State: j.status.State, Offset: offset, Rows: []Row{}}
+	if page.State == JobFailed {
+		s.mu.Unlock()
+		return JobPage{}, fmt.Errorf("job failed: %s", j.status.Error)
+	}
+	total := int(j.status.Rows)
+	switch {
+	case offset >= total:
+		s.mu.Unlock()
+	case j.file == "":
+		page.Rows = append(page.Rows, j.rows[offset:min(offset+limit, total)]...)
+		s.mu.Unlock()
+	default:
+		start := j.index[offset/jobIndexStride]
+		s.mu.Unlock()
+		page.Rows, err = readJobRows(j.file, start, offset%jobIndexStride, min(limit, total-offset))
+		if err != nil {
+			return JobPage{}, err
+		}
+	}
+
+	if next := offset + len(page.Rows); next < total || page.State == JobRunning {
+		page.NextOffset = &next
+	}
+	return page, nil
+}
+
+// readJobRows reads limit rows from the JSON lines file at path, skipping
+// skip rows from the byte offset start.
+func readJobRows(path string, start int64, skip, limit int) ([]Row, error) {
+	rows := []Row{}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return rows, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read job result file: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Seek(start, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to read job result file: %w", err)
+	}
+	r := bufio.NewReader(f)
+	for n := 0; len(rows) < limit; n++ {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read job result file: %w", err)
+		}
+		if n < skip {
+			continue
+		}
+		dec := json.NewDecoder(bytes.NewReader(line))
+		dec.UseNumber()
+		var row Row
+		if err := dec.Decode(&row); err != nil {
+			return nil, fmt.Errorf("failed to read job result file: %w", err)
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// Cancel stops the job with id submitted by session if it is running, and
+// waits for it to stop. Results of finished jobs are discarded instead.
+func (s *JobStore) Cancel(session, id string) (JobStatus, error) {
+	s.mu.Lock()
+	j, err := s.lookup(session, id)
+	if err != nil {
+		s.mu.Unlock()
+		return JobStatus{}, err
+	}
+	if j.status.State != JobRunning {
+		s.remove(j)
+		status := j.status
+		s.mu.Unlock()
+		return status, nil
+	}
+	j.status.State = JobCanceled
+	s.mu.Unlock()
+
+	j.cancel()
+	<-j.done
+	return s.Status(session, id)
+}
+
+// CloseSession cancels the jobs of session and discards their results.
+func (s *JobStore) CloseSession(session string) {
+	s.mu.Lock()
+	var jobs []*job
+	for _, j := range s.jobs {
+		if j.session == session {
+			jobs = append(jobs, j)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, j := range jobs {
+		j.cancel()
+		<-j.done
+		s.mu.Lock()
+		s.remove(j)
+		s.mu.Unlock()
+	}
+}
+
+// Close cancels every job and discards every result.
+func (s *JobStore) Close() error {
+	s.mu.Lock()
+	sessions := map[string]bool{}
+	for _, j := range s.jobs {
+		sessions[j.session] = true
+	}
+	s.mu.Unlock()
+	for session := range sessions {
+		s.CloseSession(session)
+	}
+	return nil
+}
+
+// lookup returns the job with id submitted by session. s.mu must be held.
+func (s *JobStore) lookup(session, id string) (*job, error) {
+	s.prune()
+	j, ok := s.jobs[id]
+	if !ok || j.session != session {
+		return nil, fmt.Errorf("%w: %s", ErrJobNotFound, id)
+	}
+	return j, nil
+}
+
+// prune discards the jobs that finished more than the TTL ago. s.mu must be
+// held.
+func (s *JobStore) prune() {
+	cutoff := time.Now().Add(-s.opts.TTL)
+	for _, j := range s.jobs {
+		if j.status.FinishedAt != nil && j.status.FinishedAt.Before(cutoff) {
+			s.remove(j)
+		}
+	}
+}
+
+// remove discards j and its results. s.mu must be held.
+func (s *JobStore) remove(j *job) {
+	delete(s.jobs, j.status.ID)
+	s.bytes -= j.size
+	j.rows, j.size = nil, 0
+	if j.file != "" {
+		os.Remove(j.file)
+	}
+}
@@ -0,0 +1,210 @@
+package api_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thesoulless/usqlmcp/api"
+)
+
+// slowQuery takes seconds to return its only row on SQLite.
+const slowQuery = `WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM c WHERE x < 100000000) SELECT count(*) FROM c`
+
+func waitJob(t *testing.T, jobs *api.JobStore, session, id string) api.JobStatus {
+	t.Helper()
+	var status api.JobStatus
+	require.Eventually(t, func() bool {
+		var err error
+		status, err = jobs.Status(session, id)
+		require.NoError(t, err)
+		return status.State != api.JobRunning
+	}, 5*time.Second, 10*time.Millisecond)
+	return status
+}
+
+func TestJobs(t *testing.T) {
+	db := openTestDB(t)
+	_, err := db.Exec(`CREATE TABLE users (id INTEGER, name TEXT, email TEXT);
+		INSERT INTO users VALUES (1, 'Alice', 'alice@example.com'), (2, 'Bob', 'bob@example.com'), (3, 'Carol', NULL);`)
+	require.NoError(t, err)
+
+	jobs, err := api.NewJobStore(api.JobOptions{})
+	require.NoError(t, err)
+	defer jobs.Close()
+
+	mask := func(column string, val interface{}) interface{} {
+		if column == "email" && val != nil {
+			return "[REDACTED]"
+		}
+		return val
+	}
+	status, err := jobs.Submit("s1", "main", db, `SELECT * FROM users ORDER BY id`, api.SubmitOptions{Mask: mask})
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(status.ID, "job_"))
+	assert.Equal(t, "main", status.Connection)
+
+	status = waitJob(t, jobs, "s1", status.ID)
+	assert.Equal(t, api.JobDone, status.State)
+	assert.Equal(t, int64(3), status.Rows)
+	assert.Equal(t, []string{"id", "name", "email"}, status.Columns)
+	assert.NotNil(t, status.FinishedAt)
+
+	page, err := jobs.Result("s1", status.ID, 0, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []api.Row{
+		{"id": int64(1), "name": "Alice", "email": "[REDACTED]"},
+		{"id": int64(2), "name": "Bob", "email": "[REDACTED]"},
+	}, page.Rows)
+	require.NotNil(t, page.NextOffset)
+	assert.Equal(t, 2, *page.NextOffset)
+
+	page, err = jobs.Result("s1", status.ID, 2, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []api.Row{{"id": int64(3), "name": "Carol", "email": nil}}, page.Rows)
+	assert.Nil(t, page.NextOffset)
+
+	// Jobs of other sessions are not found.
+	_, err = jobs.Status("s2", status.ID)
+	assert.ErrorIs(t, err, api.ErrJobNotFound)
+	_, err = jobs.Result("s2", status.ID, 0, 0)
+	assert.ErrorIs(t, err, api.ErrJobNotFound)
+	_, err = jobs.Cancel("s2", status.ID)
+	assert.ErrorIs(t, err, api.ErrJobNotFound)
+
+	// Canceling a finished job discards it.
+	_, err = jobs.Cancel("s1", status.ID)
+	require.NoError(t, err)
+	_, err = jobs.Status("s1", status.ID)
+	assert.ErrorIs(t, err, api.ErrJobNotFound)
+
+	// Failed jobs report their error.
+	status, err = jobs.Submit("s1", "main", db, `SELECT * FROM missing`, api.SubmitOptions{})
+	require.NoError(t, err)
+	status = waitJob(t, jobs, "s1", status.ID)
+	assert.Equal(t, api.JobFailed, status.State)
+	assert.Contains(t, status.Error, "no such table")
+	_, err = jobs.Result("s1", status.ID, 0, 0)
+	assert.Error(t, err)
+
+	// MaxRows truncates the result.
+	status, err = jobs.Submit("s1", "main", db, `SELECT * FROM users`, api.SubmitOptions{MaxRows: 2})
+	require.NoError(t, err)
+	status = waitJob(t, jobs, "s1", status.ID)
+	assert.Equal(t, int64(2), status.Rows)
+	assert.True(t, status.Truncated)
+}
+
+func TestJobsCancel(t *testing.T) {
+	db := openTestDB(t)
+
+	jobs, err := api.NewJobStore(api.JobOptions{MaxRunning: 1})
+	require.NoError(t, err)
+	defer jobs.Close()
+
+	status, err := jobs.Submit("s1", "main", db, slowQuery, api.SubmitOptions{})
+	require.NoError(t, err)
+
+	// Each session runs at most MaxRunning jobs at once.
+	_, err = jobs.Submit("s1", "main", db, `SELECT 1`, api.SubmitOptions{})
+	assert.ErrorContains(t, err, "already running")
+	other, err := jobs.Submit("s2", "main", db, `SELECT 1`, api.SubmitOptions{})
+	require.NoError(t, err)
+	waitJob(t, jobs, "s2", other.ID)
+
+	page, err := jobs.Result("s1", status.ID, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, api.JobRunning, page.State)
+	assert.Empty(t, page.Rows)
+	require.NotNil(t, page.NextOffset, "running jobs may have more rows")
+
+	status, err = jobs.Cancel("s1", status.ID)
+	require.NoError(t, err)
+	assert.Equal(t, api.JobCanceled, status.State)
+	assert.NotNil(t, status.FinishedAt)
+
+	// Ending a session discards its jobs.
+	jobs.CloseSession("s2")
+	_, err = jobs.Status("s2", other.ID)
+	assert.ErrorIs(t, err, api.ErrJobNotFound)
+}
+
+func TestJobsStore(t *testing.T) {
+	db := openTestDB(t)
+	_, err := db.Exec(`CREATE TABLE n (v INTEGER, s TEXT);
+		INSERT INTO n VALUES (1, 'a'), (2, 'b'), (3, 'c');`)
+	require.NoError(t, err)
+
+	// Results can be kept on disk.
+	dir := filepath.Join(t.TempDir(), "jobs")
+	jobs, err := api.NewJobStore(api.JobOptions{Dir: dir})
+	require.NoError(t, err)
+
+	status, err := jobs.Submit("s1", "main", db, `SELECT * FROM n ORDER BY v`, api.SubmitOptions{})
+	require.NoError(t, err)
+	waitJob(t, jobs, "s1", status.ID)
+	page, err := jobs.Result("s1", status.ID, 1, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []api.Row{
+		{"v": json.Number("2"), "s": "b"},
+		{"v": json.Number("3"), "s": "c"},
+	}, page.Rows)
+	assert.Nil(t, page.NextOffset)
+	assert.FileExists(t, filepath.Join(dir, status.ID+".jsonl"))
+
+	// Pages far into the file start from the nearest indexed row.
+	status, err = jobs.Submit("s1", "main", db, `WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM c WHERE x < 600) SELECT x FROM c`, api.SubmitOptions{})
+	require.NoError(t, err)
+	waitJob(t, jobs, "s1", status.ID)
+	page, err = jobs.Result("s1", status.ID, 513, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []api.Row{{"x": json.Number("514")}, {"x": json.Number("515")}}, page.Rows)
+	page, err = jobs.Result("s1", status.ID, 598, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []api.Row{{"x": json.Number("599")}, {"x": json.Number("600")}}, page.Rows)
+
+	require.NoError(t, jobs.Close())
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	// Jobs stop early once the results of all jobs exceed the budget.
+	jobs, err = api.NewJobStore(api.JobOptions{MaxBytes: 300})
+	require.NoError(t, err)
+	defer jobs.Close()
+	status, err = jobs.Submit("s1", "main", db, `SELECT * FROM n`, api.SubmitOptions{})
+	require.NoError(t, err)
+	status = waitJob(t, jobs, "s1", status.ID)
+	assert.Equal(t, api.JobDone, status.State)
+	assert.True(t, status.Truncated)
+	assert.Less(t, status.Rows, int64(3))
+
+	// The budget covers results written to disk too.
+	jobs, err = api.NewJobStore(api.JobOptions{Dir: dir, MaxBytes: 20})
+	require.NoError(t, err)
+	defer jobs.Close()
+	status, err = jobs.Submit("s1", "main", db, `SELECT * FROM n`, api.SubmitOptions{})
+	require.NoError(t, err)
+	status = waitJob(t, jobs, "s1", status.ID)
+	assert.True(t, status.Truncated)
+	assert.Equal(t, int64(1), status.Rows)
+	info, err := os.Stat(filepath.Join(dir, status.ID+".jsonl"))
+	require.NoError(t, err)
+	assert.LessOrEqual(t, info.Size(), int64(20))
+
+	// Finished jobs expire after the TTL.
+	jobs, err = api.NewJobStore(api.JobOptions{TTL: 50 * time.Millisecond})
+	require.NoError(t, err)
+	defer jobs.Close()
+	status, err = jobs.Submit("s1", "main", db, `SELECT 1`, api.SubmitOptions{})
+	require.NoError(t, err)
+	waitJob(t, jobs, "s1", status.ID)
+	time.Sleep(100 * time.Millisecond)
+	_, err = jobs.Status("s1", status.ID)
+	assert.ErrorIs(t, err, api.ErrJobNotFound)
+}
@@ -0,0 +1,439 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Masking strategies.
+const (
+	// MaskRedact replaces the value with a fixed placeholder.
+	MaskRedact = "redact"
+	// MaskPartial hides all but the last few characters.
+	MaskPartial = "partial"
+	// MaskHash replaces the value with a keyed hash, so equal inputs stay
+	// equal and joins or group-bys on masked columns still make sense.
+	MaskHash = "hash"
+	// MaskFake replaces letters and digits with deterministic look-alikes,
+	// preserving length, case and punctuation.
+	MaskFake = "fake"
+)
+
+// Redacted is the placeholder used by the redact strategy.
+const Redacted = "[REDACTED]"
+
+// MaskRule selects values by column pattern or by value detector and masks
+// them with a strategy. Column rules mask the whole value; detector rules only
+// mask the matching parts of a text value.
+type MaskRule struct {
+	// Columns are "table.column" glob patterns, e.g. "users.email" or "*.ssn".
+	Columns []string `yaml:"columns,omitempty"`
+	// Detect names value detectors: email, credit_card, jwt, iban, phone.
+	Detect []string `yaml:"detect,omitempty"`
+	// Strategy is one of redact, partial, hash or fake. Defaults to redact.
+	Strategy string `yaml:"strategy,omitempty"`
+	// Keep is the number of trailing characters the partial strategy leaves
+	// visible. Defaults to 4.
+	Keep int `yaml:"keep,omitempty"`
+}
+
+// MaskConfig is the masking configuration file format.
+type MaskConfig struct {
+	// Salt keys the hash and fake strategies. Changing it changes every
+	// masked value.
+	Salt  string     `yaml:"salt,omitempty"`
+	Rules []MaskRule `yaml:"rules"`
+}
+
+// Masker applies masking rules to query results and schema output. A nil
+// *Masker leaves values unchanged.
+type Masker struct {
+	salt  []byte
+	rules []MaskRule
+}
+
+// detector finds sensitive substrings in text values.
+type detector struct {
+	re    *regexp.Regexp
+	valid func(string) bool
+}
+
+var detectors = map[string]detector{
+	"email": {re: regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)},
+	"credit_card": {
+		re:    regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`),
+		valid: luhnValid,
+	},
+	"jwt": {re: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)},
+	"iban": {
+		re:    regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]){11,30}\b`),
+		valid: ibanValid,
+	},
+	"phone": {re: regexp.MustCompile(`(?:\+\d{1,3}[ .-]?)?\(?\d{2,4}\)?[ .-]\d{3,4}[ .-]\d{3,4}\b|\+\d{8,15}\b`)},
+}
+
+// LoadMasker reads a YAML masking configuration file.
+func LoadMasker(file string) (*Masker, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read masking file: %w", err)
+	}
+	var cfg MaskConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse masking file: %w", err)
+	}
+	return NewMasker(cfg)
+}
+
+// NewMasker validates cfg and returns a Masker for it.
+func NewMasker(cfg MaskConfig) (*Masker, error) {
+	m := &Masker{salt: []byte(cfg.Salt)}
+	for i, r := range cfg.Rules {
+		if len(r.Columns) == 0 && len(r.Detect) == 0 {
+			return nil, fmt.Errorf("masking rule %d: needs columns or detect", i+1)
+		}
+		if r.Strategy == "" {
+			r.Strategy = MaskRedact
+		}
+		switch r.Strategy {
+		case MaskRedact, MaskPartial, MaskHash, MaskFake:
+		default:
+			return nil, fmt.Errorf("masking rule %d: unknown strategy %q", i+1, r.Strategy)
+		}
+		for _, d := range r.Detect {
+			if _, ok := detectors[d]; !ok {
+				return nil, fmt.Errorf("masking rule %d: unknown detector %q", i+1, d)
+			}
+		}
+		for _, c := range r.Columns {
+			if !strings.Contains(c, ".") {
+				return nil, fmt.Errorf("masking rule %d: column pattern %q must have the form table.column", i+1, c)
+			}
+		}
+		if (r.Strategy == MaskHash || r.Strategy == MaskFake) && cfg.Salt == "" {
+			return nil, fmt.Errorf("masking rule %d: the %s strategy needs a salt", i+1, r.Strategy)
+		}
+		if r.Keep <= 0 {
+			r.Keep = 4
+		}
+		m.rules = append(m.rules, r)
+	}
+	return m, nil
+}
+
+// MaskRows masks the results of query in place and returns them. The tables
+// referenced by query are used to resolve table.column patterns.
+func (m *Masker) MaskRows(query string, rows []Row) []Row {
+	if m == nil || len(m.rules) == 0 {
+		return rows
+	}
+	mask := m.QueryMasker(query)
+	for _, row := range rows {
+		for col, val := range row {
+			row[col] = mask(col, val)
+		}
+	}
+	return rows
+}
+
+// QueryMasker returns a function masking single values of the results of
+// query, for callers that stream rows rather than collect them.
+//
+// Result columns are traced back to the table columns they are computed from,
+// so aliases and expressions such as lower(email) are masked like the column
+// they read. Columns that cannot be traced are masked by the first column rule
+// for any table the query reads.
+func (m *Masker) QueryMasker(query string) func(column string, val interface{}) interface{} {
+	if m == nil || len(m.rules) == 0 {
+		return func(_ string, val interface{}) interface{} { return val }
+	}
+	stmts := ParseStatements(query)
+	var mu sync.Mutex
+	rules := map[string]*MaskRule{}
+	return func(column string, val interface{}) interface{} {
+		mu.Lock()
+		r, ok := rules[column]
+		if !ok {
+			r = m.resultRule(stmts, column)
+			rules[column] = r
+		}
+		mu.Unlock()
+		return m.maskWith(r, val)
+	}
+}
+
+// resultRule returns the column rule masking the result column named column,
+// or nil if only the value detectors apply.
+func (m *Masker) resultRule(stmts []Statement, column string) *MaskRule {
+	for _, stmt := range stmts {
+		refs, ok := stmt.ColumnSources(column)
+		if !ok {
+			if r := m.tableRule(stmt.Tables); r != nil {
+				return r
+			}
+			continue
+		}
+		for _, ref := range refs {
+			table, name := stmt.ResolveColumn(ref)
+			tables := stmt.Tables
+			if slices.ContainsFunc(tables, func(t string) bool { return strings.EqualFold(t, table) }) {
+				tables = []string{table}
+			}
+			if r := m.columnRule(tables, name); r != nil {
+				return r
+			}
+		}
+	}
+	return nil
+}
+
+// tableRule returns the first column rule for any of tables.
+func (m *Masker) tableRule(tables []string) *MaskRule {
+	for i, r := range m.rules {
+		for _, pattern := range r.Columns {
+			tablePattern := pattern[:strings.LastIndex(pattern, ".")]
+			for _, t := range tables {
+				if matchName(tablePattern, t) {
+					return &m.rules[i]
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// MaskValue masks a single value read from table.column.
+func (m *Masker) MaskValue(table, column string, val interface{}) interface{} {
+	if m == nil {
+		return val
+	}
+	return m.maskWith(m.columnRule([]string{table}, column), val)
+}
+
+// MasksColumn reports whether a column rule masks the whole of table.column.
+func (m *Masker) MasksColumn(table, column string) bool {
+	if m == nil {
+		return false
+	}
+	return m.columnRule([]string{table}, column) != nil
+}
+
+// MaskColumns masks the default values shown in a table schema.
+func (m *Masker) MaskColumns(table string, columns []TableColumn) []TableColumn {
+	if m == nil {
+		return columns
+	}
+	for i, c := range columns {
+		if c.Default != nil {
+			columns[i].Default = m.MaskValue(table, c.Name, c.Default)
+		}
+	}
+	return columns
+}
+
+// columnRule returns the first column rule matching column of one of tables.
+func (m *Masker) columnRule(tables []string, column string) *MaskRule {
+	for i, r := range m.rules {
+		if r.matchesColumn(tables, column) {
+			return &m.rules[i]
+		}
+	}
+	return nil
+}
+
+// maskWith masks the whole of val with column rule r, or the parts of it the
+// value detectors find when r is nil.
+func (m *Masker) maskWith(r *MaskRule, val interface{}) interface{} {
+	if val == nil {
+		return nil
+	}
+	if r != nil {
+		return m.apply(*r, valueString(val))
+	}
+
+	s, ok := textValue(val)
+	if !ok {
+		return val
+	}
+	masked := s
+	for _, r := range m.rules {
+		for _, name := range r.Detect {
+			d := detectors[name]
+			masked = d.re.ReplaceAllStringFunc(masked, func(match string) string {
+				if d.valid != nil && !d.valid(match) {
+					return match
+				}
+				return m.apply(r, match)
+			})
+		}
+	}
+	if masked == s {
+		return val
+	}
+	return masked
+}
+
+func (r MaskRule) matchesColumn(tables []string, column string) bool {
+	for _, pattern := range r.Columns {
+		i := strings.LastIndex(pattern, ".")
+		tablePattern, columnPattern := pattern[:i], pattern[i+1:]
+		if !matchName(columnPattern, column) {
+			continue
+		}
+		if tablePattern == "*" {
+			return true
+		}
+		for _, t := range tables {
+			if matchName(tablePattern, t) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (m *Masker) apply(r MaskRule, s string) string {
+	switch r.Strategy {
+	case MaskPartial:
+		return partialMask(s, r.Keep)
+	case MaskHash:
+		return hex.EncodeToString(m.mac(s)[:8])
+	case MaskFake:
+		return m.fake(s)
+	default:
+		return Redacted
+	}
+}
+
+func (m *Masker) mac(s string) []byte {
+	h := hmac.New(sha256.New, m.salt)
+	h.Write([]byte(s))
+	return h.Sum(nil)
+}
+
+// fake replaces every letter and digit with one derived from a keyed hash of
+// the whole value, keeping case, length and separators.
+func (m *Masker) fake(s string) string {
+	seed := m.mac(s)
+	var b strings.Builder
+	i := 0
+	next := func(n int) int {
+		if i%len(seed) == 0 && i > 0 {
+			seed = m.mac(string(seed))
+		}
+		v := int(seed[i%len(seed)]) % n
+		i++
+		return v
+	}
+	for _, c := range s {
+		switch {
+		case c >= '0' && c <= '9':
+			b.WriteRune(rune('0' + next(10)))
+		case unicode.IsUpper(c):
+			b.WriteRune(rune('A' + next(26)))
+		case unicode.IsLetter(c):
+			b.WriteRune(rune('a' + next(26)))
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// partialMask hides all letters and digits except the last keep characters.
+// For email addresses the domain stays visible along with the first character
+// of the local part.
+func partialMask(s string, keep int) string {
+	if at := strings.LastIndex(s, "@"); at > 0 {
+		local := []rune(s[:at])
+		return string(local[0]) + strings.Repeat("*", len(local)-1) + s[at:]
+	}
+	r := []rune(s)
+	for i := 0; i < len(r)-keep; i++ {
+		if unicode.IsLetter(r[i]) || unicode.IsDigit(r[i]) {
+			r[i] = '*'
+		}
+	}
+	return string(r)
+}
+
+func valueString(val interface{}) string {
+	if s, ok := textValue(val); ok {
+		return s
+	}
+	return fmt.Sprint(val)
+}
+
+func textValue(val interface{}) (string, bool) {
+	switch v := val.(type) {
+	case string:
+		return v, true
+	case []byte:
+		if utf8.Valid(v) {
+			return string(v), true
+		}
+	}
+	return "", false
+}
+
+func digitsOf(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+// luhnValid reports whether s holds 13 to 19 digits passing the Luhn check.
+func luhnValid(s string) bool {
+	digits := digitsOf(s)
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+	sum := 0
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if (len(digits)-i)%2 == 0 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+// ibanValid reports whether s is an IBAN with a valid mod-97 checksum.
+func ibanValid(s string) bool {
+	s = strings.ReplaceAll(s, " ", "")
+	if len(s) < 15 || len(s) > 34 {
+		return false
+	}
+	var b strings.Builder
+	for _, c := range s[4:] + s[:4] {
+		switch {
+		case c >= '0' && c <= '9':
+			b.WriteRune(c)
+		case c >= 'A' && c <= 'Z':
+			fmt.Fprintf(&b, "%d", c-'A'+10)
+		default:
+			return false
+		}
+	}
+	n, ok := new(big.Int).SetString(b.String(), 10)
+	return ok && new(big.Int).Mod(n, big.NewInt(97)).Int64() == 1
+}
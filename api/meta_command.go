@@ -0,0 +1,366 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/xo/dburl"
+	"github.com/xo/usql/drivers"
+	"github.com/xo/usql/drivers/metadata"
+)
+
+// MetaCommand is a parsed usql backslash meta-command, such as \dt+ public.*.
+type MetaCommand struct {
+	// Name is the command without the backslash and modifiers, e.g. "dt".
+	Name    string
+	Pattern string
+	// Verbose is set by the + modifier and System by the S modifier.
+	Verbose bool
+	System  bool
+}
+
+// MetaCommands describes the meta-commands RunMetaCommand supports.
+var MetaCommands = map[string]string{
+	"d":  "describe tables, views and sequences matching the pattern; without a pattern, list them",
+	"dt": "list tables",
+	"dv": "list views",
+	"dm": "list materialized views",
+	"ds": "list sequences",
+	"di": "list indexes",
+	"df": "list functions",
+	"dn": "list schemas",
+	"l":  "list databases",
+}
+
+// relationTypes are the metadata table types listed by each command.
+var relationTypes = map[string][]string{
+	"dt": {"TABLE", "BASE TABLE", "SYSTEM TABLE", "SYNONYM", "LOCAL TEMPORARY", "GLOBAL TEMPORARY"},
+	"dv": {"VIEW", "SYSTEM VIEW"},
+	"dm": {"MATERIALIZED VIEW"},
+	"ds": {"SEQUENCE"},
+}
+
+func init() {
+	for _, cmd := range []string{"dt", "dv", "dm", "ds"} {
+		relationTypes["d"] = append(relationTypes["d"], relationTypes[cmd]...)
+	}
+}
+
+// ParseMetaCommand parses a meta-command and its optional pattern argument.
+// Only the commands in MetaCommands are accepted.
+func ParseMetaCommand(s string) (MetaCommand, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, `\`) {
+		return MetaCommand{}, fmt.Errorf("meta-command must start with a backslash: %q", s)
+	}
+	fields := strings.Fields(s[1:])
+	if len(fields) == 0 {
+		return MetaCommand{}, fmt.Errorf("empty meta-command")
+	}
+
+	var cmd MetaCommand
+	name := fields[0]
+	for len(name) > 1 && strings.ContainsAny(name[len(name)-1:], "+S") {
+		if name[len(name)-1] == '+' {
+			cmd.Verbose = true
+		} else {
+			cmd.System = true
+		}
+		name = name[:len(name)-1]
+	}
+	cmd.Name = name
+
+	if name == "copy" {
+		return MetaCommand{}, fmt.Errorf(`\copy is not supported, use the copy_data tool to copy rows between connections`)
+	}
+	if _, ok := MetaCommands[name]; !ok {
+		supported := make([]string, 0, len(MetaCommands))
+		for n := range MetaCommands {
+			supported = append(supported, `\`+n)
+		}
+		sort.Strings(supported)
+		return MetaCommand{}, fmt.Errorf(`unsupported meta-command \%s, supported: %s`, name, strings.Join(supported, " "))
+	}
+	if len(fields) > 2 {
+		return MetaCommand{}, fmt.Errorf(`too many arguments to \%s`, fields[0])
+	}
+	if len(fields) == 2 {
+		cmd.Pattern = fields[1]
+	}
+	return cmd, nil
+}
+
+// MetaCatalog is a database listed by \l.
+type MetaCatalog struct {
+	Name string `json:"name"`
+}
+
+// MetaSchema is a schema listed by \dn.
+type MetaSchema struct {
+	Catalog string `json:"catalog,omitempty"`
+	Name    string `json:"name"`
+}
+
+// MetaRelation is a table, view or sequence. Columns and indexes are only
+// filled in when it is described with \d and a pattern.
+type MetaRelation struct {
+	Catalog string       `json:"catalog,omitempty"`
+	Schema  string       `json:"schema,omitempty"`
+	Name    string       `json:"name"`
+	Type    string       `json:"type"`
+	Rows    int64        `json:"rows,omitempty"`
+	Size    string       `json:"size,omitempty"`
+	Comment string       `json:"comment,omitempty"`
+	Columns []MetaColumn `json:"columns,omitempty"`
+	Indexes []MetaIndex  `json:"indexes,omitempty"`
+}
+
+// MetaColumn is a column of a described relation.
+type MetaColumn struct {
+	Name          string      `json:"name"`
+	Type          string      `json:"type"`
+	Nullable      bool        `json:"nullable"`
+	Default       interface{} `json:"default"`
+	AutoIncrement bool        `json:"auto_increment,omitempty"`
+}
+
+// MetaIndex is an index listed by \di or of a described relation.
+type MetaIndex struct {
+	Schema  string `json:"schema,omitempty"`
+	Table   string `json:"table"`
+	Name    string `json:"name"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary"`
+	Unique  bool   `json:"unique"`
+	Columns string `json:"columns"`
+}
+
+// MetaFunction is a function listed by \df.
+type MetaFunction struct {
+	Schema     string `json:"schema,omitempty"`
+	Name       string `json:"name"`
+	ResultType string `json:"result_type"`
+	ArgTypes   string `json:"arg_types"`
+	Type       string `json:"type"`
+	Volatility string `json:"volatility,omitempty"`
+}
+
+// MetaCommandContext runs a meta-command on db using usql's metadata reader
+// for the DSN's driver.
+func MetaCommandContext(ctx context.Context, db *sql.DB, dsn, command string) (interface{}, error) {
+	cmd, err := ParseMetaCommand(command)
+	if err != nil {
+		return nil, err
+	}
+	u, err := dburl.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse DSN: %w", err)
+	}
+	reader, err := drivers.NewMetadataReader(ctx, u, db, io.Discard)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create metadata reader: %w", err)
+	}
+	if reader == nil {
+		return nil, fmt.Errorf("driver %s does not provide metadata", u.Driver)
+	}
+	return RunMetaCommand(reader, cmd)
+}
+
+// RunMetaCommand runs cmd against a usql metadata reader and returns its
+// result as a slice of MetaCatalog, MetaSchema, MetaRelation, MetaIndex or
+// MetaFunction.
+func RunMetaCommand(r metadata.Reader, cmd MetaCommand) (interface{}, error) {
+	schema, name := parseMetaPattern(cmd.Pattern)
+	filter := metadata.Filter{
+		Schema:      schema,
+		Name:        name,
+		WithSystem:  cmd.System,
+		OnlyVisible: schema == "",
+	}
+	unsupported := fmt.Errorf(`\%s is not supported by this driver`, cmd.Name)
+
+	switch cmd.Name {
+	case "l":
+		cr, ok := r.(metadata.CatalogReader)
+		if !ok {
+			return nil, unsupported
+		}
+		set, err := cr.Catalogs(metadata.Filter{Name: name, WithSystem: cmd.System})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list databases: %w", err)
+		}
+		defer set.Close()
+		results := []MetaCatalog{}
+		for set.Next() {
+			results = append(results, MetaCatalog{Name: set.Get().Catalog})
+		}
+		return results, nil
+
+	case "dn":
+		sr, ok := r.(metadata.SchemaReader)
+		if !ok {
+			return nil, unsupported
+		}
+		// A schema pattern has no qualifier, so it is parsed as the name.
+		set, err := sr.Schemas(metadata.Filter{Name: name, WithSystem: cmd.System})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list schemas: %w", err)
+		}
+		defer set.Close()
+		results := []MetaSchema{}
+		for set.Next() {
+			s := set.Get()
+			results = append(results, MetaSchema{Catalog: s.Catalog, Name: s.Schema})
+		}
+		return results, nil
+
+	case "di":
+		ir, ok := r.(metadata.IndexReader)
+		if !ok {
+			return nil, unsupported
+		}
+		return readIndexes(ir, filter)
+
+	case "df":
+		fr, ok := r.(metadata.FunctionReader)
+		if !ok {
+			return nil, unsupported
+		}
+		set, err := fr.Functions(filter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list functions: %w", err)
+		}
+		defer set.Close()
+		results := []MetaFunction{}
+		for set.Next() {
+			f := set.Get()
+			results = append(results, MetaFunction{
+				Schema:     f.Schema,
+				Name:       f.Name,
+				ResultType: f.ResultType,
+				ArgTypes:   f.ArgTypes,
+				Type:       f.Type,
+				Volatility: f.Volatility,
+			})
+		}
+		return results, nil
+	}
+
+	tr, ok := r.(metadata.TableReader)
+	if !ok {
+		return nil, unsupported
+	}
+	filter.Types = relationTypes[cmd.Name]
+	set, err := tr.Tables(filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list relations: %w", err)
+	}
+	defer set.Close()
+	results := []MetaRelation{}
+	for set.Next() {
+		t := set.Get()
+		rel := MetaRelation{Catalog: t.Catalog, Schema: t.Schema, Name: t.Name, Type: t.Type}
+		if cmd.Verbose {
+			rel.Rows, rel.Size, rel.Comment = t.Rows, t.Size, t.Comment
+		}
+		results = append(results, rel)
+	}
+
+	if cmd.Name != "d" || cmd.Pattern == "" {
+		return results, nil
+	}
+	for i := range results {
+		if err := describeRelation(r, &results[i]); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// describeRelation fills in the columns and indexes of rel, as far as the
+// reader supports them.
+func describeRelation(r metadata.Reader, rel *MetaRelation) error {
+	filter := metadata.Filter{Catalog: rel.Catalog, Schema: rel.Schema, Parent: rel.Name, WithSystem: true}
+	if cr, ok := r.(metadata.ColumnReader); ok {
+		set, err := cr.Columns(filter)
+		if err != nil {
+			return fmt.Errorf("failed to read columns of %s: %w", rel.Name, err)
+		}
+		defer set.Close()
+		for set.Next() {
+			c := set.Get()
+			col := MetaColumn{
+				Name:          c.Name,
+				Type:          c.DataType,
+				Nullable:      c.IsNullable == metadata.YES,
+				AutoIncrement: c.IsAutoIncrement == metadata.YES,
+			}
+			if c.Default != "" {
+				col.Default = c.Default
+			}
+			rel.Columns = append(rel.Columns, col)
+		}
+	}
+	if ir, ok := r.(metadata.IndexReader); ok {
+		indexes, err := readIndexes(ir, filter)
+		if err != nil {
+			return err
+		}
+		rel.Indexes = indexes
+	}
+	return nil
+}
+
+func readIndexes(ir metadata.IndexReader, filter metadata.Filter) ([]MetaIndex, error) {
+	set, err := ir.Indexes(filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list indexes: %w", err)
+	}
+	defer set.Close()
+	results := []MetaIndex{}
+	for set.Next() {
+		idx := set.Get()
+		results = append(results, MetaIndex{
+			Schema:  idx.Schema,
+			Table:   idx.Table,
+			Name:    idx.Name,
+			Type:    idx.Type,
+			Primary: idx.IsPrimary == metadata.YES,
+			Unique:  idx.IsUnique == metadata.YES,
+			Columns: idx.Columns,
+		})
+	}
+	return results, nil
+}
+
+// parseMetaPattern splits a psql-style pattern such as public.user* into
+// schema and name LIKE patterns. Double-quoted parts are taken literally.
+func parseMetaPattern(pattern string) (schema, name string) {
+	var parts []string
+	var b strings.Builder
+	quoted := false
+	for _, c := range pattern {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == '.' && !quoted:
+			parts = append(parts, b.String())
+			b.Reset()
+		case c == '*' && !quoted:
+			b.WriteByte('%')
+		case c == '?' && !quoted:
+			b.WriteByte('_')
+		default:
+			b.WriteRune(c)
+		}
+	}
+	parts = append(parts, b.String())
+	if len(parts) == 1 {
+		return "", parts[0]
+	}
+	return parts[len(parts)-2], parts[len(parts)-1]
+}
@@ -0,0 +1,93 @@
+package api_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thesoulless/usqlmcp/api"
+	"github.com/xo/usql/drivers/metadata"
+)
+
+func TestParseMetaCommand(t *testing.T) {
+	tests := []struct {
+		in   string
+		want api.MetaCommand
+	}{
+		{`\dt`, api.MetaCommand{Name: "dt"}},
+		{` \dtS+ public.* `, api.MetaCommand{Name: "dt", Pattern: "public.*", Verbose: true, System: true}},
+		{`\d users`, api.MetaCommand{Name: "d", Pattern: "users"}},
+		{`\ds`, api.MetaCommand{Name: "ds"}},
+		{`\l+`, api.MetaCommand{Name: "l", Verbose: true}},
+	}
+	for _, tt := range tests {
+		got, err := api.ParseMetaCommand(tt.in)
+		require.NoError(t, err, tt.in)
+		assert.Equal(t, tt.want, got, tt.in)
+	}
+
+	for in, want := range map[string]string{
+		`dt`:             "must start with a backslash",
+		`\`:              "empty meta-command",
+		`\copy t to 'x'`: `use the copy_data tool`,
+		`\dt a b`:        `too many arguments to \dt`,
+		`\! rm -rf /`:    `unsupported meta-command \!`,
+		`\o out.txt`:     `unsupported meta-command \o`,
+	} {
+		_, err := api.ParseMetaCommand(in)
+		assert.ErrorContains(t, err, want, in)
+	}
+}
+
+// fakeReader is a metadata reader over fixed tables.
+type fakeReader struct {
+	filters []metadata.Filter
+}
+
+func (r *fakeReader) Tables(f metadata.Filter) (*metadata.TableSet, error) {
+	r.filters = append(r.filters, f)
+	return metadata.NewTableSet([]metadata.Table{
+		{Schema: "public", Name: "users", Type: "TABLE", Rows: 2, Size: "8 kB"},
+	}), nil
+}
+
+func (r *fakeReader) Columns(f metadata.Filter) (*metadata.ColumnSet, error) {
+	r.filters = append(r.filters, f)
+	return metadata.NewColumnSet([]metadata.Column{
+		{Table: "users", Name: "id", DataType: "integer", IsNullable: metadata.NO, IsAutoIncrement: metadata.YES},
+		{Table: "users", Name: "email", DataType: "text", IsNullable: metadata.YES, Default: "'x@example.com'"},
+	}), nil
+}
+
+func (r *fakeReader) Indexes(f metadata.Filter) (*metadata.IndexSet, error) {
+	r.filters = append(r.filters, f)
+	return metadata.NewIndexSet([]metadata.Index{
+		{Schema: "public", Table: "users", Name: "users_pkey", IsPrimary: metadata.YES, IsUnique: metadata.YES, Columns: "id"},
+	}), nil
+}
+
+func TestRunMetaCommand(t *testing.T) {
+	r := &fakeReader{}
+	result, err := api.RunMetaCommand(r, api.MetaCommand{Name: "dt", Pattern: "public.us?r*", Verbose: true})
+	require.NoError(t, err)
+	assert.Equal(t, []api.MetaRelation{{Schema: "public", Name: "users", Type: "TABLE", Rows: 2, Size: "8 kB"}}, result)
+	assert.Equal(t, "public", r.filters[0].Schema)
+	assert.Equal(t, "us_r%", r.filters[0].Name)
+	assert.Contains(t, r.filters[0].Types, "BASE TABLE")
+	assert.NotContains(t, r.filters[0].Types, "VIEW")
+
+	result, err = api.RunMetaCommand(r, api.MetaCommand{Name: "d", Pattern: "users"})
+	require.NoError(t, err)
+	rels := result.([]api.MetaRelation)
+	require.Len(t, rels, 1)
+	assert.Zero(t, rels[0].Rows)
+	assert.Equal(t, []api.MetaColumn{
+		{Name: "id", Type: "integer", AutoIncrement: true},
+		{Name: "email", Type: "text", Nullable: true, Default: "'x@example.com'"},
+	}, rels[0].Columns)
+	assert.Equal(t, []api.MetaIndex{{Schema: "public", Table: "users", Name: "users_pkey", Primary: true, Unique: true, Columns: "id"}}, rels[0].Indexes)
+	assert.Equal(t, "users", r.filters[len(r.filters)-1].Parent)
+
+	_, err = api.RunMetaCommand(r, api.MetaCommand{Name: "df"})
+	assert.EqualError(t, err, `\df is not supported by this driver`)
+}
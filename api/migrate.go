@@ -0,0 +1,496 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MigrationsTable is the table that records applied migrations.
+const MigrationsTable = "usqlmcp_migrations"
+
+// Migration states reported by MigrationStatus.
+const (
+	MigrationApplied  = "applied"
+	MigrationPending  = "pending"
+	MigrationModified = "modified"
+	MigrationMissing  = "missing"
+)
+
+// Migration is a pair of numbered SQL files in a migrations directory:
+// 0001_create_users.up.sql and, optionally, 0001_create_users.down.sql.
+type Migration struct {
+	Version int64  `json:"version"`
+	Name    string `json:"name"`
+	Up      string `json:"up"`
+	Down    string `json:"down,omitempty"`
+	// Checksum is the SHA-256 of the up file, recorded when it is applied
+	// so that later edits are detected.
+	Checksum string `json:"checksum"`
+}
+
+// MigrationState is a migration and whether it has been applied.
+type MigrationState struct {
+	Version   int64      `json:"version"`
+	Name      string     `json:"name"`
+	State     string     `json:"state"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+// MigrateOptions controls ApplyMigrations and RollbackMigrations.
+type MigrateOptions struct {
+	// Target is the version to migrate up to, or down to (exclusive of
+	// later versions). Zero applies every pending migration.
+	Target int64
+	// Steps is the number of migrations to roll back when Target is not
+	// set. It defaults to one.
+	Steps int
+	// Check, if set, is called with the SQL of every migration about to
+	// run before any of them runs. An error stops the migration.
+	Check func(sql string) error
+	// Progress, if set, is called before each migration runs.
+	Progress func(done, total int, m Migration)
+}
+
+// MigrateResult lists the migrations that were run.
+type MigrateResult struct {
+	Applied    []MigrationState `json:"applied,omitempty"`
+	RolledBack []MigrationState `json:"rolled_back,omitempty"`
+	// Transactional is set when each migration ran in its own transaction.
+	// Otherwise a failed migration may be left partly applied.
+	Transactional bool `json:"transactional"`
+}
+
+var migrationFile = regexp.MustCompile(`^(\d+)_([^.]+)\.(up|down)\.sql$`)
+
+// LoadMigrations reads the migrations in dir, ordered by version. Files that
+// do not follow the naming scheme are ignored.
+func LoadMigrations(dir string) ([]Migration, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations directory: %w", err)
+	}
+	byVersion := map[int64]*Migration{}
+	for _, e := range entries {
+		m := migrationFile.FindStringSubmatch(e.Name())
+		if m == nil || e.IsDir() {
+			continue
+		}
+		version, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %s: %w", e.Name(), err)
+		}
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration version %d is used by both %s and %s", version, mig.Name, m[2])
+		}
+		path := filepath.Join(dir, e.Name())
+		if m[3] == "up" {
+			mig.Up = path
+		} else {
+			mig.Down = path
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", mig.Version, mig.Name)
+		}
+		data, err := os.ReadFile(mig.Up)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration: %w", err)
+		}
+		sum := sha256.Sum256(data)
+		mig.Checksum = hex.EncodeToString(sum[:])
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+var migrationName = regexp.MustCompile(`[^a-z0-9]+`)
+
+// CreateMigration writes a new migration with the next version number to
+// dir, without running it. Versions are zero-padded to four digits.
+func CreateMigration(dir, name, up, down string) (Migration, error) {
+	slug := strings.Trim(migrationName.ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if slug == "" {
+		return Migration{}, errors.New("migration name must contain letters or digits")
+	}
+	if strings.TrimSpace(up) == "" {
+		return Migration{}, errors.New("up migration must not be empty")
+	}
+	existing, err := LoadMigrations(dir)
+	if err != nil {
+		return Migration{}, err
+	}
+	var version int64 = 1
+	if n := len(existing); n > 0 {
+		version = existing[n-1].Version + 1
+	}
+
+	base := filepath.Join(dir, fmt.Sprintf("%04d_%s", version, slug))
+	m := Migration{Version: version, Name: slug, Up: base + ".up.sql"}
+	if err := writeNewFile(m.Up, up); err != nil {
+		return Migration{}, err
+	}
+	if strings.TrimSpace(down) != "" {
+		m.Down = base + ".down.sql"
+		if err := writeNewFile(m.Down, down); err != nil {
+			return Migration{}, err
+		}
+	}
+	sum := sha256.Sum256([]byte(ensureNewline(up)))
+	m.Checksum = hex.EncodeToString(sum[:])
+	return m, nil
+}
+
+func writeNewFile(path, content string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to create migration: %w", err)
+	}
+	if _, err := f.WriteString(ensureNewline(content)); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write migration: %w", err)
+	}
+	return f.Close()
+}
+
+func ensureNewline(s string) string {
+	if !strings.HasSuffix(s, "\n") {
+		return s + "\n"
+	}
+	return s
+}
+
+// TransactionalDDL reports whether schema changes can be rolled back as
+// part of a transaction.
+func (d Dialect) TransactionalDDL() bool {
+	switch d.system() {
+	case "postgresql", "sqlite", "mssql", "duckdb":
+		return true
+	default:
+		return false
+	}
+}
+
+// appliedMigration is a row of the migrations table.
+type appliedMigration struct {
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+// ensureMigrationsTable creates the migrations table if it does not exist.
+func ensureMigrationsTable(ctx context.Context, db *sql.DB, d Dialect) error {
+	exists, err := tableExists(ctx, db, d, MigrationsTable)
+	if err != nil || exists {
+		return err
+	}
+	key := " NOT NULL PRIMARY KEY"
+	if d.system() == "clickhouse" {
+		// The ORDER BY clause createTableStatement adds is the key.
+		key = ""
+	}
+	stmt := createTableStatement(d, MigrationsTable, []string{
+		d.QuoteIdent("version") + " " + d.typeFor(kindInteger) + key,
+		d.QuoteIdent("name") + " " + d.typeFor(kindText),
+		d.QuoteIdent("checksum") + " " + d.typeFor(kindText),
+		d.QuoteIdent("applied_at") + " " + d.typeFor(kindTimestamp),
+	})
+	if _, err := db.ExecContext(ctx, stmt); err != nil {
+		return fmt.Errorf("failed to create migrations table: %w", err)
+	}
+	return nil
+}
+
+// appliedMigrations returns the applied migrations by version. A missing
+// migrations table means that none were applied.
+func appliedMigrations(ctx context.Context, db *sql.DB, d Dialect) (map[int64]appliedMigration, error) {
+	applied := map[int64]appliedMigration{}
+	if exists, err := tableExists(ctx, db, d, MigrationsTable); err != nil || !exists {
+		return applied, err
+	}
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("SELECT %s, %s, %s, %s FROM %s",
+		d.QuoteIdent("version"), d.QuoteIdent("name"), d.QuoteIdent("checksum"), d.QuoteIdent("applied_at"), d.QuoteIdent(MigrationsTable)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations table: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version, appliedAt interface{}
+		var a appliedMigration
+		if err := rows.Scan(&version, &a.name, &a.checksum, &appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan migrations table: %w", err)
+		}
+		v, _ := intValue(version)
+		a.appliedAt = migrationTime(appliedAt)
+		applied[v] = a
+	}
+	return applied, rows.Err()
+}
+
+// migrationTime converts a scanned applied_at value, which drivers without
+// a native timestamp type return as text.
+func migrationTime(v interface{}) time.Time {
+	switch v := v.(type) {
+	case time.Time:
+		return v
+	case []byte:
+		return migrationTime(string(v))
+	case string:
+		t, _ := parseTime(v, timestampLayouts)
+		return t
+	}
+	return time.Time{}
+}
+
+// MigrationStatus returns the state of every migration in dir and of applied
+// migrations whose files are gone, ordered by version.
+func MigrationStatus(ctx context.Context, db *sql.DB, driver, dir string) ([]MigrationState, error) {
+	migrations, err := LoadMigrations(dir)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(ctx, db, DialectFor(driver))
+	if err != nil {
+		return nil, err
+	}
+	return migrationStates(migrations, applied), nil
+}
+
+func migrationStates(migrations []Migration, applied map[int64]appliedMigration) []MigrationState {
+	states := []MigrationState{}
+	for _, m := range migrations {
+		s := MigrationState{Version: m.Version, Name: m.Name, State: MigrationPending}
+		if a, ok := applied[m.Version]; ok {
+			s.State = MigrationApplied
+			if a.checksum != m.Checksum {
+				s.State = MigrationModified
+			}
+			t := a.appliedAt
+			s.AppliedAt = &t
+		}
+		states = append(states, s)
+	}
+	for v, a := range applied {
+		if !containsVersion(migrations, v) {
+			t := a.appliedAt
+			states = append(states, MigrationState{Version: v, Name: a.name, State: MigrationMissing, AppliedAt: &t})
+		}
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Version < states[j].Version })
+	return states
+}
+
+func containsVersion(migrations []Migration, v int64) bool {
+	for _, m := range migrations {
+		if m.Version == v {
+			return true
+		}
+	}
+	return false
+}
+
+// ApplyMigrations runs the pending migrations in dir up to opts.Target, in
+// order. It refuses to run when an applied migration was edited since.
+// Where the dialect has transactional DDL, each migration and its record in
+// the migrations table are committed together.
+func ApplyMigrations(ctx context.Context, db *sql.DB, driver, dir string, opts MigrateOptions) (MigrateResult, error) {
+	d := DialectFor(driver)
+	result := MigrateResult{Transactional: d.TransactionalDDL()}
+	migrations, err := LoadMigrations(dir)
+	if err != nil {
+		return result, err
+	}
+	if err := ensureMigrationsTable(ctx, db, d); err != nil {
+		return result, err
+	}
+	applied, err := appliedMigrations(ctx, db, d)
+	if err != nil {
+		return result, err
+	}
+
+	var pending []Migration
+	var modified []string
+	for _, m := range migrations {
+		a, ok := applied[m.Version]
+		switch {
+		case ok && a.checksum != m.Checksum:
+			modified = append(modified, fmt.Sprintf("%d_%s", m.Version, m.Name))
+		case !ok && (opts.Target == 0 || m.Version <= opts.Target):
+			pending = append(pending, m)
+		}
+	}
+	if len(modified) > 0 {
+		return result, fmt.Errorf("applied migrations were modified: %s", strings.Join(modified, ", "))
+	}
+	for _, m := range pending {
+		if err := checkMigration(m.Up, opts.Check); err != nil {
+			return result, fmt.Errorf("migration %d_%s: %w", m.Version, m.Name, err)
+		}
+	}
+
+	for i, m := range pending {
+		if opts.Progress != nil {
+			opts.Progress(i, len(pending), m)
+		}
+		record := fmt.Sprintf("INSERT INTO %s (%s, %s, %s, %s) VALUES (%s, %s, %s, %s)", d.QuoteIdent(MigrationsTable),
+			d.QuoteIdent("version"), d.QuoteIdent("name"), d.QuoteIdent("checksum"), d.QuoteIdent("applied_at"),
+			d.Placeholder(1), d.Placeholder(2), d.Placeholder(3), d.Placeholder(4))
+		now := time.Now().UTC()
+		if err := runMigration(ctx, db, d, m.Up, record, m.Version, m.Name, m.Checksum, now); err != nil {
+			return result, fmt.Errorf("migration %d_%s failed: %w", m.Version, m.Name, err)
+		}
+		result.Applied = append(result.Applied, MigrationState{Version: m.Version, Name: m.Name, State: MigrationApplied, AppliedAt: &now})
+	}
+	return result, nil
+}
+
+// RollbackMigrations runs the down files of the latest applied migrations:
+// those after opts.Target, or the last opts.Steps of them.
+func RollbackMigrations(ctx context.Context, db *sql.DB, driver, dir string, opts MigrateOptions) (MigrateResult, error) {
+	d := DialectFor(driver)
+	result := MigrateResult{Transactional: d.TransactionalDDL()}
+	migrations, err := LoadMigrations(dir)
+	if err != nil {
+		return result, err
+	}
+	applied, err := appliedMigrations(ctx, db, d)
+	if err != nil {
+		return result, err
+	}
+
+	versions := make([]int64, 0, len(applied))
+	for v := range applied {
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] > versions[j] })
+	if opts.Target > 0 {
+		n := 0
+		for n < len(versions) && versions[n] > opts.Target {
+			n++
+		}
+		versions = versions[:n]
+	} else {
+		steps := opts.Steps
+		if steps <= 0 {
+			steps = 1
+		}
+		if steps < len(versions) {
+			versions = versions[:steps]
+		}
+	}
+
+	byVersion := map[int64]Migration{}
+	for _, m := range migrations {
+		byVersion[m.Version] = m
+	}
+	for _, v := range versions {
+		m, ok := byVersion[v]
+		if !ok {
+			return result, fmt.Errorf("applied migration %d_%s has no files", v, applied[v].name)
+		}
+		if m.Down == "" {
+			return result, fmt.Errorf("migration %d_%s has no down file", v, m.Name)
+		}
+		if err := checkMigration(m.Down, opts.Check); err != nil {
+			return result, fmt.Errorf("migration %d_%s: %w", v, m.Name, err)
+		}
+	}
+	for i, v := range versions {
+		m := byVersion[v]
+		if opts.Progress != nil {
+			opts.Progress(i, len(versions), m)
+		}
+		record := fmt.Sprintf("DELETE FROM %s WHERE %s = %s", d.QuoteIdent(MigrationsTable), d.QuoteIdent("version"), d.Placeholder(1))
+		if err := runMigration(ctx, db, d, m.Down, record, v); err != nil {
+			return result, fmt.Errorf("rollback of %d_%s failed: %w", v, m.Name, err)
+		}
+		result.RolledBack = append(result.RolledBack, MigrationState{Version: v, Name: m.Name, State: MigrationPending})
+	}
+	return result, nil
+}
+
+// checkMigration passes the SQL of file to check, if set.
+func checkMigration(file string, check func(string) error) error {
+	if check == nil {
+		return nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to read migration: %w", err)
+	}
+	return check(string(data))
+}
+
+// runMigration executes the statements of file followed by record, which
+// updates the migrations table, on one connection and in one transaction if
+// the dialect allows. Each statement gets its own span.
+func runMigration(ctx context.Context, db *sql.DB, d Dialect, file, record string, args ...interface{}) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to read migration: %w", err)
+	}
+	stmts := append(d.SplitScript(string(data)), record)
+
+	// Session state such as SET search_path must carry over between
+	// statements, so they all run on the same connection.
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	var exec execQuerier = conn
+	var tx *sql.Tx
+	if d.TransactionalDDL() {
+		if tx, err = conn.BeginTx(ctx, nil); err != nil {
+			return fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		defer tx.Rollback()
+		exec = tx
+	}
+	for i, stmt := range stmts {
+		var stmtArgs []interface{}
+		if i == len(stmts)-1 {
+			stmtArgs = args
+		}
+		if err := execMigrationStatement(ctx, exec, stmt, stmtArgs); err != nil {
+			return err
+		}
+	}
+	if tx != nil {
+		return tx.Commit()
+	}
+	return nil
+}
+
+// execMigrationStatement executes one statement of a migration in a span.
+func execMigrationStatement(ctx context.Context, exec execQuerier, stmt string, args []interface{}) (err error) {
+	ctx, span := startStatementSpan(ctx, "migrate", stmt)
+	var rows int64
+	defer func() { endStatementSpan(ctx, span, rows, err) }()
+
+	res, err := exec.ExecContext(ctx, stmt, args...)
+	if err != nil {
+		return err
+	}
+	rows, _ = res.RowsAffected()
+	return nil
+}
@@ -0,0 +1,135 @@
+package api_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thesoulless/usqlmcp/api"
+)
+
+func writeMigration(t *testing.T, dir, name, sql string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(sql), 0o644))
+}
+
+func migrationStates(t *testing.T, states []api.MigrationState) map[int64]string {
+	t.Helper()
+	byVersion := map[int64]string{}
+	for _, s := range states {
+		byVersion[s.Version] = s.State
+	}
+	return byVersion
+}
+
+func TestMigrations(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	dir := t.TempDir()
+
+	writeMigration(t, dir, "0001_create_users.up.sql", "CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT);\nINSERT INTO users VALUES (1, 'a;b');")
+	writeMigration(t, dir, "0001_create_users.down.sql", "DROP TABLE users;")
+	writeMigration(t, dir, "0002_add_email.up.sql", "ALTER TABLE users ADD COLUMN email TEXT;")
+	writeMigration(t, dir, "0002_add_email.down.sql", "ALTER TABLE users DROP COLUMN email;")
+	writeMigration(t, dir, "README.md", "not a migration")
+
+	states, err := api.MigrationStatus(ctx, db, "sqlite3", dir)
+	require.NoError(t, err)
+	assert.Equal(t, map[int64]string{1: api.MigrationPending, 2: api.MigrationPending}, migrationStates(t, states))
+
+	result, err := api.ApplyMigrations(ctx, db, "sqlite3", dir, api.MigrateOptions{Target: 1})
+	require.NoError(t, err)
+	assert.True(t, result.Transactional)
+	require.Len(t, result.Applied, 1)
+	assert.Equal(t, "create_users", result.Applied[0].Name)
+
+	var progress []int64
+	result, err = api.ApplyMigrations(ctx, db, "sqlite3", dir, api.MigrateOptions{
+		Progress: func(done, total int, m api.Migration) { progress = append(progress, m.Version) },
+	})
+	require.NoError(t, err)
+	require.Len(t, result.Applied, 1)
+	assert.Equal(t, []int64{2}, progress)
+
+	var email interface{}
+	require.NoError(t, db.QueryRow(`SELECT email FROM users WHERE name = 'a;b'`).Scan(&email))
+
+	states, err = api.MigrationStatus(ctx, db, "sqlite3", dir)
+	require.NoError(t, err)
+	assert.Equal(t, map[int64]string{1: api.MigrationApplied, 2: api.MigrationApplied}, migrationStates(t, states))
+	assert.NotNil(t, states[0].AppliedAt)
+
+	// Editing an applied migration is detected and blocks further runs.
+	writeMigration(t, dir, "0002_add_email.up.sql", "ALTER TABLE users ADD COLUMN mail TEXT;")
+	states, err = api.MigrationStatus(ctx, db, "sqlite3", dir)
+	require.NoError(t, err)
+	assert.Equal(t, api.MigrationModified, states[1].State)
+	_, err = api.ApplyMigrations(ctx, db, "sqlite3", dir, api.MigrateOptions{})
+	assert.ErrorContains(t, err, "applied migrations were modified: 2_add_email")
+	writeMigration(t, dir, "0002_add_email.up.sql", "ALTER TABLE users ADD COLUMN email TEXT;")
+
+	// A failing migration is rolled back with its transaction.
+	writeMigration(t, dir, "0003_broken.up.sql", "CREATE TABLE broken (id INTEGER);\nINSERT INTO missing VALUES (1);")
+	_, err = api.ApplyMigrations(ctx, db, "sqlite3", dir, api.MigrateOptions{})
+	assert.ErrorContains(t, err, "migration 3_broken failed")
+	_, err = db.Exec(`SELECT * FROM broken`)
+	assert.ErrorContains(t, err, "no such table")
+	require.NoError(t, os.Remove(filepath.Join(dir, "0003_broken.up.sql")))
+
+	_, err = api.ApplyMigrations(ctx, db, "sqlite3", dir, api.MigrateOptions{
+		Check: func(sql string) error { return errors.New("denied") },
+	})
+	require.NoError(t, err, "nothing is pending, so nothing is checked")
+
+	_, err = api.RollbackMigrations(ctx, db, "sqlite3", dir, api.MigrateOptions{
+		Check: func(sql string) error { return errors.New("denied") },
+	})
+	assert.ErrorContains(t, err, "migration 2_add_email: denied")
+
+	result, err = api.RollbackMigrations(ctx, db, "sqlite3", dir, api.MigrateOptions{Steps: 2})
+	require.NoError(t, err)
+	require.Len(t, result.RolledBack, 2)
+	assert.Equal(t, int64(2), result.RolledBack[0].Version)
+	assert.Equal(t, int64(1), result.RolledBack[1].Version)
+	_, err = db.Exec(`SELECT * FROM users`)
+	assert.ErrorContains(t, err, "no such table")
+
+	// Applied migrations whose files are gone are reported.
+	_, err = api.ApplyMigrations(ctx, db, "sqlite3", dir, api.MigrateOptions{Target: 1})
+	require.NoError(t, err)
+	require.NoError(t, os.Remove(filepath.Join(dir, "0001_create_users.up.sql")))
+	require.NoError(t, os.Remove(filepath.Join(dir, "0001_create_users.down.sql")))
+	states, err = api.MigrationStatus(ctx, db, "sqlite3", dir)
+	require.NoError(t, err)
+	assert.Equal(t, map[int64]string{1: api.MigrationMissing, 2: api.MigrationPending}, migrationStates(t, states))
+	_, err = api.RollbackMigrations(ctx, db, "sqlite3", dir, api.MigrateOptions{})
+	assert.ErrorContains(t, err, "applied migration 1_create_users has no files")
+}
+
+func TestCreateMigration(t *testing.T) {
+	dir := t.TempDir()
+	writeMigration(t, dir, "0007_init.up.sql", "CREATE TABLE t (id INTEGER);")
+
+	m, err := api.CreateMigration(dir, "Add orders: status!", "ALTER TABLE orders ADD COLUMN status TEXT;", "")
+	require.NoError(t, err)
+	assert.Equal(t, int64(8), m.Version)
+	assert.Equal(t, "add_orders_status", m.Name)
+	assert.Equal(t, filepath.Join(dir, "0008_add_orders_status.up.sql"), m.Up)
+	assert.Empty(t, m.Down)
+
+	migrations, err := api.LoadMigrations(dir)
+	require.NoError(t, err)
+	require.Len(t, migrations, 2)
+	assert.Equal(t, m, migrations[1])
+
+	_, err = api.CreateMigration(dir, "!!", "SELECT 1", "")
+	assert.ErrorContains(t, err, "migration name must contain letters or digits")
+
+	writeMigration(t, dir, "0009_orphan.down.sql", "SELECT 1;")
+	_, err = api.LoadMigrations(dir)
+	assert.ErrorContains(t, err, "migration 9_orphan has no up file")
+}
@@ -0,0 +1,287 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Policy actions.
+const (
+	PolicyAllow = "allow"
+	PolicyDeny  = "deny"
+)
+
+// PolicyRule is a single allow or deny rule. A rule fires when every condition
+// it sets matches the statement; conditions left empty match anything.
+type PolicyRule struct {
+	// Name identifies the rule in violation reports.
+	Name string `yaml:"name" json:"name"`
+	// Action is either "allow" or "deny".
+	Action string `yaml:"action" json:"action"`
+	// Verbs restricts the rule to statements with one of these verbs,
+	// e.g. SELECT, INSERT, DROP.
+	Verbs []string `yaml:"verbs,omitempty" json:"verbs,omitempty"`
+	// Tables restricts the rule to statements referencing a table matching one
+	// of these glob patterns, e.g. "billing.*".
+	Tables []string `yaml:"tables,omitempty" json:"tables,omitempty"`
+	// Columns restricts the rule to statements referencing a column matching
+	// one of these "table.column" glob patterns, e.g. "users.password_hash".
+	// A "*" projection over a matching table counts as a reference.
+	Columns []string `yaml:"columns,omitempty" json:"columns,omitempty"`
+	// RequireWhere makes the rule fire only for statements without a WHERE
+	// clause, e.g. to forbid unbounded DELETEs.
+	RequireWhere bool `yaml:"require_where,omitempty" json:"require_where,omitempty"`
+	// Message is an optional explanation returned with violations.
+	Message string `yaml:"message,omitempty" json:"message,omitempty"`
+}
+
+// Policy is an ordered list of rules evaluated against every statement. The
+// first rule that fires decides; if none does, Default applies.
+type Policy struct {
+	// Default is the action for statements no rule matches. Defaults to allow.
+	Default string       `yaml:"default,omitempty" json:"default,omitempty"`
+	Rules   []PolicyRule `yaml:"rules" json:"rules"`
+}
+
+// PolicyViolation is returned when a statement is denied by a policy.
+type PolicyViolation struct {
+	Rule      string `json:"rule"`
+	Verb      string `json:"verb,omitempty"`
+	Table     string `json:"table,omitempty"`
+	Column    string `json:"column,omitempty"`
+	Message   string `json:"message"`
+	Statement string `json:"statement"`
+}
+
+func (v *PolicyViolation) Error() string {
+	return fmt.Sprintf("statement denied by policy rule %q: %s", v.Rule, v.Message)
+}
+
+// JSON returns the violation as a JSON document suitable for a tool error.
+func (v *PolicyViolation) JSON() string {
+	b, _ := json.MarshalIndent(struct {
+		Error string `json:"error"`
+		*PolicyViolation
+	}{"policy_violation", v}, "", "  ")
+	return string(b)
+}
+
+// LoadPolicy reads a YAML policy file.
+func LoadPolicy(file string) (*Policy, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+	return ParsePolicy(data)
+}
+
+// ParsePolicy parses and validates a YAML policy document.
+func ParsePolicy(data []byte) (*Policy, error) {
+	var p Policy
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse policy: %w", err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Validate checks the policy for unknown actions and malformed patterns.
+func (p *Policy) Validate() error {
+	switch p.Default {
+	case "":
+		p.Default = PolicyAllow
+	case PolicyAllow, PolicyDeny:
+	default:
+		return fmt.Errorf("invalid default policy action %q", p.Default)
+	}
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule-%d", i+1)
+		}
+		r.Action = strings.ToLower(r.Action)
+		if r.Action != PolicyAllow && r.Action != PolicyDeny {
+			return fmt.Errorf("rule %q: invalid action %q", r.Name, r.Action)
+		}
+		for j, v := range r.Verbs {
+			r.Verbs[j] = strings.ToUpper(v)
+		}
+		for _, pattern := range append(slices.Clone(r.Tables), r.Columns...) {
+			if _, err := path.Match(strings.ToLower(pattern), ""); err != nil {
+				return fmt.Errorf("rule %q: invalid pattern %q: %w", r.Name, pattern, err)
+			}
+		}
+		for _, pattern := range r.Columns {
+			if !strings.Contains(pattern, ".") {
+				return fmt.Errorf("rule %q: column pattern %q must have the form table.column", r.Name, pattern)
+			}
+		}
+	}
+	return nil
+}
+
+// Check evaluates every statement in query against the policy and returns a
+// *PolicyViolation for the first one that is denied.
+func (p *Policy) Check(query string) error {
+	if p == nil {
+		return nil
+	}
+	for _, stmt := range ParseStatements(query) {
+		if err := p.CheckStatement(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckStatement evaluates a single parsed statement against the policy.
+func (p *Policy) CheckStatement(stmt Statement) error {
+	if p == nil {
+		return nil
+	}
+	for _, r := range p.Rules {
+		m, ok := r.match(stmt)
+		if !ok {
+			continue
+		}
+		if r.Action == PolicyAllow {
+			return nil
+		}
+		m.Rule = r.Name
+		m.Verb = stmt.Verb
+		m.Statement = stmt.Text
+		m.Message = r.Message
+		if m.Message == "" {
+			m.Message = r.describe()
+		}
+		return m
+	}
+	if p.Default == PolicyDeny {
+		return &PolicyViolation{
+			Rule:      "default",
+			Verb:      stmt.Verb,
+			Message:   "no policy rule allows this statement",
+			Statement: stmt.Text,
+		}
+	}
+	return nil
+}
+
+// match reports whether the rule fires for stmt, returning the table and
+// column that triggered it.
+func (r PolicyRule) match(stmt Statement) (*PolicyViolation, bool) {
+	v := &PolicyViolation{}
+	if len(r.Verbs) > 0 && !slices.Contains(r.Verbs, stmt.Verb) {
+		return nil, false
+	}
+	if r.RequireWhere && stmt.HasWhere {
+		return nil, false
+	}
+	if len(r.Tables) > 0 {
+		v.Table = firstMatchingTable(r.Tables, stmt.Tables)
+		if v.Table == "" {
+			return nil, false
+		}
+	}
+	if len(r.Columns) > 0 {
+		v.Table, v.Column = r.matchColumn(stmt)
+		if v.Column == "" {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+func (r PolicyRule) matchColumn(stmt Statement) (string, string) {
+	for _, pattern := range r.Columns {
+		i := strings.LastIndex(pattern, ".")
+		tablePattern, columnPattern := pattern[:i], pattern[i+1:]
+		for _, ref := range stmt.Columns {
+			table, column := stmt.ResolveColumn(ref)
+			if column == "*" || !matchName(columnPattern, column) {
+				continue
+			}
+			if table != "" {
+				if matchName(tablePattern, table) {
+					return table, column
+				}
+				continue
+			}
+			// Unqualified: attribute it to any matching table in the statement.
+			if t := firstMatchingTable([]string{tablePattern}, stmt.Tables); t != "" {
+				return t, column
+			}
+		}
+		if stmt.Star {
+			for _, ref := range stmt.Columns {
+				table, column := stmt.ResolveColumn(ref)
+				if column != "*" {
+					continue
+				}
+				if table == "" {
+					if t := firstMatchingTable([]string{tablePattern}, stmt.Tables); t != "" {
+						return t, "*"
+					}
+				} else if matchName(tablePattern, table) {
+					return table, "*"
+				}
+			}
+		}
+	}
+	return "", ""
+}
+
+func (r PolicyRule) describe() string {
+	var parts []string
+	if len(r.Verbs) > 0 {
+		parts = append(parts, strings.Join(r.Verbs, "/")+" statements")
+	} else {
+		parts = append(parts, "statements")
+	}
+	if len(r.Tables) > 0 {
+		parts = append(parts, "on "+strings.Join(r.Tables, ", "))
+	}
+	if len(r.Columns) > 0 {
+		parts = append(parts, "referencing "+strings.Join(r.Columns, ", "))
+	}
+	if r.RequireWhere {
+		parts = append(parts, "without a WHERE clause")
+	}
+	return strings.Join(parts, " ") + " are not allowed"
+}
+
+func firstMatchingTable(patterns, tables []string) string {
+	for _, t := range tables {
+		for _, p := range patterns {
+			if matchName(p, t) {
+				return t
+			}
+		}
+	}
+	return ""
+}
+
+// matchName matches a possibly qualified object name against a glob pattern,
+// case-insensitively. Patterns without a "." also match the last segment of a
+// qualified name, so "users" matches "public.users".
+func matchName(pattern, name string) bool {
+	pattern, name = strings.ToLower(pattern), strings.ToLower(name)
+	if ok, _ := path.Match(pattern, name); ok {
+		return true
+	}
+	if !strings.Contains(pattern, ".") {
+		if i := strings.LastIndex(name, "."); i >= 0 {
+			ok, _ := path.Match(pattern, name[i+1:])
+			return ok
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package api_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thesoulless/usqlmcp/api"
+)
+
+const testPolicy = `
+rules:
+  - name: no-billing-writes
+    action: deny
+    verbs: [INSERT, UPDATE, DELETE]
+    tables: ["billing.*"]
+  - name: protect-password-hash
+    action: deny
+    verbs: [SELECT]
+    columns: ["users.password_hash"]
+    message: password hashes must never be read
+  - name: delete-needs-where
+    action: deny
+    verbs: [DELETE, UPDATE]
+    require_where: true
+  - name: no-drop
+    action: deny
+    verbs: [DROP]
+`
+
+func TestPolicyCheck(t *testing.T) {
+	policy, err := api.ParsePolicy([]byte(testPolicy))
+	require.NoError(t, err)
+
+	tests := []struct {
+		query  string
+		rule   string
+		column string
+	}{
+		{query: "SELECT id, name FROM users"},
+		{query: "DELETE FROM users WHERE id = 1"},
+		{query: "SELECT * FROM billing.invoices"},
+		{query: "INSERT INTO billing.invoices (id) VALUES (1)", rule: "no-billing-writes"},
+		{query: "SELECT password_hash FROM users", rule: "protect-password-hash", column: "password_hash"},
+		{query: "SELECT u.password_hash FROM public.users AS u", rule: "protect-password-hash", column: "password_hash"},
+		{query: "SELECT * FROM users", rule: "protect-password-hash", column: "*"},
+		{query: "SELECT o.* FROM orders o JOIN users u ON u.id = o.user_id"},
+		{query: "DELETE FROM sessions", rule: "delete-needs-where"},
+		{query: "SELECT 1; DROP TABLE users", rule: "no-drop"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			err := policy.Check(tt.query)
+			if tt.rule == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var violation *api.PolicyViolation
+			require.True(t, errors.As(err, &violation), "expected a policy violation, got %v", err)
+			assert.Equal(t, tt.rule, violation.Rule)
+			assert.Equal(t, tt.column, violation.Column)
+			assert.Contains(t, violation.JSON(), `"rule": "`+tt.rule+`"`)
+		})
+	}
+}
+
+func TestPolicyDefaultDeny(t *testing.T) {
+	policy, err := api.ParsePolicy([]byte(`
+default: deny
+rules:
+  - name: reads
+    action: allow
+    verbs: [SELECT]
+`))
+	require.NoError(t, err)
+
+	assert.NoError(t, policy.Check("SELECT 1"))
+
+	var violation *api.PolicyViolation
+	require.ErrorAs(t, policy.Check("UPDATE t SET x = 1 WHERE id = 2"), &violation)
+	assert.Equal(t, "default", violation.Rule)
+}
+
+func TestParsePolicyInvalid(t *testing.T) {
+	_, err := api.ParsePolicy([]byte("rules:\n  - name: bad\n    action: maybe\n"))
+	assert.ErrorContains(t, err, `invalid action "maybe"`)
+
+	_, err = api.ParsePolicy([]byte("rules:\n  - action: deny\n    columns: [password]\n"))
+	assert.ErrorContains(t, err, "table.column")
+}
@@ -0,0 +1,551 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/xo/dburl"
+)
+
+// Profile sources, reported in TableProfile.Source.
+const (
+	ProfileScan    = "scan"
+	ProfileSample  = "sample"
+	ProfileCatalog = "catalog"
+)
+
+const (
+	// DefaultProfileTopN is the number of most frequent values reported per
+	// column when ProfileOptions.TopN is not set.
+	DefaultProfileTopN = 5
+	// DefaultHistogramBuckets is the number of buckets in numeric histograms
+	// when ProfileOptions.Buckets is not set.
+	DefaultHistogramBuckets = 10
+)
+
+// ProfileOptions controls Profile. Exactly one of Table and Query is set.
+type ProfileOptions struct {
+	// Table is the table to profile, optionally schema-qualified.
+	Table string
+	// Query is a SELECT whose results are profiled.
+	Query string
+	// Columns restricts the profile to these columns.
+	Columns []string
+	// TopN is the number of most frequent values reported per column. A
+	// negative value reports none.
+	TopN int
+	// Buckets is the number of equal-width buckets in numeric histograms. A
+	// negative value skips histograms.
+	Buckets int
+	// SamplePercent, between 0 and 100 exclusive, profiles a random sample
+	// of the rows instead of all of them.
+	SamplePercent float64
+	// Catalog reads the statistics the database keeps for its planner
+	// instead of scanning the table. Only tables can be profiled this way.
+	Catalog bool
+	// Mask, if set, is applied to every value reported: minimums, maximums
+	// and frequent values.
+	Mask func(column string, val interface{}) interface{}
+}
+
+// TableProfile holds per-column statistics of a table or query.
+type TableProfile struct {
+	Table         string          `json:"table,omitempty"`
+	Source        string          `json:"source"`
+	SamplePercent float64         `json:"sample_percent,omitempty"`
+	Rows          int64           `json:"rows"`
+	Columns       []ColumnProfile `json:"columns"`
+}
+
+// ColumnProfile holds the statistics of one column. Statistics that could
+// not be determined are omitted.
+type ColumnProfile struct {
+	Name         string   `json:"name"`
+	Type         string   `json:"type"`
+	Nulls        *int64   `json:"nulls,omitempty"`
+	NullFraction *float64 `json:"null_fraction,omitempty"`
+	Distinct     *int64   `json:"distinct,omitempty"`
+	// DistinctApprox is set when Distinct is an estimate, from a HyperLogLog
+	// aggregate or catalog statistics.
+	DistinctApprox bool              `json:"distinct_approximate,omitempty"`
+	Min            interface{}       `json:"min,omitempty"`
+	Max            interface{}       `json:"max,omitempty"`
+	Length         *LengthStats      `json:"length,omitempty"`
+	TopValues      []ValueCount      `json:"top_values,omitempty"`
+	Histogram      []HistogramBucket `json:"histogram,omitempty"`
+
+	kind string
+}
+
+// LengthStats describes the lengths, in characters, of a text column's
+// values.
+type LengthStats struct {
+	Min int64   `json:"min"`
+	Max int64   `json:"max"`
+	Avg float64 `json:"avg"`
+}
+
+// ValueCount is a frequent value and how often it occurs.
+type ValueCount struct {
+	Value    interface{} `json:"value"`
+	Count    int64       `json:"count"`
+	Fraction float64     `json:"fraction"`
+}
+
+// HistogramBucket counts the values in [Low, High). The last bucket also
+// includes High.
+type HistogramBucket struct {
+	Low   interface{} `json:"low"`
+	High  interface{} `json:"high"`
+	Count int64       `json:"count"`
+}
+
+// Profile computes per-column statistics: row count, null fraction, distinct
+// count, minimum and maximum, most frequent values, string lengths and
+// numeric histograms. Table columns are taken from DescribeTableUniversal.
+func Profile(ctx context.Context, db *sql.DB, dsn string, opts ProfileOptions) (result TableProfile, err error) {
+	u, err := dburl.Parse(dsn)
+	if err != nil {
+		return result, fmt.Errorf("failed to parse DSN: %w", err)
+	}
+	d := DialectFor(u.Driver)
+
+	switch {
+	case (opts.Table == "") == (opts.Query == ""):
+		return result, errors.New("exactly one of table and query must be given")
+	case opts.Catalog && opts.Table == "":
+		return result, errors.New("catalog statistics are only available for tables")
+	case opts.Catalog && opts.SamplePercent != 0:
+		return result, errors.New("catalog statistics cannot be sampled")
+	case opts.SamplePercent < 0 || opts.SamplePercent >= 100:
+		return result, fmt.Errorf("sample percent must be between 0 and 100, got %v", opts.SamplePercent)
+	}
+	if opts.TopN == 0 {
+		opts.TopN = DefaultProfileTopN
+	}
+	if opts.Buckets == 0 {
+		opts.Buckets = DefaultHistogramBuckets
+	}
+	result.Table = opts.Table
+	result.Source = ProfileScan
+	if opts.Catalog {
+		result.Source = ProfileCatalog
+	} else if opts.SamplePercent > 0 {
+		result.Source, result.SamplePercent = ProfileSample, opts.SamplePercent
+	}
+
+	ctx, span := startStatementSpan(ctx, "profile", opts.Query)
+	defer func() { endStatementSpan(ctx, span, result.Rows, err) }()
+
+	columns, err := profileColumns(ctx, db, d, dsn, opts)
+	if err != nil {
+		return result, err
+	}
+
+	if opts.Catalog {
+		err = profileCatalog(ctx, db, d, opts.Table, &result, columns)
+	} else {
+		err = profileScan(ctx, db, d, opts, &result, columns)
+	}
+	if err != nil {
+		return result, err
+	}
+	if opts.Mask != nil {
+		for i := range result.Columns {
+			maskProfile(&result.Columns[i], opts.Mask)
+		}
+	}
+	return result, nil
+}
+
+// profileColumns returns the columns to profile, in table or result order.
+func profileColumns(ctx context.Context, db *sql.DB, d Dialect, dsn string, opts ProfileOptions) ([]ColumnProfile, error) {
+	var columns []ColumnProfile
+	if opts.Table != "" {
+		described, err := DescribeTableUniversal(db, opts.Table, dsn)
+		if err != nil {
+			return nil, err
+		}
+		if len(described) == 0 {
+			return nil, fmt.Errorf("table %s not found or has no columns", opts.Table)
+		}
+		for _, c := range described {
+			columns = append(columns, ColumnProfile{Name: c.Name, Type: c.Type, kind: typeKind(c.Type)})
+		}
+	} else {
+		rows, err := db.QueryContext(ctx, "SELECT * FROM ("+opts.Query+") src WHERE 1 = 0")
+		if err != nil {
+			return nil, fmt.Errorf("failed to execute query: %w", err)
+		}
+		defer rows.Close()
+		types, err := rows.ColumnTypes()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get columns: %w", err)
+		}
+		for _, ct := range types {
+			columns = append(columns, ColumnProfile{Name: ct.Name(), Type: ct.DatabaseTypeName(), kind: columnKind(ct)})
+		}
+	}
+
+	if len(opts.Columns) == 0 {
+		return columns, nil
+	}
+	selected := make([]ColumnProfile, 0, len(opts.Columns))
+	for _, name := range opts.Columns {
+		found := false
+		for _, c := range columns {
+			if strings.EqualFold(c.Name, name) {
+				selected = append(selected, c)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+	}
+	return selected, nil
+}
+
+// profileScan computes statistics with aggregate queries over the table or
+// query, or a sample of it. Each query draws its own sample.
+func profileScan(ctx context.Context, db *sql.DB, d Dialect, opts ProfileOptions, result *TableProfile, columns []ColumnProfile) error {
+	from := d.profileFrom(opts)
+
+	// One query computes the row count and the per-column aggregates; the
+	// setters store its results in column order.
+	exprs := []string{"COUNT(*)"}
+	var setters []func(v interface{})
+	nonNull := make([]int64, len(columns))
+	lengthSums := make([]float64, len(columns))
+	for i := range columns {
+		c := &columns[i]
+		i := i
+		col := d.QuoteIdent(c.Name)
+		exprs = append(exprs, "COUNT("+col+")")
+		setters = append(setters, func(v interface{}) { nonNull[i], _ = intValue(v) })
+		if distinctable(c.kind) {
+			expr, approx := d.countDistinct(col)
+			exprs = append(exprs, expr)
+			setters = append(setters, func(v interface{}) {
+				if n, ok := intValue(v); ok {
+					c.Distinct, c.DistinctApprox = &n, approx
+				}
+			})
+		}
+		if orderable(c.kind) {
+			exprs = append(exprs, "MIN("+col+")", "MAX("+col+")")
+			setters = append(setters,
+				func(v interface{}) { c.Min = profileValue(v) },
+				func(v interface{}) { c.Max = profileValue(v) })
+		}
+		if c.kind == kindText {
+			length := d.length(col)
+			c.Length = &LengthStats{}
+			exprs = append(exprs, "MIN("+length+")", "MAX("+length+")", "SUM("+length+")")
+			setters = append(setters,
+				func(v interface{}) { c.Length.Min, _ = intValue(v) },
+				func(v interface{}) { c.Length.Max, _ = intValue(v) },
+				func(v interface{}) { lengthSums[i], _ = floatValue(v) })
+		}
+	}
+
+	values := make([]interface{}, len(exprs))
+	scanArgs := make([]interface{}, len(exprs))
+	for i := range values {
+		scanArgs[i] = &values[i]
+	}
+	query := "SELECT " + strings.Join(exprs, ", ") + " FROM " + from
+	if err := db.QueryRowContext(ctx, query).Scan(scanArgs...); err != nil {
+		return fmt.Errorf("failed to compute column statistics: %w", err)
+	}
+	result.Rows, _ = intValue(values[0])
+	for i, set := range setters {
+		set(values[i+1])
+	}
+
+	for i := range columns {
+		c := &columns[i]
+		nulls := result.Rows - nonNull[i]
+		c.Nulls = &nulls
+		if result.Rows > 0 {
+			fraction := float64(nulls) / float64(result.Rows)
+			c.NullFraction = &fraction
+		}
+		if c.Length != nil {
+			if nonNull[i] == 0 {
+				c.Length = nil
+			} else {
+				c.Length.Avg = lengthSums[i] / float64(nonNull[i])
+			}
+		}
+		if nonNull[i] == 0 {
+			continue
+		}
+		if opts.TopN > 0 && distinctable(c.kind) {
+			top, err := profileTopValues(ctx, db, d, from, c.Name, opts.TopN, result.Rows)
+			if err != nil {
+				return err
+			}
+			c.TopValues = top
+		}
+		if opts.Buckets > 0 && numeric(c.kind) {
+			histogram, err := profileHistogram(ctx, db, d, from, c, opts.Buckets, nonNull[i])
+			if err != nil {
+				return err
+			}
+			c.Histogram = histogram
+		}
+	}
+	result.Columns = columns
+	return nil
+}
+
+// profileTopValues returns the n most frequent non-NULL values of column.
+func profileTopValues(ctx context.Context, db *sql.DB, d Dialect, from, column string, n int, total int64) ([]ValueCount, error) {
+	col := d.QuoteIdent(column)
+	query := d.limit(fmt.Sprintf("SELECT %s, COUNT(*) FROM %s WHERE %s IS NOT NULL GROUP BY %s ORDER BY 2 DESC, 1", col, from, col, col), n)
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute frequent values of %s: %w", column, err)
+	}
+	defer rows.Close()
+
+	top := []ValueCount{}
+	for rows.Next() {
+		var value, count interface{}
+		if err := rows.Scan(&value, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan frequent values of %s: %w", column, err)
+		}
+		vc := ValueCount{Value: profileValue(value)}
+		vc.Count, _ = intValue(count)
+		if total > 0 {
+			vc.Fraction = float64(vc.Count) / float64(total)
+		}
+		top = append(top, vc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to compute frequent values of %s: %w", column, err)
+	}
+	return top, nil
+}
+
+// profileHistogram returns an equal-width histogram of a numeric column
+// between its minimum and maximum. Buckets are counted with CASE
+// expressions, which every dialect supports.
+func profileHistogram(ctx context.Context, db *sql.DB, d Dialect, from string, c *ColumnProfile, buckets int, nonNull int64) ([]HistogramBucket, error) {
+	lo, okLo := floatValue(c.Min)
+	hi, okHi := floatValue(c.Max)
+	if !okLo || !okHi || math.IsInf(hi-lo, 0) {
+		return nil, nil
+	}
+	if hi == lo {
+		return []HistogramBucket{{Low: lo, High: hi, Count: nonNull}}, nil
+	}
+
+	col := d.QuoteIdent(c.Name)
+	width := (hi - lo) / float64(buckets)
+	edges := make([]float64, buckets+1)
+	for i := range edges {
+		edges[i] = lo + float64(i)*width
+	}
+	edges[buckets] = hi
+	literal := func(f float64) string { return strconv.FormatFloat(f, 'g', -1, 64) }
+
+	exprs := make([]string, buckets)
+	for i := range exprs {
+		var cond string
+		switch i {
+		case 0:
+			cond = col + " < " + literal(edges[1])
+		case buckets - 1:
+			cond = col + " >= " + literal(edges[i])
+		default:
+			cond = col + " >= " + literal(edges[i]) + " AND " + col + " < " + literal(edges[i+1])
+		}
+		exprs[i] = "SUM(CASE WHEN " + cond + " THEN 1 ELSE 0 END)"
+	}
+	values := make([]interface{}, buckets)
+	scanArgs := make([]interface{}, buckets)
+	for i := range values {
+		scanArgs[i] = &values[i]
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s IS NOT NULL", strings.Join(exprs, ", "), from, col)
+	if err := db.QueryRowContext(ctx, query).Scan(scanArgs...); err != nil {
+		return nil, fmt.Errorf("failed to compute histogram of %s: %w", c.Name, err)
+	}
+
+	histogram := make([]HistogramBucket, buckets)
+	for i := range histogram {
+		histogram[i].Low, histogram[i].High = edges[i], edges[i+1]
+		histogram[i].Count, _ = intValue(values[i])
+	}
+	return histogram, nil
+}
+
+// maskProfile masks the values reported for c. Histograms of masked columns
+// are dropped, since their bounds reveal the values.
+func maskProfile(c *ColumnProfile, mask func(column string, val interface{}) interface{}) {
+	if c.Min != nil || c.Max != nil {
+		lo, hi := mask(c.Name, c.Min), mask(c.Name, c.Max)
+		if lo != c.Min || hi != c.Max {
+			c.Histogram = nil
+		}
+		c.Min, c.Max = lo, hi
+	}
+	for i := range c.TopValues {
+		c.TopValues[i].Value = mask(c.Name, c.TopValues[i].Value)
+	}
+}
+
+// distinctable reports whether values of kind can be counted and grouped.
+func distinctable(kind string) bool {
+	return kind != kindBinary && kind != kindJSON
+}
+
+// orderable reports whether MIN and MAX are meaningful, and portable, for
+// values of kind.
+func orderable(kind string) bool {
+	switch kind {
+	case kindBool, kindBinary, kindJSON, kindUUID:
+		return false
+	}
+	return true
+}
+
+func numeric(kind string) bool {
+	return kind == kindInteger || kind == kindFloat || kind == kindDecimal
+}
+
+// profileValue converts a scanned value for output. Drivers return text as
+// []byte.
+func profileValue(v interface{}) interface{} {
+	if b, ok := v.([]byte); ok {
+		return string(b)
+	}
+	return v
+}
+
+// floatValue converts a scanned numeric value, which some drivers return as
+// text, to a float64.
+func floatValue(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case nil:
+		return 0, false
+	case []byte:
+		f, err := strconv.ParseFloat(strings.TrimSpace(string(v)), 64)
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	default:
+		f, err := toFloat64(v)
+		return f, err == nil
+	}
+}
+
+// intValue converts a scanned count to an int64.
+func intValue(v interface{}) (int64, bool) {
+	if n, err := toInt64(v); err == nil {
+		return n, true
+	}
+	f, ok := floatValue(v)
+	return int64(math.Round(f)), ok
+}
+
+// profileFrom returns the FROM clause the profile reads from, sampled when
+// asked. Tables are sampled with TABLESAMPLE where the dialect has it;
+// everything else is filtered with a random predicate.
+func (d Dialect) profileFrom(opts ProfileOptions) string {
+	source := "(" + opts.Query + ") src"
+	if opts.Table != "" {
+		source = d.QuoteQualified(opts.Table)
+	}
+	p := opts.SamplePercent
+	if p <= 0 {
+		return source
+	}
+	percent := strconv.FormatFloat(p, 'f', -1, 64)
+	if opts.Table != "" {
+		switch d.system() {
+		case "postgresql":
+			return source + " TABLESAMPLE SYSTEM (" + percent + ")"
+		case "trino", "presto":
+			return source + " TABLESAMPLE BERNOULLI (" + percent + ")"
+		case "mssql":
+			return source + " TABLESAMPLE (" + percent + " PERCENT)"
+		case "oracle", "snowflake":
+			return source + " SAMPLE (" + percent + ")"
+		case "duckdb":
+			return source + " USING SAMPLE " + percent + "%"
+		}
+	}
+	fraction := strconv.FormatFloat(p/100, 'f', -1, 64)
+	perMillion := strconv.FormatInt(int64(p*10000), 10)
+	var predicate string
+	switch d.system() {
+	case "mysql":
+		predicate = "RAND() < " + fraction
+	case "sqlite":
+		predicate = "abs(random()) % 1000000 < " + perMillion
+	case "mssql":
+		predicate = "ABS(CHECKSUM(NEWID())) % 1000000 < " + perMillion
+	case "oracle":
+		predicate = "DBMS_RANDOM.VALUE < " + fraction
+	case "clickhouse":
+		predicate = "rand() % 1000000 < " + perMillion
+	case "snowflake":
+		predicate = "UNIFORM(0::FLOAT, 1::FLOAT, RANDOM()) < " + fraction
+	default:
+		predicate = "random() < " + fraction
+	}
+	return "(SELECT * FROM " + source + " WHERE " + predicate + ") sampled"
+}
+
+// countDistinct returns an expression counting the distinct values of col,
+// and whether it is an approximation.
+func (d Dialect) countDistinct(col string) (string, bool) {
+	switch d.system() {
+	case "clickhouse":
+		return "uniq(" + col + ")", true
+	case "duckdb":
+		return "approx_count_distinct(" + col + ")", true
+	case "mssql", "oracle", "snowflake":
+		return "APPROX_COUNT_DISTINCT(" + col + ")", true
+	case "trino", "presto":
+		return "approx_distinct(" + col + ")", true
+	default:
+		return "COUNT(DISTINCT " + col + ")", false
+	}
+}
+
+// length returns an expression for the length in characters of col.
+func (d Dialect) length(col string) string {
+	switch d.system() {
+	case "mysql":
+		return "CHAR_LENGTH(" + col + ")"
+	case "mssql":
+		return "LEN(" + col + ")"
+	case "clickhouse":
+		return "lengthUTF8(" + col + ")"
+	default:
+		return "LENGTH(" + col + ")"
+	}
+}
+
+// limit adds a row limit to a SELECT statement.
+func (d Dialect) limit(query string, n int) string {
+	switch d.system() {
+	case "mssql":
+		return fmt.Sprintf("SELECT TOP %d%s", n, strings.TrimPrefix(query, "SELECT"))
+	case "oracle":
+		return fmt.Sprintf("%s FETCH FIRST %d ROWS ONLY", query, n)
+	default:
+		return fmt.Sprintf("%s LIMIT %d", query, n)
+	}
+}
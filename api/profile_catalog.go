@@ -0,0 +1,267 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// profileCatalog fills result from the planner statistics the database keeps
+// for table, without scanning it. The statistics are only as fresh as the
+// last ANALYZE.
+func profileCatalog(ctx context.Context, db *sql.DB, d Dialect, table string, result *TableProfile, columns []ColumnProfile) error {
+	schema, name := splitQualified(table)
+	var err error
+	switch d.system() {
+	case "postgresql":
+		err = postgresCatalogStats(ctx, db, schema, name, result, columns)
+	case "mysql":
+		err = mysqlCatalogStats(ctx, db, schema, name, result, columns)
+	case "sqlite":
+		err = sqliteCatalogStats(ctx, db, schema, name, result, columns)
+	default:
+		return fmt.Errorf("catalog statistics are not supported for %s", d.system())
+	}
+	if err != nil {
+		return err
+	}
+	result.Columns = columns
+	return nil
+}
+
+// splitQualified splits a possibly schema-qualified table name.
+func splitQualified(table string) (schema, name string) {
+	if i := strings.LastIndexByte(table, '.'); i >= 0 {
+		return table[:i], table[i+1:]
+	}
+	return "", table
+}
+
+// columnIndex returns the index of the column called name, or -1.
+func columnIndex(columns []ColumnProfile, name string) int {
+	for i, c := range columns {
+		if strings.EqualFold(c.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// postgresCatalogStats reads pg_stats and the row estimate in pg_class.
+func postgresCatalogStats(ctx context.Context, db *sql.DB, schema, table string, result *TableProfile, columns []ColumnProfile) error {
+	var reltuples float64
+	err := db.QueryRowContext(ctx, `SELECT c.reltuples FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+WHERE n.nspname = COALESCE(NULLIF($1, ''), current_schema()) AND c.relname = $2`, schema, table).Scan(&reltuples)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("table %s not found", table)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read table statistics: %w", err)
+	}
+	// reltuples is -1 for tables that were never analyzed.
+	if reltuples < 0 {
+		return fmt.Errorf("no catalog statistics for %s; run ANALYZE first", table)
+	}
+	result.Rows = int64(reltuples)
+
+	rows, err := db.QueryContext(ctx, `SELECT attname, null_frac, n_distinct, most_common_vals::text, most_common_freqs::text, histogram_bounds::text
+FROM pg_stats WHERE schemaname = COALESCE(NULLIF($1, ''), current_schema()) AND tablename = $2`, schema, table)
+	if err != nil {
+		return fmt.Errorf("failed to read column statistics: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			attname                       string
+			nullFrac, nDistinct           float64
+			commonVals, commonFreqs, hist sql.NullString
+		)
+		if err := rows.Scan(&attname, &nullFrac, &nDistinct, &commonVals, &commonFreqs, &hist); err != nil {
+			return fmt.Errorf("failed to scan column statistics: %w", err)
+		}
+		i := columnIndex(columns, attname)
+		if i < 0 {
+			continue
+		}
+		c := &columns[i]
+		nulls := int64(math.Round(nullFrac * reltuples))
+		c.Nulls, c.NullFraction = &nulls, &nullFrac
+		// A negative n_distinct is the negated fraction of rows that are
+		// distinct; 0 means unknown.
+		if nDistinct != 0 {
+			distinct := int64(nDistinct)
+			if nDistinct < 0 {
+				distinct = int64(math.Round(-nDistinct * reltuples))
+			}
+			c.Distinct, c.DistinctApprox = &distinct, true
+		}
+
+		values, freqs := parsePGArray(commonVals.String), parsePGArray(commonFreqs.String)
+		for j, v := range values {
+			if j >= len(freqs) {
+				break
+			}
+			f, _ := strconv.ParseFloat(freqs[j], 64)
+			c.TopValues = append(c.TopValues, ValueCount{Value: v, Count: int64(math.Round(f * reltuples)), Fraction: f})
+		}
+
+		// Histogram bounds split the values outside the most common ones
+		// into buckets holding equal numbers of rows.
+		if bounds := parsePGArray(hist.String); len(bounds) > 1 {
+			remaining := 1 - nullFrac
+			for _, vc := range c.TopValues {
+				remaining -= vc.Fraction
+			}
+			count := int64(math.Round(remaining * reltuples / float64(len(bounds)-1)))
+			for j := 0; j < len(bounds)-1; j++ {
+				c.Histogram = append(c.Histogram, HistogramBucket{Low: bounds[j], High: bounds[j+1], Count: count})
+			}
+		}
+	}
+	return rows.Err()
+}
+
+// parsePGArray splits the text form of a one-dimensional PostgreSQL array,
+// such as {a,"b c",NULL}. NULL elements are returned as empty strings.
+func parsePGArray(s string) []string {
+	s = strings.TrimSpace(s)
+	if len(s) < 2 || s[0] != '{' || s[len(s)-1] != '}' {
+		return nil
+	}
+	s = s[1 : len(s)-1]
+	var (
+		elems  []string
+		b      strings.Builder
+		quoted bool
+	)
+	for i := 0; i < len(s); i++ {
+		switch ch := s[i]; {
+		case quoted && ch == '\\' && i+1 < len(s):
+			i++
+			b.WriteByte(s[i])
+		case ch == '"':
+			quoted = !quoted
+		case ch == ',' && !quoted:
+			elems = append(elems, pgArrayElem(b.String()))
+			b.Reset()
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	if s != "" {
+		elems = append(elems, pgArrayElem(b.String()))
+	}
+	return elems
+}
+
+func pgArrayElem(s string) string {
+	if s == "NULL" {
+		return ""
+	}
+	return s
+}
+
+// mysqlCatalogStats reads the InnoDB row estimate and the cardinality of
+// indexes, which estimates the distinct count of their leading columns.
+func mysqlCatalogStats(ctx context.Context, db *sql.DB, schema, table string, result *TableProfile, columns []ColumnProfile) error {
+	err := db.QueryRowContext(ctx, `SELECT n_rows FROM mysql.innodb_table_stats
+WHERE database_name = COALESCE(NULLIF(?, ''), DATABASE()) AND table_name = ?`, schema, table).Scan(&result.Rows)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("no catalog statistics for %s; run ANALYZE TABLE first", table)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read table statistics: %w", err)
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT COLUMN_NAME, MAX(CARDINALITY) FROM information_schema.STATISTICS
+WHERE TABLE_SCHEMA = COALESCE(NULLIF(?, ''), DATABASE()) AND TABLE_NAME = ? AND SEQ_IN_INDEX = 1 AND CARDINALITY IS NOT NULL
+GROUP BY COLUMN_NAME`, schema, table)
+	if err != nil {
+		return fmt.Errorf("failed to read index statistics: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			column      string
+			cardinality int64
+		)
+		if err := rows.Scan(&column, &cardinality); err != nil {
+			return fmt.Errorf("failed to scan index statistics: %w", err)
+		}
+		if i := columnIndex(columns, column); i >= 0 {
+			columns[i].Distinct, columns[i].DistinctApprox = &cardinality, true
+		}
+	}
+	return rows.Err()
+}
+
+// sqliteCatalogStats reads sqlite_stat1, written by ANALYZE. Each index's
+// row holds the table's row count followed by the average number of rows
+// sharing a value of its leading columns.
+func sqliteCatalogStats(ctx context.Context, db *sql.DB, schema, table string, result *TableProfile, columns []ColumnProfile) error {
+	prefix, indexSchema := "", "main"
+	if schema != "" {
+		prefix, indexSchema = DialectFor("sqlite3").QuoteIdent(schema)+".", schema
+	}
+	rows, err := db.QueryContext(ctx, "SELECT idx, stat FROM "+prefix+"sqlite_stat1 WHERE tbl = ?", table)
+	if err != nil {
+		if strings.Contains(err.Error(), "no such table") {
+			return fmt.Errorf("no catalog statistics for %s; run ANALYZE first", table)
+		}
+		return fmt.Errorf("failed to read table statistics: %w", err)
+	}
+	type indexStat struct {
+		index string
+		stat  []string
+	}
+	var stats []indexStat
+	for rows.Next() {
+		var (
+			idx  sql.NullString
+			stat string
+		)
+		if err := rows.Scan(&idx, &stat); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan table statistics: %w", err)
+		}
+		stats = append(stats, indexStat{idx.String, strings.Fields(stat)})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read table statistics: %w", err)
+	}
+	if len(stats) == 0 {
+		return fmt.Errorf("no catalog statistics for %s; run ANALYZE first", table)
+	}
+
+	for _, s := range stats {
+		if len(s.stat) == 0 {
+			continue
+		}
+		n, err := strconv.ParseInt(s.stat[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		result.Rows = n
+		if s.index == "" || len(s.stat) < 2 {
+			continue
+		}
+		perValue, err := strconv.ParseFloat(s.stat[1], 64)
+		if err != nil || perValue <= 0 {
+			continue
+		}
+		var column string
+		err = db.QueryRowContext(ctx, "SELECT name FROM pragma_index_info(?, ?) WHERE seqno = 0", s.index, indexSchema).Scan(&column)
+		if err != nil {
+			continue
+		}
+		if i := columnIndex(columns, column); i >= 0 {
+			distinct := int64(math.Round(float64(n) / perValue))
+			columns[i].Distinct, columns[i].DistinctApprox = &distinct, true
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package api_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thesoulless/usqlmcp/api"
+)
+
+func TestProfile(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	dsn := "sqlite3://test_profile.db"
+
+	_, err := db.Exec(`CREATE TABLE orders (id INTEGER PRIMARY KEY, status TEXT, amount REAL, note BLOB);
+INSERT INTO orders VALUES
+  (1, 'paid', 10, NULL), (2, 'paid', 20, NULL), (3, 'open', 30, NULL),
+  (4, 'paid', 40, NULL), (5, NULL, NULL, x'00')`)
+	require.NoError(t, err)
+
+	profile, err := api.Profile(ctx, db, dsn, api.ProfileOptions{Table: "orders", TopN: 2, Buckets: 3})
+	require.NoError(t, err)
+	assert.Equal(t, api.ProfileScan, profile.Source)
+	assert.Equal(t, int64(5), profile.Rows)
+	require.Len(t, profile.Columns, 4)
+
+	status := profile.Columns[1]
+	assert.Equal(t, "status", status.Name)
+	assert.Equal(t, int64(1), *status.Nulls)
+	assert.InDelta(t, 0.2, *status.NullFraction, 1e-9)
+	assert.Equal(t, int64(2), *status.Distinct)
+	assert.False(t, status.DistinctApprox)
+	assert.Equal(t, "open", status.Min)
+	assert.Equal(t, "paid", status.Max)
+	assert.Equal(t, &api.LengthStats{Min: 4, Max: 4, Avg: 4}, status.Length)
+	assert.Equal(t, []api.ValueCount{
+		{Value: "paid", Count: 3, Fraction: 0.6},
+		{Value: "open", Count: 1, Fraction: 0.2},
+	}, status.TopValues)
+	assert.Nil(t, status.Histogram)
+
+	amount := profile.Columns[2]
+	assert.Equal(t, 10.0, amount.Min)
+	assert.Equal(t, 40.0, amount.Max)
+	assert.Equal(t, []api.HistogramBucket{
+		{Low: 10.0, High: 20.0, Count: 1},
+		{Low: 20.0, High: 30.0, Count: 1},
+		{Low: 30.0, High: 40.0, Count: 2},
+	}, amount.Histogram)
+
+	// Binary columns only get null counts.
+	note := profile.Columns[3]
+	assert.Equal(t, int64(4), *note.Nulls)
+	assert.Nil(t, note.Distinct)
+	assert.Nil(t, note.Min)
+	assert.Nil(t, note.TopValues)
+
+	// Queries are profiled through their result columns; masked columns
+	// lose their histograms.
+	profile, err = api.Profile(ctx, db, dsn, api.ProfileOptions{
+		Query:   "SELECT id, amount FROM orders WHERE id <= 4",
+		Columns: []string{"AMOUNT"},
+		Mask: func(column string, val interface{}) interface{} {
+			return api.Redacted
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), profile.Rows)
+	require.Len(t, profile.Columns, 1)
+	assert.Equal(t, api.Redacted, profile.Columns[0].Max)
+	assert.Nil(t, profile.Columns[0].Histogram)
+	assert.Equal(t, api.Redacted, profile.Columns[0].TopValues[0].Value)
+
+	profile, err = api.Profile(ctx, db, dsn, api.ProfileOptions{Table: "orders", SamplePercent: 50})
+	require.NoError(t, err)
+	assert.Equal(t, api.ProfileSample, profile.Source)
+	assert.LessOrEqual(t, profile.Rows, int64(5))
+
+	_, err = api.Profile(ctx, db, dsn, api.ProfileOptions{Table: "orders", Columns: []string{"nope"}})
+	assert.ErrorContains(t, err, `unknown column "nope"`)
+	_, err = api.Profile(ctx, db, dsn, api.ProfileOptions{Table: "orders", Query: "SELECT 1"})
+	assert.ErrorContains(t, err, "exactly one of table and query")
+	_, err = api.Profile(ctx, db, dsn, api.ProfileOptions{Table: "orders", SamplePercent: 100})
+	assert.ErrorContains(t, err, "sample percent must be between 0 and 100")
+}
+
+func TestProfileCatalog(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	dsn := "sqlite3://test_profile_catalog.db"
+
+	_, err := db.Exec(`CREATE TABLE events (id INTEGER, kind TEXT);
+CREATE INDEX events_kind ON events (kind);
+INSERT INTO events VALUES (1, 'a'), (2, 'a'), (3, 'b'), (4, 'b'), (5, 'c'), (6, 'c')`)
+	require.NoError(t, err)
+
+	_, err = api.Profile(ctx, db, dsn, api.ProfileOptions{Table: "events", Catalog: true})
+	assert.ErrorContains(t, err, "run ANALYZE first")
+
+	_, err = db.Exec(`ANALYZE`)
+	require.NoError(t, err)
+	profile, err := api.Profile(ctx, db, dsn, api.ProfileOptions{Table: "events", Catalog: true})
+	require.NoError(t, err)
+	assert.Equal(t, api.ProfileCatalog, profile.Source)
+	assert.Equal(t, int64(6), profile.Rows)
+	require.Len(t, profile.Columns, 2)
+	assert.Nil(t, profile.Columns[0].Distinct)
+	require.NotNil(t, profile.Columns[1].Distinct)
+	assert.Equal(t, int64(3), *profile.Columns[1].Distinct)
+	assert.True(t, profile.Columns[1].DistinctApprox)
+
+	_, err = api.Profile(ctx, db, dsn, api.ProfileOptions{Query: "SELECT * FROM events", Catalog: true})
+	assert.ErrorContains(t, err, "only available for tables")
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 
@@ -9,22 +10,51 @@ import (
 
 type Row map[string]interface{}
 
+// readProgressRows is how often, in rows, ReadQueryProgress reports progress.
+const readProgressRows = 1000
+
 // ReadQuery executes a SELECT query and returns the results as a slice of Row.
 func ReadQuery(db *sql.DB, query string) ([]Row, error) {
-	rows, err := db.Query(query)
+	return ReadQueryContext(context.Background(), db, query)
+}
+
+// ReadQueryContext is like ReadQuery but runs the query under ctx.
+func ReadQueryContext(ctx context.Context, db *sql.DB, query string) ([]Row, error) {
+	results, _, err := ReadQueryLimit(ctx, db, query, 0)
+	return results, err
+}
+
+// ReadQueryLimit is like ReadQueryContext but stops reading after maxRows
+// rows, reporting whether the result was truncated. A maxRows of 0 or less
+// reads every row.
+func ReadQueryLimit(ctx context.Context, db *sql.DB, query string, maxRows int) (results []Row, truncated bool, err error) {
+	return ReadQueryProgress(ctx, db, query, maxRows, nil)
+}
+
+// ReadQueryProgress is like ReadQueryLimit but calls progress, if not nil,
+// with the number of rows read so far as they are read.
+func ReadQueryProgress(ctx context.Context, db *sql.DB, query string, maxRows int, progress func(rows int64)) (results []Row, truncated bool, err error) {
+	ctx, span := startStatementSpan(ctx, "query", query)
+	defer func() { endStatementSpan(ctx, span, int64(len(results)), err) }()
+
+	rows, err := db.QueryContext(ctx, query)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute query: %w", err)
+		return nil, false, fmt.Errorf("failed to execute query: %w", err)
 	}
 	defer rows.Close()
 
 	columns, err := rows.Columns()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get columns: %w", err)
+		return nil, false, fmt.Errorf("failed to get columns: %w", err)
 	}
 	numColumns := len(columns)
 
-	results := []Row{}
+	results = []Row{}
 	for rows.Next() {
+		if maxRows > 0 && len(results) == maxRows {
+			truncated = true
+			break
+		}
 		values := make([]interface{}, numColumns)
 
 		// Create a slice of pointers to the elements in the 'values' slice.
@@ -39,7 +69,7 @@ func ReadQuery(db *sql.DB, query string) ([]Row, error) {
 		err := rows.Scan(scanArgs...)
 		if err != nil {
 			// Consider logging the error here too
-			return nil, fmt.Errorf("failed to scan row: %w", err)
+			return nil, false, fmt.Errorf("failed to scan row: %w", err)
 		}
 
 		rowMap := make(Row, numColumns) // Pre-allocate map size for efficiency
@@ -50,11 +80,14 @@ func ReadQuery(db *sql.DB, query string) ([]Row, error) {
 		}
 
 		results = append(results, rowMap)
+		if progress != nil && len(results)%readProgressRows == 0 {
+			progress(int64(len(results)))
+		}
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("row iteration error: %w", err)
+		return nil, false, fmt.Errorf("row iteration error: %w", err)
 	}
 
-	return results, nil
+	return results, truncated, nil
 }
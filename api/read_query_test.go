@@ -1,6 +1,7 @@
 package api_test
 
 import (
+	"context"
 	"database/sql"
 	"os"
 	"testing"
@@ -44,3 +45,61 @@ func TestReadQueryWithSQLite(t *testing.T) {
 	}
 	assert.Equal(t, expected, results, "results do not match expected output")
 }
+
+func TestReadQueryLimit(t *testing.T) {
+	db := openTestDB(t)
+	_, err := db.Exec(`CREATE TABLE n (v INTEGER); INSERT INTO n VALUES (1), (2), (3);`)
+	if err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+
+	results, truncated, err := api.ReadQueryLimit(context.Background(), db, `SELECT v FROM n ORDER BY v;`, 2)
+	if err != nil {
+		t.Fatalf("ReadQueryLimit failed: %v", err)
+	}
+	assert.True(t, truncated)
+	assert.Equal(t, []api.Row{{"v": int64(1)}, {"v": int64(2)}}, results)
+
+	results, truncated, err = api.ReadQueryLimit(context.Background(), db, `SELECT v FROM n;`, 3)
+	if err != nil {
+		t.Fatalf("ReadQueryLimit failed: %v", err)
+	}
+	assert.False(t, truncated)
+	assert.Len(t, results, 3)
+}
+
+func TestReadQueryProgress(t *testing.T) {
+	db := openTestDB(t)
+	_, err := db.Exec(`CREATE TABLE n (v INTEGER);
+WITH RECURSIVE seq(v) AS (SELECT 1 UNION ALL SELECT v + 1 FROM seq WHERE v < 2500)
+INSERT INTO n SELECT v FROM seq;`)
+	if err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+
+	var reported []int64
+	results, _, err := api.ReadQueryProgress(context.Background(), db, `SELECT v FROM n`, 0, func(rows int64) {
+		reported = append(reported, rows)
+	})
+	if err != nil {
+		t.Fatalf("ReadQueryProgress failed: %v", err)
+	}
+	assert.Len(t, results, 2500)
+	assert.Equal(t, []int64{1000, 2000}, reported)
+}
+
+func TestTagQuery(t *testing.T) {
+	query, tag := api.TagQuery("sqlite3", "SELECT 1")
+	assert.Equal(t, "SELECT 1", query)
+	assert.Empty(t, tag)
+	p, err := api.ReadServerProgress(context.Background(), nil, "sqlite3", tag)
+	assert.NoError(t, err)
+	assert.Nil(t, p)
+
+	for _, driver := range []string{"postgres", "clickhouse", "trino"} {
+		query, tag := api.TagQuery(driver, "SELECT 1")
+		assert.Len(t, tag, 16)
+		assert.Equal(t, "/* usqlmcp:"+tag+" */ SELECT 1", query)
+		assert.Equal(t, "SELECT", api.ParseStatement(query).Verb)
+	}
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"io"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// minSecretLen is the shortest registered secret that is redacted; shorter
+// values would mask unrelated text.
+const minSecretLen = 4
+
+var secrets struct {
+	mu     sync.RWMutex
+	values []string
+}
+
+// RegisterSecret records a secret, such as a password resolved from a file
+// or keyring, so that Redact masks it wherever it appears.
+func RegisterSecret(secret string) {
+	if len(secret) < minSecretLen {
+		return
+	}
+	secrets.mu.Lock()
+	defer secrets.mu.Unlock()
+	for _, v := range []string{secret, url.QueryEscape(secret), url.PathEscape(secret)} {
+		if !slices.Contains(secrets.values, v) {
+			secrets.values = append(secrets.values, v)
+		}
+	}
+}
+
+// Redact masks passwords in URL-style connection strings and every
+// registered secret in s.
+func Redact(s string) string {
+	s = RedactDSN(s)
+	secrets.mu.RLock()
+	defer secrets.mu.RUnlock()
+	for _, v := range secrets.values {
+		s = strings.ReplaceAll(s, v, "****")
+	}
+	return s
+}
+
+// RedactError returns err with its message redacted, or nil if err is nil.
+func RedactError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if msg := Redact(err.Error()); msg != err.Error() {
+		return &redactedError{msg: msg, err: err}
+	}
+	return err
+}
+
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string { return e.msg }
+func (e *redactedError) Unwrap() error { return e.err }
+
+// NewRedactingWriter returns a writer that redacts every write to w, for use
+// as the output of the standard logger. Each write is expected to hold whole
+// lines, as log.Logger writes do.
+func NewRedactingWriter(w io.Writer) io.Writer {
+	return redactingWriter{w: w}
+}
+
+type redactingWriter struct {
+	w io.Writer
+}
+
+func (r redactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.w, Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,234 @@
+package api
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CachedResult is a query result held by a ResultCache. Its rows are shared
+// by every caller getting it, and must not be modified.
+type CachedResult struct {
+	Rows      []Row
+	Truncated bool
+	// CachedAt is when the query started.
+	CachedAt time.Time
+}
+
+// ResultCache holds query results for a fixed TTL within a memory budget,
+// evicting the least recently used results first. Results are grouped by
+// connection and remember the tables their query read, so that writes can
+// invalidate them. A nil *ResultCache caches nothing.
+type ResultCache struct {
+	ttl      time.Duration
+	maxBytes int64
+
+	mu      sync.Mutex
+	size    int64
+	lru     *list.List // of *resultCacheEntry, most recently used first
+	entries map[string]*list.Element
+	// invalidated holds when each connection was last invalidated, so that
+	// results of queries started before are not cached.
+	invalidated map[string]time.Time
+}
+
+type resultCacheEntry struct {
+	key    string
+	conn   string
+	tables []string
+	result CachedResult
+	size   int64
+}
+
+// NewResultCache returns a cache whose results expire after ttl and take up
+// at most about maxBytes, or nil if ttl is not positive.
+func NewResultCache(ttl time.Duration, maxBytes int64) *ResultCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &ResultCache{
+		ttl:         ttl,
+		maxBytes:    maxBytes,
+		lru:         list.New(),
+		entries:     map[string]*list.Element{},
+		invalidated: map[string]time.Time{},
+	}
+}
+
+// ResultCacheKey returns the cache key of query run on the connection named
+// conn with args. Queries differing only in whitespace, comments, keyword
+// case or trailing semicolons share a key.
+func ResultCacheKey(conn, query string, args ...interface{}) string {
+	var b strings.Builder
+	tokens := tokenize(query)
+	for len(tokens) > 0 && tokens[len(tokens)-1].isPunct(";") {
+		tokens = tokens[:len(tokens)-1]
+	}
+	for i, t := range tokens {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		switch {
+		case t.kind == tokQuotedIdent:
+			b.WriteString(`"` + strings.ReplaceAll(t.text, `"`, `""`) + `"`)
+		case sqlKeywords[t.upper()]:
+			b.WriteString(t.upper())
+		default:
+			b.WriteString(t.text)
+		}
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s", conn, b.String())
+	for _, arg := range args {
+		fmt.Fprintf(h, "\x00%T:%v", arg, arg)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Get returns the result cached under key, if it has not expired.
+func (c *ResultCache) Get(key string) (CachedResult, bool) {
+	if c == nil {
+		return CachedResult{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return CachedResult{}, false
+	}
+	e := el.Value.(*resultCacheEntry)
+	if time.Since(e.result.CachedAt) >= c.ttl {
+		c.remove(el)
+		return CachedResult{}, false
+	}
+	c.lru.MoveToFront(el)
+	return e.result, true
+}
+
+// Put caches the result of query, run on the connection named conn, under
+// key. Results larger than the whole budget, or of queries started before
+// conn was last invalidated, are not cached.
+func (c *ResultCache) Put(key, conn, query string, result CachedResult) {
+	if c == nil {
+		return
+	}
+	e := &resultCacheEntry{key: key, conn: conn, result: result, size: int64(len(key)) + rowsSize(result.Rows)}
+	for _, stmt := range ParseStatements(query) {
+		e.tables = append(e.tables, stmt.Tables...)
+	}
+	if c.maxBytes > 0 && e.size > c.maxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if result.CachedAt.Before(c.invalidated[conn]) {
+		return
+	}
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+	c.entries[key] = c.lru.PushFront(e)
+	c.size += e.size
+	for c.maxBytes > 0 && c.size > c.maxBytes {
+		c.remove(c.lru.Back())
+	}
+}
+
+// Invalidate drops the results cached for the connection named conn whose
+// query read any of tables, or every result of conn if no tables are given.
+// Results whose query referenced no table the parser could find are always
+// dropped.
+func (c *ResultCache) Invalidate(conn string, tables ...string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.invalidated[conn] = time.Now()
+	for el := c.lru.Front(); el != nil; {
+		next := el.Next()
+		e := el.Value.(*resultCacheEntry)
+		if e.conn == conn && (len(tables) == 0 || len(e.tables) == 0 || readsAny(e.tables, tables)) {
+			c.remove(el)
+		}
+		el = next
+	}
+}
+
+// InvalidateQuery drops the results that the statements of query, run on
+// the connection named conn, may have changed.
+func (c *ResultCache) InvalidateQuery(conn, query string) {
+	c.InvalidateStatements(conn, ParseStatements(query)...)
+}
+
+// InvalidateStatements drops the results that stmts, run on the connection
+// named conn, may have changed. Statements other than SELECT, and SELECTs
+// with a WITH clause changing rows, invalidate the results reading the
+// tables they name, or every result of conn if they name none.
+func (c *ResultCache) InvalidateStatements(conn string, stmts ...Statement) {
+	for _, stmt := range stmts {
+		if stmt.Verb == "SELECT" && !stmt.WritingCTE {
+			continue
+		}
+		if len(stmt.Tables) == 0 {
+			c.Invalidate(conn)
+			return
+		}
+		c.Invalidate(conn, stmt.Tables...)
+	}
+}
+
+// Len returns the number of cached results and their estimated size in
+// bytes.
+func (c *ResultCache) Len() (int, int64) {
+	if c == nil {
+		return 0, 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len(), c.size
+}
+
+// remove drops el from the cache. c.mu must be held.
+func (c *ResultCache) remove(el *list.Element) {
+	e := c.lru.Remove(el).(*resultCacheEntry)
+	delete(c.entries, e.key)
+	c.size -= e.size
+}
+
+func readsAny(read, tables []string) bool {
+	for _, r := range read {
+		for _, t := range tables {
+			if sameTable(r, t) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// rowsSize estimates the memory held by rows.
+func rowsSize(rows []Row) int64 {
+	var size int64
+	for _, row := range rows {
+		size += 48
+		for k, v := range row {
+			size += int64(len(k)) + 32
+			switch v := v.(type) {
+			case string:
+				size += int64(len(v))
+			case []byte:
+				size += int64(len(v))
+			default:
+				size += 16
+			}
+		}
+	}
+	return size
+}
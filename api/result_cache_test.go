@@ -0,0 +1,99 @@
+package api_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thesoulless/usqlmcp/api"
+)
+
+func TestResultCacheKey(t *testing.T) {
+	key := api.ResultCacheKey("main", "SELECT id FROM users WHERE name = 'a  b'")
+	assert.Equal(t, key, api.ResultCacheKey("main", "select  id\n  from users -- all of them\n where name = 'a  b';"))
+	assert.NotEqual(t, key, api.ResultCacheKey("main", "SELECT id FROM users WHERE name = 'a b'"))
+	assert.NotEqual(t, key, api.ResultCacheKey("main", `SELECT id FROM "Users" WHERE name = 'a  b'`))
+	assert.NotEqual(t, key, api.ResultCacheKey("other", "SELECT id FROM users WHERE name = 'a  b'"))
+	assert.NotEqual(t, api.ResultCacheKey("main", "SELECT ?", 1), api.ResultCacheKey("main", "SELECT ?", "1"))
+}
+
+func TestResultCache(t *testing.T) {
+	put := func(c *api.ResultCache, conn, query string, rows ...api.Row) string {
+		key := api.ResultCacheKey(conn, query)
+		c.Put(key, conn, query, api.CachedResult{Rows: rows, CachedAt: time.Now()})
+		return key
+	}
+
+	cache := api.NewResultCache(time.Hour, 0)
+	users := put(cache, "main", "SELECT * FROM users", api.Row{"id": 1})
+	orders := put(cache, "main", "SELECT * FROM orders o JOIN items i ON i.order_id = o.id", api.Row{"id": 2})
+	other := put(cache, "other", "SELECT * FROM users", api.Row{"id": 3})
+	constant := put(cache, "main", "SELECT 1", api.Row{"1": 1})
+
+	result, ok := cache.Get(users)
+	require.True(t, ok)
+	assert.Equal(t, []api.Row{{"id": 1}}, result.Rows)
+
+	// Writes drop the results of their connection reading the tables they
+	// touch, and those whose tables are unknown.
+	cache.InvalidateQuery("main", "SELECT * FROM users; UPDATE main.ITEMS SET qty = 0")
+	_, ok = cache.Get(orders)
+	assert.False(t, ok)
+	_, ok = cache.Get(constant)
+	assert.False(t, ok)
+	_, ok = cache.Get(users)
+	assert.True(t, ok)
+	_, ok = cache.Get(other)
+	assert.True(t, ok)
+
+	// So do SELECTs whose WITH clause changes rows.
+	cache.InvalidateQuery("main", "WITH d AS (DELETE FROM users RETURNING *) SELECT * FROM d")
+	_, ok = cache.Get(users)
+	assert.False(t, ok)
+	_, ok = cache.Get(other)
+	assert.True(t, ok)
+
+	// Results of queries started before an invalidation are not cached.
+	started := time.Now().Add(-time.Second)
+	cache.Invalidate("main", "users")
+	_, ok = cache.Get(users)
+	assert.False(t, ok)
+	cache.Put(users, "main", "SELECT * FROM users", api.CachedResult{CachedAt: started})
+	_, ok = cache.Get(users)
+	assert.False(t, ok)
+
+	// Results expire after the TTL.
+	cache = api.NewResultCache(50*time.Millisecond, 0)
+	key := put(cache, "main", "SELECT * FROM users")
+	time.Sleep(100 * time.Millisecond)
+	_, ok = cache.Get(key)
+	assert.False(t, ok)
+
+	// The least recently used results are evicted to stay within budget.
+	row := api.Row{"name": strings.Repeat("x", 1000)}
+	cache = api.NewResultCache(time.Hour, 2500)
+	first := put(cache, "main", "SELECT 1 FROM users", row)
+	second := put(cache, "main", "SELECT 2 FROM users", row)
+	_, ok = cache.Get(first)
+	require.True(t, ok)
+	put(cache, "main", "SELECT 3 FROM users", row)
+	_, ok = cache.Get(first)
+	assert.True(t, ok)
+	_, ok = cache.Get(second)
+	assert.False(t, ok)
+	n, size := cache.Len()
+	assert.Equal(t, 2, n)
+	assert.LessOrEqual(t, size, int64(2500))
+
+	put(cache, "main", "SELECT 4 FROM users", row, row, row)
+	n, _ = cache.Len()
+	assert.Equal(t, 2, n, "results larger than the budget are not cached")
+
+	assert.Nil(t, api.NewResultCache(0, 0))
+	var none *api.ResultCache
+	none.InvalidateQuery("main", "DELETE FROM users")
+	_, ok = none.Get(key)
+	assert.False(t, ok)
+}
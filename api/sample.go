@@ -0,0 +1,155 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"unicode/utf8"
+)
+
+const (
+	// DefaultSampleRows is the number of rows SampleRows returns when
+	// SampleOptions.Rows is not set.
+	DefaultSampleRows = 5
+	// MaxSampleRows caps SampleOptions.Rows.
+	MaxSampleRows = 100
+	// DefaultMaxValueLength is the number of characters text values are
+	// truncated to when SampleOptions.MaxValueLength is not set.
+	DefaultMaxValueLength = 100
+)
+
+// Sampling methods, reported in SampleResult.Method.
+const (
+	SampleRandom = "random"
+	SampleFirst  = "first"
+)
+
+// SampleOptions controls SampleRows.
+type SampleOptions struct {
+	// Rows is the number of rows to return, up to MaxSampleRows.
+	Rows int
+	// MaxValueLength truncates longer text values to that many characters.
+	// A negative value keeps them whole.
+	MaxValueLength int
+	// Mask, if set, is applied to every value before it is truncated.
+	Mask func(column string, val interface{}) interface{}
+}
+
+// SampleResult holds sample rows of a table. Rows are lists of values in
+// column order, which is more compact than one object per row.
+type SampleResult struct {
+	Table   string          `json:"table"`
+	Method  string          `json:"method"`
+	Columns []string        `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+	// TruncatedValues counts the values that were shortened.
+	TruncatedValues int `json:"truncated_values,omitempty"`
+}
+
+// SampleRows returns a few rows of table, picked at random where the dialect
+// of driver can do so and the first rows otherwise. Long text is truncated
+// and binary values are replaced by their size.
+func SampleRows(ctx context.Context, db *sql.DB, driver, table string, opts SampleOptions) (result SampleResult, err error) {
+	if opts.Rows <= 0 {
+		opts.Rows = DefaultSampleRows
+	}
+	if opts.Rows > MaxSampleRows {
+		opts.Rows = MaxSampleRows
+	}
+	if opts.MaxValueLength == 0 {
+		opts.MaxValueLength = DefaultMaxValueLength
+	}
+
+	d := DialectFor(driver)
+	query, method := d.sampleQuery(table, opts.Rows)
+	result.Table, result.Method, result.Rows = table, method, [][]interface{}{}
+
+	ctx, span := startStatementSpan(ctx, "sample", query)
+	defer func() { endStatementSpan(ctx, span, int64(len(result.Rows)), err) }()
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return result, fmt.Errorf("failed to sample table: %w", err)
+	}
+	defer rows.Close()
+
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return result, fmt.Errorf("failed to get columns: %w", err)
+	}
+	result.Columns = make([]string, len(types))
+	kinds := make([]string, len(types))
+	for i, ct := range types {
+		result.Columns[i], kinds[i] = ct.Name(), columnKind(ct)
+	}
+
+	for len(result.Rows) < opts.Rows && rows.Next() {
+		values := make([]interface{}, len(types))
+		scanArgs := make([]interface{}, len(types))
+		for i := range values {
+			scanArgs[i] = &values[i]
+		}
+		if err := rows.Scan(scanArgs...); err != nil {
+			return result, fmt.Errorf("failed to scan row: %w", err)
+		}
+		for i, v := range values {
+			if b, ok := v.([]byte); ok {
+				if kinds[i] == kindBinary {
+					values[i] = fmt.Sprintf("<%d bytes>", len(b))
+					continue
+				}
+				v = string(b)
+			}
+			if opts.Mask != nil {
+				v = opts.Mask(result.Columns[i], v)
+			}
+			if s, ok := v.(string); ok && opts.MaxValueLength > 0 && utf8.RuneCountInString(s) > opts.MaxValueLength {
+				v = truncateText(s, opts.MaxValueLength)
+				result.TruncatedValues++
+			}
+			values[i] = v
+		}
+		result.Rows = append(result.Rows, values)
+	}
+	if err := rows.Err(); err != nil {
+		return result, fmt.Errorf("row iteration error: %w", err)
+	}
+	return result, nil
+}
+
+// truncateText shortens s to n characters, marking the cut with an ellipsis.
+func truncateText(s string, n int) string {
+	i := 0
+	for j := range s {
+		if i == n {
+			return s[:j] + "…"
+		}
+		i++
+	}
+	return s
+}
+
+// sampleQuery returns a query selecting n rows of table and the method it
+// picks them by. Sampling clauses are used where the dialect has a row-count
+// form; elsewhere the table is sorted randomly.
+func (d Dialect) sampleQuery(table string, n int) (string, string) {
+	from := "SELECT * FROM " + d.QuoteQualified(table)
+	switch d.system() {
+	case "postgresql", "sqlite", "trino", "presto":
+		return d.limit(from+" ORDER BY random()", n), SampleRandom
+	case "duckdb":
+		return fmt.Sprintf("%s USING SAMPLE %d ROWS", from, n), SampleRandom
+	case "snowflake":
+		return fmt.Sprintf("%s SAMPLE (%d ROWS)", from, n), SampleRandom
+	case "mysql":
+		return d.limit(from+" ORDER BY RAND()", n), SampleRandom
+	case "mssql":
+		return d.limit(from+" ORDER BY NEWID()", n), SampleRandom
+	case "oracle":
+		return d.limit(from+" ORDER BY DBMS_RANDOM.VALUE", n), SampleRandom
+	case "clickhouse":
+		return d.limit(from+" ORDER BY rand()", n), SampleRandom
+	default:
+		return d.limit(from, n), SampleFirst
+	}
+}
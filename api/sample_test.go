@@ -0,0 +1,52 @@
+package api_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thesoulless/usqlmcp/api"
+)
+
+func TestSampleRows(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	_, err := db.Exec(`CREATE TABLE docs (id INTEGER, title TEXT, body TEXT, data BLOB)`)
+	require.NoError(t, err)
+	for i := 0; i < 20; i++ {
+		_, err := db.Exec(`INSERT INTO docs VALUES (?, ?, ?, x'010203')`, i, "doc", strings.Repeat("é", 150))
+		require.NoError(t, err)
+	}
+
+	result, err := api.SampleRows(ctx, db, "sqlite3", "docs", api.SampleOptions{
+		Rows: 3,
+		Mask: func(column string, val interface{}) interface{} {
+			if column == "title" {
+				return api.Redacted
+			}
+			return val
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "docs", result.Table)
+	assert.Equal(t, api.SampleRandom, result.Method)
+	assert.Equal(t, []string{"id", "title", "body", "data"}, result.Columns)
+	require.Len(t, result.Rows, 3)
+	assert.Equal(t, 3, result.TruncatedValues)
+	row := result.Rows[0]
+	assert.Equal(t, api.Redacted, row[1])
+	assert.Equal(t, strings.Repeat("é", api.DefaultMaxValueLength)+"…", row[2])
+	assert.Equal(t, "<3 bytes>", row[3])
+
+	result, err = api.SampleRows(ctx, db, "sqlite3", "docs", api.SampleOptions{Rows: 1000, MaxValueLength: -1})
+	require.NoError(t, err)
+	assert.Len(t, result.Rows, 20)
+	assert.Zero(t, result.TruncatedValues)
+	assert.Equal(t, strings.Repeat("é", 150), result.Rows[0][2])
+
+	_, err = api.SampleRows(ctx, db, "sqlite3", "missing", api.SampleOptions{})
+	assert.ErrorContains(t, err, "no such table")
+}
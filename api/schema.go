@@ -0,0 +1,361 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/xo/dburl"
+)
+
+// SchemaVersion is the version of the schema snapshot format.
+const SchemaVersion = 1
+
+// Schema is the catalog of a database: its tables with their columns,
+// indexes and foreign keys. It is what DiffSchema compares, and is saved as
+// JSON in schema snapshots.
+type Schema struct {
+	Version     int           `json:"version"`
+	Driver      string        `json:"driver"`
+	GeneratedAt time.Time     `json:"generated_at"`
+	Tables      []SchemaTable `json:"tables"`
+}
+
+// SchemaTable is a table of a Schema.
+type SchemaTable struct {
+	Name        string        `json:"name"`
+	Comment     string        `json:"comment,omitempty"`
+	Columns     []TableColumn `json:"columns"`
+	Indexes     []SchemaIndex `json:"indexes,omitempty"`
+	ForeignKeys []ForeignKey  `json:"foreign_keys,omitempty"`
+}
+
+// SchemaIndex is an index of a table, other than its primary key.
+type SchemaIndex struct {
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+	Unique  bool     `json:"unique"`
+}
+
+// ForeignKey is a foreign key constraint of a table. SQLite foreign keys
+// have no name.
+type ForeignKey struct {
+	Name       string   `json:"name,omitempty"`
+	Columns    []string `json:"columns"`
+	RefTable   string   `json:"ref_table"`
+	RefColumns []string `json:"ref_columns"`
+}
+
+// ReadSchema introspects the tables of the database behind dsn matching any
+// of the glob patterns in tables, or all of them. Indexes and foreign keys
+// are read on SQLite, PostgreSQL, MySQL and SQL Server, and comments on
+// PostgreSQL, MySQL and SQL Server.
+func ReadSchema(ctx context.Context, db *sql.DB, dsn string, tables []string) (*Schema, error) {
+	u, err := dburl.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse DSN: %w", err)
+	}
+	names, err := ListTables(db, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	d := DialectFor(u.Driver)
+	schema := &Schema{Version: SchemaVersion, Driver: u.Driver, GeneratedAt: time.Now().UTC(), Tables: []SchemaTable{}}
+	for _, name := range names {
+		if !matchesAny(tables, name) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		columns, err := DescribeTableUniversal(db, name, dsn)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe %s: %w", name, err)
+		}
+		table := SchemaTable{Name: name, Columns: columns}
+		if table.Indexes, err = d.schemaIndexes(ctx, db, name); err != nil {
+			return nil, fmt.Errorf("failed to read indexes of %s: %w", name, err)
+		}
+		if table.ForeignKeys, err = d.schemaForeignKeys(ctx, db, name); err != nil {
+			return nil, fmt.Errorf("failed to read foreign keys of %s: %w", name, err)
+		}
+		if err := d.schemaComments(ctx, db, &table); err != nil {
+			return nil, fmt.Errorf("failed to read comments of %s: %w", name, err)
+		}
+		schema.Tables = append(schema.Tables, table)
+	}
+	return schema, nil
+}
+
+// LoadSchema reads a schema snapshot file.
+func LoadSchema(path string) (*Schema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema snapshot: %w", err)
+	}
+	var schema Schema
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("failed to parse schema snapshot: %w", err)
+	}
+	if schema.Version != SchemaVersion {
+		return nil, fmt.Errorf("unsupported schema snapshot version %d, want %d", schema.Version, SchemaVersion)
+	}
+	return &schema, nil
+}
+
+// WriteSchema writes s to w as indented JSON, in the schema snapshot format.
+func WriteSchema(w io.Writer, s *Schema) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(s); err != nil {
+		return fmt.Errorf("failed to write schema snapshot: %w", err)
+	}
+	return nil
+}
+
+// SaveSchema writes s to a schema snapshot file. The file is replaced
+// atomically, so that readers never see a partial snapshot.
+func SaveSchema(path string, s *Schema) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".schema-*.json")
+	if err != nil {
+		return fmt.Errorf("failed to write schema snapshot: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write schema snapshot: %w", err)
+	}
+	if err := WriteSchema(tmp, s); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write schema snapshot: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write schema snapshot: %w", err)
+	}
+	return nil
+}
+
+// TableNames returns the names of the tables of s.
+func (s *Schema) TableNames() []string {
+	names := make([]string, len(s.Tables))
+	for i, t := range s.Tables {
+		names[i] = t.Name
+	}
+	return names
+}
+
+// Table returns the table of s named name, ignoring case, or nil.
+func (s *Schema) Table(name string) *SchemaTable {
+	for i := range s.Tables {
+		if strings.EqualFold(s.Tables[i].Name, name) {
+			return &s.Tables[i]
+		}
+	}
+	return nil
+}
+
+// schemaIndexes returns the indexes of table other than its primary key.
+// Each row of the dialect's query is an index name, whether it is unique
+// and one of its columns, in order.
+func (d Dialect) schemaIndexes(ctx context.Context, db *sql.DB, table string) ([]SchemaIndex, error) {
+	var query string
+	var args []interface{}
+	switch d.system() {
+	case "sqlite":
+		query = `SELECT il.name, il."unique", COALESCE(ii.name, '')
+			FROM pragma_index_list(?) il JOIN pragma_index_info(il.name) ii
+			WHERE il.origin <> 'pk'
+			ORDER BY il.name, ii.seqno`
+		args = []interface{}{table}
+	case "postgresql":
+		query = `SELECT i.relname, ix.indisunique, COALESCE(a.attname, '')
+			FROM pg_index ix
+			JOIN pg_class i ON i.oid = ix.indexrelid
+			CROSS JOIN LATERAL unnest(ix.indkey) WITH ORDINALITY AS k(attnum, n)
+			LEFT JOIN pg_attribute a ON a.attrelid = ix.indrelid AND a.attnum = k.attnum
+			WHERE ix.indrelid = $1::regclass AND NOT ix.indisprimary
+			ORDER BY i.relname, k.n`
+		args = []interface{}{d.QuoteQualified(table)}
+	case "mysql":
+		query = `SELECT INDEX_NAME, NON_UNIQUE = 0, COALESCE(COLUMN_NAME, '')
+			FROM information_schema.STATISTICS
+			WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND INDEX_NAME <> 'PRIMARY'
+			ORDER BY INDEX_NAME, SEQ_IN_INDEX`
+		args = []interface{}{table}
+	case "mssql":
+		query = `SELECT i.name, i.is_unique, c.name
+			FROM sys.indexes i
+			JOIN sys.index_columns ic ON ic.object_id = i.object_id AND ic.index_id = i.index_id
+			JOIN sys.columns c ON c.object_id = ic.object_id AND c.column_id = ic.column_id
+			WHERE i.object_id = OBJECT_ID(@p1) AND i.is_primary_key = 0 AND ic.key_ordinal > 0
+			ORDER BY i.name, ic.key_ordinal`
+		args = []interface{}{table}
+	default:
+		return nil, nil
+	}
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var indexes []SchemaIndex
+	for rows.Next() {
+		var name, column string
+		var unique interface{}
+		if err := rows.Scan(&name, &unique, &column); err != nil {
+			return nil, err
+		}
+		if n := len(indexes); n == 0 || indexes[n-1].Name != name {
+			u, _ := unique.(bool)
+			if v, ok := intValue(unique); ok {
+				u = v != 0
+			}
+			indexes = append(indexes, SchemaIndex{Name: name, Unique: u})
+		}
+		idx := &indexes[len(indexes)-1]
+		idx.Columns = append(idx.Columns, column)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Expression indexes cannot be described by their columns alone.
+	kept := indexes[:0]
+	for _, idx := range indexes {
+		if !slices.Contains(idx.Columns, "") {
+			kept = append(kept, idx)
+		}
+	}
+	return kept, nil
+}
+
+// schemaForeignKeys returns the foreign keys of table. Each row of the
+// dialect's query is a key identifying the constraint, its name, and one
+// pair of referencing and referenced columns, in order.
+func (d Dialect) schemaForeignKeys(ctx context.Context, db *sql.DB, table string) ([]ForeignKey, error) {
+	var query string
+	var args []interface{}
+	switch d.system() {
+	case "sqlite":
+		query = `SELECT CAST(id AS TEXT), '', "table", "from", COALESCE("to", '')
+			FROM pragma_foreign_key_list(?)
+			ORDER BY id, seq`
+		args = []interface{}{table}
+	case "postgresql":
+		query = `SELECT c.conname, c.conname, f.relname, a.attname, fa.attname
+			FROM pg_constraint c
+			CROSS JOIN LATERAL unnest(c.conkey, c.confkey) WITH ORDINALITY AS k(attnum, fattnum, n)
+			JOIN pg_attribute a ON a.attrelid = c.conrelid AND a.attnum = k.attnum
+			JOIN pg_class f ON f.oid = c.confrelid
+			JOIN pg_attribute fa ON fa.attrelid = c.confrelid AND fa.attnum = k.fattnum
+			WHERE c.conrelid = $1::regclass AND c.contype = 'f'
+			ORDER BY c.conname, k.n`
+		args = []interface{}{d.QuoteQualified(table)}
+	case "mysql":
+		query = `SELECT CONSTRAINT_NAME, CONSTRAINT_NAME, REFERENCED_TABLE_NAME, COLUMN_NAME, REFERENCED_COLUMN_NAME
+			FROM information_schema.KEY_COLUMN_USAGE
+			WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND REFERENCED_TABLE_NAME IS NOT NULL
+			ORDER BY CONSTRAINT_NAME, ORDINAL_POSITION`
+		args = []interface{}{table}
+	case "mssql":
+		query = `SELECT fk.name, fk.name, OBJECT_NAME(fkc.referenced_object_id),
+				COL_NAME(fkc.parent_object_id, fkc.parent_column_id),
+				COL_NAME(fkc.referenced_object_id, fkc.referenced_column_id)
+			FROM sys.foreign_keys fk
+			JOIN sys.foreign_key_columns fkc ON fkc.constraint_object_id = fk.object_id
+			WHERE fk.parent_object_id = OBJECT_ID(@p1)
+			ORDER BY fk.name, fkc.constraint_column_id`
+		args = []interface{}{table}
+	default:
+		return nil, nil
+	}
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var keys []ForeignKey
+	last := ""
+	for rows.Next() {
+		var id, name, refTable, column, refColumn string
+		if err := rows.Scan(&id, &name, &refTable, &column, &refColumn); err != nil {
+			return nil, err
+		}
+		if len(keys) == 0 || id != last {
+			keys = append(keys, ForeignKey{Name: name, RefTable: refTable})
+			last = id
+		}
+		fk := &keys[len(keys)-1]
+		fk.Columns = append(fk.Columns, column)
+		fk.RefColumns = append(fk.RefColumns, refColumn)
+	}
+	return keys, rows.Err()
+}
+
+// schemaComments fills in the comments of table and its columns. Each row
+// of the dialect's query is a column name, or an empty string for the table
+// itself, and its comment.
+func (d Dialect) schemaComments(ctx context.Context, db *sql.DB, table *SchemaTable) error {
+	var query string
+	var args []interface{}
+	switch d.system() {
+	case "postgresql":
+		query = `SELECT '', COALESCE(obj_description($1::regclass, 'pg_class'), '')
+			UNION ALL
+			SELECT a.attname, col_description(a.attrelid, a.attnum)
+			FROM pg_attribute a
+			WHERE a.attrelid = $1::regclass AND a.attnum > 0 AND NOT a.attisdropped
+				AND col_description(a.attrelid, a.attnum) IS NOT NULL`
+		args = []interface{}{d.QuoteQualified(table.Name)}
+	case "mysql":
+		query = `SELECT '', TABLE_COMMENT FROM information_schema.TABLES
+			WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?
+			UNION ALL
+			SELECT COLUMN_NAME, COLUMN_COMMENT FROM information_schema.COLUMNS
+			WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_COMMENT <> ''`
+		args = []interface{}{table.Name, table.Name}
+	case "mssql":
+		query = `SELECT COALESCE(c.name, ''), CAST(p.value AS NVARCHAR(MAX))
+			FROM sys.extended_properties p
+			LEFT JOIN sys.columns c ON c.object_id = p.major_id AND c.column_id = p.minor_id
+			WHERE p.major_id = OBJECT_ID(@p1) AND p.class = 1 AND p.name = 'MS_Description'`
+		args = []interface{}{table.Name}
+	default:
+		return nil
+	}
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var column, comment string
+		if err := rows.Scan(&column, &comment); err != nil {
+			return err
+		}
+		if column == "" {
+			table.Comment = comment
+			continue
+		}
+		for i := range table.Columns {
+			if table.Columns[i].Name == column {
+				table.Columns[i].Comment = comment
+			}
+		}
+	}
+	return rows.Err()
+}
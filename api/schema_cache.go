@@ -0,0 +1,213 @@
+package api
+
+import (
+	"database/sql"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// SchemaCache caches the results of ListTables and DescribeTableUniversal per
+// DSN for a fixed TTL. Concurrent lookups of the same entry share a single
+// catalog query, and errors are not cached. A nil *SchemaCache caches nothing.
+type SchemaCache struct {
+	ttl   time.Duration
+	group singleflight.Group
+
+	mu  sync.Mutex
+	dbs map[string]*schemaCacheDB
+	// gen is incremented by every invalidation, so that lookups started
+	// before one do not store what they read.
+	gen uint64
+}
+
+// schemaCacheDB holds the cached catalog of one DSN. Columns are keyed by
+// table name as requested.
+type schemaCacheDB struct {
+	tables  *schemaCacheEntry
+	columns map[string]*schemaCacheEntry
+}
+
+type schemaCacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// NewSchemaCache returns a cache whose entries expire after ttl, or nil if
+// ttl is not positive.
+func NewSchemaCache(ttl time.Duration) *SchemaCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &SchemaCache{ttl: ttl, dbs: map[string]*schemaCacheDB{}}
+}
+
+// ListTables is ListTables, cached.
+func (c *SchemaCache) ListTables(db *sql.DB, dsn string) ([]string, error) {
+	if c == nil {
+		return ListTables(db, dsn)
+	}
+	v, err := c.lookup(dsn, "", func() (interface{}, error) {
+		return ListTables(db, dsn)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return slices.Clone(v.([]string)), nil
+}
+
+// DescribeTable is DescribeTableUniversal, cached.
+func (c *SchemaCache) DescribeTable(db *sql.DB, tableName string, dsn string) ([]TableColumn, error) {
+	if c == nil {
+		return DescribeTableUniversal(db, tableName, dsn)
+	}
+	v, err := c.lookup(dsn, tableName, func() (interface{}, error) {
+		return DescribeTableUniversal(db, tableName, dsn)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return slices.Clone(v.([]TableColumn)), nil
+}
+
+// lookup returns the entry of dsn for table, or the table list if table is
+// empty, calling load to fill it in if it is missing or expired.
+func (c *SchemaCache) lookup(dsn, table string, load func() (interface{}, error)) (interface{}, error) {
+	now := time.Now()
+	c.mu.Lock()
+	if e := c.entry(dsn, table); e != nil && now.Before(e.expires) {
+		c.mu.Unlock()
+		return e.value, nil
+	}
+	c.mu.Unlock()
+
+	v, err, _ := c.group.Do(c.key(dsn, table), func() (interface{}, error) {
+		c.mu.Lock()
+		gen := c.gen
+		c.mu.Unlock()
+		v, err := load()
+		if err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.gen != gen {
+			return v, nil
+		}
+		d := c.dbs[dsn]
+		if d == nil {
+			d = &schemaCacheDB{columns: map[string]*schemaCacheEntry{}}
+			c.dbs[dsn] = d
+		}
+		e := &schemaCacheEntry{value: v, expires: time.Now().Add(c.ttl)}
+		if table == "" {
+			d.tables = e
+		} else {
+			d.columns[table] = e
+		}
+		return v, nil
+	})
+	return v, err
+}
+
+// entry returns the cached entry of dsn for table, or nil. c.mu must be held.
+func (c *SchemaCache) entry(dsn, table string) *schemaCacheEntry {
+	d := c.dbs[dsn]
+	if d == nil {
+		return nil
+	}
+	if table == "" {
+		return d.tables
+	}
+	return d.columns[table]
+}
+
+func (c *SchemaCache) key(dsn, table string) string {
+	return dsn + "\x00" + table
+}
+
+// Invalidate drops the cached table list of dsn and the columns of tables,
+// or everything cached for dsn if no tables are given. Table names are
+// matched ignoring case, quotes and, when either is unqualified, schema.
+// Lookups already running when Invalidate is called are not shared with
+// later ones.
+func (c *SchemaCache) Invalidate(dsn string, tables ...string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	d := c.dbs[dsn]
+	c.group.Forget(c.key(dsn, ""))
+	if len(tables) == 0 {
+		if d != nil {
+			for table := range d.columns {
+				c.group.Forget(c.key(dsn, table))
+			}
+		}
+		delete(c.dbs, dsn)
+		return
+	}
+	if d == nil {
+		return
+	}
+	d.tables = nil
+	for table := range d.columns {
+		for _, t := range tables {
+			if sameTable(table, t) {
+				delete(d.columns, table)
+				c.group.Forget(c.key(dsn, table))
+				break
+			}
+		}
+	}
+}
+
+// InvalidateQuery invalidates what the DDL statements of query may have
+// changed on dsn, and reports whether it had any.
+func (c *SchemaCache) InvalidateQuery(dsn, query string) bool {
+	return c.InvalidateStatements(dsn, ParseStatements(query)...)
+}
+
+// InvalidateStatements invalidates what the DDL statements among stmts may
+// have changed on dsn, and reports whether there were any. Statements on
+// tables invalidate those tables; other DDL, such as on views or schemas,
+// invalidates everything cached for dsn.
+func (c *SchemaCache) InvalidateStatements(dsn string, stmts ...Statement) bool {
+	ddl := false
+	for _, stmt := range stmts {
+		switch stmt.Verb {
+		case "CREATE", "ALTER", "DROP", "RENAME", "COMMENT":
+		default:
+			continue
+		}
+		ddl = true
+		if (stmt.Object == "TABLE" || stmt.Object == "INDEX") && len(stmt.Tables) > 0 {
+			c.Invalidate(dsn, stmt.Tables...)
+		} else {
+			c.Invalidate(dsn)
+		}
+	}
+	return ddl
+}
+
+// sameTable reports whether the table names a and b may name the same
+// table.
+func sameTable(a, b string) bool {
+	a, b = normalizeTableName(a), normalizeTableName(b)
+	if a == b {
+		return true
+	}
+	if !strings.Contains(a, ".") || !strings.Contains(b, ".") {
+		return a[strings.LastIndex(a, ".")+1:] == b[strings.LastIndex(b, ".")+1:]
+	}
+	return false
+}
+
+func normalizeTableName(name string) string {
+	return strings.ToLower(strings.NewReplacer(`"`, "", "`", "", "[", "", "]", "").Replace(name))
+}
@@ -0,0 +1,92 @@
+package api_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thesoulless/usqlmcp/api"
+)
+
+func TestSchemaCache(t *testing.T) {
+	db := openTestDB(t)
+	dsn := "sqlite3://test_schema_cache.db"
+	_, err := db.Exec(`CREATE TABLE orders (id INTEGER PRIMARY KEY, total REAL)`)
+	require.NoError(t, err)
+
+	cache := api.NewSchemaCache(time.Hour)
+	tables, err := cache.ListTables(db, dsn)
+	require.NoError(t, err)
+	assert.Contains(t, tables, "orders")
+	columns, err := cache.DescribeTable(db, "orders", dsn)
+	require.NoError(t, err)
+	assert.Len(t, columns, 2)
+
+	// Changes made behind the cache's back are not seen until invalidated.
+	_, err = db.Exec(`ALTER TABLE orders ADD COLUMN status TEXT; CREATE TABLE refunds (id INTEGER)`)
+	require.NoError(t, err)
+	columns, err = cache.DescribeTable(db, "orders", dsn)
+	require.NoError(t, err)
+	assert.Len(t, columns, 2)
+	tables, err = cache.ListTables(db, dsn)
+	require.NoError(t, err)
+	assert.NotContains(t, tables, "refunds")
+
+	cache.Invalidate(dsn, `"main"."ORDERS"`)
+	columns, err = cache.DescribeTable(db, "orders", dsn)
+	require.NoError(t, err)
+	assert.Len(t, columns, 3)
+	tables, err = cache.ListTables(db, dsn)
+	require.NoError(t, err)
+	assert.Contains(t, tables, "refunds")
+
+	// DDL invalidates the tables it names; other statements do nothing.
+	assert.False(t, cache.InvalidateQuery(dsn, `UPDATE orders SET total = 0`))
+	_, err = db.Exec(`ALTER TABLE orders ADD COLUMN note TEXT`)
+	require.NoError(t, err)
+	assert.True(t, cache.InvalidateQuery(dsn, `UPDATE orders SET total = 0; ALTER TABLE orders ADD COLUMN note TEXT`))
+	columns, err = cache.DescribeTable(db, "orders", dsn)
+	require.NoError(t, err)
+	assert.Len(t, columns, 4)
+
+	// Callers cannot change cached entries.
+	columns[0].Name = "changed"
+	columns, err = cache.DescribeTable(db, "orders", dsn)
+	require.NoError(t, err)
+	assert.Equal(t, "id", columns[0].Name)
+
+	// Concurrent lookups all get the table.
+	cache.Invalidate(dsn)
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			columns, err := cache.DescribeTable(db, "orders", dsn)
+			assert.NoError(t, err)
+			assert.Len(t, columns, 4)
+		}()
+	}
+	wg.Wait()
+
+	// Entries expire after the TTL.
+	cache = api.NewSchemaCache(50 * time.Millisecond)
+	_, err = cache.DescribeTable(db, "orders", dsn)
+	require.NoError(t, err)
+	_, err = db.Exec(`ALTER TABLE orders ADD COLUMN region TEXT`)
+	require.NoError(t, err)
+	time.Sleep(100 * time.Millisecond)
+	columns, err = cache.DescribeTable(db, "orders", dsn)
+	require.NoError(t, err)
+	assert.Len(t, columns, 5)
+
+	// A zero TTL disables the cache, and a nil cache queries every time.
+	assert.Nil(t, api.NewSchemaCache(0))
+	var none *api.SchemaCache
+	none.Invalidate(dsn)
+	columns, err = none.DescribeTable(db, "orders", dsn)
+	require.NoError(t, err)
+	assert.Len(t, columns, 5)
+}
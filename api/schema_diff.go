@@ -0,0 +1,512 @@
+package api
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// SchemaDiffOptions controls DiffSchema.
+type SchemaDiffOptions struct {
+	// Tables restricts the comparison to tables matching any of these glob
+	// patterns.
+	Tables []string
+	// Drop adds DDL dropping the tables, columns, indexes and foreign keys
+	// that only the target has. They are reported either way.
+	Drop bool
+}
+
+// SchemaDiff lists the differences that keep a target schema from matching
+// a source schema, and the DDL in the target's dialect that removes them.
+type SchemaDiff struct {
+	// MissingTables are in the source only, ExtraTables in the target only.
+	MissingTables []string    `json:"missing_tables,omitempty"`
+	ExtraTables   []string    `json:"extra_tables,omitempty"`
+	ChangedTables []TableDiff `json:"changed_tables,omitempty"`
+	// DDL are the statements to run on the target. Changes the target's
+	// dialect cannot make are included as SQL comments.
+	DDL []string `json:"ddl"`
+}
+
+// TableDiff lists the differences of a table both schemas have. Missing
+// items are in the source only, extra items in the target only.
+type TableDiff struct {
+	Table              string        `json:"table"`
+	MissingColumns     []TableColumn `json:"missing_columns,omitempty"`
+	ExtraColumns       []string      `json:"extra_columns,omitempty"`
+	ChangedColumns     []ColumnDiff  `json:"changed_columns,omitempty"`
+	MissingIndexes     []SchemaIndex `json:"missing_indexes,omitempty"`
+	ExtraIndexes       []SchemaIndex `json:"extra_indexes,omitempty"`
+	MissingForeignKeys []ForeignKey  `json:"missing_foreign_keys,omitempty"`
+	ExtraForeignKeys   []ForeignKey  `json:"extra_foreign_keys,omitempty"`
+}
+
+// ColumnDiff is a column that differs between the schemas. Changes names
+// the differing attributes: type, nullable, default and primary_key.
+type ColumnDiff struct {
+	Column  string      `json:"column"`
+	Source  TableColumn `json:"source"`
+	Target  TableColumn `json:"target"`
+	Changes []string    `json:"changes"`
+}
+
+// DiffSchema compares target with source. Names are matched ignoring case.
+// When both schemas come from the same kind of database, column types and
+// defaults are compared as written; otherwise types are compared by kind
+// and defaults, which are dialect-specific expressions, are not compared.
+// Indexes and foreign keys are matched by their columns, not their names.
+func DiffSchema(source, target *Schema, opts SchemaDiffOptions) SchemaDiff {
+	g := ddlGenerator{
+		src:  DialectFor(source.Driver),
+		dst:  DialectFor(target.Driver),
+		drop: opts.Drop,
+	}
+	g.same = g.src.system() == g.dst.system()
+	diff := SchemaDiff{DDL: []string{}}
+
+	var created []SchemaTable
+	for _, t := range source.Tables {
+		if !matchesAny(opts.Tables, t.Name) {
+			continue
+		}
+		other := target.Table(t.Name)
+		if other == nil {
+			diff.MissingTables = append(diff.MissingTables, t.Name)
+			g.createTable(t)
+			created = append(created, t)
+			continue
+		}
+		if td, changed := g.diffTable(t, *other); changed {
+			diff.ChangedTables = append(diff.ChangedTables, td)
+		}
+	}
+	// Foreign keys of new tables are added once every table exists, except
+	// on SQLite where they are part of CREATE TABLE.
+	if g.dst.system() != "sqlite" {
+		for _, t := range created {
+			for _, fk := range t.ForeignKeys {
+				g.addForeignKey(t.Name, fk)
+			}
+		}
+	}
+	for _, t := range target.Tables {
+		if matchesAny(opts.Tables, t.Name) && source.Table(t.Name) == nil {
+			diff.ExtraTables = append(diff.ExtraTables, t.Name)
+			if opts.Drop {
+				g.add("DROP TABLE " + g.dst.QuoteQualified(t.Name))
+			}
+		}
+	}
+	diff.DDL = append(diff.DDL, g.ddl...)
+	return diff
+}
+
+// diffTable compares a table both schemas have.
+func (g *ddlGenerator) diffTable(src, dst SchemaTable) (TableDiff, bool) {
+	td := TableDiff{Table: dst.Name}
+	for _, c := range src.Columns {
+		other := findColumn(dst.Columns, c.Name)
+		if other == nil {
+			td.MissingColumns = append(td.MissingColumns, c)
+			g.addColumn(dst.Name, c)
+			continue
+		}
+		if changes := g.columnChanges(c, *other); len(changes) > 0 {
+			td.ChangedColumns = append(td.ChangedColumns, ColumnDiff{Column: other.Name, Source: c, Target: *other, Changes: changes})
+			g.alterColumn(dst.Name, c, *other, changes)
+		}
+	}
+	for _, c := range dst.Columns {
+		if findColumn(src.Columns, c.Name) == nil {
+			td.ExtraColumns = append(td.ExtraColumns, c.Name)
+			if g.drop {
+				g.add(fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", g.dst.QuoteQualified(dst.Name), g.dst.QuoteIdent(c.Name)))
+			}
+		}
+	}
+
+	for _, idx := range src.Indexes {
+		if !hasIndex(dst.Indexes, idx) {
+			td.MissingIndexes = append(td.MissingIndexes, idx)
+			g.createIndex(dst.Name, idx)
+		}
+	}
+	for _, idx := range dst.Indexes {
+		if !hasIndex(src.Indexes, idx) {
+			td.ExtraIndexes = append(td.ExtraIndexes, idx)
+			g.dropIndex(dst.Name, idx)
+		}
+	}
+	for _, fk := range src.ForeignKeys {
+		if !hasForeignKey(dst.ForeignKeys, fk) {
+			td.MissingForeignKeys = append(td.MissingForeignKeys, fk)
+			g.addForeignKey(dst.Name, fk)
+		}
+	}
+	for _, fk := range dst.ForeignKeys {
+		if !hasForeignKey(src.ForeignKeys, fk) {
+			td.ExtraForeignKeys = append(td.ExtraForeignKeys, fk)
+			g.dropForeignKey(dst.Name, fk)
+		}
+	}
+
+	changed := len(td.MissingColumns)+len(td.ExtraColumns)+len(td.ChangedColumns)+
+		len(td.MissingIndexes)+len(td.ExtraIndexes)+len(td.MissingForeignKeys)+len(td.ExtraForeignKeys) > 0
+	return td, changed
+}
+
+// columnChanges returns the attributes in which column dst differs from src.
+func (g *ddlGenerator) columnChanges(src, dst TableColumn) []string {
+	var changes []string
+	if g.same {
+		if normalizeType(src.Type) != normalizeType(dst.Type) {
+			changes = append(changes, "type")
+		}
+	} else if typeKind(src.Type) != typeKind(dst.Type) {
+		changes = append(changes, "type")
+	}
+	if src.Nullable != dst.Nullable {
+		changes = append(changes, "nullable")
+	}
+	if g.same && fmt.Sprint(src.Default) != fmt.Sprint(dst.Default) {
+		changes = append(changes, "default")
+	}
+	if src.IsPrimaryKey != dst.IsPrimaryKey {
+		changes = append(changes, "primary_key")
+	}
+	return changes
+}
+
+func findColumn(columns []TableColumn, name string) *TableColumn {
+	for i := range columns {
+		if strings.EqualFold(columns[i].Name, name) {
+			return &columns[i]
+		}
+	}
+	return nil
+}
+
+func hasIndex(indexes []SchemaIndex, idx SchemaIndex) bool {
+	for _, other := range indexes {
+		if other.Unique == idx.Unique && equalFoldAll(other.Columns, idx.Columns) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasForeignKey(keys []ForeignKey, fk ForeignKey) bool {
+	for _, other := range keys {
+		if strings.EqualFold(other.RefTable, fk.RefTable) &&
+			equalFoldAll(other.Columns, fk.Columns) && equalFoldAll(other.RefColumns, fk.RefColumns) {
+			return true
+		}
+	}
+	return false
+}
+
+func equalFoldAll(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !strings.EqualFold(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+var typeSpaces = regexp.MustCompile(`\s*([(),])\s*|\s+`)
+
+// normalizeType lowercases a type name and removes insignificant spaces, so
+// that DECIMAL(10, 2) and decimal(10,2) compare equal.
+func normalizeType(t string) string {
+	return typeSpaces.ReplaceAllStringFunc(strings.ToLower(strings.TrimSpace(t)), func(s string) string {
+		if s = strings.TrimSpace(s); s == "" {
+			return " "
+		}
+		return s
+	})
+}
+
+// ddlGenerator accumulates the DDL that brings a target schema in line with
+// a source schema.
+type ddlGenerator struct {
+	src, dst Dialect
+	same     bool
+	drop     bool
+	ddl      []string
+}
+
+func (g *ddlGenerator) add(stmt string) {
+	g.ddl = append(g.ddl, stmt)
+}
+
+// unsupported records a change the target's dialect cannot make as a
+// comment, so that it is not lost.
+func (g *ddlGenerator) unsupported(format string, args ...interface{}) {
+	g.add("-- " + fmt.Sprintf(format, args...))
+}
+
+var typeSize = regexp.MustCompile(`\(\s*(\d+)\s*(?:,\s*(\d+)\s*)?\)`)
+
+// columnType returns the type of source column c in the target's dialect.
+// Types are kept as written between the same kind of database; otherwise
+// they are mapped by kind, keeping decimal precision and text lengths.
+func (g *ddlGenerator) columnType(c TableColumn) string {
+	if g.same {
+		return c.Type
+	}
+	kind := typeKind(c.Type)
+	size := typeSize.FindStringSubmatch(c.Type)
+	system := g.dst.system()
+	switch {
+	case size != nil && kind == kindDecimal && system != "sqlite":
+		scale := size[2]
+		if scale == "" {
+			scale = "0"
+		}
+		switch system {
+		case "clickhouse":
+			return fmt.Sprintf("Decimal(%s, %s)", size[1], scale)
+		case "oracle":
+			return fmt.Sprintf("NUMBER(%s, %s)", size[1], scale)
+		}
+		return fmt.Sprintf("DECIMAL(%s, %s)", size[1], scale)
+	case size != nil && kind == kindText && size[2] == "" && system != "sqlite" && system != "clickhouse":
+		if system == "oracle" {
+			return "VARCHAR2(" + size[1] + ")"
+		}
+		return "VARCHAR(" + size[1] + ")"
+	}
+	return g.dst.typeFor(kind)
+}
+
+// columnDef returns the definition of source column c in the target's
+// dialect. Defaults are only carried over between the same kind of
+// database.
+func (g *ddlGenerator) columnDef(c TableColumn) string {
+	def := g.dst.QuoteIdent(c.Name) + " " + g.columnType(c)
+	if g.same && c.Default != nil {
+		def += fmt.Sprintf(" DEFAULT %v", c.Default)
+	}
+	if !c.Nullable && g.dst.system() != "clickhouse" {
+		def += " NOT NULL"
+	}
+	return def
+}
+
+func (g *ddlGenerator) quoteList(names []string) string {
+	quoted := make([]string, len(names))
+	for i, n := range names {
+		quoted[i] = g.dst.QuoteIdent(n)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func (g *ddlGenerator) createTable(t SchemaTable) {
+	defs := make([]string, 0, len(t.Columns)+1)
+	var pk []string
+	for _, c := range t.Columns {
+		defs = append(defs, g.columnDef(c))
+		if c.IsPrimaryKey {
+			pk = append(pk, c.Name)
+		}
+	}
+	stmt := fmt.Sprintf("CREATE TABLE %s (%s", g.dst.QuoteQualified(t.Name), strings.Join(defs, ", "))
+	if len(pk) > 0 && g.dst.system() != "clickhouse" {
+		stmt += ", PRIMARY KEY (" + g.quoteList(pk) + ")"
+	}
+	// SQLite cannot add foreign keys later; it also does not require the
+	// referenced table to exist yet.
+	if g.dst.system() == "sqlite" {
+		for _, fk := range t.ForeignKeys {
+			stmt += ", " + g.foreignKeyDef(fk)
+		}
+	}
+	stmt += ")"
+	if g.dst.system() == "clickhouse" {
+		order := "tuple()"
+		if len(pk) > 0 {
+			order = "(" + g.quoteList(pk) + ")"
+		}
+		stmt += " ENGINE = MergeTree ORDER BY " + order
+	}
+	g.add(stmt)
+	for _, idx := range t.Indexes {
+		g.createIndex(t.Name, idx)
+	}
+}
+
+func (g *ddlGenerator) addColumn(table string, c TableColumn) {
+	qt := g.dst.QuoteQualified(table)
+	switch g.dst.system() {
+	case "mssql":
+		g.add(fmt.Sprintf("ALTER TABLE %s ADD %s", qt, g.columnDef(c)))
+	case "oracle":
+		g.add(fmt.Sprintf("ALTER TABLE %s ADD (%s)", qt, g.columnDef(c)))
+	default:
+		g.add(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", qt, g.columnDef(c)))
+	}
+	if c.IsPrimaryKey {
+		g.unsupported("add column %s of %s to the primary key", c.Name, table)
+	}
+}
+
+// alterColumn changes column dst of table to match src.
+func (g *ddlGenerator) alterColumn(table string, src, dst TableColumn, changes []string) {
+	qt, qc := g.dst.QuoteQualified(table), g.dst.QuoteIdent(dst.Name)
+	changed := func(attr string) bool { return slices.Contains(changes, attr) }
+	if changed("primary_key") {
+		g.unsupported("change whether column %s is part of the primary key of %s", dst.Name, table)
+	}
+	if !changed("type") && !changed("nullable") && !changed("default") {
+		return
+	}
+
+	typ := g.columnType(src)
+	switch g.dst.system() {
+	case "sqlite":
+		g.unsupported("SQLite cannot alter column %s of %s (%s); rebuild the table", dst.Name, table, strings.Join(changes, ", "))
+	case "mysql":
+		g.add(fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s", qt, g.columnDef(TableColumn{Name: dst.Name, Type: src.Type, Nullable: src.Nullable, Default: src.Default})))
+	case "oracle":
+		// Oracle rejects restating the nullability a column already has.
+		null := ""
+		if changed("nullable") {
+			null = " NULL"
+			if !src.Nullable {
+				null = " NOT NULL"
+			}
+		}
+		if changed("type") {
+			g.add(fmt.Sprintf("ALTER TABLE %s MODIFY (%s %s%s)", qt, qc, typ, null))
+		} else if changed("nullable") {
+			g.add(fmt.Sprintf("ALTER TABLE %s MODIFY (%s%s)", qt, qc, null))
+		}
+		if changed("default") {
+			g.add(fmt.Sprintf("ALTER TABLE %s MODIFY (%s DEFAULT %s)", qt, qc, defaultOrNull(src.Default)))
+		}
+	case "mssql":
+		null := " NULL"
+		if !src.Nullable {
+			null = " NOT NULL"
+		}
+		if changed("type") || changed("nullable") {
+			g.add(fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s %s%s", qt, qc, typ, null))
+		}
+		if changed("default") {
+			g.unsupported("change the default of %s.%s to %s; SQL Server defaults are named constraints", table, dst.Name, defaultOrNull(src.Default))
+		}
+	case "clickhouse":
+		if src.Nullable {
+			typ = "Nullable(" + typ + ")"
+		}
+		g.add(fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s %s", qt, qc, typ))
+	default:
+		setType := "TYPE"
+		if g.dst.system() == "snowflake" {
+			setType = "SET DATA TYPE"
+		}
+		if changed("type") {
+			g.add(fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s %s %s", qt, qc, setType, typ))
+		}
+		if changed("nullable") {
+			action := "DROP NOT NULL"
+			if !src.Nullable {
+				action = "SET NOT NULL"
+			}
+			g.add(fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s %s", qt, qc, action))
+		}
+		if changed("default") {
+			if src.Default == nil {
+				g.add(fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s DROP DEFAULT", qt, qc))
+			} else {
+				g.add(fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s SET DEFAULT %v", qt, qc, src.Default))
+			}
+		}
+	}
+}
+
+func defaultOrNull(v interface{}) string {
+	if v == nil {
+		return "NULL"
+	}
+	return fmt.Sprint(v)
+}
+
+// indexName returns the name of idx, making one up from the table and
+// columns when it has none.
+func indexName(table string, idx SchemaIndex) string {
+	if idx.Name != "" {
+		return idx.Name
+	}
+	_, name := splitQualified(table)
+	return strings.ToLower("idx_" + name + "_" + strings.Join(idx.Columns, "_"))
+}
+
+func (g *ddlGenerator) createIndex(table string, idx SchemaIndex) {
+	if g.dst.system() == "clickhouse" {
+		g.unsupported("ClickHouse has no secondary index matching %s on %s", indexName(table, idx), table)
+		return
+	}
+	unique := ""
+	if idx.Unique {
+		unique = "UNIQUE "
+	}
+	g.add(fmt.Sprintf("CREATE %sINDEX %s ON %s (%s)", unique, g.dst.QuoteIdent(indexName(table, idx)), g.dst.QuoteQualified(table), g.quoteList(idx.Columns)))
+}
+
+func (g *ddlGenerator) dropIndex(table string, idx SchemaIndex) {
+	if !g.drop {
+		return
+	}
+	name := g.dst.QuoteIdent(idx.Name)
+	switch g.dst.system() {
+	case "mysql", "mssql":
+		g.add(fmt.Sprintf("DROP INDEX %s ON %s", name, g.dst.QuoteQualified(table)))
+	default:
+		g.add("DROP INDEX " + name)
+	}
+}
+
+func (g *ddlGenerator) foreignKeyDef(fk ForeignKey) string {
+	def := fmt.Sprintf("FOREIGN KEY (%s) REFERENCES %s", g.quoteList(fk.Columns), g.dst.QuoteQualified(fk.RefTable))
+	// SQLite foreign keys may leave out the columns to reference the
+	// primary key.
+	if !slices.Contains(fk.RefColumns, "") {
+		def += " (" + g.quoteList(fk.RefColumns) + ")"
+	}
+	if fk.Name != "" {
+		def = "CONSTRAINT " + g.dst.QuoteIdent(fk.Name) + " " + def
+	}
+	return def
+}
+
+func (g *ddlGenerator) addForeignKey(table string, fk ForeignKey) {
+	switch g.dst.system() {
+	case "sqlite":
+		g.unsupported("SQLite cannot add a foreign key to an existing table; rebuild %s with %s", table, g.foreignKeyDef(fk))
+	case "clickhouse":
+		g.unsupported("ClickHouse has no foreign keys; %s of %s is not enforced", g.foreignKeyDef(fk), table)
+	default:
+		g.add(fmt.Sprintf("ALTER TABLE %s ADD %s", g.dst.QuoteQualified(table), g.foreignKeyDef(fk)))
+	}
+}
+
+func (g *ddlGenerator) dropForeignKey(table string, fk ForeignKey) {
+	if !g.drop {
+		return
+	}
+	qt := g.dst.QuoteQualified(table)
+	switch {
+	case fk.Name == "" || g.dst.system() == "sqlite":
+		g.unsupported("drop %s of %s; rebuild the table without it", g.foreignKeyDef(fk), table)
+	case g.dst.system() == "mysql":
+		g.add(fmt.Sprintf("ALTER TABLE %s DROP FOREIGN KEY %s", qt, g.dst.QuoteIdent(fk.Name)))
+	default:
+		g.add(fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", qt, g.dst.QuoteIdent(fk.Name)))
+	}
+}
@@ -0,0 +1,113 @@
+package api_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thesoulless/usqlmcp/api"
+)
+
+func TestReadSchema(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	_, err := db.Exec(`CREATE TABLE customers (id INTEGER PRIMARY KEY, email TEXT NOT NULL);
+CREATE UNIQUE INDEX customers_email ON customers (email);
+CREATE TABLE orders (id INTEGER PRIMARY KEY, customer_id INTEGER REFERENCES customers (id), total DECIMAL(10, 2) DEFAULT 0);
+CREATE INDEX orders_customer ON orders (customer_id, total);`)
+	require.NoError(t, err)
+
+	schema, err := api.ReadSchema(ctx, db, "sqlite3://test_schema.db", []string{"ord*"})
+	require.NoError(t, err)
+	assert.Equal(t, api.SchemaVersion, schema.Version)
+	assert.Equal(t, "sqlite3", schema.Driver)
+	require.Len(t, schema.Tables, 1)
+	orders := schema.Tables[0]
+	assert.Equal(t, "orders", orders.Name)
+	assert.Len(t, orders.Columns, 3)
+	assert.Equal(t, []api.SchemaIndex{{Name: "orders_customer", Columns: []string{"customer_id", "total"}}}, orders.Indexes)
+	assert.Equal(t, []api.ForeignKey{{Columns: []string{"customer_id"}, RefTable: "customers", RefColumns: []string{"id"}}}, orders.ForeignKeys)
+
+	// Snapshots round-trip through JSON.
+	path := filepath.Join(t.TempDir(), "schema.json")
+	require.NoError(t, api.SaveSchema(path, schema))
+	loaded, err := api.LoadSchema(path)
+	require.NoError(t, err)
+	assert.True(t, schema.GeneratedAt.Equal(loaded.GeneratedAt))
+	assert.Equal(t, schema.Tables, loaded.Tables)
+	assert.Equal(t, []string{"orders"}, loaded.TableNames())
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "no temporary file is left behind")
+
+	_, err = api.LoadSchema(filepath.Join(t.TempDir(), "missing.json"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"version": 99}`), 0o644))
+	_, err = api.LoadSchema(path)
+	assert.ErrorContains(t, err, "unsupported schema snapshot version 99")
+}
+
+func TestDiffSchema(t *testing.T) {
+	ctx := context.Background()
+	src := openTestDB(t)
+	dst := openTestDB(t)
+
+	_, err := src.Exec(`CREATE TABLE customers (id INTEGER PRIMARY KEY, email TEXT NOT NULL, name VARCHAR(100));
+CREATE UNIQUE INDEX customers_email ON customers (email);
+CREATE TABLE orders (id INTEGER PRIMARY KEY, customer_id INTEGER REFERENCES customers (id), total DECIMAL(10, 2));`)
+	require.NoError(t, err)
+	_, err = dst.Exec(`CREATE TABLE customers (id INTEGER PRIMARY KEY, email TEXT, legacy TEXT);
+CREATE INDEX customers_legacy ON customers (legacy);
+CREATE TABLE audit (id INTEGER);`)
+	require.NoError(t, err)
+
+	source, err := api.ReadSchema(ctx, src, "sqlite3://test_schema_src.db", nil)
+	require.NoError(t, err)
+	target, err := api.ReadSchema(ctx, dst, "sqlite3://test_schema_dst.db", nil)
+	require.NoError(t, err)
+
+	diff := api.DiffSchema(source, target, api.SchemaDiffOptions{Drop: true})
+	assert.Equal(t, []string{"orders"}, diff.MissingTables)
+	assert.Equal(t, []string{"audit"}, diff.ExtraTables)
+	require.Len(t, diff.ChangedTables, 1)
+	customers := diff.ChangedTables[0]
+	assert.Equal(t, "customers", customers.Table)
+	require.Len(t, customers.MissingColumns, 1)
+	assert.Equal(t, "name", customers.MissingColumns[0].Name)
+	assert.Equal(t, []string{"legacy"}, customers.ExtraColumns)
+	require.Len(t, customers.ChangedColumns, 1)
+	assert.Equal(t, []string{"nullable"}, customers.ChangedColumns[0].Changes)
+	assert.Equal(t, []api.SchemaIndex{{Name: "customers_email", Columns: []string{"email"}, Unique: true}}, customers.MissingIndexes)
+	assert.Equal(t, []api.SchemaIndex{{Name: "customers_legacy", Columns: []string{"legacy"}}}, customers.ExtraIndexes)
+	assert.Equal(t, []string{
+		`-- SQLite cannot alter column email of customers (nullable); rebuild the table`,
+		`ALTER TABLE "customers" ADD COLUMN "name" VARCHAR(100)`,
+		`ALTER TABLE "customers" DROP COLUMN "legacy"`,
+		`CREATE UNIQUE INDEX "customers_email" ON "customers" ("email")`,
+		`DROP INDEX "customers_legacy"`,
+		`CREATE TABLE "orders" ("id" INTEGER, "customer_id" INTEGER, "total" DECIMAL(10, 2), PRIMARY KEY ("id"), FOREIGN KEY ("customer_id") REFERENCES "customers" ("id"))`,
+		`DROP TABLE "audit"`,
+	}, diff.DDL)
+
+	// Types are mapped to the target's dialect, and foreign keys of new
+	// tables are added after every table is created.
+	target = &api.Schema{Version: api.SchemaVersion, Driver: "postgres"}
+	diff = api.DiffSchema(source, target, api.SchemaDiffOptions{})
+	assert.Equal(t, []string{"customers", "orders"}, diff.MissingTables)
+	assert.Equal(t, []string{
+		`CREATE TABLE "customers" ("id" BIGINT, "email" TEXT NOT NULL, "name" VARCHAR(100), PRIMARY KEY ("id"))`,
+		`CREATE UNIQUE INDEX "customers_email" ON "customers" ("email")`,
+		`CREATE TABLE "orders" ("id" BIGINT, "customer_id" BIGINT, "total" DECIMAL(10, 2), PRIMARY KEY ("id"))`,
+		`ALTER TABLE "orders" ADD FOREIGN KEY ("customer_id") REFERENCES "customers" ("id")`,
+	}, diff.DDL)
+
+	diff = api.DiffSchema(source, source, api.SchemaDiffOptions{})
+	assert.Empty(t, diff.MissingTables)
+	assert.Empty(t, diff.ChangedTables)
+	assert.Empty(t, diff.DDL)
+}
@@ -0,0 +1,428 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Statement statuses of a script run.
+const (
+	StatementOK      = "ok"
+	StatementError   = "error"
+	StatementSkipped = "skipped"
+)
+
+var (
+	// goLine is a SQL Server batch separator, optionally with a count.
+	goLine = regexp.MustCompile(`(?i)^\s*GO(?:\s+(\d+))?\s*$`)
+	// delimiterLine is a MySQL client command changing the delimiter.
+	delimiterLine = regexp.MustCompile(`(?i)^\s*DELIMITER\s+(\S+)\s*$`)
+	// slashLine ends a PL/SQL block in Oracle scripts.
+	slashLine = regexp.MustCompile(`^\s*/\s*()$`)
+)
+
+// ReadsOnly reports whether each of stmts is a query returning rows, judging
+// by its verb and WITH clause, rather than a write.
+func ReadsOnly(stmts []string) bool {
+	for _, s := range stmts {
+		if stmt := ParseStatement(s); stmt.Class() != ClassQuery || stmt.WritingCTE {
+			return false
+		}
+	}
+	return true
+}
+
+// SplitScript splits a SQL script into statements the way the database's
+// own client would. Semicolons inside strings, comments, dollar-quoted
+// bodies, parentheses and BEGIN ... END or CASE ... END blocks do not end a
+// statement. On SQL Server, lines holding only GO end a batch, which is run
+// as one statement if it creates a procedure, function, trigger or view,
+// and repeated if GO has a count. On MySQL, DELIMITER lines change the
+// statement delimiter. On Oracle, lines holding only a slash end a
+// statement, and the declarations of PL/SQL blocks are kept with them.
+func (d Dialect) SplitScript(script string) []string {
+	var stmts []string
+	switch d.system() {
+	case "mssql":
+		for _, batch := range splitLines(script, goLine) {
+			n := 1
+			if batch.arg != "" {
+				n, _ = strconv.Atoi(batch.arg)
+			}
+			var split []string
+			if tokens := tokenize(batch.text); len(tokens) > 0 && isModuleDefinition(tokens) {
+				split = []string{strings.TrimSpace(batch.text)}
+			} else {
+				split = splitBlocks(batch.text, false)
+			}
+			for range n {
+				stmts = append(stmts, split...)
+			}
+		}
+	case "mysql":
+		delimiter := ";"
+		for _, section := range splitLines(script, delimiterLine) {
+			if delimiter == ";" {
+				stmts = append(stmts, splitBlocks(section.text, false)...)
+			} else {
+				stmts = append(stmts, splitDelimiter(section.text, delimiter)...)
+			}
+			if section.arg != "" {
+				delimiter = section.arg
+			}
+		}
+	case "oracle":
+		for _, section := range splitLines(script, slashLine) {
+			stmts = append(stmts, splitBlocks(section.text, true)...)
+		}
+	default:
+		stmts = splitBlocks(script, false)
+	}
+	return stmts
+}
+
+type scriptSection struct {
+	text string
+	// arg is the argument of the directive line ending the section.
+	arg string
+}
+
+// splitLines splits script at lines matching directive, whose first
+// submatch becomes the argument of the section before it.
+func splitLines(script string, directive *regexp.Regexp) []scriptSection {
+	var sections []scriptSection
+	var b strings.Builder
+	for _, line := range strings.SplitAfter(script, "\n") {
+		if m := directive.FindStringSubmatch(line); m != nil {
+			sections = append(sections, scriptSection{text: b.String(), arg: m[1]})
+			b.Reset()
+			continue
+		}
+		b.WriteString(line)
+	}
+	return append(sections, scriptSection{text: b.String()})
+}
+
+// isModuleDefinition reports whether tokens create or alter a procedure,
+// function, trigger or view, whose body runs to the end of the batch.
+func isModuleDefinition(tokens []token) bool {
+	verb := tokens[0].upper()
+	if verb != "CREATE" && verb != "ALTER" {
+		return false
+	}
+	for _, t := range tokens[1:min(len(tokens), 4)] {
+		switch t.upper() {
+		case "PROCEDURE", "PROC", "FUNCTION", "TRIGGER", "VIEW":
+			return true
+		}
+	}
+	return false
+}
+
+// transactionWords are the words after BEGIN that start a transaction rather
+// than a block.
+var transactionWords = map[string]bool{
+	"TRANSACTION": true, "TRAN": true, "WORK": true, "DEFERRED": true,
+	"IMMEDIATE": true, "EXCLUSIVE": true, "ISOLATION": true, "READ": true,
+	"DISTRIBUTED": true,
+}
+
+// endedWords are the words after END that close an IF, loop or other
+// statement not counted as a block.
+var endedWords = map[string]bool{
+	"IF": true, "LOOP": true, "WHILE": true, "REPEAT": true, "FOR": true,
+}
+
+// splitBlocks splits script on semicolons outside parentheses and BEGIN ...
+// END or CASE ... END blocks. With plsql, PL/SQL blocks and the procedures,
+// functions and triggers they define also hold their declarations, and
+// packages everything up to their END. Empty statements are dropped.
+func splitBlocks(script string, plsql bool) []string {
+	var stmts []string
+	tokens := tokenize(script)
+	start, first, parens, blocks := 0, 0, 0, 0
+	// declaring is set while in the declarations of a PL/SQL block, which
+	// already count as the block its BEGIN opens.
+	declaring := false
+	for i, t := range tokens {
+		next := ""
+		if i+1 < len(tokens) {
+			next = tokens[i+1].upper()
+			if tokens[i+1].isPunct(";") {
+				next = ";"
+			}
+		}
+		if plsql && i == first {
+			switch plsqlUnit(tokens[i:]) {
+			case "PACKAGE":
+				blocks++
+			case "BLOCK":
+				blocks++
+				declaring = true
+			}
+		}
+		switch {
+		case t.isPunct("("):
+			parens++
+		case t.isPunct(")"):
+			parens = max(parens-1, 0)
+		case t.upper() == "BEGIN":
+			if declaring {
+				declaring = false
+			} else if next != "" && next != ";" && !transactionWords[next] {
+				blocks++
+			}
+		case t.upper() == "CASE":
+			blocks++
+		case t.upper() == "END":
+			if !endedWords[next] {
+				blocks = max(blocks-1, 0)
+			}
+		case t.isPunct(";") && parens == 0 && blocks == 0:
+			if s := strings.TrimSpace(script[start:t.pos]); s != "" {
+				stmts = append(stmts, s)
+			}
+			start, first = t.pos+1, i+1
+		}
+	}
+	if s := strings.TrimSpace(script[start:]); s != "" {
+		stmts = append(stmts, s)
+	}
+	return stmts
+}
+
+// plsqlUnit returns "BLOCK" if tokens start a PL/SQL block with
+// declarations, or a procedure, function or trigger, "PACKAGE" if they
+// start a package, and "" otherwise.
+func plsqlUnit(tokens []token) string {
+	if tokens[0].upper() == "DECLARE" {
+		return "BLOCK"
+	}
+	if tokens[0].upper() != "CREATE" {
+		return ""
+	}
+	for _, t := range tokens[1:min(len(tokens), 6)] {
+		switch t.upper() {
+		case "PROCEDURE", "FUNCTION", "TRIGGER":
+			return "BLOCK"
+		case "PACKAGE":
+			return "PACKAGE"
+		}
+	}
+	return ""
+}
+
+// splitDelimiter splits script on delimiter outside strings, quoted
+// identifiers and comments, as the MySQL client does after DELIMITER.
+func splitDelimiter(script, delimiter string) []string {
+	var stmts []string
+	r, delim := []rune(script), []rune(delimiter)
+	n := len(r)
+	var b strings.Builder
+	flush := func() {
+		if s := strings.TrimSpace(b.String()); s != "" {
+			stmts = append(stmts, s)
+		}
+		b.Reset()
+	}
+	for i := 0; i < n; {
+		c := r[i]
+		j := i + 1
+		switch {
+		case string(r[i:min(i+len(delim), n)]) == delimiter:
+			flush()
+			i += len(delim)
+			continue
+		case c == '\'' || c == '"' || c == '`':
+			j = scanQuoted(r, i, c)
+		case c == '#' || (c == '-' && i+1 < n && r[i+1] == '-'):
+			for j < n && r[j] != '\n' {
+				j++
+			}
+		case c == '/' && i+1 < n && r[i+1] == '*':
+			j = i + 2
+			for j < n && !(r[j] == '*' && j+1 < n && r[j+1] == '/') {
+				j++
+			}
+			j = min(j+2, n)
+		}
+		b.WriteString(string(r[i:j]))
+		i = j
+	}
+	flush()
+	return stmts
+}
+
+// ScriptOptions configures RunScript.
+type ScriptOptions struct {
+	// Transaction runs every statement in one transaction, which is rolled
+	// back at the first error.
+	Transaction bool
+	// ContinueOnError runs the remaining statements after one fails. It
+	// cannot be combined with Transaction.
+	ContinueOnError bool
+	// MaxRows stops reading the rows of a statement after this many.
+	MaxRows int
+	// Driver is the usql driver of the database, which decides whether
+	// inserted IDs are reported.
+	Driver string
+}
+
+// StatementResult is the outcome of one statement of a script.
+type StatementResult struct {
+	Index     int    `json:"index"`
+	Statement string `json:"statement"`
+	Verb      string `json:"verb,omitempty"`
+	Status    string `json:"status"`
+	Rows      []Row  `json:"rows,omitempty"`
+	Truncated bool   `json:"truncated,omitempty"`
+	// RowsAffected is set for statements that do not return rows, if the
+	// driver reports it, and for writes returning rows.
+	RowsAffected *int64 `json:"rows_affected,omitempty"`
+	LastInsertID *int64 `json:"last_insert_id,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// ScriptResult is the outcome of RunScript.
+type ScriptResult struct {
+	Statements []StatementResult `json:"statements"`
+	// Transaction is "committed" or "rolled back" when the script ran in a
+	// transaction.
+	Transaction string `json:"transaction,omitempty"`
+}
+
+// RunScript runs stmts in order on a single connection from db. Statements
+// returning rows are read like ReadQueryLimit, and others report their
+// affected row count. After an error the remaining statements are skipped,
+// unless opts.ContinueOnError is set.
+func RunScript(ctx context.Context, db *sql.DB, stmts []string, opts ScriptOptions) (result ScriptResult, err error) {
+	if opts.Transaction && opts.ContinueOnError {
+		return ScriptResult{}, errors.New("continue_on_error cannot be used with transaction")
+	}
+	ctx, span := startStatementSpan(ctx, "script", strings.Join(stmts, ";\n"))
+	defer func() { endStatementSpan(ctx, span, int64(len(result.Statements)), err) }()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return ScriptResult{}, fmt.Errorf("failed to get a connection: %w", err)
+	}
+	defer conn.Close()
+
+	var exec execQuerier = conn
+	var tx *sql.Tx
+	if opts.Transaction {
+		if tx, err = conn.BeginTx(ctx, nil); err != nil {
+			return ScriptResult{}, fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		defer tx.Rollback()
+		exec = tx
+	}
+
+	failed := false
+	result.Statements = []StatementResult{}
+	for i, stmt := range stmts {
+		parsed := ParseStatement(stmt)
+		r := StatementResult{Index: i, Statement: stmt, Verb: parsed.Verb, Status: StatementOK}
+		if failed && !opts.ContinueOnError {
+			r.Status = StatementSkipped
+			result.Statements = append(result.Statements, r)
+			continue
+		}
+		var stmtErr error
+		switch parsed.Class() {
+		case ClassQuery:
+			var rows *sql.Rows
+			if rows, stmtErr = exec.QueryContext(ctx, stmt); stmtErr == nil {
+				r.Rows, r.Truncated, stmtErr = scanRows(rows, opts.MaxRows)
+			}
+		case ClassDML:
+			var w WriteResult
+			if w, stmtErr = execWrite(ctx, exec, opts.Driver, parsed, opts.MaxRows); stmtErr == nil {
+				r.Rows, r.Truncated = w.Rows, w.Truncated
+				r.RowsAffected, r.LastInsertID = &w.RowsAffected, w.LastInsertID
+			}
+		default:
+			var res sql.Result
+			if res, stmtErr = exec.ExecContext(ctx, stmt); stmtErr == nil {
+				if n, err := res.RowsAffected(); err == nil {
+					r.RowsAffected = &n
+				}
+			}
+		}
+		if stmtErr != nil {
+			failed = true
+			r.Status, r.Error = StatementError, RedactError(stmtErr).Error()
+		}
+		result.Statements = append(result.Statements, r)
+	}
+
+	if tx != nil {
+		if failed {
+			result.Transaction = "rolled back"
+		} else if err := tx.Commit(); err != nil {
+			return result, fmt.Errorf("failed to commit transaction: %w", err)
+		} else {
+			result.Transaction = "committed"
+		}
+	}
+	return result, nil
+}
+
+// scanRows reads up to maxRows rows, or all of them if maxRows is not
+// positive, and closes rows. Text returned as []byte is converted to string,
+// so that results encode as text in JSON. It reports whether rows were left
+// out.
+func scanRows(rows *sql.Rows, maxRows int) ([]Row, bool, error) {
+	results, n, err := countRows(rows, maxRows, false)
+	return results, n > int64(len(results)), err
+}
+
+// countRows reads rows like scanRows and returns them with the number of rows
+// read. Rows past maxRows are counted without being kept when count is set;
+// otherwise reading stops at the first of them.
+func countRows(rows *sql.Rows, maxRows int, count bool) ([]Row, int64, error) {
+	defer rows.Close()
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, 0, err
+	}
+	columns := make([]string, len(columnTypes))
+	kinds := make([]string, len(columnTypes))
+	for i, ct := range columnTypes {
+		columns[i] = ct.Name()
+		kinds[i] = columnKind(ct)
+	}
+	results := []Row{}
+	var n int64
+	for rows.Next() {
+		n++
+		if maxRows > 0 && len(results) == maxRows {
+			if count {
+				continue
+			}
+			break
+		}
+		values := make([]interface{}, len(columns))
+		scanArgs := make([]interface{}, len(columns))
+		for i := range values {
+			scanArgs[i] = &values[i]
+		}
+		if err := rows.Scan(scanArgs...); err != nil {
+			return nil, 0, err
+		}
+		row := make(Row, len(columns))
+		for i, column := range columns {
+			if b, ok := values[i].([]byte); ok && kinds[i] != kindBinary {
+				values[i] = string(b)
+			}
+			row[column] = values[i]
+		}
+		results = append(results, row)
+	}
+	return results, n, rows.Err()
+}
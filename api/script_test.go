@@ -0,0 +1,146 @@
+package api_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thesoulless/usqlmcp/api"
+)
+
+func TestSplitScript(t *testing.T) {
+	tests := []struct {
+		name   string
+		driver string
+		script string
+		want   []string
+	}{
+		{
+			name:   "semicolons in strings and comments",
+			driver: "sqlite3",
+			script: "INSERT INTO t VALUES ('a;b'); -- c;d\nSELECT 1 /* e; */;;",
+			want:   []string{"INSERT INTO t VALUES ('a;b')", "-- c;d\nSELECT 1 /* e; */"},
+		},
+		{
+			name:   "dollar-quoted body",
+			driver: "postgres",
+			script: "CREATE FUNCTION f() RETURNS int AS $$ BEGIN RETURN 1; END; $$ LANGUAGE plpgsql;\nBEGIN;\nSELECT f();\nCOMMIT;",
+			want: []string{
+				"CREATE FUNCTION f() RETURNS int AS $$ BEGIN RETURN 1; END; $$ LANGUAGE plpgsql",
+				"BEGIN", "SELECT f()", "COMMIT",
+			},
+		},
+		{
+			name:   "trigger with BEGIN ... END and CASE",
+			driver: "sqlite3",
+			script: "BEGIN TRANSACTION; CREATE TRIGGER tr AFTER INSERT ON t BEGIN UPDATE t SET n = CASE WHEN n > 0 THEN 1 ELSE 0 END; DELETE FROM u; END; COMMIT;",
+			want: []string{
+				"BEGIN TRANSACTION",
+				"CREATE TRIGGER tr AFTER INSERT ON t BEGIN UPDATE t SET n = CASE WHEN n > 0 THEN 1 ELSE 0 END; DELETE FROM u; END",
+				"COMMIT",
+			},
+		},
+		{
+			name:   "DELIMITER",
+			driver: "mysql",
+			script: "DROP PROCEDURE IF EXISTS p;\nDELIMITER $$\nCREATE PROCEDURE p() BEGIN IF 1 THEN SELECT '$$'; END IF; END$$\nDELIMITER ;\nCALL p();",
+			want: []string{
+				"DROP PROCEDURE IF EXISTS p",
+				"CREATE PROCEDURE p() BEGIN IF 1 THEN SELECT '$$'; END IF; END",
+				"CALL p()",
+			},
+		},
+		{
+			name:   "GO",
+			driver: "sqlserver",
+			script: "CREATE TABLE t (n int); INSERT INTO t VALUES (1);\nGO\nCREATE PROCEDURE p AS\nSELECT 1;\nSELECT 2;\ngo\nEXEC p\nGO 2\n",
+			want: []string{
+				"CREATE TABLE t (n int)", "INSERT INTO t VALUES (1)",
+				"CREATE PROCEDURE p AS\nSELECT 1;\nSELECT 2;",
+				"EXEC p", "EXEC p",
+			},
+		},
+		{
+			name:   "PL/SQL",
+			driver: "oracle",
+			script: "DECLARE\n  n NUMBER;\nBEGIN\n  SELECT 1 INTO n FROM dual;\nEND;\n/\nCREATE PACKAGE pk AS\n  PROCEDURE p;\nEND pk;\n/\nSELECT 1 FROM dual;",
+			want: []string{
+				"DECLARE\n  n NUMBER;\nBEGIN\n  SELECT 1 INTO n FROM dual;\nEND",
+				"CREATE PACKAGE pk AS\n  PROCEDURE p;\nEND pk",
+				"SELECT 1 FROM dual",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, api.DialectFor(tt.driver).SplitScript(tt.script))
+		})
+	}
+}
+
+func TestRunScript(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	d := api.DialectFor("sqlite3")
+
+	result, err := api.RunScript(ctx, db, d.SplitScript(`CREATE TABLE t (n INTEGER);
+		INSERT INTO t VALUES (1), (2), (3);
+		SELECT n FROM t ORDER BY n;`), api.ScriptOptions{MaxRows: 2})
+	require.NoError(t, err)
+	require.Len(t, result.Statements, 3)
+	assert.Equal(t, api.StatementOK, result.Statements[0].Status)
+	assert.Equal(t, "INSERT", result.Statements[1].Verb)
+	require.NotNil(t, result.Statements[1].RowsAffected)
+	assert.Equal(t, int64(3), *result.Statements[1].RowsAffected)
+	assert.Equal(t, []api.Row{{"n": int64(1)}, {"n": int64(2)}}, result.Statements[2].Rows)
+	assert.True(t, result.Statements[2].Truncated)
+	assert.Empty(t, result.Transaction)
+
+	// The script stops at the first error unless told to continue.
+	script := d.SplitScript("DELETE FROM t WHERE n = 1; INSERT INTO missing VALUES (1); DELETE FROM t WHERE n = 2;")
+	result, err = api.RunScript(ctx, db, script, api.ScriptOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{api.StatementOK, api.StatementError, api.StatementSkipped}, statuses(result))
+	assert.Contains(t, result.Statements[1].Error, "no such table")
+
+	result, err = api.RunScript(ctx, db, script, api.ScriptOptions{ContinueOnError: true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{api.StatementOK, api.StatementError, api.StatementOK}, statuses(result))
+
+	// In a transaction, an error rolls back every statement.
+	result, err = api.RunScript(ctx, db, d.SplitScript("DELETE FROM t; INSERT INTO missing VALUES (1);"), api.ScriptOptions{Transaction: true})
+	require.NoError(t, err)
+	assert.Equal(t, "rolled back", result.Transaction)
+	var n int
+	require.NoError(t, db.QueryRow(`SELECT count(*) FROM t`).Scan(&n))
+	assert.Equal(t, 1, n)
+
+	result, err = api.RunScript(ctx, db, d.SplitScript("INSERT INTO t VALUES (4); INSERT INTO t VALUES (5);"), api.ScriptOptions{Transaction: true})
+	require.NoError(t, err)
+	assert.Equal(t, "committed", result.Transaction)
+	require.NoError(t, db.QueryRow(`SELECT count(*) FROM t`).Scan(&n))
+	assert.Equal(t, 3, n)
+
+	// Writes report generated IDs and the rows they return.
+	result, err = api.RunScript(ctx, db, d.SplitScript("INSERT INTO t VALUES (6); DELETE FROM t WHERE n > 4 RETURNING n;"), api.ScriptOptions{Driver: "sqlite3"})
+	require.NoError(t, err)
+	require.NotNil(t, result.Statements[0].LastInsertID)
+	assert.ElementsMatch(t, []api.Row{{"n": int64(5)}, {"n": int64(6)}}, result.Statements[1].Rows)
+	assert.Equal(t, int64(2), *result.Statements[1].RowsAffected)
+
+	_, err = api.RunScript(ctx, db, script, api.ScriptOptions{Transaction: true, ContinueOnError: true})
+	assert.Error(t, err)
+
+	assert.True(t, api.ReadsOnly(d.SplitScript("SELECT 1; WITH x AS (SELECT 1) SELECT * FROM x; PRAGMA table_info(t)")))
+	assert.False(t, api.ReadsOnly(d.SplitScript("SELECT 1; DELETE FROM t")))
+	assert.False(t, api.ReadsOnly(d.SplitScript("WITH d AS (DELETE FROM t RETURNING *) SELECT * FROM d")))
+}
+
+func statuses(result api.ScriptResult) []string {
+	var s []string
+	for _, stmt := range result.Statements {
+		s = append(s, stmt.Status)
+	}
+	return s
+}
@@ -0,0 +1,420 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode"
+
+	"github.com/xo/dburl"
+)
+
+const (
+	// DefaultSearchLimit is the number of hits SearchValues returns when
+	// SearchOptions.Limit is not set.
+	DefaultSearchLimit = 50
+	// DefaultSearchPerColumn is the number of hits read per column when
+	// SearchOptions.PerColumn is not set.
+	DefaultSearchPerColumn = 5
+	// DefaultSearchConcurrency is the number of queries SearchValues runs at
+	// once when SearchOptions.Concurrency is not set.
+	DefaultSearchConcurrency = 4
+	// snippetContext is the number of characters shown around a match.
+	snippetContext = 40
+)
+
+// Search methods, reported in SearchHit.Method.
+const (
+	SearchLike     = "like"
+	SearchEquals   = "equals"
+	SearchFullText = "fulltext"
+)
+
+// SearchOptions controls SearchValues.
+type SearchOptions struct {
+	// Tables and Columns restrict the search to names matching these
+	// case-insensitive glob patterns.
+	Tables  []string
+	Columns []string
+	// Limit is the total number of hits returned.
+	Limit int
+	// PerColumn is the number of hits read from each column.
+	PerColumn int
+	// Concurrency is the number of queries run at once.
+	Concurrency int
+	// Exclude, if set, skips the columns it returns true for, such as
+	// masked columns or columns the statement policy denies.
+	Exclude func(table, column string) bool
+	// Mask, if set, is applied to snippets and primary key values.
+	Mask func(table, column string, val interface{}) interface{}
+}
+
+// SearchHit is a row in which a column matched the search term.
+type SearchHit struct {
+	Table      string                 `json:"table"`
+	Column     string                 `json:"column"`
+	PrimaryKey map[string]interface{} `json:"primary_key,omitempty"`
+	Snippet    string                 `json:"snippet"`
+	Method     string                 `json:"method"`
+}
+
+// SearchResult holds the hits of SearchValues.
+type SearchResult struct {
+	Term string      `json:"term"`
+	Hits []SearchHit `json:"hits"`
+	// Columns is the number of columns searched.
+	Columns int `json:"columns"`
+	// Truncated is set when more hits may exist than were returned.
+	Truncated bool `json:"truncated"`
+	// Errors lists the columns whose search failed; the others are still
+	// reported.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// searchColumn is a column to search and how.
+type searchColumn struct {
+	table, column string
+	pk            []string
+	method        string
+	// cond is the WHERE condition, with a single placeholder, and arg its
+	// argument.
+	cond string
+	arg  interface{}
+}
+
+// SearchValues looks for term in the values of every table. Text columns are
+// matched case-insensitively as substrings, using a full-text index instead
+// where one covers the column, and numeric columns are compared for equality
+// when term is a number. Queries run in parallel, each bounded to a few rows.
+func SearchValues(ctx context.Context, db *sql.DB, dsn, term string, opts SearchOptions) (result SearchResult, err error) {
+	if strings.TrimSpace(term) == "" {
+		return result, fmt.Errorf("search term must not be empty")
+	}
+	u, err := dburl.Parse(dsn)
+	if err != nil {
+		return result, fmt.Errorf("failed to parse DSN: %w", err)
+	}
+	d := DialectFor(u.Driver)
+	if opts.Limit <= 0 {
+		opts.Limit = DefaultSearchLimit
+	}
+	if opts.PerColumn <= 0 {
+		opts.PerColumn = DefaultSearchPerColumn
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DefaultSearchConcurrency
+	}
+	result.Term, result.Hits = term, []SearchHit{}
+
+	ctx, span := startStatementSpan(ctx, "search", "")
+	defer func() { endStatementSpan(ctx, span, int64(len(result.Hits)), err) }()
+
+	tables, err := ListTables(db, dsn)
+	if err != nil {
+		return result, err
+	}
+	var columns []searchColumn
+	for _, table := range tables {
+		if !matchesAny(opts.Tables, table) {
+			continue
+		}
+		cols, err := d.searchColumns(ctx, db, dsn, table, term, opts)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", table, err))
+			continue
+		}
+		columns = append(columns, cols...)
+	}
+	result.Columns = len(columns)
+
+	// Each column's hits go to its own slot so that the result is in table
+	// and column order however the queries finish.
+	hits := make([][]SearchHit, len(columns))
+	errs := make([]error, len(columns))
+	var (
+		found     atomic.Int64
+		truncated atomic.Bool
+		wg        sync.WaitGroup
+	)
+	sem := make(chan struct{}, opts.Concurrency)
+	for i, c := range columns {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			// Columns left once the limit is reached are not searched.
+			if found.Load() >= int64(opts.Limit) {
+				truncated.Store(true)
+				return
+			}
+			hits[i], errs[i] = d.searchColumn(ctx, db, c, term, opts)
+			found.Add(int64(len(hits[i])))
+			if len(hits[i]) == opts.PerColumn {
+				truncated.Store(true)
+			}
+		}()
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+	result.Truncated = truncated.Load()
+
+	for i, c := range columns {
+		if errs[i] != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s.%s: %v", c.table, c.column, errs[i]))
+		}
+		for _, hit := range hits[i] {
+			if len(result.Hits) == opts.Limit {
+				result.Truncated = true
+				break
+			}
+			result.Hits = append(result.Hits, hit)
+		}
+	}
+	return result, nil
+}
+
+func matchesAny(patterns []string, name string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, p := range patterns {
+		if matchName(p, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// searchColumns picks the columns of table to search for term.
+func (d Dialect) searchColumns(ctx context.Context, db *sql.DB, dsn, table, term string, opts SearchOptions) ([]searchColumn, error) {
+	described, err := DescribeTableUniversal(db, table, dsn)
+	if err != nil {
+		return nil, err
+	}
+	var pk []string
+	for _, c := range described {
+		if c.IsPrimaryKey {
+			pk = append(pk, c.Name)
+		}
+	}
+	fullText, err := d.fullTextColumns(ctx, db, table)
+	if err != nil {
+		// Full-text indexes are an optimization; fall back to LIKE.
+		fullText = nil
+	}
+
+	var number interface{}
+	if n, err := strconv.ParseInt(term, 10, 64); err == nil {
+		number = n
+	} else if f, err := strconv.ParseFloat(term, 64); err == nil {
+		number = f
+	}
+
+	var columns []searchColumn
+	for _, c := range described {
+		if !matchesAny(opts.Columns, c.Name) || (opts.Exclude != nil && opts.Exclude(table, c.Name)) {
+			continue
+		}
+		sc := searchColumn{table: table, column: c.Name, pk: pk}
+		col := d.QuoteIdent(c.Name)
+		switch kind := typeKind(c.Type); {
+		case fullText[c.Name] != "":
+			sc.method, sc.cond, sc.arg = SearchFullText, fullText[c.Name], d.fullTextTerm(term)
+		case kind == kindText:
+			sc.method, sc.cond, sc.arg = SearchLike, d.likeCondition(col), "%"+d.escapeLike(term)+"%"
+		case numeric(kind) && number != nil:
+			if _, ok := number.(float64); ok && kind == kindInteger {
+				continue
+			}
+			sc.method, sc.cond, sc.arg = SearchEquals, col+" = "+d.Placeholder(1), number
+		default:
+			continue
+		}
+		columns = append(columns, sc)
+	}
+	return columns, nil
+}
+
+// searchColumn runs the search query of c.
+func (d Dialect) searchColumn(ctx context.Context, db *sql.DB, c searchColumn, term string, opts SearchOptions) ([]SearchHit, error) {
+	selected := make([]string, 0, len(c.pk)+1)
+	for _, pk := range c.pk {
+		selected = append(selected, d.QuoteIdent(pk))
+	}
+	selected = append(selected, d.QuoteIdent(c.column))
+	query := d.limit(fmt.Sprintf("SELECT %s FROM %s WHERE %s", strings.Join(selected, ", "), d.QuoteQualified(c.table), c.cond), opts.PerColumn)
+
+	rows, err := db.QueryContext(ctx, query, c.arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hits []SearchHit
+	for rows.Next() {
+		values := make([]interface{}, len(selected))
+		scanArgs := make([]interface{}, len(selected))
+		for i := range values {
+			scanArgs[i] = &values[i]
+		}
+		if err := rows.Scan(scanArgs...); err != nil {
+			return nil, err
+		}
+		hit := SearchHit{Table: c.table, Column: c.column, Method: c.method}
+		for i, pk := range c.pk {
+			if hit.PrimaryKey == nil {
+				hit.PrimaryKey = make(map[string]interface{}, len(c.pk))
+			}
+			hit.PrimaryKey[pk] = maskSearchValue(opts, c.table, pk, values[i])
+		}
+		value := maskSearchValue(opts, c.table, c.column, values[len(values)-1])
+		hit.Snippet = snippet(formatText(value), term)
+		hits = append(hits, hit)
+	}
+	return hits, rows.Err()
+}
+
+func maskSearchValue(opts SearchOptions, table, column string, v interface{}) interface{} {
+	if b, ok := v.([]byte); ok {
+		v = string(b)
+	}
+	if opts.Mask != nil {
+		v = opts.Mask(table, column, v)
+	}
+	return v
+}
+
+// snippet returns the part of s around the first case-insensitive match of
+// term, or its beginning when term does not appear verbatim.
+func snippet(s, term string) string {
+	text, needle := []rune(s), []rune(strings.ToLower(term))
+	lower := make([]rune, len(text))
+	for i, r := range text {
+		lower[i] = unicode.ToLower(r)
+	}
+	at := 0
+	for i := 0; i+len(needle) <= len(lower); i++ {
+		if string(lower[i:i+len(needle)]) == string(needle) {
+			at = i
+			break
+		}
+	}
+	start, end := at-snippetContext, at+len(needle)+snippetContext
+	prefix, suffix := "…", "…"
+	if start <= 0 {
+		start, prefix = 0, ""
+	}
+	if end >= len(text) {
+		end, suffix = len(text), ""
+	}
+	return prefix + string(text[start:end]) + suffix
+}
+
+// likeCondition returns a case-insensitive LIKE condition on col whose
+// pattern is escaped with escapeLike.
+func (d Dialect) likeCondition(col string) string {
+	p := d.Placeholder(1)
+	switch d.system() {
+	case "postgresql", "duckdb", "snowflake":
+		return col + " ILIKE " + p + " ESCAPE '!'"
+	case "clickhouse":
+		// ClickHouse has no ESCAPE clause; backslash escapes.
+		return col + " ILIKE " + p
+	case "oracle", "trino", "presto":
+		return "LOWER(" + col + ") LIKE LOWER(" + p + ") ESCAPE '!'"
+	default:
+		// MySQL, SQLite and SQL Server compare case-insensitively by
+		// default.
+		return col + " LIKE " + p + " ESCAPE '!'"
+	}
+}
+
+// escapeLike escapes the LIKE wildcards in s for likeCondition.
+func (d Dialect) escapeLike(s string) string {
+	if d.system() == "clickhouse" {
+		return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+	}
+	r := []string{"!", "!!", "%", "!%", "_", "!_"}
+	if d.system() == "mssql" {
+		r = append(r, "[", "![")
+	}
+	return strings.NewReplacer(r...).Replace(s)
+}
+
+var tsvectorIndex = regexp.MustCompile(`to_tsvector\('([^']+)'::regconfig,\s*\(?"?([^"()]+?)"?\)?(?:::text)?\)`)
+
+// fullTextTerm returns term as bound to the conditions of fullTextColumns.
+// SQL Server parses the argument of CONTAINS as a search condition, where a
+// bare multi-word term such as "acme corp" is a syntax error, so it is quoted
+// as a phrase.
+func (d Dialect) fullTextTerm(term string) string {
+	if d.system() == "mssql" {
+		return `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	}
+	return term
+}
+
+// fullTextColumns returns a search condition for each column of table
+// covered by a full-text index on its own.
+func (d Dialect) fullTextColumns(ctx context.Context, db *sql.DB, table string) (map[string]string, error) {
+	schema, name := splitQualified(table)
+	p := d.Placeholder(1)
+	var (
+		query string
+		args  = []interface{}{schema, name}
+	)
+	switch d.system() {
+	case "postgresql":
+		query = `SELECT indexdef FROM pg_indexes
+WHERE schemaname = COALESCE(NULLIF($1, ''), current_schema()) AND tablename = $2 AND indexdef LIKE '%to_tsvector%'`
+	case "mysql":
+		query = `SELECT MIN(COLUMN_NAME) FROM information_schema.STATISTICS
+WHERE TABLE_SCHEMA = COALESCE(NULLIF(?, ''), DATABASE()) AND TABLE_NAME = ? AND INDEX_TYPE = 'FULLTEXT'
+GROUP BY INDEX_NAME HAVING COUNT(*) = 1`
+	case "mssql":
+		query = `SELECT c.name FROM sys.fulltext_index_columns ic
+JOIN sys.columns c ON c.object_id = ic.object_id AND c.column_id = ic.column_id
+WHERE ic.object_id = OBJECT_ID(@p1)`
+		args = []interface{}{table}
+	default:
+		return nil, nil
+	}
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	conds := map[string]string{}
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, err
+		}
+		switch d.system() {
+		case "postgresql":
+			m := tsvectorIndex.FindStringSubmatch(s)
+			if m == nil {
+				continue
+			}
+			config, column := m[1], m[2]
+			// The expression matches the index's so that the planner uses
+			// it.
+			conds[column] = fmt.Sprintf("to_tsvector('%s', %s) @@ plainto_tsquery('%s', %s)", config, d.QuoteIdent(column), config, p)
+		case "mysql":
+			conds[s] = fmt.Sprintf("MATCH(%s) AGAINST (%s IN NATURAL LANGUAGE MODE)", d.QuoteIdent(s), p)
+		case "mssql":
+			// The term is bound as a phrase; see fullTextTerm.
+			conds[s] = fmt.Sprintf("CONTAINS(%s, %s)", d.QuoteIdent(s), p)
+		}
+	}
+	return conds, rows.Err()
+}
@@ -0,0 +1,80 @@
+package api_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thesoulless/usqlmcp/api"
+)
+
+func TestSearchValues(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	dsn := "sqlite3://test_search.db"
+
+	_, err := db.Exec(`CREATE TABLE customers (id INTEGER PRIMARY KEY, name TEXT, email TEXT, score REAL);
+CREATE TABLE orders (order_id INTEGER PRIMARY KEY, customer_id INTEGER, note TEXT);
+INSERT INTO customers VALUES (1, 'ACME Corp', 'ops@acme.test', 42), (2, 'Globex', 'info@globex.test', 7);
+INSERT INTO orders VALUES (10, 42, 'Deliver to Acme loading dock'), (11, 2, 'rush 100%_off');`)
+	require.NoError(t, err)
+
+	result, err := api.SearchValues(ctx, db, dsn, "acme", api.SearchOptions{
+		Exclude: func(table, column string) bool { return column == "email" },
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Columns)
+	assert.False(t, result.Truncated)
+	assert.Empty(t, result.Errors)
+	assert.Equal(t, []api.SearchHit{
+		{Table: "customers", Column: "name", PrimaryKey: map[string]interface{}{"id": int64(1)}, Snippet: "ACME Corp", Method: api.SearchLike},
+		{Table: "orders", Column: "note", PrimaryKey: map[string]interface{}{"order_id": int64(10)}, Snippet: "Deliver to Acme loading dock", Method: api.SearchLike},
+	}, result.Hits)
+
+	// Numbers are compared for equality with numeric columns and searched
+	// as substrings of text.
+	result, err = api.SearchValues(ctx, db, dsn, "42", api.SearchOptions{})
+	require.NoError(t, err)
+	var found []string
+	for _, hit := range result.Hits {
+		found = append(found, hit.Table+"."+hit.Column)
+	}
+	assert.Equal(t, []string{"customers.score", "orders.customer_id"}, found)
+
+	// LIKE wildcards in the term match literally.
+	result, err = api.SearchValues(ctx, db, dsn, "%_", api.SearchOptions{Tables: []string{"ord*"}, Columns: []string{"note"}})
+	require.NoError(t, err)
+	require.Len(t, result.Hits, 1)
+	assert.Equal(t, "rush 100%_off", result.Hits[0].Snippet)
+
+	result, err = api.SearchValues(ctx, db, dsn, "test", api.SearchOptions{
+		Limit: 1,
+		Mask:  func(table, column string, val interface{}) interface{} { return api.Redacted },
+	})
+	require.NoError(t, err)
+	assert.True(t, result.Truncated)
+	require.Len(t, result.Hits, 1)
+	assert.Equal(t, api.Redacted, result.Hits[0].Snippet)
+	assert.Equal(t, api.Redacted, result.Hits[0].PrimaryKey["id"])
+
+	_, err = api.SearchValues(ctx, db, dsn, " ", api.SearchOptions{})
+	assert.ErrorContains(t, err, "search term must not be empty")
+}
+
+func TestSearchSnippet(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	dsn := "sqlite3://test_search_snippet.db"
+
+	long := strings.Repeat("a", 100) + " needle " + strings.Repeat("b", 100)
+	_, err := db.Exec(`CREATE TABLE docs (body TEXT); INSERT INTO docs VALUES (?)`, long)
+	require.NoError(t, err)
+
+	result, err := api.SearchValues(ctx, db, dsn, "NEEDLE", api.SearchOptions{})
+	require.NoError(t, err)
+	require.Len(t, result.Hits, 1)
+	assert.Equal(t, "…"+strings.Repeat("a", 39)+" needle "+strings.Repeat("b", 39)+"…", result.Hits[0].Snippet)
+	assert.Nil(t, result.Hits[0].PrimaryKey)
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+)
+
+// ServerProgress is the progress of a running query as reported by the
+// database server.
+type ServerProgress struct {
+	// State is what the server says the query is doing, e.g. "active" or a
+	// PostgreSQL progress phase.
+	State string
+	// Percent is the share of the work done, or -1 if the server does not
+	// know.
+	Percent float64
+	// RowsRead is the number of rows the server has read so far, if known.
+	RowsRead int64
+}
+
+// serverProgressQueries reads the progress of the query tagged with the
+// argument. Each returns at most one row of state, work done, total work and
+// rows read, with 0 for an unknown total. The tag is concatenated in SQL so
+// that the probe does not find itself.
+var serverProgressQueries = map[string]string{
+	// SELECTs have no progress view; DDL, COPY and maintenance commands do.
+	// pg_stat_progress_copy needs PostgreSQL 14.
+	"postgresql": `SELECT COALESCE(p.phase, a.state, ''), COALESCE(p.done, 0), COALESCE(p.total, 0), 0
+		FROM pg_stat_activity a
+		LEFT JOIN (
+			SELECT pid, phase, blocks_done AS done, blocks_total AS total FROM pg_stat_progress_create_index
+			UNION ALL SELECT pid, phase, heap_blks_scanned, heap_blks_total FROM pg_stat_progress_vacuum
+			UNION ALL SELECT pid, phase, heap_blks_scanned, heap_blks_total FROM pg_stat_progress_cluster
+			UNION ALL SELECT pid, phase, sample_blks_scanned, sample_blks_total FROM pg_stat_progress_analyze
+			UNION ALL SELECT pid, command, bytes_processed, bytes_total FROM pg_stat_progress_copy
+		) p ON p.pid = a.pid
+		WHERE strpos(a.query, 'usqlmcp:' || $1) > 0 AND a.pid <> pg_backend_pid()
+		LIMIT 1`,
+	"clickhouse": `SELECT 'running', read_rows, total_rows_approx, read_rows
+		FROM system.processes
+		WHERE position(query, concat('usqlmcp:', ?)) > 0
+		LIMIT 1`,
+	"trino": `SELECT lower(q.state), COALESCE(sum(t.completed_splits), 0), COALESCE(sum(t.splits), 0), COALESCE(sum(t.processed_input_rows), 0)
+		FROM system.runtime.queries q
+		LEFT JOIN system.runtime.tasks t ON t.query_id = q.query_id
+		WHERE strpos(q.query, concat('usqlmcp:', ?)) > 0 AND q.state NOT IN ('FINISHED', 'FAILED')
+		GROUP BY q.state
+		LIMIT 1`,
+}
+
+// TagQuery returns query prefixed with a comment identifying it to
+// ReadServerProgress, and the tag. On databases that do not report query
+// progress, it returns query unchanged and an empty tag.
+func TagQuery(driver, query string) (string, string) {
+	if _, ok := serverProgressQueries[DialectFor(driver).system()]; !ok {
+		return query, ""
+	}
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return query, ""
+	}
+	tag := hex.EncodeToString(b)
+	return "/* usqlmcp:" + tag + " */ " + query, tag
+}
+
+// ReadServerProgress returns the progress of the query tagged with tag, as
+// reported by the server, or nil if it is not running. It must run on
+// another connection than the query.
+func ReadServerProgress(ctx context.Context, db *sql.DB, driver, tag string) (*ServerProgress, error) {
+	query, ok := serverProgressQueries[DialectFor(driver).system()]
+	if !ok || tag == "" {
+		return nil, nil
+	}
+	var p ServerProgress
+	var done, total float64
+	err := db.QueryRowContext(ctx, query, tag).Scan(&p.State, &done, &total, &p.RowsRead)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.Percent = -1
+	if total > 0 {
+		p.Percent = min(100*done/total, 100)
+	}
+	return &p, nil
+}
@@ -0,0 +1,791 @@
+package api
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Statement is a lightweight, dialect-agnostic description of a single SQL
+// statement. It is produced by a tokenizer rather than a full parser, so it is
+// deliberately conservative: anything it cannot classify is left empty.
+type Statement struct {
+	// Text is the statement text as it was given.
+	Text string `json:"text"`
+	// Verb is the leading keyword in upper case, e.g. SELECT, INSERT or CREATE.
+	// For WITH queries it is the verb of the main statement.
+	Verb string `json:"verb"`
+	// Object is the kind of object a DDL statement operates on, e.g. TABLE,
+	// INDEX or VIEW.
+	Object string `json:"object,omitempty"`
+	// Tables lists the tables referenced by the statement, as written.
+	// Qualified names are joined with ".".
+	Tables []string `json:"tables,omitempty"`
+	// Columns lists the column references found in the statement, as written.
+	Columns []string `json:"columns,omitempty"`
+	// Star reports whether the statement selects "*" or "t.*".
+	Star bool `json:"star,omitempty"`
+	// HasWhere reports whether the statement has a WHERE clause.
+	HasWhere bool `json:"has_where,omitempty"`
+	// Returning reports whether a DML statement returns rows through a
+	// RETURNING or, on SQL Server, OUTPUT clause.
+	Returning bool `json:"returning,omitempty"`
+	// WritingCTE reports whether the statement has a WITH clause holding an
+	// INSERT, UPDATE, DELETE or MERGE, which PostgreSQL runs even when the
+	// main statement is a SELECT.
+	WritingCTE bool `json:"writing_cte,omitempty"`
+
+	aliases map[string]string
+	// outputs maps lower-case result column names to the column references
+	// their expressions read. unnamed holds the references of expressions
+	// whose result name depends on the database, such as lower(email).
+	outputs    map[string][]string
+	unnamed    []string
+	hasUnnamed bool
+}
+
+// Statement classes, as returned by Statement.Class.
+const (
+	ClassQuery = "query"
+	ClassDML   = "dml"
+	ClassDDL   = "ddl"
+	ClassOther = "other"
+)
+
+var verbClasses = map[string]string{
+	"SELECT": ClassQuery, "VALUES": ClassQuery, "TABLE": ClassQuery, "SHOW": ClassQuery,
+	"DESCRIBE": ClassQuery, "DESC": ClassQuery, "EXPLAIN": ClassQuery, "PRAGMA": ClassQuery,
+
+	"INSERT": ClassDML, "UPDATE": ClassDML, "DELETE": ClassDML, "MERGE": ClassDML,
+	"REPLACE": ClassDML, "UPSERT": ClassDML,
+
+	"CREATE": ClassDDL, "ALTER": ClassDDL, "DROP": ClassDDL, "TRUNCATE": ClassDDL,
+	"RENAME": ClassDDL, "COMMENT": ClassDDL,
+}
+
+// Class returns whether the statement is a query returning rows, a DML
+// statement changing rows, a DDL statement changing the schema, or something
+// else, judging by its verb.
+func (s Statement) Class() string {
+	if class, ok := verbClasses[s.Verb]; ok {
+		return class
+	}
+	return ClassOther
+}
+
+type tokenKind int
+
+const (
+	tokWord tokenKind = iota
+	tokQuotedIdent
+	tokString
+	tokNumber
+	tokPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// upper returns the token text in upper case for keyword comparison.
+func (t token) upper() string {
+	if t.kind != tokWord {
+		return ""
+	}
+	return strings.ToUpper(t.text)
+}
+
+func (t token) isIdent() bool {
+	return t.kind == tokQuotedIdent || (t.kind == tokWord && !sqlKeywords[t.upper()])
+}
+
+func (t token) isPunct(s string) bool {
+	return t.kind == tokPunct && t.text == s
+}
+
+// tokenize splits a SQL string into tokens, dropping whitespace and comments.
+// Token positions are byte offsets into query.
+func tokenize(query string) []token {
+	var tokens []token
+	r := []rune(query)
+	n := len(r)
+	offsets := make([]int, n+1)
+	for i, off := 0, 0; i < n; i++ {
+		offsets[i] = off
+		off += len(string(r[i]))
+		offsets[i+1] = off
+	}
+	emit := func(kind tokenKind, text string, start int) {
+		tokens = append(tokens, token{kind, text, offsets[start]})
+	}
+	for i := 0; i < n; {
+		c := r[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '-' && i+1 < n && r[i+1] == '-':
+			for i < n && r[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < n && r[i+1] == '*':
+			i += 2
+			for i < n && !(r[i] == '*' && i+1 < n && r[i+1] == '/') {
+				i++
+			}
+			i = min(i+2, n)
+		case c == '\'':
+			start := i
+			i = scanQuoted(r, i, '\'')
+			emit(tokString, string(r[start:i]), start)
+		case c == '"' || c == '`':
+			start := i
+			i = scanQuoted(r, i, c)
+			emit(tokQuotedIdent, unquote(string(r[start:i])), start)
+		case c == '[':
+			start := i
+			for i < n && r[i] != ']' {
+				i++
+			}
+			i = min(i+1, n)
+			emit(tokQuotedIdent, strings.TrimSuffix(string(r[start+1:i]), "]"), start)
+		case c == '$' && dollarTag(r, i) != "":
+			start := i
+			tag := []rune(dollarTag(r, i))
+			i += len(tag)
+			for i < n && !(i+len(tag) <= n && string(r[i:i+len(tag)]) == string(tag)) {
+				i++
+			}
+			i = min(i+len(tag), n)
+			emit(tokString, string(r[start:i]), start)
+		case unicode.IsDigit(c):
+			start := i
+			for i < n && (unicode.IsDigit(r[i]) || r[i] == '.' || r[i] == 'e' || r[i] == 'E') {
+				i++
+			}
+			emit(tokNumber, string(r[start:i]), start)
+		case isWordRune(c, true):
+			start := i
+			for i < n && isWordRune(r[i], false) {
+				i++
+			}
+			emit(tokWord, string(r[start:i]), start)
+		default:
+			emit(tokPunct, string(c), i)
+			i++
+		}
+	}
+	return tokens
+}
+
+func isWordRune(c rune, first bool) bool {
+	if c == '_' || unicode.IsLetter(c) {
+		return true
+	}
+	if first {
+		return c == '@' || c == '#'
+	}
+	return unicode.IsDigit(c) || c == '$' || c == '@' || c == '#'
+}
+
+// scanQuoted returns the index just past the closing quote, treating a
+// doubled quote as an escaped one.
+func scanQuoted(r []rune, i int, q rune) int {
+	n := len(r)
+	i++
+	for i < n {
+		if r[i] == q {
+			if i+1 < n && r[i+1] == q {
+				i += 2
+				continue
+			}
+			return i + 1
+		}
+		if r[i] == '\\' && q == '\'' && i+1 < n {
+			i += 2
+			continue
+		}
+		i++
+	}
+	return n
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 {
+		q := s[:1]
+		s = strings.TrimSuffix(s[1:], q)
+		return strings.ReplaceAll(s, q+q, q)
+	}
+	return s
+}
+
+// dollarTag returns the PostgreSQL dollar-quote tag starting at i, such as
+// "$$" or "$body$", or "" if there is none.
+func dollarTag(r []rune, i int) string {
+	j := i + 1
+	for j < len(r) && (r[j] == '_' || unicode.IsLetter(r[j]) || (j > i+1 && unicode.IsDigit(r[j]))) {
+		j++
+	}
+	if j < len(r) && r[j] == '$' {
+		return string(r[i : j+1])
+	}
+	return ""
+}
+
+// SplitStatements splits a SQL string on top-level semicolons, ignoring those
+// inside strings, quoted identifiers and comments. Empty statements are
+// dropped.
+func SplitStatements(query string) []string {
+	var stmts []string
+	start := 0
+	for _, t := range tokenize(query) {
+		if t.isPunct(";") {
+			if s := strings.TrimSpace(query[start:t.pos]); s != "" {
+				stmts = append(stmts, s)
+			}
+			start = t.pos + 1
+		}
+	}
+	if s := strings.TrimSpace(query[start:]); s != "" {
+		stmts = append(stmts, s)
+	}
+	return stmts
+}
+
+// ParseStatements splits query into statements and parses each of them.
+func ParseStatements(query string) []Statement {
+	var stmts []Statement
+	for _, s := range SplitStatements(query) {
+		stmts = append(stmts, ParseStatement(s))
+	}
+	return stmts
+}
+
+// ParseStatement classifies a single SQL statement and extracts the tables
+// and columns it references.
+func ParseStatement(query string) Statement {
+	stmt := Statement{Text: query, aliases: map[string]string{}}
+	tokens := tokenize(query)
+	if len(tokens) == 0 {
+		return stmt
+	}
+
+	ctes := map[string]bool{}
+	start := 0
+	if tokens[0].upper() == "WITH" {
+		start, stmt.WritingCTE = skipCTEs(tokens, ctes)
+	}
+	if start < len(tokens) {
+		stmt.Verb = tokens[start].upper()
+	}
+	stmt.Object = statementObject(tokens, start)
+
+	seenTable := map[string]bool{}
+	addTable := func(name string) {
+		if name == "" || ctes[strings.ToLower(name)] || seenTable[name] {
+			return
+		}
+		seenTable[name] = true
+		stmt.Tables = append(stmt.Tables, name)
+	}
+	seenColumn := map[string]bool{}
+	addColumn := func(name string) {
+		if seenColumn[name] {
+			return
+		}
+		seenColumn[name] = true
+		stmt.Columns = append(stmt.Columns, name)
+	}
+
+	depth := 0
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		switch {
+		case t.isPunct("("):
+			depth++
+		case t.isPunct(")"):
+			depth--
+		}
+		switch t.upper() {
+		case "WHERE":
+			if depth == 0 {
+				stmt.HasWhere = true
+			}
+			continue
+		case "FROM", "JOIN", "INTO", "UPDATE", "USING":
+			i = readTableList(tokens, i+1, t.upper() == "FROM", addTable, stmt.aliases) - 1
+			continue
+		case "TABLE", "TRUNCATE":
+			if i == 0 || tokens[i-1].upper() != "RETURNS" {
+				i = readTableList(tokens, i+1, false, addTable, stmt.aliases) - 1
+			}
+			continue
+		case "ON":
+			if stmt.Object == "INDEX" {
+				i = readTableList(tokens, i+1, false, addTable, stmt.aliases) - 1
+				continue
+			}
+		case "AS":
+			// Skip alias names so they are not mistaken for columns.
+			if i+1 < len(tokens) && tokens[i+1].isIdent() {
+				i++
+			}
+			continue
+		}
+
+		if t.isPunct("*") && i > 0 && isProjectionStar(tokens, i) {
+			stmt.Star = true
+			if i >= 2 && tokens[i-1].isPunct(".") && tokens[i-2].isIdent() {
+				addColumn(tokens[i-2].text + ".*")
+			} else {
+				addColumn("*")
+			}
+			continue
+		}
+
+		if !t.isIdent() {
+			continue
+		}
+		name, next := readQualifiedName(tokens, i)
+		if next < len(tokens) && tokens[next].isPunct("(") {
+			// Function call.
+			i = next - 1
+			continue
+		}
+		if next < len(tokens) && tokens[next].isPunct(".") {
+			// "t.*" handled by the star case.
+			i = next - 1
+			continue
+		}
+		addColumn(name)
+		i = next - 1
+	}
+
+	// CTE names and table aliases may have been picked up as columns when
+	// referenced on their own; drop those.
+	filtered := stmt.Columns[:0]
+	for _, c := range stmt.Columns {
+		lc := strings.ToLower(c)
+		if ctes[lc] || seenTable[c] {
+			continue
+		}
+		if _, ok := stmt.aliases[lc]; ok {
+			continue
+		}
+		filtered = append(filtered, c)
+	}
+	stmt.Columns = filtered
+	stmt.Returning = stmt.Class() == ClassDML && returnsRows(tokens[start:])
+	stmt.readProjections(tokens)
+
+	return stmt
+}
+
+// returnsRows reports whether tokens have a top-level RETURNING or OUTPUT
+// clause that is not followed by INTO, which stores the rows in variables
+// instead of returning them.
+func returnsRows(tokens []token) bool {
+	returning := false
+	depth := 0
+	for i, t := range tokens {
+		switch {
+		case t.isPunct("("):
+			depth++
+		case t.isPunct(")"):
+			depth--
+		case depth != 0:
+		case t.upper() == "RETURNING" || (t.upper() == "OUTPUT" && isOutputClause(tokens, i)):
+			returning = true
+		case t.upper() == "INTO" && returning:
+			return false
+		}
+	}
+	return returning
+}
+
+// isOutputClause reports whether the OUTPUT at i starts a SQL Server OUTPUT
+// clause, which reads inserted.*, deleted.* or $action, rather than naming a
+// column.
+func isOutputClause(tokens []token, i int) bool {
+	if i+1 >= len(tokens) {
+		return false
+	}
+	next := tokens[i+1]
+	if next.isPunct("$") {
+		return true
+	}
+	switch next.upper() {
+	case "INSERTED", "DELETED":
+		return i+2 < len(tokens) && tokens[i+2].isPunct(".")
+	}
+	return false
+}
+
+// ResolveColumn splits a column reference into the table it belongs to and the
+// bare column name, resolving table aliases. Unqualified columns return an
+// empty table.
+func (s Statement) ResolveColumn(ref string) (table, column string) {
+	i := strings.LastIndex(ref, ".")
+	if i < 0 {
+		return "", ref
+	}
+	qualifier, column := ref[:i], ref[i+1:]
+	if t, ok := s.aliases[strings.ToLower(qualifier)]; ok {
+		return t, column
+	}
+	return qualifier, column
+}
+
+// ColumnSources returns the column references a result column named column
+// is computed from, following aliases through subqueries and CTEs. ok is false
+// when the statement does not say where the column comes from.
+func (s Statement) ColumnSources(column string) (refs []string, ok bool) {
+	key := strings.ToLower(column)
+	pending, found := s.outputs[key]
+	if !found {
+		if !s.Star && !s.hasUnnamed {
+			return nil, false
+		}
+		// The column comes from a star or from an expression the parser
+		// cannot name; assume any of them.
+		if s.Star {
+			pending = []string{column}
+		}
+		pending = append(pending, s.unnamed...)
+	}
+	seen := map[string]bool{key: true}
+	for len(pending) > 0 {
+		ref := pending[0]
+		pending = pending[1:]
+		if slices.Contains(refs, ref) {
+			continue
+		}
+		refs = append(refs, ref)
+		bare := strings.ToLower(ref[strings.LastIndex(ref, ".")+1:])
+		if more, ok := s.outputs[bare]; ok && !seen[bare] {
+			seen[bare] = true
+			pending = append(pending, more...)
+		}
+	}
+	return refs, true
+}
+
+// selectItem is one expression of a select or RETURNING list.
+type selectItem struct {
+	name string
+	refs []string
+}
+
+var selectListEnd = map[string]bool{
+	"FROM": true, "INTO": true, "WHERE": true, "GROUP": true, "HAVING": true,
+	"ORDER": true, "LIMIT": true, "OFFSET": true, "FETCH": true, "FOR": true,
+	"WINDOW": true, "UNION": true, "INTERSECT": true, "EXCEPT": true, "MINUS": true,
+}
+
+// readProjections records the result columns of every select and RETURNING
+// list in tokens. The columns of later UNION branches are recorded under the
+// names of the first branch, as the database reports them.
+func (s *Statement) readProjections(tokens []token) {
+	s.outputs = map[string][]string{}
+	first := map[int][]string{}
+	compound := map[int]bool{}
+	depth := 0
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		switch {
+		case t.isPunct("("):
+			depth++
+			continue
+		case t.isPunct(")"):
+			delete(first, depth)
+			delete(compound, depth)
+			depth--
+			continue
+		}
+		switch t.upper() {
+		case "UNION", "INTERSECT", "EXCEPT", "MINUS":
+			compound[depth] = true
+		case "SELECT", "RETURNING":
+			items, next := readSelectList(tokens, i+1)
+			var names []string
+			for n, item := range items {
+				s.addOutput(item.name, item.refs)
+				if compound[depth] && n < len(first[depth]) {
+					s.addOutput(first[depth][n], item.refs)
+				}
+				names = append(names, item.name)
+			}
+			if !compound[depth] {
+				first[depth] = names
+			}
+			compound[depth] = false
+			i = next - 1
+		}
+	}
+}
+
+func (s *Statement) addOutput(name string, refs []string) {
+	if name == "" {
+		s.unnamed = append(s.unnamed, refs...)
+		s.hasUnnamed = true
+		return
+	}
+	key := strings.ToLower(name)
+	s.outputs[key] = append(s.outputs[key], refs...)
+}
+
+// readSelectList reads the comma-separated expressions starting at i and
+// returns them with the index after the list. Star items are left out.
+func readSelectList(tokens []token, i int) ([]selectItem, int) {
+	for next := skipSelectModifier(tokens, i); next != i; next = skipSelectModifier(tokens, i) {
+		i = next
+	}
+	var items []selectItem
+	var item []token
+	depth := 0
+	for ; i < len(tokens); i++ {
+		t := tokens[i]
+		if depth == 0 {
+			if t.isPunct(",") {
+				items = appendSelectItem(items, item)
+				item = nil
+				continue
+			}
+			if t.isPunct(")") || t.isPunct(";") || selectListEnd[t.upper()] {
+				break
+			}
+		}
+		switch {
+		case t.isPunct("("):
+			depth++
+		case t.isPunct(")"):
+			depth--
+		}
+		item = append(item, t)
+	}
+	return appendSelectItem(items, item), i
+}
+
+// skipSelectModifier returns the index after a DISTINCT, ALL or TOP modifier
+// at i, or i if there is none.
+func skipSelectModifier(tokens []token, i int) int {
+	if i >= len(tokens) {
+		return i
+	}
+	switch u := tokens[i].upper(); {
+	case u == "DISTINCT" && i+1 < len(tokens) && tokens[i+1].upper() == "ON":
+		return skipParens(tokens, i+2)
+	case u == "DISTINCT" || u == "ALL" || u == "PERCENT":
+		return i + 1
+	case u == "TOP" && i+1 < len(tokens) && tokens[i+1].isPunct("("):
+		return skipParens(tokens, i+1)
+	case u == "TOP":
+		return min(i+2, len(tokens))
+	case u == "WITH" && i+1 < len(tokens) && strings.EqualFold(tokens[i+1].text, "TIES"):
+		return i + 2
+	}
+	return i
+}
+
+// appendSelectItem names the expression in tokens by its alias, or by the
+// column it selects, and appends it to items.
+func appendSelectItem(items []selectItem, tokens []token) []selectItem {
+	n := len(tokens)
+	if n == 0 || tokens[n-1].isPunct("*") {
+		return items
+	}
+	var item selectItem
+	if last := tokens[n-1]; n >= 2 && last.isIdent() {
+		prev := tokens[n-2]
+		switch {
+		case prev.upper() == "AS":
+			item.name, tokens = last.text, tokens[:n-2]
+		case prev.isIdent() || prev.isPunct(")") || prev.upper() == "END" ||
+			prev.kind == tokString || prev.kind == tokNumber:
+			item.name, tokens = last.text, tokens[:n-1]
+		}
+	}
+	for i := 0; i < len(tokens); i++ {
+		if !tokens[i].isIdent() || (i > 0 && tokens[i-1].upper() == "AS") {
+			continue
+		}
+		name, next := readQualifiedName(tokens, i)
+		if next < len(tokens) && tokens[next].isPunct("(") {
+			i = next - 1
+			continue
+		}
+		if item.name == "" && i == 0 && next == len(tokens) {
+			item.name = tokens[next-1].text
+		}
+		item.refs = append(item.refs, name)
+		i = next - 1
+	}
+	return append(items, item)
+}
+
+// skipCTEs returns the index of the main statement after a WITH clause,
+// recording the CTE names it defines, and whether any CTE body changes rows.
+func skipCTEs(tokens []token, ctes map[string]bool) (int, bool) {
+	writes := false
+	i := 1
+	if i < len(tokens) && tokens[i].upper() == "RECURSIVE" {
+		i++
+	}
+	for i < len(tokens) {
+		if tokens[i].isIdent() {
+			ctes[strings.ToLower(tokens[i].text)] = true
+		}
+		// Skip to the CTE body and past its closing parenthesis.
+		for i < len(tokens) && !tokens[i].isPunct("(") {
+			i++
+		}
+		if i+1 < len(tokens) && verbClasses[tokens[i+1].upper()] == ClassDML {
+			writes = true
+		}
+		i = skipParens(tokens, i)
+		if i < len(tokens) && tokens[i].isPunct(",") {
+			i++
+			continue
+		}
+		return i, writes
+	}
+	return i, writes
+}
+
+// skipParens returns the index just past the parenthesis group opening at i.
+func skipParens(tokens []token, i int) int {
+	depth := 0
+	for ; i < len(tokens); i++ {
+		switch {
+		case tokens[i].isPunct("("):
+			depth++
+		case tokens[i].isPunct(")"):
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return i
+}
+
+var objectModifiers = map[string]bool{
+	"OR": true, "REPLACE": true, "TEMP": true, "TEMPORARY": true, "UNIQUE": true,
+	"GLOBAL": true, "LOCAL": true, "UNLOGGED": true, "VIRTUAL": true,
+	"MATERIALIZED": true, "EXTERNAL": true, "TRANSIENT": true, "CLUSTERED": true,
+	"NONCLUSTERED": true, "IF": true, "NOT": true, "EXISTS": true,
+}
+
+// statementObject returns the object kind for DDL statements.
+func statementObject(tokens []token, start int) string {
+	if start >= len(tokens) {
+		return ""
+	}
+	switch tokens[start].upper() {
+	case "CREATE", "DROP", "ALTER":
+	case "TRUNCATE":
+		return "TABLE"
+	default:
+		return ""
+	}
+	for i := start + 1; i < len(tokens); i++ {
+		u := tokens[i].upper()
+		if u == "" {
+			return ""
+		}
+		if !objectModifiers[u] {
+			return u
+		}
+	}
+	return ""
+}
+
+// readQualifiedName reads ident(.ident)* starting at i and returns the joined
+// name and the index after it.
+func readQualifiedName(tokens []token, i int) (string, int) {
+	parts := []string{tokens[i].text}
+	i++
+	for i+1 < len(tokens) && tokens[i].isPunct(".") && tokens[i+1].isIdent() {
+		parts = append(parts, tokens[i+1].text)
+		i += 2
+	}
+	return strings.Join(parts, "."), i
+}
+
+// readTableList reads one table reference (or a comma-separated list of them
+// when list is set) starting at i, and returns the index after it.
+func readTableList(tokens []token, i int, list bool, add func(string), aliases map[string]string) int {
+	for i < len(tokens) {
+		for i < len(tokens) && tableListNoise[tokens[i].upper()] {
+			i++
+		}
+		if i >= len(tokens) || !tokens[i].isIdent() {
+			return i
+		}
+		name, next := readQualifiedName(tokens, i)
+		if next < len(tokens) && tokens[next].isPunct("(") && !list {
+			// INSERT INTO t (cols) or CREATE TABLE t (defs).
+			add(name)
+			return next
+		}
+		if next < len(tokens) && tokens[next].isPunct("(") {
+			// Table-valued function.
+			return next
+		}
+		add(name)
+		i = next
+		if i < len(tokens) && tokens[i].upper() == "AS" {
+			i++
+		}
+		if i < len(tokens) && tokens[i].isIdent() {
+			aliases[strings.ToLower(tokens[i].text)] = name
+			i++
+		}
+		if !list || i >= len(tokens) || !tokens[i].isPunct(",") {
+			return i
+		}
+		i++
+	}
+	return i
+}
+
+var tableListNoise = map[string]bool{
+	"IF": true, "NOT": true, "EXISTS": true, "ONLY": true, "LATERAL": true,
+	"TABLE": true,
+}
+
+// isProjectionStar reports whether the "*" at i is a projection rather than a
+// multiplication or COUNT(*).
+func isProjectionStar(tokens []token, i int) bool {
+	if i+1 < len(tokens) && tokens[i+1].isPunct(")") && i > 0 && tokens[i-1].isPunct("(") {
+		return false
+	}
+	prev := tokens[i-1]
+	if prev.isPunct(".") {
+		return true
+	}
+	switch prev.upper() {
+	case "SELECT", "DISTINCT", "ALL", "RETURNING":
+		return true
+	}
+	return prev.isPunct(",")
+}
+
+// sqlKeywords holds reserved words that are never treated as identifiers.
+var sqlKeywords = map[string]bool{}
+
+func init() {
+	for _, k := range strings.Fields(`
+		ADD ALL ALTER AND ANY AS ASC BETWEEN BY CASE CAST CHECK COLUMN CONSTRAINT
+		CREATE CROSS CURRENT_DATE CURRENT_TIME CURRENT_TIMESTAMP DEFAULT DELETE
+		DESC DISTINCT DROP ELSE END ESCAPE EXCEPT EXISTS EXPLAIN FALSE FETCH FIRST
+		FOR FOREIGN FROM FULL GROUP HAVING IF ILIKE IN INDEX INNER INSERT INTERSECT
+		INTERVAL INTO IS JOIN KEY LATERAL LEFT LIKE LIMIT MERGE NATURAL NEXT NOT
+		NULL NULLS OF OFFSET ON ONLY OR ORDER OUTER OVER PARTITION PRIMARY
+		RECURSIVE REFERENCES REPLACE RETURNING RIGHT ROW ROWS SELECT SET SOME TABLE
+		THEN TO TOP TRUE TRUNCATE UNION UNIQUE UPDATE USING VALUES VIEW WHEN WHERE
+		WINDOW WITH`) {
+		sqlKeywords[k] = true
+	}
+}
@@ -0,0 +1,207 @@
+package api_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thesoulless/usqlmcp/api"
+)
+
+func TestParseStatement(t *testing.T) {
+	tests := []struct {
+		query    string
+		verb     string
+		object   string
+		tables   []string
+		columns  []string
+		star     bool
+		hasWhere bool
+	}{
+		{
+			query:   "SELECT id, name FROM users",
+			verb:    "SELECT",
+			tables:  []string{"users"},
+			columns: []string{"id", "name"},
+		},
+		{
+			query:    "select u.email, o.total from public.users u join billing.orders as o on o.user_id = u.id where o.total > 10",
+			verb:     "SELECT",
+			tables:   []string{"public.users", "billing.orders"},
+			columns:  []string{"u.email", "o.total", "o.user_id", "u.id"},
+			hasWhere: true,
+		},
+		{
+			query:   "SELECT * FROM users",
+			verb:    "SELECT",
+			tables:  []string{"users"},
+			columns: []string{"*"},
+			star:    true,
+		},
+		{
+			query:  "SELECT COUNT(*) FROM users",
+			verb:   "SELECT",
+			tables: []string{"users"},
+		},
+		{
+			query:   "WITH recent AS (SELECT id FROM orders WHERE created > '2024-01-01') DELETE FROM orders",
+			verb:    "DELETE",
+			tables:  []string{"orders"},
+			columns: []string{"id", "created"},
+		},
+		{
+			query:    "DELETE FROM sessions WHERE id IN (SELECT id FROM expired)",
+			verb:     "DELETE",
+			tables:   []string{"sessions", "expired"},
+			columns:  []string{"id"},
+			hasWhere: true,
+		},
+		{
+			query:   "UPDATE accounts SET balance = (SELECT 0 FROM dual WHERE 1 = 1)",
+			verb:    "UPDATE",
+			tables:  []string{"accounts", "dual"},
+			columns: []string{"balance"},
+		},
+		{
+			query:   `INSERT INTO "audit log" (who, "when") VALUES ('it''s me', now())`,
+			verb:    "INSERT",
+			tables:  []string{"audit log"},
+			columns: []string{"who", "when"},
+		},
+		{
+			query:  "DROP TABLE IF EXISTS billing.invoices",
+			verb:   "DROP",
+			object: "TABLE",
+			tables: []string{"billing.invoices"},
+		},
+		{
+			query:  "CREATE UNIQUE INDEX idx_email ON users (email)",
+			verb:   "CREATE",
+			object: "INDEX",
+			tables: []string{"users"},
+		},
+		{
+			query:  "create or replace view v as select 1",
+			verb:   "CREATE",
+			object: "VIEW",
+		},
+		{
+			query:  "-- leading comment\nTRUNCATE logs",
+			verb:   "TRUNCATE",
+			object: "TABLE",
+			tables: []string{"logs"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			stmt := api.ParseStatement(tt.query)
+			assert.Equal(t, tt.verb, stmt.Verb, "verb")
+			assert.Equal(t, tt.object, stmt.Object, "object")
+			assert.Equal(t, tt.tables, stmt.Tables, "tables")
+			if tt.columns != nil {
+				assert.Equal(t, tt.columns, stmt.Columns, "columns")
+			}
+			assert.Equal(t, tt.star, stmt.Star, "star")
+			assert.Equal(t, tt.hasWhere, stmt.HasWhere, "has where")
+		})
+	}
+}
+
+func TestResolveColumn(t *testing.T) {
+	stmt := api.ParseStatement("SELECT u.password_hash FROM users u")
+	table, column := stmt.ResolveColumn("u.password_hash")
+	assert.Equal(t, "users", table)
+	assert.Equal(t, "password_hash", column)
+
+	table, column = stmt.ResolveColumn("password_hash")
+	assert.Equal(t, "", table)
+	assert.Equal(t, "password_hash", column)
+}
+
+func TestColumnSources(t *testing.T) {
+	tests := []struct {
+		query  string
+		column string
+		want   []string
+	}{
+		{"SELECT email FROM users", "email", []string{"email"}},
+		{"SELECT email AS e FROM users", "e", []string{"email"}},
+		{"SELECT u.email x, id FROM users u", "x", []string{"u.email"}},
+		{"SELECT DISTINCT lower(email) FROM users", "lower(email)", []string{"email"}},
+		{"SELECT CASE WHEN id > 0 THEN email END contact FROM users", "contact", []string{"id", "email"}},
+		{"SELECT e FROM (SELECT email AS e FROM users) sub", "e", []string{"e", "email"}},
+		{"WITH x AS (SELECT email AS e FROM users) SELECT * FROM x", "e", []string{"email"}},
+		{"SELECT id FROM t UNION SELECT email FROM users", "id", []string{"id", "email"}},
+		{"SELECT * FROM users", "email", []string{"email"}},
+		{"DELETE FROM users RETURNING email AS gone", "gone", []string{"email"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			refs, ok := api.ParseStatement(tt.query).ColumnSources(tt.column)
+			assert.True(t, ok)
+			assert.Equal(t, tt.want, refs)
+		})
+	}
+
+	_, ok := api.ParseStatement("SELECT id FROM users").ColumnSources("email")
+	assert.False(t, ok)
+}
+
+func TestSplitStatements(t *testing.T) {
+	query := `INSERT INTO t VALUES ('a;b'); -- trailing; comment
+		/* block; */ UPDATE t SET x = 1;;
+		SELECT $$;$$`
+	assert.Equal(t, []string{
+		"INSERT INTO t VALUES ('a;b')",
+		"-- trailing; comment\n\t\t/* block; */ UPDATE t SET x = 1",
+		"SELECT $$;$$",
+	}, api.SplitStatements(query))
+}
+
+func TestStatementClass(t *testing.T) {
+	for query, want := range map[string]string{
+		"SELECT 1":                                api.ClassQuery,
+		"WITH x AS (SELECT 1) SELECT * FROM x":    api.ClassQuery,
+		"show tables":                             api.ClassQuery,
+		"INSERT INTO t VALUES (1)":                api.ClassDML,
+		"WITH x AS (SELECT 1) UPDATE t SET n = 1": api.ClassDML,
+		"ALTER TABLE t ADD n int":                 api.ClassDDL,
+		"TRUNCATE t":                              api.ClassDDL,
+		"GRANT SELECT ON t TO u":                  api.ClassOther,
+		"":                                        api.ClassOther,
+	} {
+		assert.Equal(t, want, api.ParseStatement(query).Class(), query)
+	}
+}
+
+func TestStatementReturning(t *testing.T) {
+	for query, want := range map[string]bool{
+		"INSERT INTO t (n) VALUES (1) RETURNING id":                                       true,
+		"insert into t (n) values (1) on conflict do nothing returning *":                 true,
+		"DELETE FROM t OUTPUT deleted.* WHERE n = 1":                                      true,
+		"INSERT INTO t (n) OUTPUT inserted.id VALUES (1)":                                 true,
+		"UPDATE t SET n = 1 RETURNING n INTO :n":                                          false,
+		"INSERT INTO t (n) OUTPUT inserted.id INTO @ids VALUES (1)":                       false,
+		"WITH d AS (DELETE FROM t RETURNING *) INSERT INTO archive SELECT * FROM d":       false,
+		"WITH d AS (DELETE FROM t RETURNING *) SELECT * FROM d":                           false,
+		"SELECT output FROM t":                                                            false,
+		"UPDATE t SET output = 1":                                                         false,
+		"UPDATE t SET n = 1 WHERE output > 0":                                             false,
+		"MERGE t USING s ON t.n = s.n WHEN MATCHED THEN DELETE OUTPUT $action, deleted.n": true,
+		"INSERT INTO t (n) VALUES (1)":                                                    false,
+	} {
+		assert.Equal(t, want, api.ParseStatement(query).Returning, query)
+	}
+}
+
+func TestStatementWritingCTE(t *testing.T) {
+	for query, want := range map[string]bool{
+		"WITH d AS (DELETE FROM t RETURNING *) SELECT * FROM d":                       true,
+		"WITH x AS (SELECT 1), u AS (UPDATE t SET n = 1 RETURNING n) SELECT * FROM u": true,
+		"WITH RECURSIVE i AS (INSERT INTO t VALUES (1) RETURNING n) SELECT * FROM i":  true,
+		"WITH x AS (SELECT * FROM t) SELECT * FROM x":                                 false,
+		"DELETE FROM t": false,
+	} {
+		assert.Equal(t, want, api.ParseStatement(query).WritingCTE, query)
+	}
+}
@@ -0,0 +1,229 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName is the instrumentation name used for usqlmcp spans.
+const TracerName = "github.com/thesoulless/usqlmcp"
+
+// Tracer returns the usqlmcp tracer from the global tracer provider.
+func Tracer() trace.Tracer {
+	return otel.Tracer(TracerName)
+}
+
+type driverKey struct{}
+
+// WithDriver annotates ctx with the name of the driver statements run on, as
+// reported on statement spans and query metrics.
+func WithDriver(ctx context.Context, driver string) context.Context {
+	return context.WithValue(ctx, driverKey{}, driver)
+}
+
+func driverFrom(ctx context.Context) string {
+	driver, _ := ctx.Value(driverKey{}).(string)
+	return driver
+}
+
+// DBSystem returns the OpenTelemetry db.system value for a driver name.
+func DBSystem(driver string) string {
+	switch driver = strings.ToLower(driver); driver {
+	case "postgres", "pgx":
+		return "postgresql"
+	case "mysql", "mymysql":
+		return "mysql"
+	case "sqlite", "sqlite3", "moderncsqlite":
+		return "sqlite"
+	case "sqlserver":
+		return "mssql"
+	case "oracle", "godror":
+		return "oracle"
+	case "":
+		return "other_sql"
+	default:
+		return driver
+	}
+}
+
+// startStatementSpan starts a client span for a single SQL statement.
+func startStatementSpan(ctx context.Context, operation, query string) (context.Context, trace.Span) {
+	system := DBSystem(driverFrom(ctx))
+	ctx, span := Tracer().Start(ctx, operation+" "+system, trace.WithSpanKind(trace.SpanKindClient))
+	span.SetAttributes(
+		attribute.String("db.system", system),
+		attribute.String("db.operation", ParseStatement(query).Verb),
+		attribute.String("db.statement", SanitizeSQL(query)),
+	)
+	return ctx, span
+}
+
+// endStatementSpan records the outcome of a statement on its span and in the
+// query metrics, then ends the span.
+func endStatementSpan(ctx context.Context, span trace.Span, rows int64, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		DefaultMetrics.QueryErrors.WithLabelValues(driverFrom(ctx)).Inc()
+	} else {
+		span.SetAttributes(attribute.Int64("db.rows", rows))
+	}
+	span.End()
+}
+
+// SanitizeSQL replaces string and numeric literals in query with "?", so
+// statements can be recorded without leaking the values they contain.
+func SanitizeSQL(query string) string {
+	var b strings.Builder
+	last := 0
+	for _, t := range tokenize(query) {
+		if t.kind != tokString && t.kind != tokNumber {
+			continue
+		}
+		b.WriteString(query[last:t.pos])
+		b.WriteString("?")
+		last = t.pos + len(t.text)
+	}
+	b.WriteString(query[last:])
+	return b.String()
+}
+
+// Metrics holds the Prometheus collectors exported by usqlmcp.
+type Metrics struct {
+	Registry     *prometheus.Registry
+	ToolCalls    *prometheus.CounterVec
+	ToolDuration *prometheus.HistogramVec
+	QueryErrors  *prometheus.CounterVec
+	ResultBytes  *prometheus.CounterVec
+}
+
+// NewMetrics creates the usqlmcp collectors and registers them, along with
+// the Go runtime and process collectors, on a new registry.
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		ToolCalls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "usqlmcp_tool_calls_total",
+			Help: "Number of MCP tool calls by tool and status.",
+		}, []string{"tool", "status"}),
+		ToolDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "usqlmcp_tool_call_duration_seconds",
+			Help:    "Latency of MCP tool calls.",
+			Buckets: prometheus.ExponentialBuckets(0.001, 4, 10),
+		}, []string{"tool"}),
+		QueryErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "usqlmcp_query_errors_total",
+			Help: "Number of failed SQL statements by driver.",
+		}, []string{"driver"}),
+		ResultBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "usqlmcp_result_bytes_total",
+			Help: "Bytes of tool results returned to clients.",
+		}, []string{"tool"}),
+	}
+	m.Registry.MustRegister(
+		m.ToolCalls, m.ToolDuration, m.QueryErrors, m.ResultBytes,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// DefaultMetrics is the registry used by the server.
+var DefaultMetrics = NewMetrics()
+
+// RegisterDB exports the connection pool statistics of db, including open
+// connections, under the given connection name.
+func (m *Metrics) RegisterDB(db *sql.DB, name string) error {
+	return m.Registry.Register(collectors.NewDBStatsCollector(db, name))
+}
+
+// ObserveToolCall records a completed tool call.
+func (m *Metrics) ObserveToolCall(tool string, d time.Duration, failed bool, resultBytes int) {
+	status := "ok"
+	if failed {
+		status = "error"
+	}
+	m.ToolCalls.WithLabelValues(tool, status).Inc()
+	m.ToolDuration.WithLabelValues(tool).Observe(d.Seconds())
+	m.ResultBytes.WithLabelValues(tool).Add(float64(resultBytes))
+}
+
+// JSONSpanExporter writes finished spans as JSON lines, for deployments
+// without an OpenTelemetry collector.
+type JSONSpanExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+var _ sdktrace.SpanExporter = (*JSONSpanExporter)(nil)
+
+// NewJSONSpanExporter returns an exporter writing to w.
+func NewJSONSpanExporter(w io.Writer) *JSONSpanExporter {
+	return &JSONSpanExporter{w: w}
+}
+
+type jsonSpan struct {
+	Name       string                 `json:"name"`
+	TraceID    string                 `json:"trace_id"`
+	SpanID     string                 `json:"span_id"`
+	ParentID   string                 `json:"parent_id,omitempty"`
+	Kind       string                 `json:"kind"`
+	Start      time.Time              `json:"start"`
+	End        time.Time              `json:"end"`
+	Status     string                 `json:"status,omitempty"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// ExportSpans implements sdktrace.SpanExporter.
+func (e *JSONSpanExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	enc := json.NewEncoder(e.w)
+	for _, s := range spans {
+		js := jsonSpan{
+			Name:    s.Name(),
+			TraceID: s.SpanContext().TraceID().String(),
+			SpanID:  s.SpanContext().SpanID().String(),
+			Kind:    s.SpanKind().String(),
+			Start:   s.StartTime(),
+			End:     s.EndTime(),
+		}
+		if s.Parent().IsValid() {
+			js.ParentID = s.Parent().SpanID().String()
+		}
+		if s.Status().Code == codes.Error {
+			js.Status = s.Status().Description
+		}
+		if attrs := s.Attributes(); len(attrs) > 0 {
+			js.Attributes = make(map[string]interface{}, len(attrs))
+			for _, kv := range attrs {
+				js.Attributes[string(kv.Key)] = kv.Value.AsInterface()
+			}
+		}
+		if err := enc.Encode(js); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Shutdown implements sdktrace.SpanExporter.
+func (e *JSONSpanExporter) Shutdown(ctx context.Context) error {
+	if c, ok := e.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
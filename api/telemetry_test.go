@@ -0,0 +1,139 @@
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thesoulless/usqlmcp/api"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestStatementSpans(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(previous)
+
+	db := openTestDB(t)
+	ctx := api.WithDriver(context.Background(), "sqlite3")
+	_, err := api.CreateTableContext(ctx, db, `CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT);`)
+	require.NoError(t, err)
+	_, err = api.WriteQueryContext(ctx, db, `INSERT INTO users (name) VALUES ('Alice'), ('Bob');`)
+	require.NoError(t, err)
+	_, err = api.ReadQueryContext(ctx, db, `SELECT name FROM users WHERE name <> 'Carol' AND id < 10;`)
+	require.NoError(t, err)
+
+	errorsBefore := testutil.ToFloat64(api.DefaultMetrics.QueryErrors.WithLabelValues("sqlite3"))
+	_, err = api.ReadQueryContext(ctx, db, `SELECT * FROM missing;`)
+	require.Error(t, err)
+	assert.Equal(t, errorsBefore+1, testutil.ToFloat64(api.DefaultMetrics.QueryErrors.WithLabelValues("sqlite3")))
+
+	_, err = api.DiffData(ctx,
+		api.DiffSource{DB: db, Driver: "sqlite3", Table: "users"},
+		api.DiffSource{DB: db, Driver: "sqlite3", Query: "SELECT * FROM users WHERE id > 1"},
+		api.DiffOptions{Keys: []string{"id"}})
+	require.NoError(t, err)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 5)
+
+	insert := spans[1]
+	assert.Equal(t, "exec sqlite", insert.Name)
+	assert.Contains(t, insert.Attributes, attribute.String("db.system", "sqlite"))
+	assert.Contains(t, insert.Attributes, attribute.String("db.operation", "INSERT"))
+	assert.Contains(t, insert.Attributes, attribute.String("db.statement", `INSERT INTO users (name) VALUES (?), (?)`))
+	assert.Contains(t, insert.Attributes, attribute.Int64("db.rows", 2))
+
+	query := spans[2]
+	assert.Equal(t, "query sqlite", query.Name)
+	assert.Contains(t, query.Attributes, attribute.String("db.statement", `SELECT name FROM users WHERE name <> ? AND id < ?;`))
+	assert.Contains(t, query.Attributes, attribute.Int64("db.rows", 2))
+
+	assert.Equal(t, codes.Error, spans[3].Status.Code)
+
+	diff := spans[4]
+	assert.Equal(t, "diff sqlite", diff.Name)
+	assert.Contains(t, diff.Attributes, attribute.String("db.statement", "SELECT * FROM \"users\";\nSELECT * FROM (SELECT * FROM users WHERE id > ?) src"))
+	assert.Contains(t, diff.Attributes, attribute.Int64("db.rows", 3))
+}
+
+func TestMigrationSpans(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(previous)
+
+	db := openTestDB(t)
+	dir := t.TempDir()
+	writeMigration(t, dir, "0001_users.up.sql", "CREATE TABLE users (id INTEGER);\nINSERT INTO users VALUES (1), (2);")
+
+	ctx := api.WithDriver(context.Background(), "sqlite3")
+	_, err := api.ApplyMigrations(ctx, db, "sqlite3", dir, api.MigrateOptions{})
+	require.NoError(t, err)
+
+	var statements []string
+	for _, span := range exporter.GetSpans() {
+		if span.Name != "migrate sqlite" {
+			continue
+		}
+		for _, attr := range span.Attributes {
+			if attr.Key == "db.statement" {
+				statements = append(statements, attr.Value.AsString())
+			}
+		}
+	}
+	require.Len(t, statements, 3, "one span per statement and one for the migrations table")
+	assert.Equal(t, "CREATE TABLE users (id INTEGER)", statements[0])
+	assert.Equal(t, "INSERT INTO users VALUES (?), (?)", statements[1])
+	assert.Contains(t, statements[2], "INSERT INTO")
+}
+
+func TestMetricsRegisterDB(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, db.Ping())
+
+	metrics := api.NewMetrics()
+	require.NoError(t, metrics.RegisterDB(db, "main"))
+	metrics.ObserveToolCall("read_query", 0, false, 42)
+	metrics.ObserveToolCall("read_query", 0, true, 0)
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.ToolCalls.WithLabelValues("read_query", "ok")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.ToolCalls.WithLabelValues("read_query", "error")))
+	assert.Equal(t, float64(42), testutil.ToFloat64(metrics.ResultBytes.WithLabelValues("read_query")))
+
+	families, err := metrics.Registry.Gather()
+	require.NoError(t, err)
+	var names []string
+	for _, f := range families {
+		names = append(names, f.GetName())
+	}
+	assert.Contains(t, names, "go_sql_open_connections")
+}
+
+func TestJSONSpanExporter(t *testing.T) {
+	var buf bytes.Buffer
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(api.NewJSONSpanExporter(&buf)))
+	_, span := provider.Tracer("test").Start(context.Background(), "tools/call read_query")
+	span.SetAttributes(attribute.String("mcp.tool.name", "read_query"))
+	span.End()
+
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+	assert.Equal(t, "tools/call read_query", got["name"])
+	assert.Equal(t, map[string]interface{}{"mcp.tool.name": "read_query"}, got["attributes"])
+}
@@ -1,23 +1,179 @@
 package api
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
 
 	_ "github.com/xo/usql/drivers"
 )
 
 // WriteQuery executes an INSERT, UPDATE, DELETE, or ALTER query and returns the number of affected rows.
 func WriteQuery(db *sql.DB, query string) (int64, error) {
-	result, err := db.Exec(query)
+	return WriteQueryContext(context.Background(), db, query)
+}
+
+// WriteQueryContext is like WriteQuery but runs the query under ctx. It is a
+// shorthand for ParseWrite followed by WriteStatement, using the driver set
+// with WithDriver.
+func WriteQueryContext(ctx context.Context, db *sql.DB, query string) (int64, error) {
+	stmt, err := ParseWrite(query)
 	if err != nil {
-		return 0, fmt.Errorf("failed to execute query: %w", err)
+		return 0, err
 	}
+	result, err := WriteStatement(ctx, db, driverFrom(ctx), stmt, 0)
+	return result.RowsAffected, err
+}
+
+// WriteResult is the outcome of a write statement.
+type WriteResult struct {
+	RowsAffected int64 `json:"rows_affected"`
+	// LastInsertID is the ID generated by an INSERT, on databases that
+	// report it.
+	LastInsertID *int64 `json:"last_insert_id,omitempty"`
+	// Rows are the rows returned by a RETURNING or OUTPUT clause, and
+	// Truncated reports whether some were left out.
+	Rows      []Row `json:"rows,omitempty"`
+	Truncated bool  `json:"truncated,omitempty"`
+}
 
-	affectedRows, err := result.RowsAffected()
+// execQuerier runs statements on a database, connection or transaction.
+type execQuerier interface {
+	ExecContext(context.Context, string, ...interface{}) (sql.Result, error)
+	QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error)
+}
+
+// WriteStatement runs stmt, a write statement on a database of driver. Rows
+// returned by a RETURNING or OUTPUT clause are read like ReadQueryLimit,
+// up to maxRows of them, and all of them count as affected.
+func WriteStatement(ctx context.Context, db *sql.DB, driver string, stmt Statement, maxRows int) (result WriteResult, err error) {
+	ctx, span := startStatementSpan(ctx, "exec", stmt.Text)
+	defer func() { endStatementSpan(ctx, span, result.RowsAffected, err) }()
+
+	if result, err = execWrite(ctx, db, driver, stmt, maxRows); err != nil {
+		return WriteResult{}, fmt.Errorf("failed to execute query: %w", err)
+	}
+	return result, nil
+}
+
+// execWrite runs stmt on exec like WriteStatement.
+func execWrite(ctx context.Context, exec execQuerier, driver string, stmt Statement, maxRows int) (WriteResult, error) {
+	var result WriteResult
+	if stmt.Returning {
+		rows, err := exec.QueryContext(ctx, stmt.Text)
+		if err != nil {
+			return result, err
+		}
+		// Every returned row was written, so all of them are counted, but
+		// only maxRows are kept.
+		if result.Rows, result.RowsAffected, err = countRows(rows, maxRows, true); err != nil {
+			return result, err
+		}
+		result.Truncated = result.RowsAffected > int64(len(result.Rows))
+		return result, nil
+	}
+
+	res, err := exec.ExecContext(ctx, stmt.Text)
 	if err != nil {
-		return 0, fmt.Errorf("failed to retrieve affected rows: %w", err)
+		return result, err
+	}
+	if result.RowsAffected, err = res.RowsAffected(); err != nil {
+		return result, fmt.Errorf("failed to retrieve affected rows: %w", err)
+	}
+	if insertVerbs[stmt.Verb] && result.RowsAffected > 0 && DialectFor(driver).LastInsertID() {
+		if id, err := res.LastInsertId(); err == nil {
+			result.LastInsertID = &id
+		}
 	}
+	return result, nil
+}
+
+// insertVerbs are the verbs of statements that may generate IDs.
+var insertVerbs = map[string]bool{"INSERT": true, "REPLACE": true, "UPSERT": true}
 
-	return affectedRows, nil
+// LastInsertID reports whether the dialect's drivers report the ID
+// generated by an INSERT without a RETURNING clause.
+func (d Dialect) LastInsertID() bool {
+	switch d.system() {
+	case "mysql", "sqlite":
+		return true
+	default:
+		return false
+	}
+}
+
+// ParseWrite parses query, which must be a single INSERT, UPDATE, DELETE,
+// MERGE or ALTER statement, as write_query runs.
+func ParseWrite(query string) (Statement, error) {
+	stmt, err := parseSingle(query)
+	if err != nil {
+		return Statement{}, err
+	}
+	if stmt.Class() != ClassDML && stmt.Verb != "ALTER" {
+		return Statement{}, fmt.Errorf("only INSERT, UPDATE, DELETE, MERGE and ALTER statements are allowed, not %s", describeStatement(stmt))
+	}
+	return stmt, nil
+}
+
+// parseSingle parses query, which must hold exactly one statement.
+func parseSingle(query string) (Statement, error) {
+	var stmts []Statement
+	for _, stmt := range ParseStatements(query) {
+		// Comments alone are not statements.
+		if len(tokenize(stmt.Text)) > 0 {
+			stmts = append(stmts, stmt)
+		}
+	}
+	switch len(stmts) {
+	case 0:
+		return Statement{}, errors.New("query holds no statement")
+	case 1:
+		return stmts[0], nil
+	default:
+		return Statement{}, fmt.Errorf("query holds %d statements, but only one is allowed", len(stmts))
+	}
+}
+
+// describeStatement names the kind of stmt in error messages, e.g. "DROP
+// TABLE".
+func describeStatement(stmt Statement) string {
+	switch {
+	case stmt.Verb == "":
+		return "an unrecognized statement"
+	case stmt.Object != "":
+		return stmt.Verb + " " + stmt.Object
+	default:
+		return stmt.Verb
+	}
+}
+
+// pastTenses maps DML and DDL verbs to the past tense used by WriteSummary.
+var pastTenses = map[string]string{
+	"INSERT": "inserted", "UPDATE": "updated", "DELETE": "deleted",
+	"MERGE": "merged", "REPLACE": "replaced", "UPSERT": "upserted",
+	"CREATE": "created", "ALTER": "altered", "DROP": "dropped",
+	"TRUNCATE": "truncated", "RENAME": "renamed", "COMMENT": "commented on",
+}
+
+// WriteSummary describes the outcome of stmt, which changed rowsAffected
+// rows, e.g. "3 rows inserted" or "table altered".
+func WriteSummary(stmt Statement, rowsAffected int64) string {
+	if stmt.Class() == ClassDDL {
+		object := strings.ToLower(stmt.Object)
+		if object == "" {
+			object = "object"
+		}
+		return object + " " + pastTenses[stmt.Verb]
+	}
+	noun := "rows"
+	if rowsAffected == 1 {
+		noun = "row"
+	}
+	past, ok := pastTenses[stmt.Verb]
+	if !ok {
+		past = "affected"
+	}
+	return fmt.Sprintf("%d %s %s", rowsAffected, noun, past)
 }
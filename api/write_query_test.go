@@ -1,12 +1,14 @@
 package api_test
 
 import (
+	"context"
 	"database/sql"
 	"os"
 	"testing"
 
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/thesoulless/usqlmcp/api"
 )
 
@@ -41,4 +43,95 @@ func TestWriteQuery(t *testing.T) {
 		t.Fatalf("failed to verify inserted data: %v", err)
 	}
 	assert.Equal(t, 2, count, "unexpected row count in table")
+
+	_, err = api.WriteQuery(db, `DROP TABLE test_table`)
+	assert.ErrorContains(t, err, "not DROP TABLE")
+}
+
+func TestParseWrite(t *testing.T) {
+	for _, query := range []string{
+		"INSERT INTO t VALUES (1)",
+		"  update t set n = 1;",
+		"WITH x AS (SELECT 1) DELETE FROM t WHERE n IN (SELECT * FROM x)",
+		"alter table t add column m int",
+		"MERGE INTO t USING s ON t.id = s.id WHEN MATCHED THEN DELETE",
+	} {
+		_, err := api.ParseWrite(query)
+		assert.NoError(t, err, query)
+	}
+
+	for query, want := range map[string]string{
+		"":                            "no statement",
+		"DROP TABLE t":                "not DROP TABLE",
+		"SELECT 1":                    "not SELECT",
+		"CREATE INDEX i ON t (n)":     "not CREATE INDEX",
+		"INSERT INTO t VALUES (1); X": "2 statements",
+		"-- comment only":             "no statement",
+	} {
+		_, err := api.ParseWrite(query)
+		assert.ErrorContains(t, err, want, query)
+	}
+}
+
+func TestWriteSummary(t *testing.T) {
+	tests := map[string]struct {
+		rows int64
+		want string
+	}{
+		"INSERT INTO t VALUES (1), (2), (3)":   {3, "3 rows inserted"},
+		"UPDATE t SET n = 1":                   {1, "1 row updated"},
+		"delete from t":                        {0, "0 rows deleted"},
+		"ALTER TABLE t ADD COLUMN m int":       {0, "table altered"},
+		"CREATE TABLE IF NOT EXISTS t (n int)": {0, "table created"},
+		"CALL p()":                             {2, "2 rows affected"},
+	}
+	for query, tt := range tests {
+		assert.Equal(t, tt.want, api.WriteSummary(api.ParseStatement(query), tt.rows), query)
+	}
+}
+
+func TestWriteStatement(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	_, err := db.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT)`)
+	require.NoError(t, err)
+
+	write := func(query string, maxRows int) api.WriteResult {
+		t.Helper()
+		stmt, err := api.ParseWrite(query)
+		require.NoError(t, err)
+		result, err := api.WriteStatement(ctx, db, "sqlite3", stmt, maxRows)
+		require.NoError(t, err)
+		return result
+	}
+
+	// Inserts report the generated ID.
+	result := write(`INSERT INTO users (name) VALUES ('Alice'), ('Bob')`, 0)
+	assert.Equal(t, int64(2), result.RowsAffected)
+	require.NotNil(t, result.LastInsertID)
+	assert.Equal(t, int64(2), *result.LastInsertID)
+	assert.Nil(t, result.Rows)
+
+	result = write(`UPDATE users SET name = upper(name)`, 0)
+	assert.Equal(t, int64(2), result.RowsAffected)
+	assert.Nil(t, result.LastInsertID)
+
+	// Rows returned by RETURNING are read, and all count as affected.
+	result = write(`INSERT INTO users (name) VALUES ('Carol'), ('Dave') RETURNING id, name`, 0)
+	assert.Equal(t, int64(2), result.RowsAffected)
+	assert.Equal(t, []api.Row{{"id": int64(3), "name": "Carol"}, {"id": int64(4), "name": "Dave"}}, result.Rows)
+
+	result = write(`DELETE FROM users WHERE id > 1 RETURNING id`, 2)
+	assert.Equal(t, int64(3), result.RowsAffected)
+	assert.Len(t, result.Rows, 2)
+	assert.True(t, result.Truncated)
+	var left int
+	require.NoError(t, db.QueryRow(`SELECT count(*) FROM users`).Scan(&left))
+	assert.Equal(t, 1, left, "rows past the cap are still written")
+
+	// The result of a failed write is empty.
+	stmt, err := api.ParseWrite(`INSERT INTO missing VALUES (1) RETURNING *`)
+	require.NoError(t, err)
+	_, err = api.WriteStatement(ctx, db, "sqlite3", stmt, 0)
+	assert.ErrorContains(t, err, "no such table")
 }
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/thesoulless/usqlmcp/api"
+)
+
+// auditMiddleware records every tool call in the audit log, including calls
+// that fail or are rejected by other middleware.
+func auditMiddleware(logger *api.AuditLogger, connection string) server.ToolHandlerMiddleware {
+	return func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+		return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			ctx, stats := api.WithQueryStats(ctx)
+			start := time.Now()
+			result, err := next(ctx, request)
+
+			entry := api.AuditEntry{
+				Time:       start.UTC(),
+				Tool:       request.Params.Name,
+				Connection: connection,
+				Params:     map[string]interface{}{},
+				Rows:       stats.Rows(),
+				DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+			}
+			if session := server.ClientSessionFromContext(ctx); session != nil {
+				entry.SessionID = session.SessionID()
+				if s, ok := session.(server.SessionWithClientInfo); ok {
+					info := s.GetClientInfo()
+					entry.Client = strings.TrimSpace(info.Name + " " + info.Version)
+				}
+			}
+			sqlArg, ok := sqlArguments[request.Params.Name]
+			if !ok {
+				sqlArg = scriptArguments[request.Params.Name]
+			}
+			for k, v := range request.GetArguments() {
+				if k == sqlArg {
+					entry.SQL, _ = v.(string)
+					continue
+				}
+				if k == "connection" {
+					entry.Connection, _ = v.(string)
+					continue
+				}
+				entry.Params[k] = v
+			}
+			switch {
+			case err != nil:
+				entry.Error = err.Error()
+			case result != nil && result.IsError:
+				entry.Error = resultText(result)
+			}
+
+			if logErr := logger.Log(entry); logErr != nil {
+				log.Printf("Warning: %v", logErr)
+			}
+			return result, err
+		}
+	}
+}
+
+// redactMiddleware masks connection passwords and other registered secrets in
+// tool errors before they reach the client.
+func redactMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		result, err := next(ctx, request)
+		if result != nil && result.IsError {
+			for i, c := range result.Content {
+				if t, ok := mcp.AsTextContent(c); ok {
+					t.Text = api.Redact(t.Text)
+					result.Content[i] = *t
+				}
+			}
+		}
+		return result, api.RedactError(err)
+	}
+}
+
+// resultText joins the text content of a tool result.
+func resultText(result *mcp.CallToolResult) string {
+	var parts []string
+	for _, c := range result.Content {
+		if t, ok := mcp.AsTextContent(c); ok {
+			parts = append(parts, t.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/thesoulless/usqlmcp/config"
+)
+
+// runConfig implements the "config" subcommand and returns the exit code.
+//
+//	usqlmcp config validate [--config file]
+func runConfig(args []string) int {
+	if len(args) == 0 || args[0] != "validate" {
+		fmt.Fprintln(os.Stderr, "Usage: usqlmcp config validate [--config file]")
+		return 2
+	}
+
+	fs := flag.NewFlagSet("config validate", flag.ContinueOnError)
+	configFlag := fs.String("config", "", "Path to the config file to validate (default $XDG_CONFIG_HOME/usqlmcp/config.yaml)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	path := *configFlag
+	if path == "" && fs.NArg() > 0 {
+		path = fs.Arg(0)
+	}
+	if path == "" {
+		path = config.DefaultPath()
+	}
+
+	f, err := config.Load(path)
+	if err == nil {
+		err = f.Validate(toolNames())
+	}
+	if err != nil {
+		printErrors(err)
+		return 1
+	}
+
+	fmt.Printf("%s: ok\n", path)
+	return 0
+}
+
+// printErrors prints each of a set of joined errors on its own line.
+func printErrors(err error) {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, e := range joined.Unwrap() {
+			printErrors(e)
+		}
+		return
+	}
+	fmt.Fprintln(os.Stderr, err)
+}
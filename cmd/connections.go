@@ -0,0 +1,444 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/thesoulless/usqlmcp/api"
+	"github.com/thesoulless/usqlmcp/config"
+	"github.com/xo/dburl"
+	"github.com/xo/usql/drivers"
+)
+
+// Connection states reported by connection_status.
+const (
+	stateConnecting  = "connecting"
+	stateConnected   = "connected"
+	stateUnavailable = "unavailable"
+)
+
+// connection is a database connection from the active profile. It is opened
+// in the background with retries and kept healthy by periodic pings; until
+// it first connects, db is nil and calls fail with api.ErrUnavailable.
+type connection struct {
+	name string
+	dsn  string // with secrets resolved
+	url  *dburl.URL
+	cfg  *config.Connection
+
+	// onConnect runs once, after the first successful connect.
+	onConnect func(*connection)
+	started   chan struct{}
+
+	mu        sync.RWMutex
+	db        *sql.DB
+	state     string
+	lastErr   error
+	lastCheck time.Time
+	since     time.Time
+	version   string
+}
+
+// newConnection resolves the secrets in a configured connection's DSN.
+// Secrets are registered for redaction before anything that could log or
+// return them runs. The connection is not opened until start is called.
+func newConnection(name string, cfg *config.Connection) (*connection, error) {
+	dsn, secrets, err := config.ResolveDSN(cfg.DSN, cfg.PassFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve secrets for connection %q: %w", name, err)
+	}
+	for _, secret := range secrets {
+		api.RegisterSecret(secret)
+	}
+
+	u, err := dburl.Parse(dsn)
+	if err != nil {
+		return nil, api.RedactError(fmt.Errorf("failed to parse DSN for connection %q: %w", name, err))
+	}
+	if password, ok := u.User.Password(); ok {
+		api.RegisterSecret(password)
+	}
+
+	return &connection{
+		name:    name,
+		dsn:     dsn,
+		url:     u,
+		cfg:     cfg,
+		started: make(chan struct{}),
+		state:   stateConnecting,
+	}, nil
+}
+
+// start connects in the background, retrying with backoff, and then runs
+// health checks until ctx is done.
+func (c *connection) start(ctx context.Context) {
+	go func() {
+		c.connectWithRetry(ctx)
+		close(c.started)
+		c.healthLoop(ctx)
+	}()
+}
+
+// wait blocks until the startup connection attempts are over and returns the
+// last error if they all failed.
+func (c *connection) wait() error {
+	<-c.started
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.db == nil {
+		return c.lastErr
+	}
+	return nil
+}
+
+func (c *connection) connectWithRetry(ctx context.Context) {
+	backoff := c.cfg.Retry.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := c.connect(ctx)
+		if err == nil {
+			return
+		}
+		if c.cfg.Retry.Attempts > 0 && attempt >= c.cfg.Retry.Attempts {
+			log.Printf("Connection %q: giving up after %d attempts: %v", c.name, attempt, err)
+			return
+		}
+		log.Printf("Connection %q: attempt %d failed, retrying in %s: %v", c.name, attempt, backoff, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, c.cfg.Retry.MaxBackoff)
+	}
+}
+
+// connect opens the database, verifies it answers a ping and applies the pool
+// settings.
+func (c *connection) connect(ctx context.Context) error {
+	openCtx, cancel := context.WithTimeout(ctx, c.cfg.OpenTimeout)
+	defer cancel()
+
+	db, err := drivers.Open(openCtx, c.url, func() io.Writer { return os.Stdout }, func() io.Writer { return os.Stderr })
+	if err == nil {
+		if err = db.PingContext(openCtx); err != nil {
+			db.Close()
+		}
+	}
+	if err != nil {
+		err = api.RedactError(fmt.Errorf("failed to open connection %q: %w", c.name, err))
+		c.setState(stateUnavailable, err)
+		return err
+	}
+	if c.cfg.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(c.cfg.MaxOpenConns)
+	}
+	if c.cfg.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(c.cfg.MaxIdleConns)
+	}
+	if c.cfg.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(c.cfg.ConnMaxLifetime)
+	}
+	if c.cfg.ConnMaxIdleTime > 0 {
+		db.SetConnMaxIdleTime(c.cfg.ConnMaxIdleTime)
+	}
+
+	version, err := api.ServerVersion(openCtx, db, c.url.Driver)
+	if err != nil {
+		log.Printf("Warning: connection %q: %v", c.name, err)
+	}
+
+	c.mu.Lock()
+	c.db = db
+	c.version = version
+	c.mu.Unlock()
+	c.setState(stateConnected, nil)
+	log.Printf("Connection %q: connected", c.name)
+
+	if c.onConnect != nil {
+		c.onConnect(c)
+	}
+	return nil
+}
+
+// healthLoop pings the database periodically, or keeps trying to connect if
+// the startup attempts failed.
+func (c *connection) healthLoop(ctx context.Context) {
+	interval := c.cfg.HealthCheckInterval
+	if interval < 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		c.mu.RLock()
+		connected := c.db != nil
+		c.mu.RUnlock()
+		if !connected {
+			c.connect(ctx)
+			continue
+		}
+		c.ping(ctx)
+	}
+}
+
+// ping checks that the database answers and updates the connection state.
+// After a failed ping idle connections are dropped, so that none opened
+// before a database restart are reused once it is back.
+func (c *connection) ping(ctx context.Context) error {
+	c.mu.RLock()
+	db, prev := c.db, c.state
+	c.mu.RUnlock()
+
+	pingCtx, cancel := context.WithTimeout(ctx, c.cfg.OpenTimeout)
+	defer cancel()
+	err := db.PingContext(pingCtx)
+	if err != nil {
+		err = api.RedactError(fmt.Errorf("health check of connection %q failed: %w", c.name, err))
+		if prev != stateUnavailable {
+			log.Print(err)
+		}
+		idle := c.cfg.MaxIdleConns
+		if idle == 0 {
+			idle = 2 // database/sql default
+		}
+		db.SetMaxIdleConns(0)
+		db.SetMaxIdleConns(idle)
+		c.setState(stateUnavailable, err)
+		return err
+	}
+
+	if prev != stateConnected {
+		log.Printf("Connection %q: recovered", c.name)
+		if version, err := api.ServerVersion(pingCtx, db, c.url.Driver); err == nil {
+			c.mu.Lock()
+			c.version = version
+			c.mu.Unlock()
+		}
+	}
+	c.setState(stateConnected, nil)
+	return nil
+}
+
+func (c *connection) setState(state string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if state == stateConnected && c.state != stateConnected {
+		c.since = time.Now()
+	}
+	c.state, c.lastErr, c.lastCheck = state, err, time.Now()
+}
+
+// DB returns the connection's database handle. If the connection has never
+// connected, or its last health check failed and a fresh ping fails too, it
+// returns an error wrapping api.ErrUnavailable.
+func (c *connection) DB(ctx context.Context) (*sql.DB, error) {
+	c.mu.RLock()
+	db, state, lastErr := c.db, c.state, c.lastErr
+	c.mu.RUnlock()
+
+	if db == nil {
+		return nil, c.unavailable(lastErr)
+	}
+	if state == stateUnavailable {
+		if err := c.ping(ctx); err != nil {
+			return nil, c.unavailable(err)
+		}
+	}
+	return db, nil
+}
+
+func (c *connection) unavailable(cause error) error {
+	if cause == nil {
+		return fmt.Errorf("connection %q: %w: still connecting", c.name, api.ErrUnavailable)
+	}
+	return fmt.Errorf("connection %q: %w: %v", c.name, api.ErrUnavailable, cause)
+}
+
+// connectionStatus is the connection_status view of a connection.
+type connectionStatus struct {
+	Name           string     `json:"name"`
+	Driver         string     `json:"driver"`
+	State          string     `json:"state"`
+	ServerVersion  string     `json:"server_version,omitempty"`
+	ConnectedSince *time.Time `json:"connected_since,omitempty"`
+	LastCheck      *time.Time `json:"last_check,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	ReadOnly       bool       `json:"read_only,omitempty"`
+	Stats          *poolStats `json:"stats,omitempty"`
+}
+
+// poolStats is the connection_status view of sql.DBStats.
+type poolStats struct {
+	MaxOpenConnections int     `json:"max_open_connections"`
+	OpenConnections    int     `json:"open_connections"`
+	InUse              int     `json:"in_use"`
+	Idle               int     `json:"idle"`
+	WaitCount          int64   `json:"wait_count"`
+	WaitDurationMS     float64 `json:"wait_duration_ms"`
+	MaxIdleClosed      int64   `json:"max_idle_closed"`
+	MaxLifetimeClosed  int64   `json:"max_lifetime_closed"`
+}
+
+func (c *connection) status() connectionStatus {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	s := connectionStatus{
+		Name:          c.name,
+		Driver:        c.url.Driver,
+		State:         c.state,
+		ServerVersion: c.version,
+		ReadOnly:      c.cfg.ReadOnly,
+	}
+	if c.state == stateConnected {
+		since := c.since
+		s.ConnectedSince = &since
+	}
+	if !c.lastCheck.IsZero() {
+		check := c.lastCheck
+		s.LastCheck = &check
+	}
+	if c.lastErr != nil {
+		s.LastError = api.Redact(c.lastErr.Error())
+	}
+	if c.db != nil {
+		stats := c.db.Stats()
+		s.Stats = &poolStats{
+			MaxOpenConnections: stats.MaxOpenConnections,
+			OpenConnections:    stats.OpenConnections,
+			InUse:              stats.InUse,
+			Idle:               stats.Idle,
+			WaitCount:          stats.WaitCount,
+			WaitDurationMS:     float64(stats.WaitDuration.Microseconds()) / 1000,
+			MaxIdleClosed:      stats.MaxIdleClosed,
+			MaxLifetimeClosed:  stats.MaxLifetimeClosed,
+		}
+	}
+	return s
+}
+
+// withTimeout bounds ctx by the connection's query timeout, if one is set.
+func (c *connection) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx = api.WithDriver(ctx, c.url.Driver)
+	if c.cfg.QueryTimeout > 0 {
+		return context.WithTimeout(ctx, c.cfg.QueryTimeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// checkWritable returns an error if the connection is configured read-only.
+func (c *connection) checkWritable() error {
+	if c.cfg.ReadOnly {
+		return fmt.Errorf("connection %q is read-only", c.name)
+	}
+	return nil
+}
+
+// Close closes the database handle, if the connection was ever opened.
+func (c *connection) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.db == nil {
+		return nil
+	}
+	return c.db.Close()
+}
+
+// connections holds every connection of the active profile.
+type connections struct {
+	byName map[string]*connection
+	def    string
+}
+
+// newConnections prepares every connection in profile without opening them.
+func newConnections(profile *config.Profile) (*connections, error) {
+	cs := &connections{byName: map[string]*connection{}, def: profile.DefaultConnection}
+	for name, cfg := range profile.Connections {
+		c, err := newConnection(name, cfg)
+		if err != nil {
+			return nil, err
+		}
+		cs.byName[name] = c
+	}
+	if cs.byName[cs.def] == nil {
+		return nil, fmt.Errorf("default connection %q is not defined", cs.def)
+	}
+	return cs, nil
+}
+
+// start starts every connection and waits for those that are not lazy to
+// connect, returning an error if one of them could not.
+func (cs *connections) start(ctx context.Context) error {
+	for _, c := range cs.byName {
+		c.start(ctx)
+	}
+	for _, name := range cs.names() {
+		c := cs.byName[name]
+		if c.cfg.Lazy {
+			continue
+		}
+		if err := c.wait(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// get returns the connection named by the request's connection argument, or
+// the default connection when it is omitted.
+func (cs *connections) get(request mcp.CallToolRequest) (*connection, error) {
+	return cs.lookup(request.GetString("connection", ""))
+}
+
+// lookup returns the named connection, or the default connection when name
+// is empty.
+func (cs *connections) lookup(name string) (*connection, error) {
+	if name == "" {
+		return cs.byName[cs.def], nil
+	}
+	c, ok := cs.byName[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown connection %q, available: %v", name, cs.names())
+	}
+	return c, nil
+}
+
+// driver returns the driver of the connection a request runs on.
+func (cs *connections) driver(request mcp.CallToolRequest) string {
+	c, err := cs.get(request)
+	if err != nil {
+		return ""
+	}
+	return c.url.Driver
+}
+
+func (cs *connections) names() []string {
+	names := make([]string, 0, len(cs.byName))
+	for name := range cs.byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Close closes every open connection.
+func (cs *connections) Close() error {
+	var errs []error
+	for _, c := range cs.byName {
+		errs = append(errs, c.Close())
+	}
+	return errors.Join(errs...)
+}
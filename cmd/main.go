@@ -2,255 +2,328 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
+	"net/http"
 	"os"
-	"strings"
-	"time"
 
-	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/thesoulless/usqlmcp/api"
+	"github.com/thesoulless/usqlmcp/config"
 	_ "github.com/thesoulless/usqlmcp/internal"
-	"github.com/xo/dburl"
-	"github.com/xo/usql/drivers"
 )
 
 func main() {
-	dsnFlag := flag.String("dsn", "", "Database connection string")
+	log.SetOutput(api.NewRedactingWriter(os.Stderr))
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		os.Exit(runConfig(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "schema" {
+		os.Exit(runSchema(os.Args[2:]))
+	}
+
+	configFlag := flag.String("config", "", "Path to a YAML config file (default $XDG_CONFIG_HOME/usqlmcp/config.yaml)")
+	profileFlag := flag.String("profile", "", "Config profile to use")
+	dsnFlag := flag.String("dsn", "", "Database connection string, overriding the profile's connections")
+	policyFlag := flag.String("policy", "", "Path to a YAML statement policy file")
+	maskFlag := flag.String("mask", "", "Path to a YAML column masking file")
+	auditFlag := flag.String("audit-log", "", "Path to an append-only JSONL audit log")
+	auditMaxSizeFlag := flag.Int64("audit-max-size", 100, "Maximum audit log size in megabytes before it is rotated")
+	auditMaxBackupsFlag := flag.Int("audit-max-backups", 5, "Number of rotated audit logs to keep (at least 1)")
+	auditSyslogFlag := flag.Bool("audit-syslog", false, "Also send audit entries to syslog")
+	transportFlag := flag.String("transport", "stdio", "Transport to serve MCP on: stdio, sse or http")
+	addrFlag := flag.String("addr", ":8080", "Listen address for the sse and http transports")
+	traceFileFlag := flag.String("trace-file", "", "Write OpenTelemetry spans as JSON lines to this file")
+	importDirFlag := flag.String("import-dir", "", "Directory import_file may read files from")
+	exportDirFlag := flag.String("export-dir", "", "Directory export_query may write files to")
+	migrationsDirFlag := flag.String("migrations-dir", "", "Directory holding numbered up and down SQL migrations")
+	schemaSnapshotFlag := flag.String("schema-snapshot", "", "Schema snapshot file answering schema lookups, refreshed once the database connects")
+	schemaCacheTTLFlag := flag.Duration("schema-cache-ttl", 0, "How long to cache table lists and descriptions; 0 disables the cache")
+	resultCacheTTLFlag := flag.Duration("result-cache-ttl", 0, "How long read_query results are cached; 0 disables the cache")
+	resultCacheSizeFlag := flag.Int64("result-cache-size", 64, "Maximum size of the read_query result cache in megabytes")
+	jobsDirFlag := flag.String("jobs-dir", "", "Directory to keep submit_query results in instead of memory")
+	schemaRefreshFlag := flag.Duration("schema-refresh", 0, "Interval to refresh the schema snapshot at after the first refresh")
+	lazyFlag := flag.Bool("lazy", false, "Start without waiting for the database; tools report it unavailable until it connects")
 	flag.Parse()
 
+	srv, profile, err := loadProfile(*configFlag, *profileFlag)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	// Flags given explicitly take precedence over the config file.
 	dsn := *dsnFlag
 	if dsn == "" {
 		dsn = os.Getenv("DB_DSN")
 	}
-	if dsn == "" {
-		fmt.Fprintln(os.Stderr, "Error: DSN is required. Provide it using --dsn flag or DB_DSN environment variable.")
-		os.Exit(100)
+	if dsn != "" {
+		profile.Connections = map[string]*config.Connection{config.DefaultConnection: {DSN: dsn}}
+		profile.DefaultConnection = ""
 	}
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "policy":
+			profile.Policy = *policyFlag
+		case "mask":
+			profile.Mask = *maskFlag
+		case "audit-log":
+			profile.Audit.File = *auditFlag
+		case "audit-max-size":
+			profile.Audit.MaxSizeMB = *auditMaxSizeFlag
+		case "audit-max-backups":
+			profile.Audit.MaxBackups = *auditMaxBackupsFlag
+		case "audit-syslog":
+			profile.Audit.Syslog = *auditSyslogFlag
+		case "transport":
+			srv.Transport = *transportFlag
+		case "addr":
+			srv.Addr = *addrFlag
+		case "trace-file":
+			srv.TraceFile = *traceFileFlag
+		case "import-dir":
+			profile.ImportDir = *importDirFlag
+		case "export-dir":
+			profile.ExportDir = *exportDirFlag
+		case "migrations-dir":
+			profile.MigrationsDir = *migrationsDirFlag
+		case "schema-snapshot":
+			profile.SchemaSnapshot = *schemaSnapshotFlag
+		case "schema-refresh":
+			profile.SchemaRefresh = *schemaRefreshFlag
+		case "schema-cache-ttl":
+			profile.SchemaCacheTTL = *schemaCacheTTLFlag
+		case "result-cache-ttl":
+			profile.ResultCache.TTL = *resultCacheTTLFlag
+		case "result-cache-size":
+			profile.ResultCache.MaxSizeMB = *resultCacheSizeFlag
+		case "jobs-dir":
+			profile.Jobs.Dir = *jobsDirFlag
+		}
+	})
+	srv.Defaults()
+	profile.Defaults()
 
-	ctx := context.Background()
+	if len(profile.Connections) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: DSN is required. Provide it using --dsn flag, DB_DSN environment variable or a config file.")
+		os.Exit(100)
+	}
 
-	u, err := dburl.Parse(dsn)
-	if err != nil {
-		log.Fatalf("Failed to parse DSN: %v", err)
-		fmt.Fprintln(os.Stderr, "Error: Invalid DSN format.")
-		os.Exit(101)
+	if *lazyFlag {
+		for _, c := range profile.Connections {
+			c.Lazy = true
+		}
 	}
 
-	openCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
-	db, err := drivers.Open(openCtx, u, func() io.Writer { return os.Stdout }, func() io.Writer { return os.Stderr })
+
+	conns, err := newConnections(profile)
 	if err != nil {
 		log.Fatalf("Failed to open database: %v", err)
-		fmt.Fprintln(os.Stderr, "Error: Failed to open database.")
-		os.Exit(102)
 	}
-	defer db.Close()
+	defer conns.Close()
 
-	s := server.NewMCPServer(
-		"USQL MCP Server",
-		"0.3.0",
+	if srv.TraceFile != "" {
+		shutdown, err := setupTracing(srv.TraceFile)
+		if err != nil {
+			log.Fatalf("Failed to set up tracing: %v", err)
+		}
+		defer shutdown(context.Background())
+	}
+
+	opts := []server.ServerOption{
 		server.WithResourceCapabilities(true, true),
 		server.WithToolCapabilities(true),
 		server.WithLogging(),
-		server.WithRecovery(),
-	)
+	}
 
-	s.AddTool(mcp.NewTool(
-		"db_type",
-		mcp.WithDescription("Get the database type based on the DSN."),
-	), func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		dbType, err := api.GetDBType(dsn)
+	var auditWriters []io.Writer
+	if profile.Audit.File != "" {
+		f, err := api.NewRotatingFile(profile.Audit.File, profile.Audit.MaxSizeMB<<20, profile.Audit.MaxBackups)
 		if err != nil {
-			return nil, fmt.Errorf("failed to get database type: %w", err)
+			log.Fatalf("Failed to open audit log: %v", err)
 		}
-
-		return mcp.NewToolResultText(dbType), nil
-	})
-
-	s.AddTool(mcp.NewTool(
-		"read_query",
-		mcp.WithDescription("Execute a SELECT query and return the results."),
-		mcp.WithString("query", mcp.Required(), mcp.Description("The SELECT query to execute.")),
-	), func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		args, ok := request.Params.Arguments.(map[string]interface{})
-		if !ok {
-			return nil, errors.New("invalid arguments format")
-		}
-		query, ok := args["query"].(string)
-		if !ok {
-			return nil, errors.New("query must be a string")
-		}
-
-		results, err := api.ReadQuery(db, query)
+		auditWriters = append(auditWriters, f)
+	}
+	if profile.Audit.Syslog {
+		w, err := api.NewSyslogWriter("usqlmcp")
 		if err != nil {
-			return nil, fmt.Errorf("failed to execute read query: %w", err)
+			log.Fatalf("Failed to open syslog: %v", err)
 		}
+		auditWriters = append(auditWriters, w)
+	}
+	if len(auditWriters) > 0 {
+		auditLogger := api.NewAuditLogger(auditWriters...)
+		defer auditLogger.Close()
+		// Registered first so that it wraps every other middleware and sees
+		// recovered panics and policy denials.
+		opts = append(opts, server.WithToolHandlerMiddleware(auditMiddleware(auditLogger, conns.def)))
+	}
 
-		return mcp.NewToolResultText(fmt.Sprintf("%v", results)), nil
-	})
-
-	s.AddTool(mcp.NewTool(
-		"write_query",
-		mcp.WithDescription("Execute an INSERT, UPDATE, DELETE, or ALTER query and return the number of affected rows."),
-		mcp.WithString("query", mcp.Required(), mcp.Description("The query to execute.")),
-	), func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		args, ok := request.Params.Arguments.(map[string]interface{})
-		if !ok {
-			return nil, errors.New("invalid arguments format")
-		}
-		query, ok := args["query"].(string)
-		if !ok {
-			return nil, errors.New("query must be a string")
-		}
+	opts = append(opts,
+		server.WithToolHandlerMiddleware(telemetryMiddleware(api.DefaultMetrics, conns.driver)),
+		server.WithRecovery(),
+	)
 
-		affectedRows, err := api.WriteQuery(db, query)
+	var policy *api.Policy
+	if profile.Policy != "" {
+		policy, err = api.LoadPolicy(profile.Policy)
 		if err != nil {
-			return nil, fmt.Errorf("failed to execute write query: %w", err)
-		}
-
-		if query[:6] == "ALTER " && affectedRows == 0 {
-			return mcp.NewToolResultText("ALTER query executed successfully, but no rows were affected."), nil
-		}
-
-		return mcp.NewToolResultText(fmt.Sprintf("%d rows affected", affectedRows)), nil
-	})
-
-	s.AddTool(mcp.NewTool(
-		"create_table",
-		mcp.WithDescription("Execute a CREATE TABLE query."),
-		mcp.WithString("query", mcp.Required(), mcp.Description("The CREATE TABLE query to execute.")),
-	), func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		args, ok := request.Params.Arguments.(map[string]interface{})
-		if !ok {
-			return nil, errors.New("invalid arguments format")
-		}
-		query, ok := args["query"].(string)
-		if !ok {
-			return nil, errors.New("query must be a string")
+			log.Fatalf("Failed to load policy: %v", err)
 		}
+		opts = append(opts, server.WithToolHandlerMiddleware(policyMiddleware(policy)))
+		log.Printf("Loaded %d policy rules from %s", len(policy.Rules), profile.Policy)
+	}
 
-		message, err := api.CreateTable(db, query)
+	var snapshot *schemaSnapshot
+	if profile.SchemaSnapshot != "" {
+		snapshot, err = loadSchemaSnapshot(profile.SchemaSnapshot)
 		if err != nil {
-			return nil, fmt.Errorf("failed to execute create table query: %w", err)
+			log.Fatalf("Failed to load schema snapshot: %v", err)
 		}
+	}
+	schemaCache := api.NewSchemaCache(profile.SchemaCacheTTL)
+	if snapshot != nil || schemaCache != nil {
+		opts = append(opts, server.WithToolHandlerMiddleware(schemaMiddleware(schemaCache, snapshot, conns)))
+	}
+	results := api.NewResultCache(profile.ResultCache.TTL, profile.ResultCache.MaxSizeMB<<20)
+	if results != nil {
+		opts = append(opts, server.WithToolHandlerMiddleware(resultCacheMiddleware(results, conns)))
+	}
 
-		return mcp.NewToolResultText(message), nil
+	jobs, err := api.NewJobStore(api.JobOptions{
+		TTL:        profile.Jobs.TTL,
+		MaxRunning: profile.Jobs.MaxRunning,
+		MaxBytes:   profile.Jobs.MaxSizeMB << 20,
+		Dir:        profile.Jobs.Dir,
 	})
-
-	s.AddTool(mcp.NewTool(
-		"describe_table_schema",
-		mcp.WithDescription("Get the JSON schema for a given table, including column names and data types, for all supported databases."),
-		mcp.WithString("table", mcp.Required(), mcp.Description("The name of the table to describe.")),
-	), func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		args, ok := request.Params.Arguments.(map[string]interface{})
-		if !ok {
-			return nil, errors.New("invalid arguments format")
-		}
-		tableName, ok := args["table"].(string)
-		if !ok {
-			return nil, errors.New("table must be a string")
-		}
-
-		schema, err := api.DescribeTableUniversal(db, tableName, dsn)
-		if err != nil {
-			return nil, fmt.Errorf("failed to describe table schema: %w", err)
-		}
-
-		schemaJSON, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		log.Fatalf("Failed to create job store: %v", err)
+	}
+	defer jobs.Close()
+	// Jobs belong to the session that submitted them and are canceled when
+	// it ends.
+	hooks := &server.Hooks{}
+	hooks.AddOnUnregisterSession(func(ctx context.Context, session server.ClientSession) {
+		jobs.CloseSession(session.SessionID())
+	})
+	opts = append(opts, server.WithHooks(hooks))
+
+	// Registered last so that every other middleware, including the audit
+	// log, only sees redacted errors.
+	opts = append(opts, server.WithToolHandlerMiddleware(redactMiddleware))
+
+	a := &app{
+		conns:         conns,
+		policy:        policy,
+		importDir:     profile.ImportDir,
+		exportDir:     profile.ExportDir,
+		migrationsDir: profile.MigrationsDir,
+		snapshot:      snapshot,
+		schemaCache:   schemaCache,
+		results:       results,
+		jobs:          jobs,
+	}
+	if profile.Mask != "" {
+		a.masker, err = api.LoadMasker(profile.Mask)
 		if err != nil {
-			return nil, fmt.Errorf("failed to marshal schema to JSON: %w", err)
+			log.Fatalf("Failed to load masking rules: %v", err)
 		}
+	}
 
-		return mcp.NewToolResultText(string(schemaJSON)), nil
-	})
-
-	// Add resource template for usqlmcp://<table>/schema
-	template := mcp.NewResourceTemplate(
-		"usqlmcp://{table}/schema",
-		"Table Schema",
-		mcp.WithTemplateDescription("Returns the JSON schema for a given table, including column names and data types"),
-		mcp.WithTemplateMIMEType("application/json"),
+	s := server.NewMCPServer(
+		srv.Name,
+		srv.Version,
+		opts...,
 	)
+	a.server = s
 
-	s.AddResourceTemplate(template, func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
-		uri := request.Params.URI
-
-		if len(uri) < 10 || uri[:9] != "usqlmcp://" {
-			return nil, fmt.Errorf("invalid URI scheme, expected usqlmcp://")
-		}
-
-		path := uri[9:] // Remove "usqlmcp://"
-		parts := strings.Split(path, "/")
-		if len(parts) != 2 || parts[1] != "schema" {
-			return nil, fmt.Errorf("invalid URI format, expected usqlmcp://<table>/schema")
+	for _, tool := range a.tools() {
+		if profile.ToolEnabled(tool.Tool.Name) {
+			s.AddTools(tool)
 		}
+	}
+	a.registerResources(s)
+	a.registerExportResources(s)
+	if tables := a.snapshot.tables(); len(tables) > 0 {
+		a.addTableResources(s, conns.byName[conns.def], tables)
+	}
 
-		tableName := parts[0]
-		if tableName == "" {
-			return nil, fmt.Errorf("table name cannot be empty")
+	for name, c := range conns.byName {
+		c.onConnect = func(c *connection) {
+			if err := api.DefaultMetrics.RegisterDB(c.db, c.name); err != nil {
+				log.Printf("Warning: failed to register connection metrics: %v", err)
+			}
+			if name != conns.def {
+				return
+			}
+			if a.snapshot == nil {
+				a.registerTableResources(s, c)
+				return
+			}
+			go a.snapshot.refreshLoop(ctx, c, profile.SchemaRefresh, func() {
+				a.addTableResources(s, c, a.snapshot.tables())
+			})
 		}
+	}
+	if err := conns.start(ctx); err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
 
-		schema, err := api.DescribeTableUniversal(db, tableName, dsn)
-		if err != nil {
-			return nil, fmt.Errorf("failed to describe table schema: %w", err)
-		}
+	if err := serve(s, srv.Transport, srv.Addr); err != nil {
+		log.Fatalf("Server error: %v", err)
+	}
+}
 
-		schemaJSON, err := json.MarshalIndent(schema, "", "  ")
-		if err != nil {
-			return nil, fmt.Errorf("failed to marshal schema to JSON: %w", err)
+// loadProfile loads the selected profile from the config file at path, or
+// from the default location if path is empty and a file exists there. Without
+// a config file it returns an empty profile to be filled in from flags.
+func loadProfile(path, profile string) (*config.Server, *config.Profile, error) {
+	if path == "" {
+		path = config.DefaultPath()
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) || path == "" {
+			if profile != "" {
+				return nil, nil, fmt.Errorf("--profile %q given but no config file found", profile)
+			}
+			return &config.Server{}, &config.Profile{}, nil
 		}
+	}
 
-		return []mcp.ResourceContents{
-			mcp.TextResourceContents{
-				URI:      uri,
-				MIMEType: "application/json",
-				Text:     string(schemaJSON),
-			},
-		}, nil
-	})
-
-	tables, err := api.ListTables(db, dsn)
+	f, err := config.Load(path)
 	if err != nil {
-		log.Printf("Warning: failed to list tables for resource registration: %v", err)
-	} else {
-		for _, tableName := range tables {
-			resourceURI := fmt.Sprintf("usqlmcp://%s/schema", tableName)
-			resource := mcp.NewResource(
-				resourceURI,
-				fmt.Sprintf("Schema for table %s", tableName),
-			)
-
-			tableNameCopy := tableName
-			s.AddResource(resource, func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
-				schema, err := api.DescribeTableUniversal(db, tableNameCopy, dsn)
-				if err != nil {
-					return nil, fmt.Errorf("failed to describe table schema: %w", err)
-				}
-
-				schemaJSON, err := json.MarshalIndent(schema, "", "  ")
-				if err != nil {
-					return nil, fmt.Errorf("failed to marshal schema to JSON: %w", err)
-				}
-
-				return []mcp.ResourceContents{
-					mcp.TextResourceContents{
-						URI:      request.Params.URI,
-						MIMEType: "application/json",
-						Text:     string(schemaJSON),
-					},
-				}, nil
-			})
-		}
-		log.Printf("Registered %d table schema resources", len(tables))
+		return nil, nil, err
 	}
+	p, err := f.Select(profile)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &f.Server, p, nil
+}
 
-	if err := server.ServeStdio(s); err != nil {
-		log.Fatalf("Server error: %v", err)
+// serve runs the MCP server on the given transport. The HTTP-based
+// transports also expose Prometheus metrics on /metrics.
+func serve(s *server.MCPServer, transport, addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(api.DefaultMetrics.Registry, promhttp.HandlerOpts{}))
+
+	switch transport {
+	case "stdio":
+		return server.ServeStdio(s)
+	case "sse":
+		mux.Handle("/", server.NewSSEServer(s))
+	case "http":
+		mux.Handle("/mcp", server.NewStreamableHTTPServer(s))
+	default:
+		return fmt.Errorf("unknown transport %q", transport)
 	}
+
+	log.Printf("Serving MCP over %s on %s", transport, addr)
+	return http.ListenAndServe(addr, mux)
 }
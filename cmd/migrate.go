@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/thesoulless/usqlmcp/api"
+	"github.com/thesoulless/usqlmcp/config"
+)
+
+const migrateUsage = "Usage: usqlmcp migrate status|up|down [--config file] [--profile name] [--dsn dsn] [--connection name] [--dir dir] [--target version] [--steps n]"
+
+// runMigrate implements the "migrate" subcommand and returns the exit code.
+//
+//	usqlmcp migrate status            list migrations and their state
+//	usqlmcp migrate up [--target N]   apply pending migrations
+//	usqlmcp migrate down [--steps N]  roll back applied migrations
+func runMigrate(args []string) int {
+	if len(args) == 0 || (args[0] != "status" && args[0] != "up" && args[0] != "down") {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+	command := args[0]
+
+	fs := flag.NewFlagSet("migrate "+command, flag.ContinueOnError)
+	configFlag := fs.String("config", "", "Path to a YAML config file (default $XDG_CONFIG_HOME/usqlmcp/config.yaml)")
+	profileFlag := fs.String("profile", "", "Config profile to use")
+	dsnFlag := fs.String("dsn", "", "Database connection string, overriding the profile's connections")
+	connectionFlag := fs.String("connection", "", "Name of the connection to migrate (default the profile's default connection)")
+	dirFlag := fs.String("dir", "", "Directory holding the migrations (default the profile's migrations_dir)")
+	targetFlag := fs.Int64("target", 0, "Version to migrate up to, or down to")
+	stepsFlag := fs.Int("steps", 1, "Number of migrations to roll back")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	_, profile, err := loadProfile(*configFlag, *profileFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		return 1
+	}
+	dsn := *dsnFlag
+	if dsn == "" {
+		dsn = os.Getenv("DB_DSN")
+	}
+	if dsn != "" {
+		profile.Connections = map[string]*config.Connection{config.DefaultConnection: {DSN: dsn}}
+		profile.DefaultConnection = ""
+	}
+	if *dirFlag != "" {
+		profile.MigrationsDir = *dirFlag
+	}
+	profile.Defaults()
+	if profile.MigrationsDir == "" {
+		fmt.Fprintln(os.Stderr, errNoMigrationsDir)
+		return 2
+	}
+	if len(profile.Connections) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: DSN is required. Provide it using --dsn flag, DB_DSN environment variable or a config file.")
+		return 2
+	}
+
+	conns, err := newConnections(profile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer conns.Close()
+	conn, err := conns.lookup(*connectionFlag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if command != "status" {
+		if err := conn.checkWritable(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	ctx := context.Background()
+	if err := conn.connect(ctx); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	db, err := conn.DB(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	opts := api.MigrateOptions{
+		Target: *targetFlag,
+		Steps:  *stepsFlag,
+		Progress: func(done, total int, m api.Migration) {
+			fmt.Fprintf(os.Stderr, "[%d/%d] %d_%s\n", done+1, total, m.Version, m.Name)
+		},
+	}
+	switch command {
+	case "status":
+		states, err := api.MigrationStatus(ctx, db, conn.url.Driver, profile.MigrationsDir)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATE\tAPPLIED AT")
+		for _, s := range states {
+			applied := ""
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", s.Version, s.Name, s.State, applied)
+		}
+		w.Flush()
+	case "up":
+		result, err := api.ApplyMigrations(ctx, db, conn.url.Driver, profile.MigrationsDir, opts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Printf("Applied %d migrations\n", len(result.Applied))
+	case "down":
+		result, err := api.RollbackMigrations(ctx, db, conn.url.Driver, profile.MigrationsDir, opts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Printf("Rolled back %d migrations\n", len(result.RolledBack))
+	}
+	return 0
+}
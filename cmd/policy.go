@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/thesoulless/usqlmcp/api"
+)
+
+// sqlArguments maps tools that execute SQL to the argument holding the SQL
+// text, so that cross-cutting checks apply to every such tool.
+var sqlArguments = map[string]string{
+	"read_query":    "query",
+	"submit_query":  "query",
+	"write_query":   "query",
+	"create_table":  "query",
+	"copy_data":     "query",
+	"export_query":  "query",
+	"profile_table": "query",
+	"diff_data":     "left_query",
+}
+
+// scriptArguments maps tools that run scripts to the argument holding the
+// script. Scripts are split into statements the way the database's client
+// would before the policy sees them, so the tools check them themselves.
+var scriptArguments = map[string]string{
+	"run_script": "script",
+}
+
+// moreSQLArguments lists the other arguments holding SQL text of tools that
+// take more than one query. The audit log records only the sqlArguments one.
+var moreSQLArguments = map[string][]string{
+	"diff_data": {"right_query"},
+}
+
+// selectArguments maps tools that read whole tables to the arguments naming
+// them. The policy sees such calls as a SELECT * from each table.
+var selectArguments = map[string][]string{
+	"profile_table": {"table"},
+	"sample_rows":   {"table"},
+	"diff_data":     {"left_table", "right_table"},
+}
+
+// insertArguments maps tools that insert rows into a table to the argument
+// naming it. The policy sees such calls as an INSERT into that table.
+var insertArguments = map[string]string{
+	"copy_data":   "table",
+	"import_file": "table",
+}
+
+// policyMiddleware rejects tool calls whose SQL is denied by policy. Violations
+// are returned as tool errors carrying the JSON description of the rule that
+// fired.
+func policyMiddleware(policy *api.Policy) server.ToolHandlerMiddleware {
+	return func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+		return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			var queries []string
+			if arg, ok := sqlArguments[request.Params.Name]; ok {
+				if query, ok := request.GetArguments()[arg].(string); ok && query != "" {
+					queries = append(queries, query)
+				}
+			}
+			for _, arg := range moreSQLArguments[request.Params.Name] {
+				if query, ok := request.GetArguments()[arg].(string); ok && query != "" {
+					queries = append(queries, query)
+				}
+			}
+			for _, arg := range selectArguments[request.Params.Name] {
+				if table, ok := request.GetArguments()[arg].(string); ok && table != "" {
+					queries = append(queries, "SELECT * FROM "+table)
+				}
+			}
+			if arg, ok := insertArguments[request.Params.Name]; ok {
+				if table, ok := request.GetArguments()[arg].(string); ok {
+					queries = append(queries, "INSERT INTO "+table)
+				}
+			}
+
+			var violation *api.PolicyViolation
+			for _, query := range queries {
+				if err := policy.Check(query); errors.As(err, &violation) {
+					return mcp.NewToolResultError(violation.JSON()), nil
+				}
+			}
+
+			return next(ctx, request)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thesoulless/usqlmcp/api"
+	"github.com/thesoulless/usqlmcp/config"
+)
+
+func TestRunScriptPolicy(t *testing.T) {
+	conns, err := newConnections(&config.Profile{
+		DefaultConnection: "main",
+		Connections: map[string]*config.Connection{
+			"main": {DSN: "sqlserver://localhost/shop", OpenTimeout: config.DefaultOpenTimeout},
+		},
+	})
+	require.NoError(t, err)
+	policy, err := api.ParsePolicy([]byte(`
+rules:
+  - name: no-drops
+    action: deny
+    verbs: ["DROP"]
+`))
+	require.NoError(t, err)
+	a := &app{conns: conns, policy: policy}
+
+	// The DROP follows a GO line rather than a semicolon, and is denied
+	// before the script is run.
+	var request mcp.CallToolRequest
+	request.Params.Name = "run_script"
+	request.Params.Arguments = map[string]interface{}{"script": "SELECT 1\nGO\nDROP TABLE users\nGO"}
+	result, err := a.runScript(context.Background(), request)
+	require.NoError(t, err)
+	require.True(t, result.IsError)
+	assert.Contains(t, resultText(result), `"no-drops"`)
+}
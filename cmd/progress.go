@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/thesoulless/usqlmcp/api"
+)
+
+// progressFunc reports progress on a tool call. total is 0 when unknown.
+type progressFunc func(progress, total float64, message string)
+
+// progressNotifier returns a function that sends MCP progress notifications
+// for request. It does nothing when the client did not send a progress token.
+func progressNotifier(ctx context.Context, request mcp.CallToolRequest) progressFunc {
+	s := server.ServerFromContext(ctx)
+	if s == nil || request.Params.Meta == nil || request.Params.Meta.ProgressToken == nil {
+		return func(float64, float64, string) {}
+	}
+	token := request.Params.Meta.ProgressToken
+	return func(progress, total float64, message string) {
+		params := map[string]any{
+			"progressToken": token,
+			"progress":      progress,
+		}
+		if total > 0 {
+			params["total"] = total
+		}
+		if message != "" {
+			params["message"] = message
+		}
+		if err := s.SendNotificationToClient(ctx, "notifications/progress", params); err != nil {
+			log.Printf("Warning: failed to send progress notification: %v", err)
+		}
+	}
+}
+
+// progressInterval is how often long-running tools report progress.
+const progressInterval = time.Second
+
+// progressTracker reports the progress of a long-running tool call every
+// progressInterval: the rows processed so far, the elapsed time and, where
+// the database reports it, the server-side progress of its query. Progress
+// values are elapsed seconds, since the total work is rarely known and
+// progress must increase with every notification. A nil *progressTracker
+// does nothing.
+type progressTracker struct {
+	rows atomic.Int64
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// trackProgress starts tracking the progress of request, whose rows are
+// described by verb, e.g. "fetched". If query is not empty, it is returned
+// tagged so that the server-side progress of running it on db can be read.
+// Without a progress token, trackProgress returns a nil tracker and query
+// unchanged.
+func trackProgress(ctx context.Context, request mcp.CallToolRequest, conn *connection, db *sql.DB, query, verb string) (*progressTracker, string) {
+	if request.Params.Meta == nil || request.Params.Meta.ProgressToken == nil {
+		return nil, query
+	}
+	notify := progressNotifier(ctx, request)
+	var tag string
+	if query != "" {
+		query, tag = api.TagQuery(conn.url.Driver, query)
+	}
+
+	t := &progressTracker{done: make(chan struct{})}
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		start := time.Now()
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.done:
+				return
+			case <-ticker.C:
+			}
+			elapsed := time.Since(start)
+			msg := fmt.Sprintf("%d rows %s, %s elapsed", t.rows.Load(), verb, elapsed.Round(time.Second))
+			if tag != "" {
+				probeCtx, cancel := context.WithTimeout(ctx, progressInterval)
+				p, err := api.ReadServerProgress(probeCtx, db, conn.url.Driver, tag)
+				cancel()
+				if err != nil {
+					log.Printf("Warning: failed to read server progress, giving up: %v", err)
+					tag = ""
+				} else if p != nil {
+					msg += "; server: " + p.State
+					if p.Percent >= 0 {
+						msg += fmt.Sprintf(", %.0f%% done", p.Percent)
+					}
+					if p.RowsRead > 0 {
+						msg += fmt.Sprintf(", %d rows read", p.RowsRead)
+					}
+				}
+			}
+			notify(elapsed.Seconds(), 0, msg)
+		}
+	}()
+	return t, query
+}
+
+// setRows records the number of rows processed so far.
+func (t *progressTracker) setRows(n int64) {
+	if t != nil {
+		t.rows.Store(n)
+	}
+}
+
+// stop stops reporting progress.
+func (t *progressTracker) stop() {
+	if t != nil {
+		close(t.done)
+		t.wg.Wait()
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/thesoulless/usqlmcp/api"
+)
+
+// registerResources adds the table schema and sample resource templates of
+// the default connection.
+func (a *app) registerResources(s *server.MCPServer) {
+	conn := a.conns.byName[a.conns.def]
+	driver := conn.url.Driver
+
+	// Add resource template for usqlmcp://<table>/schema
+	template := mcp.NewResourceTemplate(
+		"usqlmcp://{table}/schema",
+		"Table Schema",
+		mcp.WithTemplateDescription("Returns the JSON schema for a given table, including column names and data types"),
+		mcp.WithTemplateMIMEType("application/json"),
+	)
+
+	s.AddResourceTemplate(template, server.ResourceTemplateHandlerFunc(traceResource(driver, func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		uri := request.Params.URI
+
+		if len(uri) < 10 || uri[:9] != "usqlmcp://" {
+			return nil, fmt.Errorf("invalid URI scheme, expected usqlmcp://")
+		}
+
+		path := uri[9:] // Remove "usqlmcp://"
+		parts := strings.Split(path, "/")
+		if len(parts) != 2 || parts[1] != "schema" {
+			return nil, fmt.Errorf("invalid URI format, expected usqlmcp://<table>/schema")
+		}
+
+		tableName := parts[0]
+		if tableName == "" {
+			return nil, fmt.Errorf("table name cannot be empty")
+		}
+
+		schemaJSON, err := a.tableSchemaJSON(ctx, conn, tableName)
+		if err != nil {
+			return nil, err
+		}
+
+		return []mcp.ResourceContents{
+			mcp.TextResourceContents{
+				URI:      uri,
+				MIMEType: "application/json",
+				Text:     string(schemaJSON),
+			},
+		}, nil
+	})))
+
+	sampleTemplate := mcp.NewResourceTemplate(
+		"usqlmcp://{table}/sample",
+		"Table Sample",
+		mcp.WithTemplateDescription("Returns a few randomly picked rows of a given table as JSON, with long values truncated and masked columns masked"),
+		mcp.WithTemplateMIMEType("application/json"),
+	)
+
+	s.AddResourceTemplate(sampleTemplate, server.ResourceTemplateHandlerFunc(traceResource(driver, func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		tableName, ok := strings.CutSuffix(strings.TrimPrefix(request.Params.URI, "usqlmcp://"), "/sample")
+		if !ok || tableName == "" || strings.Contains(tableName, "/") {
+			return nil, fmt.Errorf("invalid URI format, expected usqlmcp://<table>/sample")
+		}
+		return a.sampleResource(ctx, conn, request.Params.URI, tableName)
+	})))
+}
+
+// sampleResource reads the sample resource of tableName. Resources bypass the
+// tool middleware, so the policy is checked here as it is for sample_rows.
+func (a *app) sampleResource(ctx context.Context, conn *connection, uri, tableName string) ([]mcp.ResourceContents, error) {
+	if err := a.policy.Check("SELECT * FROM " + tableName); err != nil {
+		return nil, err
+	}
+	sampleJSON, err := a.sampleJSON(ctx, conn, tableName, api.SampleOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return []mcp.ResourceContents{
+		mcp.TextResourceContents{
+			URI:      uri,
+			MIMEType: "application/json",
+			Text:     string(sampleJSON),
+		},
+	}, nil
+}
+
+// exportsURI is the URI prefix of files written by export_query.
+const exportsURI = "usqlmcp://exports/"
+
+// exportMIMETypes maps export formats to the MIME types their resources are
+// served as. Formats not listed here are served as text.
+var exportMIMETypes = map[string]string{
+	api.FormatCSV:     "text/csv",
+	api.FormatJSONL:   "application/jsonl",
+	api.FormatParquet: "application/vnd.apache.parquet",
+	api.FormatXLSX:    "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// exportURI returns the resource URI of an export file at rel, a slash
+// separated path relative to the export directory.
+func exportURI(rel string) string {
+	return exportsURI + rel
+}
+
+// exportPath returns path relative to the export directory, with forward
+// slashes.
+func (a *app) exportPath(path string) (string, error) {
+	root, err := filepath.Abs(a.exportDir)
+	if err != nil {
+		return "", err
+	}
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// registerExportResources adds the export file resource template, which
+// serves any file in the export directory, including those written by
+// earlier runs.
+func (a *app) registerExportResources(s *server.MCPServer) {
+	if a.exportDir == "" {
+		return
+	}
+	template := mcp.NewResourceTemplate(
+		exportsURI+"{+path}",
+		"Exported File",
+		mcp.WithTemplateDescription("Returns a file written by export_query. CSV and JSONL files are returned as text, Parquet and XLSX files as base64 blobs."),
+	)
+	s.AddResourceTemplate(template, a.readExport)
+}
+
+// addExportResource lists the export file at rel as a resource.
+func (a *app) addExportResource(s *server.MCPServer, rel string) {
+	format, _ := api.ExportFormat(rel, "")
+	resource := mcp.NewResource(
+		exportURI(rel),
+		fmt.Sprintf("Exported file %s", rel),
+		mcp.WithMIMEType(exportMIMETypes[format]),
+	)
+	s.AddResource(resource, a.readExport)
+}
+
+// readExport reads an export file resource.
+func (a *app) readExport(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	uri := request.Params.URI
+	rel, ok := strings.CutPrefix(uri, exportsURI)
+	if !ok || rel == "" {
+		return nil, fmt.Errorf("invalid URI format, expected %s<path>", exportsURI)
+	}
+	path, err := api.ResolvePath(a.exportDir, filepath.FromSlash(rel))
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read exported file: %w", err)
+	}
+
+	format, _ := api.ExportFormat(path, "")
+	mimeType := exportMIMETypes[format]
+	switch format {
+	case api.FormatParquet, api.FormatXLSX:
+		return []mcp.ResourceContents{
+			mcp.BlobResourceContents{
+				URI:      uri,
+				MIMEType: mimeType,
+				Blob:     base64.StdEncoding.EncodeToString(data),
+			},
+		}, nil
+	default:
+		if mimeType == "" {
+			mimeType = "text/plain"
+		}
+		return []mcp.ResourceContents{
+			mcp.TextResourceContents{
+				URI:      uri,
+				MIMEType: mimeType,
+				Text:     string(data),
+			},
+		}, nil
+	}
+}
+
+// registerTableResources adds a schema and a sample resource for every table
+// on conn. It runs once conn has connected.
+func (a *app) registerTableResources(s *server.MCPServer, conn *connection) {
+	db, err := conn.DB(context.Background())
+	if err != nil {
+		log.Printf("Warning: failed to list tables for resource registration: %v", err)
+		return
+	}
+	tables, err := a.schemaCache.ListTables(db, conn.dsn)
+	if err != nil {
+		log.Printf("Warning: failed to list tables for resource registration: %v", err)
+		return
+	}
+	a.addTableResources(s, conn, tables)
+}
+
+// addTableResources adds a schema and a sample resource for each of tables on
+// conn. Resources already added are replaced.
+func (a *app) addTableResources(s *server.MCPServer, conn *connection, tables []string) {
+	driver := conn.url.Driver
+	for _, tableName := range tables {
+		resourceURI := fmt.Sprintf("usqlmcp://%s/schema", tableName)
+		resource := mcp.NewResource(
+			resourceURI,
+			fmt.Sprintf("Schema for table %s", tableName),
+		)
+
+		tableNameCopy := tableName
+		s.AddResource(resource, traceResource(driver, func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+			schemaJSON, err := a.tableSchemaJSON(ctx, conn, tableNameCopy)
+			if err != nil {
+				return nil, err
+			}
+
+			return []mcp.ResourceContents{
+				mcp.TextResourceContents{
+					URI:      request.Params.URI,
+					MIMEType: "application/json",
+					Text:     string(schemaJSON),
+				},
+			}, nil
+		}))
+
+		sample := mcp.NewResource(
+			fmt.Sprintf("usqlmcp://%s/sample", tableName),
+			fmt.Sprintf("Sample rows of table %s", tableName),
+			mcp.WithMIMEType("application/json"),
+		)
+		s.AddResource(sample, traceResource(driver, func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+			return a.sampleResource(ctx, conn, request.Params.URI, tableNameCopy)
+		}))
+	}
+	log.Printf("Registered schema and sample resources for %d tables", len(tables))
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thesoulless/usqlmcp/api"
+	"github.com/thesoulless/usqlmcp/config"
+)
+
+func TestSampleResourcePolicy(t *testing.T) {
+	ctx := context.Background()
+	conn, err := newConnection("main", &config.Connection{
+		DSN:         "sqlite3://" + filepath.Join(t.TempDir(), "test.db"),
+		OpenTimeout: config.DefaultOpenTimeout,
+	})
+	require.NoError(t, err)
+	require.NoError(t, conn.connect(ctx))
+	t.Cleanup(func() { conn.Close() })
+
+	db, err := conn.DB(ctx)
+	require.NoError(t, err)
+	_, err = db.Exec(`CREATE TABLE users (id INTEGER); CREATE TABLE secrets (token TEXT);
+		INSERT INTO users VALUES (1); INSERT INTO secrets VALUES ('s3cr3t');`)
+	require.NoError(t, err)
+
+	policy, err := api.ParsePolicy([]byte(`
+rules:
+  - name: no-secrets
+    action: deny
+    tables: ["secrets"]
+`))
+	require.NoError(t, err)
+	a := &app{policy: policy}
+
+	_, err = a.sampleResource(ctx, conn, "usqlmcp://secrets/sample", "secrets")
+	var violation *api.PolicyViolation
+	require.ErrorAs(t, err, &violation)
+	assert.Equal(t, "no-secrets", violation.Rule)
+
+	contents, err := a.sampleResource(ctx, conn, "usqlmcp://users/sample", "users")
+	require.NoError(t, err)
+	require.Len(t, contents, 1)
+	assert.Contains(t, contents[0].(mcp.TextResourceContents).Text, `"rows":[[1]]`)
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/thesoulless/usqlmcp/api"
+	"github.com/thesoulless/usqlmcp/config"
+)
+
+const schemaUsage = "Usage: usqlmcp schema dump [--config file] [--profile name] [--dsn dsn] [--connection name] [--tables pattern,...] [--output file]"
+
+// runSchema implements the "schema" subcommand and returns the exit code.
+//
+//	usqlmcp schema dump [--output file]  write a schema snapshot of a connection
+func runSchema(args []string) int {
+	if len(args) == 0 || args[0] != "dump" {
+		fmt.Fprintln(os.Stderr, schemaUsage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("schema dump", flag.ContinueOnError)
+	configFlag := fs.String("config", "", "Path to a YAML config file (default $XDG_CONFIG_HOME/usqlmcp/config.yaml)")
+	profileFlag := fs.String("profile", "", "Config profile to use")
+	dsnFlag := fs.String("dsn", "", "Database connection string, overriding the profile's connections")
+	connectionFlag := fs.String("connection", "", "Name of the connection to dump (default the profile's default connection)")
+	tablesFlag := fs.String("tables", "", "Comma separated glob patterns of the tables to dump (default all)")
+	outputFlag := fs.String("output", "", "File to write the snapshot to (default the profile's schema_snapshot, or standard output)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	_, profile, err := loadProfile(*configFlag, *profileFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		return 1
+	}
+	dsn := *dsnFlag
+	if dsn == "" {
+		dsn = os.Getenv("DB_DSN")
+	}
+	if dsn != "" {
+		profile.Connections = map[string]*config.Connection{config.DefaultConnection: {DSN: dsn}}
+		profile.DefaultConnection = ""
+	}
+	profile.Defaults()
+	if len(profile.Connections) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: DSN is required. Provide it using --dsn flag, DB_DSN environment variable or a config file.")
+		return 2
+	}
+	output := *outputFlag
+	if output == "" {
+		output = profile.SchemaSnapshot
+	}
+	var tables []string
+	if *tablesFlag != "" {
+		tables = strings.Split(*tablesFlag, ",")
+	}
+
+	conns, err := newConnections(profile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer conns.Close()
+	conn, err := conns.lookup(*connectionFlag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	ctx := context.Background()
+	if err := conn.connect(ctx); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	db, err := conn.DB(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	schema, err := api.ReadSchema(ctx, db, conn.dsn, tables)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if output == "" || output == "-" {
+		if err := api.WriteSchema(os.Stdout, schema); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	}
+	if err := api.SaveSchema(output, schema); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %d tables to %s\n", len(schema.Tables), output)
+	return 0
+}
+
+// schemaSnapshot holds the schema snapshot of the default connection, which
+// answers describe_table_schema and the table schema resources without
+// querying the database. A nil *schemaSnapshot holds nothing.
+type schemaSnapshot struct {
+	path string
+
+	mu     sync.RWMutex
+	schema *api.Schema
+}
+
+// loadSchemaSnapshot loads the snapshot file at path. A missing file yields
+// an empty snapshot, to be filled in by the first refresh.
+func loadSchemaSnapshot(path string) (*schemaSnapshot, error) {
+	s := &schemaSnapshot{path: path}
+	schema, err := api.LoadSchema(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	s.schema = schema
+	return s, nil
+}
+
+// table returns the columns of the snapshot's table named name.
+func (s *schemaSnapshot) table(name string) ([]api.TableColumn, bool) {
+	if s == nil {
+		return nil, false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.schema == nil {
+		return nil, false
+	}
+	t := s.schema.Table(name)
+	if t == nil {
+		return nil, false
+	}
+	return t.Columns, true
+}
+
+// tables returns the names of the snapshot's tables.
+func (s *schemaSnapshot) tables() []string {
+	if s == nil {
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.schema == nil {
+		return nil
+	}
+	return s.schema.TableNames()
+}
+
+// refresh reads the schema of conn, replaces the snapshot with it and saves
+// it to the snapshot file.
+func (s *schemaSnapshot) refresh(ctx context.Context, conn *connection) error {
+	db, err := conn.DB(ctx)
+	if err != nil {
+		return err
+	}
+	schema, err := api.ReadSchema(ctx, db, conn.dsn, nil)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.schema = schema
+	s.mu.Unlock()
+	return api.SaveSchema(s.path, schema)
+}
+
+// refreshLoop refreshes the snapshot from conn, then again on every interval
+// if it is positive, calling done after each successful refresh.
+func (s *schemaSnapshot) refreshLoop(ctx context.Context, conn *connection, interval time.Duration, done func()) {
+	for {
+		start := time.Now()
+		if err := s.refresh(ctx, conn); err != nil {
+			log.Printf("Warning: failed to refresh schema snapshot: %v", err)
+		} else {
+			log.Printf("Refreshed schema snapshot %s in %s", s.path, time.Since(start).Round(time.Millisecond))
+			done()
+		}
+		if interval <= 0 {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// writeTools lists the tools that change data or the schema: write_query,
+// run_script and create_table by running SQL, copy_data and import_file by filling and
+// creating tables, and the migration tools.
+var writeTools = map[string]bool{
+	"write_query":        true,
+	"run_script":         true,
+	"create_table":       true,
+	"copy_data":          true,
+	"import_file":        true,
+	"migration_apply":    true,
+	"migration_rollback": true,
+}
+
+// writeConnection returns the connection a call to one of writeTools
+// changed.
+func writeConnection(conns *connections, request mcp.CallToolRequest) (*connection, error) {
+	if request.Params.Name == "copy_data" {
+		return conns.lookup(request.GetString("destination_connection", ""))
+	}
+	return conns.get(request)
+}
+
+// writtenStatements returns the statements that a call to write_query,
+// run_script or create_table ran on conn. Scripts are split the way
+// run_script splits them.
+func writtenStatements(conn *connection, request mcp.CallToolRequest) []api.Statement {
+	name := request.Params.Name
+	if name != "run_script" {
+		return api.ParseStatements(request.GetString(sqlArguments[name], ""))
+	}
+	var stmts []api.Statement
+	for _, stmt := range api.DialectFor(conn.url.Driver).SplitScript(request.GetString("script", "")) {
+		stmts = append(stmts, api.ParseStatement(stmt))
+	}
+	return stmts
+}
+
+// schemaMiddleware invalidates the schema cache, and refreshes the schema
+// snapshot if the default connection was changed, after successful calls to
+// writeTools that may have changed the schema.
+func schemaMiddleware(cache *api.SchemaCache, snapshot *schemaSnapshot, conns *connections) server.ToolHandlerMiddleware {
+	return func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+		return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			result, err := next(ctx, request)
+			name := request.Params.Name
+			if !writeTools[name] || err != nil || result == nil || result.IsError {
+				return result, err
+			}
+			conn, lookupErr := writeConnection(conns, request)
+			if lookupErr != nil {
+				return result, err
+			}
+
+			changed := true
+			switch name {
+			case "write_query", "run_script", "create_table":
+				changed = cache.InvalidateStatements(conn.dsn, writtenStatements(conn, request)...)
+			case "copy_data", "import_file":
+				cache.Invalidate(conn.dsn, request.GetString(insertArguments[name], ""))
+			default:
+				cache.Invalidate(conn.dsn)
+			}
+			if changed && snapshot != nil && conn.name == conns.def {
+				go func() {
+					if err := snapshot.refresh(context.Background(), conn); err != nil {
+						log.Printf("Warning: failed to refresh schema snapshot: %v", err)
+					}
+				}()
+			}
+			return result, err
+		}
+	}
+}
+
+// resultCacheMiddleware drops the cached read_query results that calls to
+// writeTools may have made stale: those reading the tables written to, or
+// every result of the connection after migrations. Failed calls count too,
+// since they may have written part of their changes.
+func resultCacheMiddleware(cache *api.ResultCache, conns *connections) server.ToolHandlerMiddleware {
+	return func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+		return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			result, err := next(ctx, request)
+			name := request.Params.Name
+			if !writeTools[name] {
+				return result, err
+			}
+			conn, lookupErr := writeConnection(conns, request)
+			if lookupErr != nil {
+				return result, err
+			}
+
+			switch name {
+			case "write_query", "run_script", "create_table":
+				cache.InvalidateStatements(conn.name, writtenStatements(conn, request)...)
+			case "copy_data", "import_file":
+				cache.Invalidate(conn.name, request.GetString(insertArguments[name], ""))
+			default:
+				cache.Invalidate(conn.name)
+			}
+			return result, err
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thesoulless/usqlmcp/api"
+	"github.com/thesoulless/usqlmcp/config"
+)
+
+func TestWrittenStatements(t *testing.T) {
+	conn, err := newConnection("main", &config.Connection{
+		DSN:         "sqlserver://localhost/shop",
+		OpenTimeout: config.DefaultOpenTimeout,
+	})
+	require.NoError(t, err)
+
+	var request mcp.CallToolRequest
+	request.Params.Name = "run_script"
+	request.Params.Arguments = map[string]interface{}{
+		"script": "UPDATE orders SET total = 0\nGO\nDROP TABLE refunds\nGO",
+	}
+	stmts := writtenStatements(conn, request)
+	require.Len(t, stmts, 2)
+	assert.Equal(t, []string{"orders"}, stmts[0].Tables)
+	assert.Equal(t, []string{"refunds"}, stmts[1].Tables)
+
+	cache := api.NewResultCache(time.Hour, 0)
+	key := api.ResultCacheKey("main", "SELECT * FROM refunds")
+	cache.Put(key, "main", "SELECT * FROM refunds", api.CachedResult{CachedAt: time.Now()})
+	_, ok := cache.Get(key)
+	require.True(t, ok)
+	cache.InvalidateStatements("main", stmts...)
+	_, ok = cache.Get(key)
+	assert.False(t, ok)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/thesoulless/usqlmcp/api"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// telemetryMiddleware starts a server span for every tool call and records
+// tool call metrics. The driver the call runs on is attached to the context so
+// statement spans started by the api package carry the right db.system.
+func telemetryMiddleware(metrics *api.Metrics, driver func(mcp.CallToolRequest) string) server.ToolHandlerMiddleware {
+	return func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+		return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			ctx = api.WithDriver(ctx, driver(request))
+			ctx, span := api.Tracer().Start(ctx, "tools/call "+request.Params.Name,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					attribute.String("mcp.method", string(mcp.MethodToolsCall)),
+					attribute.String("mcp.tool.name", request.Params.Name),
+				),
+			)
+			defer span.End()
+
+			start := time.Now()
+			result, err := next(ctx, request)
+
+			failed := err != nil || (result != nil && result.IsError)
+			size := 0
+			if result != nil {
+				size = len(resultText(result))
+			}
+			metrics.ObserveToolCall(request.Params.Name, time.Since(start), failed, size)
+
+			switch {
+			case err != nil:
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			case failed:
+				span.SetStatus(codes.Error, "tool returned an error")
+			}
+			span.SetAttributes(attribute.Int("mcp.result.bytes", size))
+			return result, err
+		}
+	}
+}
+
+// traceResource wraps a resource handler in a server span.
+func traceResource(driver string, handler server.ResourceHandlerFunc) server.ResourceHandlerFunc {
+	return func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		ctx = api.WithDriver(ctx, driver)
+		ctx, span := api.Tracer().Start(ctx, "resources/read",
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("mcp.method", string(mcp.MethodResourcesRead)),
+				attribute.String("mcp.resource.uri", request.Params.URI),
+			),
+		)
+		defer span.End()
+
+		contents, err := handler(ctx, request)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		return contents, err
+	}
+}
+
+// setupTracing installs a global tracer provider exporting spans as JSON lines
+// to traceFile. It returns a function flushing and closing the exporter.
+func setupTracing(traceFile string) (func(context.Context) error, error) {
+	f, err := os.OpenFile(traceFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open trace file: %w", err)
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(api.NewJSONSpanExporter(f)))
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
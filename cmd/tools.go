@@ -0,0 +1,1217 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/thesoulless/usqlmcp/api"
+)
+
+// app holds the state shared by tool and resource handlers.
+type app struct {
+	conns  *connections
+	masker *api.Masker
+	// policy is consulted by tools that pick the columns they read
+	// themselves or run SQL from files; the policy middleware only sees
+	// tool arguments.
+	policy *api.Policy
+	// importDir is the directory import_file reads from and exportDir the
+	// one export_query writes to.
+	importDir string
+	exportDir string
+	// migrationsDir holds the files of the migration tools.
+	migrationsDir string
+	// snapshot answers schema lookups on the default connection, if set,
+	// and schemaCache caches those it does not answer.
+	snapshot    *schemaSnapshot
+	schemaCache *api.SchemaCache
+	// results caches read_query results, if enabled.
+	results *api.ResultCache
+	// jobs runs the queries of submit_query in the background.
+	jobs *api.JobStore
+	// server is the server the tools are registered on, for tools that
+	// register resources.
+	server *server.MCPServer
+}
+
+// connectionOption is the optional argument selecting which configured
+// connection a tool runs on.
+var connectionOption = mcp.WithString("connection", mcp.Description("Name of the connection to use. Defaults to the profile's default connection."))
+
+// toolNames returns the names of every tool the server can register.
+func toolNames() []string {
+	var names []string
+	for _, t := range (*app)(nil).tools() {
+		names = append(names, t.Tool.Name)
+	}
+	return names
+}
+
+// tools returns every tool the server can register. Handlers only
+// dereference a when called.
+func (a *app) tools() []server.ServerTool {
+	return []server.ServerTool{
+		{Tool: mcp.NewTool(
+			"db_type",
+			mcp.WithDescription("Get the database type based on the DSN."),
+			connectionOption,
+		), Handler: a.dbType},
+		{Tool: mcp.NewTool(
+			"read_query",
+			mcp.WithDescription("Execute a SELECT query and return the results."),
+			mcp.WithString("query", mcp.Required(), mcp.Description("The SELECT query to execute.")),
+			connectionOption,
+		), Handler: a.readQuery},
+		{Tool: mcp.NewTool(
+			"submit_query",
+			mcp.WithDescription("Start a SELECT query in the background and return a job ID at once, for queries that take longer than a tool call may. Poll job_status, fetch rows with job_result and stop it with cancel_job. Jobs are only visible to the session that submitted them and their results expire."),
+			mcp.WithString("query", mcp.Required(), mcp.Description("The SELECT query to execute.")),
+			connectionOption,
+		), Handler: a.submitQuery},
+		{Tool: mcp.NewTool(
+			"job_status",
+			mcp.WithDescription("Get the state of a job started with submit_query: running, done, failed or canceled, with its row count and columns."),
+			mcp.WithString("job_id", mcp.Required(), mcp.Description("The ID returned by submit_query.")),
+		), Handler: a.jobStatus},
+		{Tool: mcp.NewTool(
+			"job_result",
+			mcp.WithDescription("Get a page of the rows of a job started with submit_query. Rows of running jobs can be fetched as they arrive. Fetch the next page from next_offset until it is absent."),
+			mcp.WithString("job_id", mcp.Required(), mcp.Description("The ID returned by submit_query.")),
+			mcp.WithNumber("offset", mcp.Description("Index of the first row to return. Defaults to 0.")),
+			mcp.WithNumber("limit", mcp.Description(fmt.Sprintf("Number of rows to return, up to %d. Defaults to %d.", api.MaxJobPageSize, api.DefaultJobPageSize))),
+		), Handler: a.jobResult},
+		{Tool: mcp.NewTool(
+			"cancel_job",
+			mcp.WithDescription("Stop a running job started with submit_query, or discard the results of a finished one."),
+			mcp.WithString("job_id", mcp.Required(), mcp.Description("The ID returned by submit_query.")),
+		), Handler: a.cancelJob},
+		{Tool: mcp.NewTool(
+			"write_query",
+			mcp.WithDescription("Execute a single INSERT, UPDATE, DELETE, MERGE or ALTER statement and report what it changed, e.g. \"3 rows inserted\" or \"table altered\", with the generated ID on MySQL and SQLite. Rows returned by a RETURNING or OUTPUT clause are returned like read_query results. Use create_table to create tables and run_script for other statements."),
+			mcp.WithString("query", mcp.Required(), mcp.Description("The query to execute.")),
+			connectionOption,
+		), Handler: a.writeQuery},
+		{Tool: mcp.NewTool(
+			"run_script",
+			mcp.WithDescription("Run a script of several SQL statements in order and return the status, rows or affected row count, and error of each. Statements are split the way the database's own client would, keeping dollar-quoted bodies and BEGIN ... END blocks whole and honoring DELIMITER on MySQL and GO on SQL Server. By default the script stops at the first error."),
+			mcp.WithString("script", mcp.Required(), mcp.Description("The SQL statements to run.")),
+			mcp.WithBoolean("transaction", mcp.Description("Run every statement in one transaction, rolled back at the first error.")),
+			mcp.WithBoolean("continue_on_error", mcp.Description("Run the remaining statements after one fails. Cannot be used with transaction.")),
+			connectionOption,
+		), Handler: a.runScript},
+		{Tool: mcp.NewTool(
+			"create_table",
+			mcp.WithDescription("Execute a single CREATE TABLE statement."),
+			mcp.WithString("query", mcp.Required(), mcp.Description("The CREATE TABLE query to execute.")),
+			connectionOption,
+		), Handler: a.createTable},
+		{Tool: mcp.NewTool(
+			"describe_table_schema",
+			mcp.WithDescription("Get the JSON schema for a given table, including column names and data types, for all supported databases."),
+			mcp.WithString("table", mcp.Required(), mcp.Description("The name of the table to describe.")),
+			connectionOption,
+		), Handler: a.describeTableSchema},
+		{Tool: mcp.NewTool(
+			"usql_command",
+			mcp.WithDescription(`Run a usql meta-command and return its result as JSON. Supported: \d [pattern] (describe, or list relations), \dt, \dv, \dm, \ds (tables, views, materialized views, sequences), \di (indexes), \df (functions), \dn (schemas) and \l (databases). Append S to include system objects and + for more detail. Patterns are psql-style, e.g. public.user*.`),
+			mcp.WithString("command", mcp.Required(), mcp.Description(`The meta-command to run, e.g. "\dt+ public.*".`)),
+			connectionOption,
+		), Handler: a.usqlCommand},
+		{Tool: mcp.NewTool(
+			"copy_data",
+			mcp.WithDescription("Copy the results of a SELECT query on one connection into a table on another connection, which may be a different kind of database. The destination table is created with mapped column types when it does not exist. Rows are inserted in batches in a single transaction and masked like read_query results."),
+			mcp.WithString("query", mcp.Required(), mcp.Description("The SELECT query to read rows from.")),
+			mcp.WithString("table", mcp.Required(), mcp.Description("The destination table, optionally schema-qualified.")),
+			mcp.WithString("connection", mcp.Description("Name of the source connection. Defaults to the profile's default connection.")),
+			mcp.WithString("destination_connection", mcp.Description("Name of the destination connection. Defaults to the profile's default connection.")),
+			mcp.WithBoolean("create", mcp.DefaultBool(true), mcp.Description("Create the destination table when it does not exist.")),
+			mcp.WithNumber("batch_size", mcp.Description(fmt.Sprintf("Rows inserted per statement. Defaults to %d.", api.DefaultCopyBatchSize))),
+			mcp.WithNumber("max_rows", mcp.Description("Stop after copying this many rows. The source connection's max_rows setting still applies.")),
+		), Handler: a.copyData},
+		{Tool: mcp.NewTool(
+			"import_file",
+			mcp.WithDescription("Load a CSV, JSON (array of objects), JSONL or Parquet file from the server's import directory into a table. Column types are inferred from the first rows unless overridden, and the table is created when it does not exist. Records that do not match the column types are skipped and reported with their line numbers."),
+			mcp.WithString("path", mcp.Required(), mcp.Description("Path of the file, relative to the import directory.")),
+			mcp.WithString("table", mcp.Required(), mcp.Description("The destination table, optionally schema-qualified.")),
+			mcp.WithString("format", mcp.Enum(api.FormatCSV, api.FormatJSON, api.FormatJSONL, api.FormatParquet), mcp.Description("File format. Defaults to the file extension.")),
+			mcp.WithObject("types", mcp.Description(`Column type overrides, e.g. {"zip": "VARCHAR(10)"}, in the destination database's type names.`)),
+			mcp.WithString("delimiter", mcp.Description("CSV field delimiter. Defaults to a comma.")),
+			mcp.WithBoolean("create", mcp.DefaultBool(true), mcp.Description("Create the table when it does not exist.")),
+			mcp.WithNumber("max_rejects", mcp.Description(fmt.Sprintf("Abort after this many rejected records. Defaults to %d; -1 never aborts.", api.DefaultMaxRejects))),
+			connectionOption,
+		), Handler: a.importFile},
+		{Tool: mcp.NewTool(
+			"export_query",
+			mcp.WithDescription("Run a SELECT query and write its results to a CSV, JSONL, Parquet or XLSX file in the server's export directory, without returning them. Returns the file's path, resource URI, row count, size and the first few rows. Use it for results too large for read_query."),
+			mcp.WithString("query", mcp.Required(), mcp.Description("The SELECT query to execute.")),
+			mcp.WithString("path", mcp.Required(), mcp.Description("Path of the file to write, relative to the export directory.")),
+			mcp.WithString("format", mcp.Enum(api.FormatCSV, api.FormatJSONL, api.FormatParquet, api.FormatXLSX), mcp.Description("File format. Defaults to the file extension.")),
+			mcp.WithBoolean("overwrite", mcp.Description("Replace the file if it exists.")),
+			mcp.WithNumber("max_rows", mcp.Description("Stop after writing this many rows.")),
+			connectionOption,
+		), Handler: a.exportQuery},
+		{Tool: mcp.NewTool(
+			"sample_rows",
+			mcp.WithDescription("Return a few rows of a table, picked at random where the database supports it, to see what its data looks like. Long text is truncated, binary values are replaced by their size and masked columns stay masked."),
+			mcp.WithString("table", mcp.Required(), mcp.Description("The table to sample, optionally schema-qualified.")),
+			mcp.WithNumber("rows", mcp.Description(fmt.Sprintf("Number of rows to return, up to %d. Defaults to %d.", api.MaxSampleRows, api.DefaultSampleRows))),
+			mcp.WithNumber("max_value_length", mcp.Description(fmt.Sprintf("Truncate text values to this many characters. Defaults to %d; -1 keeps them whole.", api.DefaultMaxValueLength))),
+			connectionOption,
+		), Handler: a.sampleRows},
+		{Tool: mcp.NewTool(
+			"search_values",
+			mcp.WithDescription("Find where a value appears in the database: searches text columns for a case-insensitive substring, or full-text indexes where they exist, and numeric columns for equality when the term is a number. Returns the table, column, primary key and a snippet of each matching row."),
+			mcp.WithString("term", mcp.Required(), mcp.Description("The value to look for, e.g. a customer ID or a name.")),
+			mcp.WithArray("tables", mcp.Items(map[string]any{"type": "string"}), mcp.Description(`Only search tables matching these glob patterns, e.g. ["customers", "sales.*"].`)),
+			mcp.WithArray("columns", mcp.Items(map[string]any{"type": "string"}), mcp.Description(`Only search columns matching these glob patterns, e.g. ["*_id", "email"].`)),
+			mcp.WithNumber("limit", mcp.Description(fmt.Sprintf("Maximum number of hits. Defaults to %d.", api.DefaultSearchLimit))),
+			mcp.WithNumber("per_column", mcp.Description(fmt.Sprintf("Maximum number of hits per column. Defaults to %d.", api.DefaultSearchPerColumn))),
+			connectionOption,
+		), Handler: a.searchValues},
+		{Tool: mcp.NewTool(
+			"diff_data",
+			mcp.WithDescription("Compare two tables or SELECT queries by key columns, possibly on different connections or kinds of database. Reports the row counts, rows only on the left, rows only on the right and changed rows with the columns that differ. Large tables are compared in chunks of keys, skipping chunks whose checksums match when both sides are the same kind of database."),
+			mcp.WithString("left_table", mcp.Description("The left table, optionally schema-qualified.")),
+			mcp.WithString("left_query", mcp.Description("A SELECT query to use as the left side instead of a table.")),
+			mcp.WithString("left_connection", mcp.Description("Name of the left connection. Defaults to the profile's default connection.")),
+			mcp.WithString("right_table", mcp.Description("The right table. Defaults to left_table when no right_query is given.")),
+			mcp.WithString("right_query", mcp.Description("A SELECT query to use as the right side instead of a table.")),
+			mcp.WithString("right_connection", mcp.Description("Name of the right connection. Defaults to the profile's default connection.")),
+			mcp.WithArray("keys", mcp.Required(), mcp.Items(map[string]any{"type": "string"}), mcp.Description("The columns identifying a row on both sides.")),
+			mcp.WithArray("columns", mcp.Items(map[string]any{"type": "string"}), mcp.Description("Only compare these columns. Defaults to every column both sides have.")),
+			mcp.WithNumber("chunk_size", mcp.Description(fmt.Sprintf("Width of the key ranges compared at once for a single integer key. Defaults to %d.", api.DefaultDiffChunkSize))),
+			mcp.WithNumber("max_reported", mcp.Description(fmt.Sprintf("Rows listed for each kind of difference; all are counted. Defaults to %d.", api.DefaultDiffMaxReported))),
+		), Handler: a.diffData},
+		{Tool: mcp.NewTool(
+			"diff_schema",
+			mcp.WithDescription("Compare the schema of a target database with a source: tables, columns, indexes and foreign keys. Either side can be a connection or a schema snapshot file. Returns the differences and the ALTER and CREATE statements, in the target's dialect, that bring the target in line with the source. The statements are not executed."),
+			mcp.WithString("source_connection", mcp.Description("Name of the source connection. Defaults to the profile's default connection.")),
+			mcp.WithString("source_snapshot", mcp.Description("Path of a schema snapshot to use as the source instead, relative to the import directory.")),
+			mcp.WithString("target_connection", mcp.Description("Name of the target connection. Defaults to the profile's default connection.")),
+			mcp.WithString("target_snapshot", mcp.Description("Path of a schema snapshot to use as the target instead, relative to the import directory.")),
+			mcp.WithArray("tables", mcp.Items(map[string]any{"type": "string"}), mcp.Description(`Only compare tables matching these glob patterns, e.g. ["orders", "sales.*"].`)),
+			mcp.WithBoolean("drop", mcp.Description("Also generate DROP statements for what only the target has.")),
+		), Handler: a.diffSchema},
+		{Tool: mcp.NewTool(
+			"profile_table",
+			mcp.WithDescription("Compute per-column statistics of a table or SELECT query: row count, null fraction, distinct count, min and max, most frequent values, string lengths and numeric histograms. Use sample_percent on large tables, or catalog to read the database's planner statistics without scanning."),
+			mcp.WithString("table", mcp.Description("The table to profile, optionally schema-qualified.")),
+			mcp.WithString("query", mcp.Description("A SELECT query to profile instead of a table.")),
+			mcp.WithArray("columns", mcp.Items(map[string]any{"type": "string"}), mcp.Description("Only profile these columns.")),
+			mcp.WithNumber("top_n", mcp.Description(fmt.Sprintf("Most frequent values reported per column. Defaults to %d.", api.DefaultProfileTopN))),
+			mcp.WithNumber("buckets", mcp.Description(fmt.Sprintf("Buckets in numeric histograms. Defaults to %d.", api.DefaultHistogramBuckets))),
+			mcp.WithNumber("sample_percent", mcp.Description("Profile a random sample of this percentage of the rows.")),
+			mcp.WithBoolean("catalog", mcp.Description("Read planner statistics (pg_stats, mysql.innodb_table_stats, sqlite_stat1) instead of scanning the table.")),
+			connectionOption,
+		), Handler: a.profileTable},
+		{Tool: mcp.NewTool(
+			"migration_status",
+			mcp.WithDescription("List the migrations in the migrations directory and whether each is applied, pending, modified since it was applied, or applied but missing from the directory."),
+			connectionOption,
+		), Handler: a.migrationStatus},
+		{Tool: mcp.NewTool(
+			"migration_apply",
+			mcp.WithDescription("Apply the pending migrations in order, each in its own transaction where the database supports transactional DDL. Refuses to run if an applied migration was modified."),
+			mcp.WithNumber("target_version", mcp.Description("Apply migrations up to and including this version. Defaults to all.")),
+			connectionOption,
+		), Handler: a.migrationApply},
+		{Tool: mcp.NewTool(
+			"migration_rollback",
+			mcp.WithDescription("Roll back the latest applied migrations by running their down files."),
+			mcp.WithNumber("steps", mcp.Description("Number of migrations to roll back. Defaults to 1.")),
+			mcp.WithNumber("target_version", mcp.Description("Roll back every migration after this version instead.")),
+			connectionOption,
+		), Handler: a.migrationRollback},
+		{Tool: mcp.NewTool(
+			"migration_create",
+			mcp.WithDescription("Propose a schema change as a new migration file with the next version number, for review, instead of executing DDL directly. Nothing is run until the migration is applied."),
+			mcp.WithString("name", mcp.Required(), mcp.Description(`A short description used in the file name, e.g. "add orders status".`)),
+			mcp.WithString("up", mcp.Required(), mcp.Description("The SQL statements making the change.")),
+			mcp.WithString("down", mcp.Description("The SQL statements reverting the change.")),
+		), Handler: a.migrationCreate},
+		{Tool: mcp.NewTool(
+			"refresh_schema",
+			mcp.WithDescription("Discard the cached schema of a connection, or of some of its tables, after it was changed outside the server, and list its tables again. The schema snapshot of the default connection is read again too."),
+			mcp.WithArray("tables", mcp.Items(map[string]any{"type": "string"}), mcp.Description("Tables to discard. Defaults to every table.")),
+			connectionOption,
+		), Handler: a.refreshSchema},
+		{Tool: mcp.NewTool(
+			"connection_status",
+			mcp.WithDescription("Get the health of the configured database connections, including pool statistics and server version."),
+			mcp.WithString("connection", mcp.Description("Name of the connection to report on. Defaults to every connection.")),
+		), Handler: a.connectionStatus},
+	}
+}
+
+func (a *app) dbType(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	conn, err := a.conns.get(request)
+	if err != nil {
+		return nil, err
+	}
+
+	dbType, err := api.GetDBType(conn.dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database type: %w", err)
+	}
+
+	return mcp.NewToolResultText(dbType), nil
+}
+
+func (a *app) readQuery(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, ok := request.Params.Arguments.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("invalid arguments format")
+	}
+	query, ok := args["query"].(string)
+	if !ok {
+		return nil, errors.New("query must be a string")
+	}
+	conn, err := a.conns.get(request)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := conn.withTimeout(ctx)
+	defer cancel()
+
+	key := api.ResultCacheKey(conn.name, query)
+	cached, hit := a.results.Get(key)
+	if !hit {
+		db, err := conn.DB(ctx)
+		if err != nil {
+			return nil, err
+		}
+		start := time.Now()
+		tracker, tagged := trackProgress(ctx, request, conn, db, query, "fetched")
+		results, truncated, err := api.ReadQueryProgress(ctx, db, tagged, conn.cfg.MaxRows, tracker.setRows)
+		tracker.stop()
+		if err != nil {
+			return nil, fmt.Errorf("failed to execute read query: %w", err)
+		}
+		cached = api.CachedResult{Rows: a.masker.MaskRows(query, results), Truncated: truncated, CachedAt: start}
+		a.results.Put(key, conn.name, query, cached)
+	}
+	api.RecordRows(ctx, int64(len(cached.Rows)))
+
+	text := fmt.Sprintf("%v", cached.Rows)
+	if cached.Truncated {
+		text += fmt.Sprintf("\n(truncated to %d rows)", conn.cfg.MaxRows)
+	}
+	switch {
+	case hit:
+		text += fmt.Sprintf("\n(cache hit, %s old)", time.Since(cached.CachedAt).Round(time.Millisecond))
+	case a.results != nil:
+		text += "\n(cache miss)"
+	}
+	return mcp.NewToolResultText(text), nil
+}
+
+func (a *app) submitQuery(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	query, err := request.RequireString("query")
+	if err != nil {
+		return nil, err
+	}
+	conn, err := a.conns.get(request)
+	if err != nil {
+		return nil, err
+	}
+	// Jobs outlive the call, so they are not bound by its context or the
+	// connection's query timeout.
+	db, err := conn.DB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	status, err := a.jobs.Submit(sessionID(ctx), conn.name, db, query, api.SubmitOptions{
+		MaxRows: conn.cfg.MaxRows,
+		Mask:    a.masker.QueryMasker(query),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to submit query: %w", err)
+	}
+	return jobJSON(status)
+}
+
+func (a *app) jobStatus(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	id, err := request.RequireString("job_id")
+	if err != nil {
+		return nil, err
+	}
+	status, err := a.jobs.Status(sessionID(ctx), id)
+	if err != nil {
+		return nil, err
+	}
+	return jobJSON(status)
+}
+
+func (a *app) jobResult(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	id, err := request.RequireString("job_id")
+	if err != nil {
+		return nil, err
+	}
+	page, err := a.jobs.Result(sessionID(ctx), id, request.GetInt("offset", 0), request.GetInt("limit", 0))
+	if err != nil {
+		return nil, err
+	}
+	api.RecordRows(ctx, int64(len(page.Rows)))
+	return jobJSON(page)
+}
+
+func (a *app) cancelJob(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	id, err := request.RequireString("job_id")
+	if err != nil {
+		return nil, err
+	}
+	status, err := a.jobs.Cancel(sessionID(ctx), id)
+	if err != nil {
+		return nil, err
+	}
+	return jobJSON(status)
+}
+
+// jobJSON returns v, a job status or result page, as the tool result.
+func jobJSON(v interface{}) (*mcp.CallToolResult, error) {
+	jobJSON, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal job to JSON: %w", err)
+	}
+	return mcp.NewToolResultText(string(jobJSON)), nil
+}
+
+// sessionID returns the ID of the client session calling a tool, which owns
+// the jobs it submits.
+func sessionID(ctx context.Context) string {
+	if session := server.ClientSessionFromContext(ctx); session != nil {
+		return session.SessionID()
+	}
+	return ""
+}
+
+func (a *app) writeQuery(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, ok := request.Params.Arguments.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("invalid arguments format")
+	}
+	query, ok := args["query"].(string)
+	if !ok {
+		return nil, errors.New("query must be a string")
+	}
+	stmt, err := api.ParseWrite(query)
+	if err != nil {
+		return nil, fmt.Errorf("%w; use create_table or run_script for other statements", err)
+	}
+	conn, err := a.conns.get(request)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.checkWritable(); err != nil {
+		return nil, err
+	}
+	ctx, cancel := conn.withTimeout(ctx)
+	defer cancel()
+
+	db, err := conn.DB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result, err := api.WriteStatement(ctx, db, conn.url.Driver, stmt, conn.cfg.MaxRows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute write query: %w", err)
+	}
+	api.RecordRows(ctx, result.RowsAffected)
+
+	summary := api.WriteSummary(stmt, result.RowsAffected)
+	if result.LastInsertID != nil {
+		summary += fmt.Sprintf(", last insert ID %d", *result.LastInsertID)
+	}
+	if !stmt.Returning {
+		return mcp.NewToolResultText(summary), nil
+	}
+
+	// Returned rows are formatted like read_query results.
+	text := fmt.Sprintf("%v", a.masker.MaskRows(query, result.Rows))
+	if result.Truncated {
+		text += fmt.Sprintf("\n(truncated to %d rows)", conn.cfg.MaxRows)
+	}
+	return mcp.NewToolResultText(text + "\n(" + summary + ")"), nil
+}
+
+func (a *app) runScript(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	script, err := request.RequireString("script")
+	if err != nil {
+		return nil, err
+	}
+	conn, err := a.conns.get(request)
+	if err != nil {
+		return nil, err
+	}
+	stmts := api.DialectFor(conn.url.Driver).SplitScript(script)
+	if len(stmts) == 0 {
+		return nil, errors.New("script holds no statements")
+	}
+	var violation *api.PolicyViolation
+	for _, stmt := range stmts {
+		if err := a.policy.CheckStatement(api.ParseStatement(stmt)); errors.As(err, &violation) {
+			return mcp.NewToolResultError(violation.JSON()), nil
+		}
+	}
+	if !api.ReadsOnly(stmts) {
+		if err := conn.checkWritable(); err != nil {
+			return nil, err
+		}
+	}
+	ctx, cancel := conn.withTimeout(ctx)
+	defer cancel()
+
+	db, err := conn.DB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result, err := api.RunScript(ctx, db, stmts, api.ScriptOptions{
+		Transaction:     request.GetBool("transaction", false),
+		ContinueOnError: request.GetBool("continue_on_error", false),
+		MaxRows:         conn.cfg.MaxRows,
+		Driver:          conn.url.Driver,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to run script: %w", err)
+	}
+	var rows int64
+	for i, stmt := range result.Statements {
+		result.Statements[i].Rows = a.masker.MaskRows(stmt.Statement, stmt.Rows)
+		rows += int64(len(stmt.Rows))
+		if stmt.RowsAffected != nil {
+			rows += *stmt.RowsAffected
+		}
+	}
+	api.RecordRows(ctx, rows)
+
+	resultJSON, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal script result to JSON: %w", err)
+	}
+
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+func (a *app) createTable(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, ok := request.Params.Arguments.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("invalid arguments format")
+	}
+	query, ok := args["query"].(string)
+	if !ok {
+		return nil, errors.New("query must be a string")
+	}
+	conn, err := a.conns.get(request)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.checkWritable(); err != nil {
+		return nil, err
+	}
+	ctx, cancel := conn.withTimeout(ctx)
+	defer cancel()
+
+	db, err := conn.DB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	message, err := api.CreateTableContext(ctx, db, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute create table query: %w", err)
+	}
+
+	return mcp.NewToolResultText(message), nil
+}
+
+func (a *app) describeTableSchema(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, ok := request.Params.Arguments.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("invalid arguments format")
+	}
+	tableName, ok := args["table"].(string)
+	if !ok {
+		return nil, errors.New("table must be a string")
+	}
+	conn, err := a.conns.get(request)
+	if err != nil {
+		return nil, err
+	}
+
+	schemaJSON, err := a.tableSchemaJSON(ctx, conn, tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	return mcp.NewToolResultText(string(schemaJSON)), nil
+}
+
+func (a *app) usqlCommand(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	command, err := request.RequireString("command")
+	if err != nil {
+		return nil, err
+	}
+	conn, err := a.conns.get(request)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := conn.withTimeout(ctx)
+	defer cancel()
+
+	db, err := conn.DB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result, err := api.MetaCommandContext(ctx, db, conn.dsn, command)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run meta-command: %w", err)
+	}
+	if relations, ok := result.([]api.MetaRelation); ok {
+		for i, rel := range relations {
+			for j, col := range rel.Columns {
+				relations[i].Columns[j].Default = a.masker.MaskValue(rel.Name, col.Name, col.Default)
+			}
+		}
+	}
+
+	resultJSON, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal meta-command result to JSON: %w", err)
+	}
+
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+func (a *app) copyData(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	query, err := request.RequireString("query")
+	if err != nil {
+		return nil, err
+	}
+	table, err := request.RequireString("table")
+	if err != nil {
+		return nil, err
+	}
+	src, err := a.conns.get(request)
+	if err != nil {
+		return nil, err
+	}
+	dst, err := a.conns.lookup(request.GetString("destination_connection", ""))
+	if err != nil {
+		return nil, err
+	}
+	if err := dst.checkWritable(); err != nil {
+		return nil, err
+	}
+
+	maxRows := src.cfg.MaxRows
+	if n := request.GetInt("max_rows", 0); n > 0 && (maxRows <= 0 || n < maxRows) {
+		maxRows = n
+	}
+	progress := progressNotifier(ctx, request)
+
+	ctx, cancel := src.withTimeout(ctx)
+	defer cancel()
+
+	srcDB, err := src.DB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	dstDB, err := dst.DB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result, err := api.CopyData(ctx, srcDB, query, dstDB, dst.url.Driver, api.CopyOptions{
+		Table:     table,
+		Create:    request.GetBool("create", true),
+		BatchSize: request.GetInt("batch_size", 0),
+		MaxRows:   maxRows,
+		Transform: func(rows []api.Row) []api.Row { return a.masker.MaskRows(query, rows) },
+		Progress: func(copied int64) {
+			progress(float64(copied), float64(maxRows), fmt.Sprintf("%d rows copied", copied))
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy data: %w", err)
+	}
+	api.RecordRows(ctx, result.Rows)
+
+	resultJSON, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal copy result to JSON: %w", err)
+	}
+
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+func (a *app) importFile(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	name, err := request.RequireString("path")
+	if err != nil {
+		return nil, err
+	}
+	table, err := request.RequireString("table")
+	if err != nil {
+		return nil, err
+	}
+	opts := api.ImportOptions{
+		Table:      table,
+		Format:     request.GetString("format", ""),
+		Create:     request.GetBool("create", true),
+		MaxRejects: request.GetInt("max_rejects", 0),
+	}
+	if raw, ok := request.GetArguments()["types"]; ok && raw != nil {
+		types, ok := raw.(map[string]interface{})
+		if !ok {
+			return nil, errors.New("types must be an object")
+		}
+		opts.Types = map[string]string{}
+		for col, t := range types {
+			if opts.Types[col], ok = t.(string); !ok {
+				return nil, fmt.Errorf("type of column %q must be a string", col)
+			}
+		}
+	}
+	if delimiter := request.GetString("delimiter", ""); delimiter != "" {
+		r := []rune(delimiter)
+		if len(r) != 1 {
+			return nil, errors.New("delimiter must be a single character")
+		}
+		opts.Delimiter = r[0]
+	}
+
+	path, err := api.ResolvePath(a.importDir, name)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := a.conns.get(request)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.checkWritable(); err != nil {
+		return nil, err
+	}
+	ctx, cancel := conn.withTimeout(ctx)
+	defer cancel()
+
+	db, err := conn.DB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tracker, _ := trackProgress(ctx, request, conn, db, "", "loaded")
+	opts.Progress = tracker.setRows
+	result, err := api.ImportFile(ctx, db, conn.url.Driver, path, opts)
+	tracker.stop()
+	if err != nil {
+		return nil, fmt.Errorf("failed to import file: %w", err)
+	}
+	api.RecordRows(ctx, result.Rows)
+
+	resultJSON, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal import result to JSON: %w", err)
+	}
+
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+func (a *app) exportQuery(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	query, err := request.RequireString("query")
+	if err != nil {
+		return nil, err
+	}
+	name, err := request.RequireString("path")
+	if err != nil {
+		return nil, err
+	}
+	path, err := api.ResolvePath(a.exportDir, name)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := a.conns.get(request)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := conn.withTimeout(ctx)
+	defer cancel()
+
+	db, err := conn.DB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tracker, tagged := trackProgress(ctx, request, conn, db, query, "written")
+	result, err := api.ExportQuery(ctx, db, tagged, path, api.ExportOptions{
+		Format:    request.GetString("format", ""),
+		MaxRows:   request.GetInt("max_rows", 0),
+		Overwrite: request.GetBool("overwrite", false),
+		Mask:      a.masker.QueryMasker(query),
+		Progress:  tracker.setRows,
+	})
+	tracker.stop()
+	if err != nil {
+		return nil, fmt.Errorf("failed to export query: %w", err)
+	}
+	api.RecordRows(ctx, result.Rows)
+
+	rel, err := a.exportPath(path)
+	if err != nil {
+		return nil, err
+	}
+	result.Path = rel
+	uri := exportURI(rel)
+	if s := server.ServerFromContext(ctx); s != nil {
+		a.addExportResource(s, rel)
+	}
+
+	resultJSON, err := json.MarshalIndent(struct {
+		api.ExportResult
+		URI string `json:"uri"`
+	}{result, uri}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal export result to JSON: %w", err)
+	}
+
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+func (a *app) sampleRows(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	table, err := request.RequireString("table")
+	if err != nil {
+		return nil, err
+	}
+	conn, err := a.conns.get(request)
+	if err != nil {
+		return nil, err
+	}
+	sampleJSON, err := a.sampleJSON(ctx, conn, table, api.SampleOptions{
+		Rows:           request.GetInt("rows", 0),
+		MaxValueLength: request.GetInt("max_value_length", 0),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return mcp.NewToolResultText(string(sampleJSON)), nil
+}
+
+// sampleJSON samples table on conn, masking the rows, and returns them as
+// JSON.
+func (a *app) sampleJSON(ctx context.Context, conn *connection, table string, opts api.SampleOptions) ([]byte, error) {
+	ctx, cancel := conn.withTimeout(ctx)
+	defer cancel()
+
+	db, err := conn.DB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if conn.cfg.MaxRows > 0 && opts.Rows > conn.cfg.MaxRows {
+		opts.Rows = conn.cfg.MaxRows
+	}
+	opts.Mask = func(column string, val interface{}) interface{} {
+		return a.masker.MaskValue(table, column, val)
+	}
+	sample, err := api.SampleRows(ctx, db, conn.url.Driver, table, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sample rows: %w", err)
+	}
+	api.RecordRows(ctx, int64(len(sample.Rows)))
+
+	sampleJSON, err := json.Marshal(sample)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal sample to JSON: %w", err)
+	}
+	return sampleJSON, nil
+}
+
+func (a *app) searchValues(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	term, err := request.RequireString("term")
+	if err != nil {
+		return nil, err
+	}
+	conn, err := a.conns.get(request)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := conn.withTimeout(ctx)
+	defer cancel()
+
+	db, err := conn.DB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result, err := api.SearchValues(ctx, db, conn.dsn, term, api.SearchOptions{
+		Tables:    request.GetStringSlice("tables", nil),
+		Columns:   request.GetStringSlice("columns", nil),
+		Limit:     request.GetInt("limit", 0),
+		PerColumn: request.GetInt("per_column", 0),
+		// Searching a masked column would reveal what it holds, and the
+		// policy would deny selecting it.
+		Exclude: func(table, column string) bool {
+			return a.masker.MasksColumn(table, column) ||
+				a.policy.Check(fmt.Sprintf("SELECT %s FROM %s", column, table)) != nil
+		},
+		Mask: a.masker.MaskValue,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search values: %w", err)
+	}
+	api.RecordRows(ctx, int64(len(result.Hits)))
+
+	resultJSON, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal search result to JSON: %w", err)
+	}
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+func (a *app) diffData(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	keys := request.GetStringSlice("keys", nil)
+	if len(keys) == 0 {
+		return nil, errors.New("keys must list at least one column")
+	}
+	left, err := a.conns.lookup(request.GetString("left_connection", ""))
+	if err != nil {
+		return nil, err
+	}
+	right, err := a.conns.lookup(request.GetString("right_connection", ""))
+	if err != nil {
+		return nil, err
+	}
+	leftSide := api.DiffSource{
+		Driver: left.url.Driver,
+		Table:  request.GetString("left_table", ""),
+		Query:  request.GetString("left_query", ""),
+	}
+	rightSide := api.DiffSource{
+		Driver: right.url.Driver,
+		Table:  request.GetString("right_table", ""),
+		Query:  request.GetString("right_query", ""),
+	}
+	if rightSide.Table == "" && rightSide.Query == "" {
+		rightSide.Table = leftSide.Table
+	}
+	leftSide.Mask, rightSide.Mask = a.diffMasker(leftSide), a.diffMasker(rightSide)
+
+	ctx, cancel := left.withTimeout(ctx)
+	defer cancel()
+
+	if leftSide.DB, err = left.DB(ctx); err != nil {
+		return nil, err
+	}
+	if rightSide.DB, err = right.DB(ctx); err != nil {
+		return nil, err
+	}
+	result, err := api.DiffData(ctx, leftSide, rightSide, api.DiffOptions{
+		Keys:        keys,
+		Columns:     request.GetStringSlice("columns", nil),
+		ChunkSize:   request.GetInt("chunk_size", 0),
+		MaxReported: request.GetInt("max_reported", 0),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff data: %w", err)
+	}
+
+	resultJSON, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal diff result to JSON: %w", err)
+	}
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// diffMasker masks the values reported from one side of a diff like rows
+// read from its table or query.
+func (a *app) diffMasker(side api.DiffSource) func(column string, val interface{}) interface{} {
+	if side.Table != "" {
+		return func(column string, val interface{}) interface{} {
+			return a.masker.MaskValue(side.Table, column, val)
+		}
+	}
+	return a.masker.QueryMasker(side.Query)
+}
+
+func (a *app) diffSchema(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	tables := request.GetStringSlice("tables", nil)
+	source, err := a.schemaFor(ctx, request, "source", tables)
+	if err != nil {
+		return nil, err
+	}
+	target, err := a.schemaFor(ctx, request, "target", tables)
+	if err != nil {
+		return nil, err
+	}
+	diff := api.DiffSchema(source, target, api.SchemaDiffOptions{
+		Tables: tables,
+		Drop:   request.GetBool("drop", false),
+	})
+
+	diffJSON, err := json.MarshalIndent(diff, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal schema diff to JSON: %w", err)
+	}
+	return mcp.NewToolResultText(string(diffJSON)), nil
+}
+
+// schemaFor returns one side of a schema diff: the snapshot named by the
+// side's _snapshot argument, or else the catalog of its _connection.
+func (a *app) schemaFor(ctx context.Context, request mcp.CallToolRequest, side string, tables []string) (*api.Schema, error) {
+	if name := request.GetString(side+"_snapshot", ""); name != "" {
+		path, err := api.ResolvePath(a.importDir, name)
+		if err != nil {
+			return nil, err
+		}
+		return api.LoadSchema(path)
+	}
+	conn, err := a.conns.lookup(request.GetString(side+"_connection", ""))
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := conn.withTimeout(ctx)
+	defer cancel()
+
+	db, err := conn.DB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	schema, err := api.ReadSchema(ctx, db, conn.dsn, tables)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s schema: %w", side, err)
+	}
+	return schema, nil
+}
+
+func (a *app) profileTable(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	opts := api.ProfileOptions{
+		Table:         request.GetString("table", ""),
+		Query:         request.GetString("query", ""),
+		Columns:       request.GetStringSlice("columns", nil),
+		TopN:          request.GetInt("top_n", 0),
+		Buckets:       request.GetInt("buckets", 0),
+		SamplePercent: request.GetFloat("sample_percent", 0),
+		Catalog:       request.GetBool("catalog", false),
+	}
+	if opts.Table != "" {
+		opts.Mask = func(column string, val interface{}) interface{} {
+			return a.masker.MaskValue(opts.Table, column, val)
+		}
+	} else {
+		opts.Mask = a.masker.QueryMasker(opts.Query)
+	}
+	conn, err := a.conns.get(request)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := conn.withTimeout(ctx)
+	defer cancel()
+
+	db, err := conn.DB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	profile, err := api.Profile(ctx, db, conn.dsn, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to profile: %w", err)
+	}
+
+	profileJSON, err := json.MarshalIndent(profile, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal profile to JSON: %w", err)
+	}
+	return mcp.NewToolResultText(string(profileJSON)), nil
+}
+
+func (a *app) migrationStatus(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	if a.migrationsDir == "" {
+		return nil, errNoMigrationsDir
+	}
+	conn, err := a.conns.get(request)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := conn.withTimeout(ctx)
+	defer cancel()
+
+	db, err := conn.DB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	states, err := api.MigrationStatus(ctx, db, conn.url.Driver, a.migrationsDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migration status: %w", err)
+	}
+
+	statesJSON, err := json.MarshalIndent(states, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal migration status to JSON: %w", err)
+	}
+	return mcp.NewToolResultText(string(statesJSON)), nil
+}
+
+func (a *app) migrationApply(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return a.migrate(ctx, request, api.ApplyMigrations)
+}
+
+func (a *app) migrationRollback(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return a.migrate(ctx, request, api.RollbackMigrations)
+}
+
+// migrate runs migrations in either direction. The SQL of every migration
+// is checked against the policy first, as if it had been sent to
+// write_query.
+func (a *app) migrate(ctx context.Context, request mcp.CallToolRequest, run func(context.Context, *sql.DB, string, string, api.MigrateOptions) (api.MigrateResult, error)) (*mcp.CallToolResult, error) {
+	if a.migrationsDir == "" {
+		return nil, errNoMigrationsDir
+	}
+	conn, err := a.conns.get(request)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.checkWritable(); err != nil {
+		return nil, err
+	}
+	progress := progressNotifier(ctx, request)
+
+	ctx, cancel := conn.withTimeout(ctx)
+	defer cancel()
+
+	db, err := conn.DB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result, err := run(ctx, db, conn.url.Driver, a.migrationsDir, api.MigrateOptions{
+		Target: int64(request.GetInt("target_version", 0)),
+		Steps:  request.GetInt("steps", 0),
+		Check:  a.policy.Check,
+		Progress: func(done, total int, m api.Migration) {
+			progress(float64(done), float64(total), fmt.Sprintf("running %d_%s", m.Version, m.Name))
+		},
+	})
+	var violation *api.PolicyViolation
+	if errors.As(err, &violation) {
+		return mcp.NewToolResultError(violation.JSON()), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	resultJSON, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal migration result to JSON: %w", err)
+	}
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+func (a *app) migrationCreate(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	if a.migrationsDir == "" {
+		return nil, errNoMigrationsDir
+	}
+	name, err := request.RequireString("name")
+	if err != nil {
+		return nil, err
+	}
+	up, err := request.RequireString("up")
+	if err != nil {
+		return nil, err
+	}
+	m, err := api.CreateMigration(a.migrationsDir, name, up, request.GetString("down", ""))
+	if err != nil {
+		return nil, err
+	}
+
+	migrationJSON, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal migration to JSON: %w", err)
+	}
+	return mcp.NewToolResultText(string(migrationJSON)), nil
+}
+
+func (a *app) refreshSchema(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	conn, err := a.conns.get(request)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := conn.withTimeout(ctx)
+	defer cancel()
+
+	db, err := conn.DB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	a.schemaCache.Invalidate(conn.dsn, request.GetStringSlice("tables", nil)...)
+	isDefault := conn.name == a.conns.def
+	if isDefault && a.snapshot != nil {
+		if err := a.snapshot.refresh(ctx, conn); err != nil {
+			return nil, fmt.Errorf("failed to refresh schema snapshot: %w", err)
+		}
+	}
+	tables, err := a.schemaCache.ListTables(db, conn.dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	if isDefault && a.server != nil {
+		a.addTableResources(a.server, conn, tables)
+	}
+
+	resultJSON, err := json.MarshalIndent(map[string]interface{}{
+		"connection":         conn.name,
+		"tables":             len(tables),
+		"snapshot_refreshed": isDefault && a.snapshot != nil,
+	}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal result to JSON: %w", err)
+	}
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+var errNoMigrationsDir = errors.New("no migrations directory is configured; set --migrations-dir or the profile's migrations_dir")
+
+func (a *app) connectionStatus(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	var statuses []connectionStatus
+	if request.GetString("connection", "") != "" {
+		conn, err := a.conns.get(request)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, conn.status())
+	} else {
+		for _, name := range a.conns.names() {
+			statuses = append(statuses, a.conns.byName[name].status())
+		}
+	}
+
+	statusJSON, err := json.MarshalIndent(statuses, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal connection status to JSON: %w", err)
+	}
+
+	return mcp.NewToolResultText(string(statusJSON)), nil
+}
+
+// tableSchemaJSON describes a table on conn as masked, indented JSON. Tables
+// of the default connection are looked up in the schema snapshot first, and
+// then in the schema cache.
+func (a *app) tableSchemaJSON(ctx context.Context, conn *connection, tableName string) ([]byte, error) {
+	var schema []api.TableColumn
+	var ok bool
+	if conn.name == a.conns.def {
+		schema, ok = a.snapshot.table(tableName)
+	}
+	if !ok {
+		db, err := conn.DB(ctx)
+		if err != nil {
+			return nil, err
+		}
+		schema, err = a.schemaCache.DescribeTable(db, tableName, conn.dsn)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe table schema: %w", err)
+		}
+	}
+	schema = a.masker.MaskColumns(tableName, schema)
+
+	schemaJSON, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal schema to JSON: %w", err)
+	}
+	return schemaJSON, nil
+}
@@ -0,0 +1,533 @@
+// Package config loads the usqlmcp configuration file.
+//
+// A configuration file holds server settings and any number of named
+// profiles. Each profile describes the database connections the server opens
+// and the tools, policy and masking rules it uses:
+//
+//	profile: dev
+//	server:
+//	  name: USQL MCP Server
+//	profiles:
+//	  dev:
+//	    connections:
+//	      main:
+//	        dsn: ${DB_DSN:-sqlite3:///tmp/dev.db}
+//	        max_rows: 1000
+//	    tools:
+//	      write_query: false
+//
+// References of the form ${VAR} or ${VAR:-default} are replaced with
+// environment variables before the file is parsed. DSNs may also hold the
+// secret placeholders ${file:/path}, ${env:NAME} and
+// ${keyring:service/account}, which are only resolved when connecting; see
+// ResolveDSN.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xo/dburl"
+	"gopkg.in/yaml.v3"
+)
+
+// Default values for settings left out of the file.
+const (
+	DefaultServerName    = "USQL MCP Server"
+	DefaultServerVersion = "0.3.0"
+	DefaultTransport     = "stdio"
+	DefaultAddr          = ":8080"
+	DefaultOpenTimeout   = 5 * time.Second
+	DefaultRetryAttempts = 5
+	DefaultBackoff       = time.Second
+	DefaultMaxBackoff    = 30 * time.Second
+	DefaultHealthCheck   = 30 * time.Second
+	DefaultProfile       = "default"
+	DefaultConnection    = "default"
+)
+
+// File is the top-level configuration file.
+type File struct {
+	// Profile names the profile used when none is given on the command line.
+	Profile  string              `yaml:"profile,omitempty"`
+	Server   Server              `yaml:"server,omitempty"`
+	Profiles map[string]*Profile `yaml:"profiles"`
+
+	path string
+	root *yaml.Node
+}
+
+// Server holds settings for the MCP server itself.
+type Server struct {
+	Name      string `yaml:"name,omitempty"`
+	Version   string `yaml:"version,omitempty"`
+	Transport string `yaml:"transport,omitempty"`
+	Addr      string `yaml:"addr,omitempty"`
+	TraceFile string `yaml:"trace_file,omitempty"`
+}
+
+// Profile is a named set of connections and tool settings.
+type Profile struct {
+	Connections map[string]*Connection `yaml:"connections"`
+	// DefaultConnection is used by tools called without a connection
+	// argument. It may be omitted when there is a single connection.
+	DefaultConnection string `yaml:"default_connection,omitempty"`
+	// Tools enables or disables individual tools by name. Tools not listed
+	// are enabled.
+	Tools  map[string]bool `yaml:"tools,omitempty"`
+	Policy string          `yaml:"policy,omitempty"`
+	Mask   string          `yaml:"mask,omitempty"`
+	Audit  Audit           `yaml:"audit,omitempty"`
+	// ImportDir is the only directory import_file may read from, and
+	// ExportDir the only one export_query may write to.
+	ImportDir string `yaml:"import_dir,omitempty"`
+	ExportDir string `yaml:"export_dir,omitempty"`
+	// MigrationsDir holds the numbered SQL files of the migration tools.
+	MigrationsDir string `yaml:"migrations_dir,omitempty"`
+	// SchemaSnapshot is a file written by "usqlmcp schema dump" that answers
+	// schema lookups on the default connection. It is refreshed once the
+	// connection is up, and then every SchemaRefresh if that is set.
+	SchemaSnapshot string        `yaml:"schema_snapshot,omitempty"`
+	SchemaRefresh  time.Duration `yaml:"schema_refresh,omitempty"`
+	// SchemaCacheTTL is how long table lists and descriptions are cached.
+	// Zero disables the cache.
+	SchemaCacheTTL time.Duration `yaml:"schema_cache_ttl,omitempty"`
+	ResultCache    ResultCache   `yaml:"result_cache,omitempty"`
+	Jobs           Jobs          `yaml:"jobs,omitempty"`
+}
+
+// Connection holds per-connection settings.
+type Connection struct {
+	DSN             string        `yaml:"dsn"`
+	MaxOpenConns    int           `yaml:"max_open_conns,omitempty"`
+	MaxIdleConns    int           `yaml:"max_idle_conns,omitempty"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime,omitempty"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time,omitempty"`
+	OpenTimeout     time.Duration `yaml:"open_timeout,omitempty"`
+	QueryTimeout    time.Duration `yaml:"query_timeout,omitempty"`
+	ReadOnly        bool          `yaml:"read_only,omitempty"`
+	MaxRows         int           `yaml:"max_rows,omitempty"`
+	// PassFile is a pgpass-style file consulted when the DSN has a user
+	// but no password.
+	PassFile string `yaml:"passfile,omitempty"`
+	// Lazy connections are opened in the background, so the server starts
+	// even while the database is unreachable.
+	Lazy  bool  `yaml:"lazy,omitempty"`
+	Retry Retry `yaml:"retry,omitempty"`
+	// HealthCheckInterval is how often the connection is pinged. A
+	// negative interval disables health checks.
+	HealthCheckInterval time.Duration `yaml:"health_check_interval,omitempty"`
+}
+
+// Retry configures how often opening a connection is retried at startup.
+type Retry struct {
+	// Attempts is the number of connection attempts before giving up. A
+	// negative value retries until the connection succeeds.
+	Attempts       int           `yaml:"attempts,omitempty"`
+	InitialBackoff time.Duration `yaml:"initial_backoff,omitempty"`
+	MaxBackoff     time.Duration `yaml:"max_backoff,omitempty"`
+}
+
+// Audit configures the audit log.
+type Audit struct {
+	File       string `yaml:"file,omitempty"`
+	MaxSizeMB  int64  `yaml:"max_size_mb,omitempty"`
+	MaxBackups int    `yaml:"max_backups,omitempty"`
+	Syslog     bool   `yaml:"syslog,omitempty"`
+}
+
+// ResultCache configures the read_query result cache, which is disabled
+// unless TTL is set.
+type ResultCache struct {
+	TTL       time.Duration `yaml:"ttl,omitempty"`
+	MaxSizeMB int64         `yaml:"max_size_mb,omitempty"`
+}
+
+// Jobs configures the background jobs of submit_query.
+type Jobs struct {
+	// TTL is how long finished jobs and their results are kept.
+	TTL time.Duration `yaml:"ttl,omitempty"`
+	// MaxRunning is how many jobs a session may run at once.
+	MaxRunning int   `yaml:"max_running,omitempty"`
+	MaxSizeMB  int64 `yaml:"max_size_mb,omitempty"`
+	// Dir, if set, holds job results on disk instead of in memory.
+	Dir string `yaml:"dir,omitempty"`
+}
+
+// Error is a configuration error located in the file.
+type Error struct {
+	File string
+	Line int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+	}
+	return fmt.Sprintf("%s: %s", e.File, e.Msg)
+}
+
+// DefaultPath returns $XDG_CONFIG_HOME/usqlmcp/config.yaml, falling back to
+// ~/.config when XDG_CONFIG_HOME is not set.
+func DefaultPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "usqlmcp", "config.yaml")
+}
+
+// Load reads, interpolates and validates the configuration file at path.
+// Validation problems are returned joined, each as an *Error with the line it
+// refers to.
+func Load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	return Parse(path, data)
+}
+
+// Parse is like Load but reads the configuration from data. The path is only
+// used in error messages.
+func Parse(path string, data []byte) (*File, error) {
+	f := &File{path: path}
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, f.yamlError(err)
+	}
+	if err := f.interpolate(&root); err != nil {
+		return nil, err
+	}
+	f.root = &root
+
+	if err := f.checkFields(data); err != nil {
+		return nil, err
+	}
+	if root.Kind != 0 {
+		if err := root.Decode(f); err != nil {
+			return nil, f.yamlError(err)
+		}
+	}
+	if err := f.Validate(nil); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// checkFields reports unknown fields in data. Values are decoded from the
+// interpolated tree, which yaml.Node.Decode cannot check strictly, so this
+// decodes data separately and keeps only the unknown field errors.
+func (f *File) checkFields(data []byte) error {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	var probe File
+	err := dec.Decode(&probe)
+	var typeErr *yaml.TypeError
+	if err == nil || errors.Is(err, io.EOF) || !errors.As(err, &typeErr) {
+		return nil
+	}
+	var unknown []string
+	for _, msg := range typeErr.Errors {
+		if strings.Contains(msg, " not found in type ") {
+			unknown = append(unknown, msg)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	return f.yamlError(&yaml.TypeError{Errors: unknown})
+}
+
+var yamlLine = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// yamlError converts yaml.v3 errors, which embed line numbers in their
+// messages, into *Errors.
+func (f *File) yamlError(err error) error {
+	var msgs []string
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		msgs = typeErr.Errors
+	} else {
+		msgs = []string{err.Error()}
+	}
+	var errs []error
+	for _, msg := range msgs {
+		e := &Error{File: f.path, Msg: msg}
+		if m := yamlLine.FindStringSubmatch(msg); m != nil {
+			e.Line, _ = strconv.Atoi(m[1])
+			e.Msg = m[2]
+		}
+		errs = append(errs, e)
+	}
+	return errors.Join(errs...)
+}
+
+// Validate checks the configuration for semantic errors. When knownTools is
+// not nil, tool names in profiles must be among them.
+func (f *File) Validate(knownTools []string) error {
+	var errs []error
+	fail := func(msg string, path ...string) {
+		errs = append(errs, &Error{File: f.path, Line: f.line(path...), Msg: msg})
+	}
+
+	switch f.Server.Transport {
+	case "", "stdio", "sse", "http":
+	default:
+		fail(fmt.Sprintf("unknown transport %q", f.Server.Transport), "server", "transport")
+	}
+	if len(f.Profiles) == 0 {
+		fail("no profiles defined", "profiles")
+	}
+	if f.Profile != "" && f.Profiles[f.Profile] == nil {
+		fail(fmt.Sprintf("profile %q is not defined", f.Profile), "profile")
+	}
+
+	for _, name := range sortedKeys(f.Profiles) {
+		p := f.Profiles[name]
+		if p == nil || len(p.Connections) == 0 {
+			fail("profile has no connections", "profiles", name)
+			continue
+		}
+		for _, cname := range sortedKeys(p.Connections) {
+			c := p.Connections[cname]
+			path := []string{"profiles", name, "connections", cname}
+			switch {
+			case c == nil || c.DSN == "":
+				fail("connection has no dsn", path...)
+			default:
+				// Secret placeholders are resolved when connecting, so check
+				// the shape of the DSN with a stand-in value.
+				if _, err := dburl.Parse(secretRef.ReplaceAllString(c.DSN, "secret")); err != nil {
+					// url.Error includes the DSN, which may hold a password.
+					var urlErr *url.Error
+					if errors.As(err, &urlErr) {
+						err = urlErr.Err
+					}
+					fail(fmt.Sprintf("invalid dsn: %v", err), append(path, "dsn")...)
+				}
+			}
+			if c == nil {
+				continue
+			}
+			for key, v := range map[string]int{"max_open_conns": c.MaxOpenConns, "max_idle_conns": c.MaxIdleConns, "max_rows": c.MaxRows} {
+				if v < 0 {
+					fail(key+" must not be negative", append(path, key)...)
+				}
+			}
+		}
+		if p.DefaultConnection != "" && p.Connections[p.DefaultConnection] == nil {
+			fail(fmt.Sprintf("default connection %q is not defined", p.DefaultConnection), "profiles", name, "default_connection")
+		}
+		if p.DefaultConnection == "" && len(p.Connections) > 1 && p.Connections[DefaultConnection] == nil {
+			fail("default_connection is required when a profile has several connections", "profiles", name, "connections")
+		}
+		if knownTools != nil {
+			for _, tool := range sortedKeys(p.Tools) {
+				if !slices.Contains(knownTools, tool) {
+					fail(fmt.Sprintf("unknown tool %q", tool), "profiles", name, "tools", tool)
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(errs, func(i, j int) bool {
+		return errs[i].(*Error).Line < errs[j].(*Error).Line
+	})
+	return errors.Join(errs...)
+}
+
+// Select returns the named profile, falling back to the file's default
+// profile and then to a profile called "default". Missing settings are
+// filled in with defaults.
+func (f *File) Select(name string) (*Profile, error) {
+	if name == "" {
+		name = f.Profile
+	}
+	if name == "" {
+		if len(f.Profiles) == 1 {
+			for n := range f.Profiles {
+				name = n
+			}
+		} else {
+			name = DefaultProfile
+		}
+	}
+	p := f.Profiles[name]
+	if p == nil {
+		return nil, fmt.Errorf("profile %q is not defined in %s", name, f.path)
+	}
+	p.Defaults()
+	return p, nil
+}
+
+// Defaults fills in server settings left out of the file.
+func (s *Server) Defaults() {
+	if s.Name == "" {
+		s.Name = DefaultServerName
+	}
+	if s.Version == "" {
+		s.Version = DefaultServerVersion
+	}
+	if s.Transport == "" {
+		s.Transport = DefaultTransport
+	}
+	if s.Addr == "" {
+		s.Addr = DefaultAddr
+	}
+}
+
+// Defaults fills in profile and connection settings left out of the file.
+func (p *Profile) Defaults() {
+	if p.DefaultConnection == "" {
+		if len(p.Connections) == 1 {
+			for n := range p.Connections {
+				p.DefaultConnection = n
+			}
+		} else {
+			p.DefaultConnection = DefaultConnection
+		}
+	}
+	for _, c := range p.Connections {
+		if c.OpenTimeout == 0 {
+			c.OpenTimeout = DefaultOpenTimeout
+		}
+		if c.Retry.Attempts == 0 {
+			c.Retry.Attempts = DefaultRetryAttempts
+		}
+		if c.Retry.InitialBackoff == 0 {
+			c.Retry.InitialBackoff = DefaultBackoff
+		}
+		if c.Retry.MaxBackoff == 0 {
+			c.Retry.MaxBackoff = DefaultMaxBackoff
+		}
+		if c.HealthCheckInterval == 0 {
+			c.HealthCheckInterval = DefaultHealthCheck
+		}
+	}
+	if p.Audit.MaxSizeMB == 0 {
+		p.Audit.MaxSizeMB = 100
+	}
+	if p.Audit.MaxBackups == 0 {
+		p.Audit.MaxBackups = 5
+	}
+	if p.ResultCache.MaxSizeMB == 0 {
+		p.ResultCache.MaxSizeMB = 64
+	}
+	if p.Jobs.TTL == 0 {
+		p.Jobs.TTL = time.Hour
+	}
+	if p.Jobs.MaxRunning == 0 {
+		p.Jobs.MaxRunning = 4
+	}
+	if p.Jobs.MaxSizeMB == 0 {
+		p.Jobs.MaxSizeMB = 256
+	}
+}
+
+// ToolEnabled reports whether the named tool is enabled in the profile.
+func (p *Profile) ToolEnabled(name string) bool {
+	enabled, ok := p.Tools[name]
+	return !ok || enabled
+}
+
+// line returns the line of the YAML node at the given mapping path, or of
+// its deepest existing ancestor.
+func (f *File) line(path ...string) int {
+	if f.root == nil || len(f.root.Content) == 0 {
+		return 0
+	}
+	node := f.root.Content[0]
+	line := node.Line
+	for _, key := range path {
+		if node.Kind != yaml.MappingNode {
+			break
+		}
+		var next *yaml.Node
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				line = node.Content[i].Line
+				next = node.Content[i+1]
+				break
+			}
+		}
+		if next == nil {
+			break
+		}
+		node = next
+	}
+	return line
+}
+
+var envRef = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// interpolate replaces ${VAR} and ${VAR:-default} in the scalar values of the
+// tree under node with environment variables. Working on parsed values keeps
+// comments out of it and substituted values from changing the document
+// structure. A reference to an unset variable without a default is an error.
+func (f *File) interpolate(node *yaml.Node) error {
+	var errs []error
+	var walk func(n *yaml.Node)
+	walk = func(n *yaml.Node) {
+		for _, c := range n.Content {
+			walk(c)
+		}
+		if n.Kind != yaml.ScalarNode || !strings.Contains(n.Value, "${") {
+			return
+		}
+		var out strings.Builder
+		last := 0
+		for _, m := range envRef.FindAllStringSubmatchIndex(n.Value, -1) {
+			out.WriteString(n.Value[last:m[0]])
+			last = m[1]
+			name := n.Value[m[2]:m[3]]
+			if v, ok := os.LookupEnv(name); ok {
+				out.WriteString(v)
+				continue
+			}
+			if m[4] >= 0 {
+				out.WriteString(n.Value[m[6]:m[7]])
+				continue
+			}
+			errs = append(errs, &Error{
+				File: f.path,
+				Line: n.Line,
+				Msg:  fmt.Sprintf("environment variable %s is not set", name),
+			})
+		}
+		out.WriteString(n.Value[last:])
+		n.Value = out.String()
+		if n.Style&(yaml.TaggedStyle|yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle|yaml.LiteralStyle|yaml.FoldedStyle) == 0 {
+			// Let plain values such as max_rows: ${MAX_ROWS} resolve to
+			// their substituted type.
+			n.Tag = ""
+		}
+	}
+	walk(node)
+	return errors.Join(errs...)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
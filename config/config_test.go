@@ -0,0 +1,139 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thesoulless/usqlmcp/config"
+)
+
+func TestLoad(t *testing.T) {
+	t.Setenv("TEST_DSN", "sqlite3:///tmp/test.db")
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+profile: dev
+server:
+  name: Test Server
+profiles:
+  dev:
+    connections:
+      main:
+        dsn: ${TEST_DSN}
+        max_open_conns: 4
+        query_timeout: 30s
+        read_only: true
+        max_rows: 100
+    tools:
+      write_query: false
+  prod:
+    default_connection: primary
+    connections:
+      primary:
+        dsn: ${PROD_DSN:-postgres://db.internal/app}
+      replica:
+        dsn: postgres://replica.internal/app
+`), 0o600))
+
+	f, err := config.Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, "Test Server", f.Server.Name)
+
+	dev, err := f.Select("")
+	require.NoError(t, err)
+	assert.Equal(t, "main", dev.DefaultConnection)
+	main := dev.Connections["main"]
+	assert.Equal(t, "sqlite3:///tmp/test.db", main.DSN)
+	assert.Equal(t, 4, main.MaxOpenConns)
+	assert.Equal(t, 30*time.Second, main.QueryTimeout)
+	assert.Equal(t, config.DefaultOpenTimeout, main.OpenTimeout)
+	assert.True(t, main.ReadOnly)
+	assert.Equal(t, 100, main.MaxRows)
+	assert.False(t, dev.ToolEnabled("write_query"))
+	assert.True(t, dev.ToolEnabled("read_query"))
+
+	prod, err := f.Select("prod")
+	require.NoError(t, err)
+	assert.Equal(t, "postgres://db.internal/app", prod.Connections["primary"].DSN)
+
+	_, err = f.Select("staging")
+	assert.ErrorContains(t, err, `profile "staging" is not defined`)
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []string
+	}{
+		{
+			name: "unknown field",
+			data: "profiles:\n  dev:\n    connections:\n      main:\n        dsn: sqlite3:///tmp/x.db\n        max_row: 10\n",
+			want: []string{"test.yaml:6: field max_row not found"},
+		},
+		{
+			name: "bad duration",
+			data: "profiles:\n  dev:\n    connections:\n      main:\n        dsn: sqlite3:///tmp/x.db\n        query_timeout: soon\n",
+			want: []string{"test.yaml:6: cannot unmarshal"},
+		},
+		{
+			name: "missing variable",
+			data: "profiles:\n  dev:\n    connections:\n      main:\n        dsn: ${USQLMCP_TEST_UNSET}\n",
+			want: []string{"test.yaml:5: environment variable USQLMCP_TEST_UNSET is not set"},
+		},
+		{
+			name: "semantic errors",
+			data: "profile: prod\nprofiles:\n  dev:\n    connections:\n      a:\n        dsn: sqlite3:///tmp/a.db\n        max_rows: -1\n      b:\n        dsn: sqlite3:///tmp/b.db\n  empty: {}\n",
+			want: []string{
+				`test.yaml:1: profile "prod" is not defined`,
+				"test.yaml:4: default_connection is required",
+				"test.yaml:7: max_rows must not be negative",
+				"test.yaml:10: profile has no connections",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := config.Parse("test.yaml", []byte(tt.data))
+			require.Error(t, err)
+			for _, want := range tt.want {
+				assert.Contains(t, err.Error(), want)
+			}
+		})
+	}
+}
+
+func TestInterpolate(t *testing.T) {
+	t.Setenv("TEST_DSN", "sqlite3:///tmp/a.db?_pragma=x#frag: y\nz")
+	t.Setenv("TEST_MAX_ROWS", "50")
+	f, err := config.Parse("test.yaml", []byte(`profiles:
+  dev:
+    connections:
+      main:
+        # dsn: ${USQLMCP_TEST_UNSET}
+        dsn: ${TEST_DSN}
+        max_rows: ${TEST_MAX_ROWS}
+        query_timeout: ${TEST_TIMEOUT:-5s}
+`))
+	require.NoError(t, err)
+	main := f.Profiles["dev"].Connections["main"]
+	assert.Equal(t, "sqlite3:///tmp/a.db?_pragma=x#frag: y\nz", main.DSN)
+	assert.Equal(t, 50, main.MaxRows)
+	assert.Equal(t, 5*time.Second, main.QueryTimeout)
+}
+
+func TestValidateTools(t *testing.T) {
+	f, err := config.Parse("test.yaml", []byte("profiles:\n  dev:\n    connections:\n      main:\n        dsn: sqlite3:///tmp/x.db\n    tools:\n      read_query: true\n      drop_everything: false\n"))
+	require.NoError(t, err)
+
+	err = f.Validate([]string{"read_query", "write_query"})
+	assert.EqualError(t, err, `test.yaml:8: unknown tool "drop_everything"`)
+}
+
+func TestDefaultPath(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", "/etc/xdg")
+	assert.Equal(t, "/etc/xdg/usqlmcp/config.yaml", config.DefaultPath())
+}
@@ -0,0 +1,247 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/99designs/keyring"
+	"github.com/xo/dburl"
+)
+
+// secretRef matches the secret placeholders allowed in DSNs:
+// ${file:/path}, ${env:NAME} and ${keyring:service/account}.
+var secretRef = regexp.MustCompile(`\$\{(file|env|keyring):([^}]+)\}`)
+
+// OpenKeyring opens the OS keyring for a service. It is a variable so that
+// platforms without a keyring backend can be given a replacement.
+var OpenKeyring = func(service string) (keyring.Keyring, error) {
+	return keyring.Open(keyring.Config{ServiceName: service})
+}
+
+// ResolveDSN replaces secret placeholders in dsn and, when the DSN carries a
+// user but no password, looks the password up in passfile. An empty passfile
+// falls back to $PGPASSFILE or ~/.pgpass for postgres DSNs.
+//
+// The resolved secrets are returned alongside the DSN so that callers can
+// redact them from logs and error messages.
+func ResolveDSN(dsn, passfile string) (string, []string, error) {
+	var secrets []string
+	var resolveErr error
+	// Replace placeholders with sentinels first, so their position in the
+	// URL can be told apart from paths inside the placeholders themselves.
+	var values []string
+	templ := secretRef.ReplaceAllStringFunc(dsn, func(ref string) string {
+		m := secretRef.FindStringSubmatch(ref)
+		v, err := resolveSecret(m[1], m[2])
+		if err != nil && resolveErr == nil {
+			resolveErr = err
+		}
+		values = append(values, v)
+		if v != "" {
+			secrets = append(secrets, v)
+		}
+		return fmt.Sprintf("\x00%d\x00", len(values)-1)
+	})
+	if resolveErr != nil {
+		return "", nil, resolveErr
+	}
+
+	userinfo := userinfoSpan(templ)
+	for i, v := range values {
+		sentinel := fmt.Sprintf("\x00%d\x00", i)
+		if pos := strings.Index(templ, sentinel); pos >= userinfo[0] && pos < userinfo[1] {
+			v = escapeUserinfo(v)
+		}
+		templ = strings.Replace(templ, sentinel, v, 1)
+	}
+	dsn = templ
+
+	password, err := passfilePassword(dsn, passfile)
+	if err != nil {
+		return "", nil, err
+	}
+	if password != "" {
+		u, _ := url.Parse(dsn)
+		u.User = url.UserPassword(u.User.Username(), password)
+		dsn = u.String()
+		secrets = append(secrets, password)
+	}
+	return dsn, secrets, nil
+}
+
+func resolveSecret(kind, ref string) (string, error) {
+	switch kind {
+	case "file":
+		path := ref
+		if strings.HasPrefix(path, "~/") {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return "", fmt.Errorf("failed to resolve secret file %s: %w", ref, err)
+			}
+			path = filepath.Join(home, path[2:])
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read secret file: %w", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	case "env":
+		v, ok := os.LookupEnv(ref)
+		if !ok {
+			return "", fmt.Errorf("secret environment variable %s is not set", ref)
+		}
+		return v, nil
+	case "keyring":
+		service, account, ok := strings.Cut(ref, "/")
+		if !ok || service == "" || account == "" {
+			return "", fmt.Errorf("invalid keyring reference %q, expected service/account", ref)
+		}
+		ring, err := OpenKeyring(service)
+		if err != nil {
+			return "", fmt.Errorf("failed to open keyring: %w", err)
+		}
+		item, err := ring.Get(account)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s from keyring: %w", ref, err)
+		}
+		return string(item.Data), nil
+	}
+	return "", fmt.Errorf("unknown secret type %q", kind)
+}
+
+// userinfoSpan returns the byte range of the user:password part of a URL
+// DSN, or an empty range if it has none.
+func userinfoSpan(dsn string) [2]int {
+	i := strings.Index(dsn, "://")
+	if i < 0 {
+		return [2]int{}
+	}
+	start := i + 3
+	end := len(dsn)
+	if j := strings.IndexAny(dsn[start:], "/?#"); j >= 0 {
+		end = start + j
+	}
+	at := strings.LastIndex(dsn[start:end], "@")
+	if at < 0 {
+		return [2]int{}
+	}
+	return [2]int{start, start + at}
+}
+
+// escapeUserinfo percent-encodes v for use in the userinfo part of a URL.
+func escapeUserinfo(v string) string {
+	return strings.TrimPrefix(url.UserPassword("", v).String(), ":")
+}
+
+// passfilePassword looks up the password for dsn in a pgpass-style file,
+// whose lines have the form hostname:port:database:username:password and
+// may use * as a wildcard. It returns "" if the DSN already has a password
+// or no line matches.
+func passfilePassword(dsn, passfile string) (string, error) {
+	u, err := dburl.Parse(dsn)
+	if err != nil || u.User == nil || u.User.Username() == "" {
+		return "", nil
+	}
+	if _, ok := u.User.Password(); ok {
+		return "", nil
+	}
+
+	explicit := passfile != ""
+	if !explicit {
+		if u.Driver != "postgres" && u.Driver != "pgx" {
+			return "", nil
+		}
+		passfile = os.Getenv("PGPASSFILE")
+		if passfile == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return "", nil
+			}
+			passfile = filepath.Join(home, ".pgpass")
+		}
+	}
+
+	f, err := os.Open(passfile)
+	if err != nil {
+		if !explicit && errors.Is(err, os.ErrNotExist) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to open password file: %w", err)
+	}
+	defer f.Close()
+	if info, err := f.Stat(); err == nil && runtime.GOOS != "windows" && info.Mode().Perm()&0o077 != 0 {
+		return "", fmt.Errorf("password file %s has group or world access; permissions should be u=rw (0600) or less", passfile)
+	}
+
+	host := u.Hostname()
+	if host == "" {
+		host = "localhost"
+	}
+	port := u.Port()
+	if port == "" {
+		port = defaultPorts[u.Driver]
+	}
+	database := strings.TrimPrefix(u.Path, "/")
+	want := []string{host, port, database, u.User.Username()}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := splitPassfileLine(line)
+		if len(fields) != 5 {
+			continue
+		}
+		if matchPassfileFields(fields[:4], want) {
+			return fields[4], nil
+		}
+	}
+	return "", scanner.Err()
+}
+
+var defaultPorts = map[string]string{
+	"postgres":  "5432",
+	"pgx":       "5432",
+	"mysql":     "3306",
+	"sqlserver": "1433",
+	"oracle":    "1521",
+	"godror":    "1521",
+}
+
+// splitPassfileLine splits a pgpass line on unescaped colons, unescaping
+// \: and \\.
+func splitPassfileLine(line string) []string {
+	var fields []string
+	var b strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case c == '\\' && i+1 < len(line):
+			i++
+			b.WriteByte(line[i])
+		case c == ':':
+			fields = append(fields, b.String())
+			b.Reset()
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return append(fields, b.String())
+}
+
+func matchPassfileFields(fields, want []string) bool {
+	for i, f := range fields {
+		if f != "*" && f != want[i] {
+			return false
+		}
+	}
+	return true
+}